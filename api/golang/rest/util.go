@@ -236,7 +236,7 @@ func NewAsyncWriter(w io.Writer) *AsyncWriter {
 
 // WriteCompressAsync is identical to WriteCompress, but it does compression in another thread, since gzip is cpu-consuming
 func WriteCompressAsync(w http.ResponseWriter, r *http.Request, towrite io.Reader, status int) error {
-	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || assets.Get().Config.Verbose {
+	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || assets.Get().GetConfig().Verbose {
 		// If gzip is not supported, or we are in verbose mode, disable gzip output
 		w.WriteHeader(status)
 		_, err := io.Copy(w, towrite)
@@ -260,7 +260,7 @@ func WriteCompressAsync(w http.ResponseWriter, r *http.Request, towrite io.Reade
 // WriteCompress compresses a response Reader object if it has an accepted encoding. While it can be a security risk
 // is some cases, it is very useful when the response can be enormous (like timeseries data).
 func WriteCompress(w http.ResponseWriter, r *http.Request, towrite io.Reader, status int) error {
-	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || assets.Get().Config.Verbose {
+	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || assets.Get().GetConfig().Verbose {
 		// If gzip is not supported, or we are in verbose mode, disable gzip output
 		w.WriteHeader(status)
 		_, err := io.Copy(w, towrite)
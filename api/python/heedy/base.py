@@ -1,8 +1,10 @@
 import json
+import socket
 from urllib.parse import urljoin
 
 # Used for the synchronous session
 import requests
+import urllib3
 
 # Used for the asynchronous session
 import aiohttp
@@ -33,13 +35,54 @@ class HeedyError(Exception):
         return f"{self.error}: {self.error_description}"
 
 
+class _UnixConnection(urllib3.connection.HTTPConnection):
+    def __init__(self, unix_socket, *args, **kwargs):
+        super().__init__("localhost", *args, **kwargs)
+        self.unix_socket = unix_socket
+
+    def connect(self):
+        self.sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+        self.sock.settimeout(self.timeout)
+        self.sock.connect(self.unix_socket)
+
+
+class _UnixConnectionPool(urllib3.connectionpool.HTTPConnectionPool):
+    def __init__(self, unix_socket, timeout):
+        super().__init__("localhost", timeout=timeout)
+        self.unix_socket = unix_socket
+
+    def _new_conn(self):
+        return _UnixConnection(self.unix_socket, timeout=self.timeout.connect_timeout)
+
+
+class _UnixAdapter(requests.adapters.HTTPAdapter):
+    """
+    Sends all requests of a requests session over the given unix socket
+    """
+
+    def __init__(self, unix_socket, timeout=60):
+        super().__init__()
+        self.pool = _UnixConnectionPool(unix_socket, timeout)
+
+    def get_connection(self, url, proxies=None):
+        return self.pool
+
+    def get_connection_with_tls_context(self, request, verify, proxies=None, cert=None):
+        return self.pool
+
+    def close(self):
+        self.pool.close()
+
+
 class Session:
     """
-    Session is the abstract base class that both sync and async sessions implement
+    Session is the abstract base class that both sync and async sessions implement.
+    If unix_socket is given, all requests are sent to the server over that socket.
     """
 
-    def __init__(self, namespace, url=DEFAULT_URL):
+    def __init__(self, namespace, url=DEFAULT_URL, unix_socket=None):
         self.namespace = namespace
+        self.unix_socket = unix_socket
 
         # Set up the API url
         if not url.startswith("http"):
@@ -88,9 +131,11 @@ class SyncSession(Session):
     SyncSession is to be used in synchronous programs. It uses requests internally.
     """
 
-    def __init__(self, namespace, url=DEFAULT_URL):
-        super().__init__(namespace, url)
+    def __init__(self, namespace, url=DEFAULT_URL, unix_socket=None):
+        super().__init__(namespace, url, unix_socket)
         self.s = requests.Session()
+        if unix_socket is not None:
+            self.s.mount(self.url, _UnixAdapter(unix_socket))
         self.s.headers.update({"Content-Type": "application/json"})
 
     def f(self, x, func):
@@ -169,8 +214,8 @@ class AsyncSession(Session):
     allowing them to be awaited
     """
 
-    def __init__(self, namespace, url=DEFAULT_URL):
-        super().__init__(namespace, url)
+    def __init__(self, namespace, url=DEFAULT_URL, unix_socket=None):
+        super().__init__(namespace, url, unix_socket)
         self.s = None
         self.headers = {"Content-Type": "application/json"}
 
@@ -199,7 +244,10 @@ class AsyncSession(Session):
 
     def initSession(self):
         if self.s is None:
-            self.s = aiohttp.ClientSession()
+            connector = None
+            if self.unix_socket is not None:
+                connector = aiohttp.UnixConnector(path=self.unix_socket)
+            self.s = aiohttp.ClientSession(connector=connector)
 
     async def handleResponse(self, r):
         if r.status >= 400:
@@ -294,14 +342,16 @@ class AsyncSession(Session):
             await self.s.close()
 
 
-def getSessionType(sessionType: str, namespace: str, url: str = DEFAULT_URL) -> Session:
+def getSessionType(
+    sessionType: str, namespace: str, url: str = DEFAULT_URL, unix_socket: str = None
+) -> Session:
     """
     This function is given a string, either "sync" or "async", and it returns a SyncSession or AsyncSession respectively.
     """
     if sessionType == "sync":
-        return SyncSession(namespace, url)
+        return SyncSession(namespace, url, unix_socket)
     if sessionType == "async":
-        return AsyncSession(namespace, url)
+        return AsyncSession(namespace, url, unix_socket)
     raise NotImplementedError(f"The session type '{sessionType}' is not implemented")
 
 
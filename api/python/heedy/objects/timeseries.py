@@ -199,6 +199,10 @@ class Timeseries(Object):
         Each datapoint can optionally also contain a "dt" parameter with the datapoint's duration in seconds.
         A time series can't have multiple datapoints with the same timestamp, so such datapoints are automatically
         overwritten by default. Using method="insert" will throw an error if a timestamp conflicts with an existing one.
+
+        Using method="merge" replaces only the existing datapoints with the same timestamps, and keeps all others.
+        Passing key="..." makes the insert idempotent: retrying an insert with the same key skips its data.
+        The result gives the number of datapoints that were inserted, replaced and skipped.
         """
         return self.session.post(
             self.uri + "/timeseries", data=datapoint_array, params=kwargs
@@ -22,8 +22,12 @@ class Plugin:
             # Change the directory to the data dir
             os.chdir(self.config["data_dir"])
 
+        # Plugins that run without network access are given a unix socket to reach heedy
         self.session = getSessionType(
-            session, self.name, f"http://localhost:{self.config['config']['port']}"
+            session,
+            self.name,
+            f"http://localhost:{self.config['config']['port']}",
+            self.config.get("api_socket"),
         )
         self.session.setPluginKey(self.config["apikey"])
 
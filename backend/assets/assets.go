@@ -8,6 +8,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/dkumor/revhttpfs"
 	"github.com/rakyll/statik/fs"
@@ -67,7 +68,8 @@ type Assets struct {
 	// before any special processing
 	ConfigOverride *Configuration
 
-	// The active configuration. This is loaded automatically
+	// The active configuration. This is loaded automatically. It is replaced when the assets are
+	// reloaded, so code running alongside a reload should read it with GetConfig.
 	Config *Configuration
 
 	// The overlay stack. index 0 represents built-in assets. Each index is just that stack element.
@@ -76,6 +78,42 @@ type Assets struct {
 	// The overlay filesystems that include the builtin assets, as well as all
 	// overrides from active plugins, and user overrides. It is loaded automatically
 	FS afero.Fs
+
+	lock sync.RWMutex
+}
+
+// GetConfig returns the active configuration
+func (a *Assets) GetConfig() *Configuration {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.Config
+}
+
+// GetFS returns the active overlay filesystem
+func (a *Assets) GetFS() afero.Fs {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.FS
+}
+
+// Replace swaps in the configuration and filesystems of the given assets, and returns assets holding
+// the ones that were replaced, so that they can be restored.
+func (a *Assets) Replace(na *Assets) *Assets {
+	na.lock.RLock()
+	config, fs, stack := na.Config, na.FS, na.Stack
+	na.lock.RUnlock()
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	old := &Assets{
+		FolderPath:     a.FolderPath,
+		ConfigOverride: a.ConfigOverride,
+		Config:         a.Config,
+		Stack:          a.Stack,
+		FS:             a.FS,
+	}
+	a.Config, a.FS, a.Stack = config, fs, stack
+	return old
 }
 
 // Reload the assets from scratch
@@ -181,21 +219,24 @@ func (a *Assets) Reload() error {
 
 	}
 
-	// Set the new config and assets
-	a.Config = mergedConfiguration
-	a.FS = FS
-	a.Stack = assetStack
-
-	if a.Config.Verbose {
-		b, err := json.MarshalIndent(a.Config, "", " ")
+	if mergedConfiguration.Verbose {
+		b, err := json.MarshalIndent(mergedConfiguration, "", " ")
 		if err != nil {
 			return err
 		}
 		logrus.Debug(string(b))
 	}
 
-	// Validate the configuration
-	return Validate(a.Config)
+	// The configuration is validated before it is set, so that invalid configurations never become active
+	if err = Validate(mergedConfiguration); err != nil {
+		return err
+	}
+	a.lock.Lock()
+	a.Config = mergedConfiguration
+	a.FS = FS
+	a.Stack = assetStack
+	a.lock.Unlock()
+	return nil
 }
 
 // Abs returns config-relative absolute paths
@@ -229,23 +270,24 @@ func (a *Assets) PluginDir() string {
 }
 
 func (a *Assets) AddAdmin(username string) error {
-	a.Config.Lock()
-	defer a.Config.Unlock()
-	if a.Config.AdminUsers == nil {
+	cfg := a.GetConfig()
+	cfg.Lock()
+	defer cfg.Unlock()
+	if cfg.AdminUsers == nil {
 		au := []string{}
-		a.Config.AdminUsers = &au
+		cfg.AdminUsers = &au
 	}
 
 	// Check if the admin user already exists
-	for _, v := range *a.Config.AdminUsers {
+	for _, v := range *cfg.AdminUsers {
 		if v == username {
 			return nil
 		}
 	}
 
 	// Append the user to current configuration
-	au := append(*a.Config.AdminUsers, username)
-	a.Config.AdminUsers = &au
+	au := append(*cfg.AdminUsers, username)
+	cfg.AdminUsers = &au
 
 	c := NewConfiguration()
 	c.AdminUsers = &au
@@ -259,21 +301,22 @@ func (a *Assets) AddAdmin(username string) error {
 }
 
 func (a *Assets) RemAdmin(username string) error {
-	a.Config.Lock()
-	defer a.Config.Unlock()
-	if a.Config.AdminUsers == nil {
+	cfg := a.GetConfig()
+	cfg.Lock()
+	defer cfg.Unlock()
+	if cfg.AdminUsers == nil {
 		return nil
 	}
 
 	// Check if the admin user already exists
-	for i, v := range *a.Config.AdminUsers {
+	for i, v := range *cfg.AdminUsers {
 		if v == username {
 			// The username exists
-			au := *a.Config.AdminUsers
+			au := *cfg.AdminUsers
 			au[len(au)-1], au[i] = au[i], au[len(au)-1]
 			au = au[:len(au)-1]
 
-			a.Config.AdminUsers = &au
+			cfg.AdminUsers = &au
 
 			c := NewConfiguration()
 			c.AdminUsers = &au
@@ -290,7 +333,7 @@ func (a *Assets) RemAdmin(username string) error {
 }
 
 func (a *Assets) IsAdmin(username string) bool {
-	return a.Config.UserIsAdmin(username)
+	return a.GetConfig().UserIsAdmin(username)
 }
 
 func (a *Assets) SwapAdmin(username, newname string) error {
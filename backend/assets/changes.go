@@ -0,0 +1,72 @@
+package assets
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+func jsonEqual(a, b interface{}) bool {
+	ab, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ab, bb)
+}
+
+// RestartSettings returns the settings that differ between the two configurations and can only
+// be applied by restarting heedy, since they are used when the server and database are opened.
+func RestartSettings(oldc, newc *Configuration) []string {
+	settings := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"host", oldc.Host, newc.Host},
+		{"port", oldc.Port, newc.Port},
+		{"sql", oldc.SQL, newc.SQL},
+		{"tls_cert", oldc.TLSCert, newc.TLSCert},
+		{"tls_key", oldc.TLSKey, newc.TLSKey},
+		{"acme", oldc.ACME, newc.ACME},
+		{"redirect_port", oldc.RedirectPort, newc.RedirectPort},
+		{"listener", oldc.Listeners, newc.Listeners},
+		{"runtype", oldc.RunTypes, newc.RunTypes},
+		{"log_level", oldc.LogLevel, newc.LogLevel},
+		{"log_file", oldc.LogFile, newc.LogFile},
+	}
+	changed := []string{}
+	for _, s := range settings {
+		if !jsonEqual(s.old, s.new) {
+			changed = append(changed, s.name)
+		}
+	}
+	return changed
+}
+
+// ChangedPlugins returns the plugins that need to be restarted to go from the old configuration to the new one,
+// which are the active plugins whose configuration changed, as well as the plugins that were activated or deactivated.
+func ChangedPlugins(oldc, newc *Configuration) []string {
+	oldActive := make(map[string]bool)
+	for _, p := range oldc.GetActivePlugins() {
+		oldActive[p] = true
+	}
+	newActive := make(map[string]bool)
+	for _, p := range newc.GetActivePlugins() {
+		newActive[p] = true
+	}
+
+	changed := []string{}
+	for _, p := range oldc.GetActivePlugins() {
+		if !newActive[p] {
+			changed = append(changed, p)
+		}
+	}
+	for _, p := range newc.GetActivePlugins() {
+		if !oldActive[p] || !jsonEqual(oldc.Plugins[p], newc.Plugins[p]) {
+			changed = append(changed, p)
+		}
+	}
+	return changed
+}
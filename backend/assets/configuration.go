@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
@@ -66,6 +67,107 @@ type Run struct {
 	Enabled  *bool                  `hcl:"enabled" json:"enabled,omitempty"`
 	Cron     *string                `hcl:"cron" json:"cron,omitempty"`
 	Settings map[string]interface{} `json:"settings,omitempty"`
+
+	// Restart is the policy for restarting the runner's process when it exits: always, on-failure or never
+	Restart      *string `hcl:"restart" json:"restart,omitempty"`
+	RestartDelay *string `hcl:"restart_delay" json:"restart_delay,omitempty"`
+	MaxRestarts  *int    `hcl:"max_restarts" json:"max_restarts,omitempty"`
+
+	// Sandbox isolates the runner's process, and limits the resources it can use
+	Sandbox *Sandbox `hcl:"sandbox,block" json:"sandbox,omitempty"`
+}
+
+// Sandbox gives the isolation and resource limits of a plugin process. It is supported by the exec and python runtypes.
+type Sandbox struct {
+	// The maximum memory of the process, such as "512M"
+	Memory *string `hcl:"memory" json:"memory,omitempty"`
+	// The number of CPUs the process can use, such as 0.5
+	CPU *float64 `hcl:"cpu" json:"cpu,omitempty"`
+	// The maximum CPU time the process can use, such as "1h"
+	CPUTime *string `hcl:"cpu_time" json:"cpu_time,omitempty"`
+	// The maximum number of processes and threads
+	Processes *int `hcl:"processes" json:"processes,omitempty"`
+	// The maximum number of open files
+	OpenFiles *int `hcl:"open_files" json:"open_files,omitempty"`
+
+	// When false, the process runs without network access, and can only communicate over unix sockets.
+	// Heedy's API is then reached through the unix socket given as api_socket in the process' info.
+	Network *bool `hcl:"network" json:"network,omitempty"`
+	// The environment variables passed to the process. All other variables are removed.
+	Env *[]string `hcl:"env" json:"env,omitempty"`
+	// The working directory of the process, relative to the plugin's folder. This does not restrict
+	// which files the process can access.
+	Dir *string `hcl:"dir" json:"dir,omitempty"`
+}
+
+// GetMemory returns the memory limit in bytes, or 0 if there is no limit
+func (s *Sandbox) GetMemory() int64 {
+	if s.Memory != nil {
+		m, err := ParseBytes(*s.Memory)
+		if err == nil {
+			return m
+		}
+	}
+	return 0
+}
+
+// GetCPUTime returns the limit on CPU time, or 0 if there is no limit
+func (s *Sandbox) GetCPUTime() time.Duration {
+	if s.CPUTime != nil {
+		d, err := time.ParseDuration(*s.CPUTime)
+		if err == nil {
+			return d
+		}
+	}
+	return 0
+}
+
+// GetNetwork returns whether the process has network access
+func (s *Sandbox) GetNetwork() bool {
+	return s.Network == nil || *s.Network
+}
+
+// GetEnv returns the environment variables that are passed to the process
+func (s *Sandbox) GetEnv() []string {
+	if s.Env != nil {
+		return *s.Env
+	}
+	return []string{"PATH", "LANG", "LC_ALL", "TZ"}
+}
+
+// The restart policies of runners
+const (
+	RestartAlways    = "always"
+	RestartOnFailure = "on-failure"
+	RestartNever     = "never"
+)
+
+// GetRestart returns the runner's restart policy, which defaults to on-failure
+func (r *Run) GetRestart() string {
+	if r.Restart != nil {
+		return *r.Restart
+	}
+	return RestartOnFailure
+}
+
+// GetRestartDelay returns the time to wait before the first restart of a failed runner.
+// Each subsequent restart waits twice as long as the previous one.
+func (r *Run) GetRestartDelay() time.Duration {
+	if r.RestartDelay != nil {
+		d, err := time.ParseDuration(*r.RestartDelay)
+		if err == nil {
+			return d
+		}
+	}
+	return time.Second
+}
+
+// GetMaxRestarts returns the number of consecutive restarts after which heedy gives up on the runner
+func (r *Run) GetMaxRestarts() int {
+	if r.MaxRestarts != nil {
+		return *r.MaxRestarts
+	}
+	return 5
 }
 
 type Plugin struct {
@@ -81,6 +183,14 @@ type Plugin struct {
 	Routes *map[string]string `json:"routes,omitempty"`
 	Events *map[string]string `json:"events,omitempty"`
 
+	// AdminRoutes are the path prefixes of the plugin's routes that belong to the admin API,
+	// which is not served on listeners with admin_api = false
+	AdminRoutes *[]string `json:"admin_routes,omitempty"`
+
+	// OpenAPI is a fragment of an OpenAPI 3 document describing the plugin's routes,
+	// which is merged into the document served at /api/openapi.json
+	OpenAPI *map[string]interface{} `json:"openapi,omitempty"`
+
 	On []Event `hcl:"on,block" json:"on,omitempty"`
 
 	Run            map[string]Run         `json:"run,omitempty"`
@@ -121,6 +231,15 @@ func (p *Plugin) Copy() *Plugin {
 	return &np
 }
 
+// GraphQLField describes a field that an object type adds to objects in the GraphQL API.
+// The field is resolved by making a request to the given route of the object.
+type GraphQLField struct {
+	Type        string            `json:"type"`
+	Route       string            `json:"route"`
+	Args        map[string]string `json:"args,omitempty"`
+	Description *string           `json:"description,omitempty"`
+}
+
 type ObjectType struct {
 	Frontend *string            `json:"frontend,omitempty" hcl:"frontend,block" cty:"frontend"`
 	Routes   *map[string]string `json:"routes,omitempty" hcl:"routes" cty:"routes"`
@@ -129,6 +248,13 @@ type ObjectType struct {
 
 	Scope *map[string]string `json:"scope,omitempty" hcl:"scope" cty:"scope"`
 
+	// OpenAPI is a fragment of an OpenAPI 3 document describing the object type's routes.
+	// Its paths are relative to /api/objects/{objectid}
+	OpenAPI *map[string]interface{} `json:"openapi,omitempty"`
+
+	// GraphQL gives the fields that the object type adds to its objects in the GraphQL API
+	GraphQL *map[string]GraphQLField `json:"graphql,omitempty"`
+
 	metaSchema *JSONSchema
 }
 
@@ -228,7 +354,8 @@ type Configuration struct {
 	Frontend *string   `json:"frontend,omitempty"`
 	Preload  *[]string `json:"preload,omitempty" hcl:"preload"`
 
-	RunTimeout *string `json:"run_timeout,omitempty"`
+	RunTimeout      *string `json:"run_timeout,omitempty"`
+	ShutdownTimeout *string `json:"shutdown_timeout,omitempty"`
 
 	Scope *map[string]string `json:"scope,omitempty" hcl:"scope"`
 
@@ -238,6 +365,19 @@ type Configuration struct {
 	RequestBodyByteLimit *int64 `hcl:"request_body_byte_limit" json:"request_body_byte_limit,omitempty"`
 	AllowPublicWebsocket *bool  `hcl:"allow_public_websocket" json:"allow_public_websocket,omitempty"`
 
+	MetricsToken *string `hcl:"metrics_token" json:"metrics_token,omitempty"`
+
+	TLSCert      *string `hcl:"tls_cert" json:"tls_cert,omitempty"`
+	TLSKey       *string `hcl:"tls_key" json:"tls_key,omitempty"`
+	ACME         *ACME   `hcl:"acme,block" json:"acme,omitempty"`
+	RedirectPort *uint16 `hcl:"redirect_port" json:"redirect_port,omitempty"`
+	HSTS         *string `hcl:"hsts" json:"hsts,omitempty"`
+
+	Listeners map[string]Listener `json:"listener,omitempty"`
+
+	BasePath       *string   `hcl:"base_path" json:"base_path,omitempty"`
+	TrustedProxies *[]string `hcl:"trusted_proxies" json:"trusted_proxies,omitempty"`
+
 	Plugins map[string]*Plugin `json:"plugin,omitempty"`
 
 	LogLevel *string `json:"log_level,omitempty" hcl:"log_level"`
@@ -247,6 +387,31 @@ type Configuration struct {
 	Verbose bool `json:"verbose,omitempty"`
 }
 
+// ACME configures automatically getting TLS certificates from an ACME server, such as Let's Encrypt
+type ACME struct {
+	// The domains to get certificates for
+	Domains []string `hcl:"domains" json:"domains"`
+	// The contact email given to the ACME server
+	Email *string `hcl:"email" json:"email,omitempty"`
+	// The directory of the ACME server. Let's Encrypt is used by default.
+	DirectoryURL *string `hcl:"directory_url" json:"directory_url,omitempty"`
+	// A file with extra root certificates to trust when connecting to the ACME server,
+	// for servers with a private certificate authority
+	CARoot *string `hcl:"ca_root" json:"ca_root,omitempty"`
+}
+
+// Listener is an address that heedy serves on in addition to its host and port
+type Listener struct {
+	// The address to listen on, either host:port, or unix:// followed by the path of a socket file
+	Address *string `hcl:"address" json:"address,omitempty"`
+	// The permissions of the socket file of a unix socket, such as "0660"
+	Permissions *string `hcl:"permissions" json:"permissions,omitempty"`
+	// Whether the admin API is served on the listener. It is served by default.
+	AdminAPI *bool `hcl:"admin_api" json:"admin_api,omitempty"`
+	// Serve only the admin API on the listener
+	AdminOnly *bool `hcl:"admin_only" json:"admin_only,omitempty"`
+}
+
 func copyStringArrayPtr(s *[]string) *[]string {
 	if s == nil {
 		return s
@@ -269,6 +434,11 @@ func (c *Configuration) Copy() *Configuration {
 		nc.ObjectTypes[k] = v.Copy()
 	}
 
+	nc.Listeners = make(map[string]Listener)
+	for k, v := range c.Listeners {
+		nc.Listeners[k] = v
+	}
+
 	return &nc
 
 }
@@ -278,6 +448,7 @@ func NewConfiguration() *Configuration {
 		Plugins:     make(map[string]*Plugin),
 		ObjectTypes: make(map[string]ObjectType),
 		RunTypes:    make(map[string]RunType),
+		Listeners:   make(map[string]Listener),
 	}
 }
 
@@ -359,6 +530,16 @@ func MergeConfig(base *Configuration, overlay *Configuration) *Configuration {
 		}
 	}
 
+	for k, v := range overlay.Listeners {
+		bv, ok := base.Listeners[k]
+		if ok {
+			CopyStructIfPtrSet(&bv, &v)
+			base.Listeners[k] = bv
+		} else {
+			base.Listeners[k] = v
+		}
+	}
+
 	// Now go into the plugins, and continue the good work
 	for pluginName, oplugin := range overlay.Plugins {
 		bplugin, ok := base.Plugins[pluginName]
@@ -123,3 +123,61 @@ func TestSchemaValidation(t *testing.T) {
 	}
 	require.Error(t, c.ValidateObjectMeta("timeseries", &v))
 }
+
+func TestParseBytes(t *testing.T) {
+	for s, v := range map[string]int64{
+		"100":   100,
+		"512M":  512 << 20,
+		"512MB": 512 << 20,
+		"1.5G":  3 << 29,
+		"2gib":  2 << 30,
+		" 64k ": 64 << 10,
+	} {
+		b, err := ParseBytes(s)
+		require.NoError(t, err, s)
+		require.Equal(t, v, b, s)
+	}
+	for _, s := range []string{"", "M", "12X", "-5M"} {
+		_, err := ParseBytes(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestConfigChanges(t *testing.T) {
+	oldc, err := LoadConfigBytes([]byte(`
+		port = 1324
+		active_plugins = ["a", "b", "c"]
+		plugin "a" {
+			version = "1.0"
+		}
+		plugin "b" {
+			version = "1.0"
+		}
+		plugin "c" {
+			version = "1.0"
+		}
+	`), "old.conf")
+	require.NoError(t, err)
+	newc, err := LoadConfigBytes([]byte(`
+		port = 1324
+		active_plugins = ["a", "b", "d"]
+		plugin "a" {
+			version = "1.0"
+		}
+		plugin "b" {
+			version = "2.0"
+		}
+		plugin "d" {
+			version = "1.0"
+		}
+	`), "new.conf")
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"c", "b", "d"}, ChangedPlugins(oldc, newc))
+	require.Len(t, ChangedPlugins(oldc, oldc), 0)
+	require.Len(t, RestartSettings(oldc, newc), 0)
+
+	port := uint16(8000)
+	newc.Port = &port
+	require.Equal(t, []string{"port"}, RestartSettings(oldc, newc))
+}
@@ -2,6 +2,8 @@ package assets
 
 import (
 	"fmt"
+	"net"
+	"strings"
 	"time"
 )
 
@@ -41,6 +43,77 @@ func (c *Configuration) GetActivePlugins() []string {
 	return *c.ActivePlugins
 }
 
+// TLSEnabled returns whether heedy serves https, with either a certificate from the configuration or from ACME
+func (c *Configuration) TLSEnabled() bool {
+	c.RLock()
+	defer c.RUnlock()
+	return c.TLSCert != nil && *c.TLSCert != "" || c.ACME != nil && len(c.ACME.Domains) > 0
+}
+
+// GetHSTS returns the Strict-Transport-Security header to send with https responses, or an empty string if none is sent
+func (c *Configuration) GetHSTS() string {
+	c.RLock()
+	defer c.RUnlock()
+	if c.HSTS != nil {
+		return *c.HSTS
+	}
+	return ""
+}
+
+// GetListeners returns the addresses that heedy serves on in addition to its host and port
+func (c *Configuration) GetListeners() map[string]Listener {
+	c.RLock()
+	defer c.RUnlock()
+	listeners := make(map[string]Listener)
+	for k, v := range c.Listeners {
+		listeners[k] = v
+	}
+	return listeners
+}
+
+// GetBasePath returns the path at which heedy is served, without a trailing slash. It is an empty string
+// when heedy is served at the root of its domain.
+func (c *Configuration) GetBasePath() string {
+	c.RLock()
+	defer c.RUnlock()
+	if c.BasePath == nil {
+		return ""
+	}
+	return strings.TrimSuffix(*c.BasePath, "/")
+}
+
+// GetTrustedProxies returns the networks of the proxies whose forwarded headers are trusted,
+// and whether requests through unix sockets are trusted
+func (c *Configuration) GetTrustedProxies() (networks []*net.IPNet, unix bool) {
+	c.RLock()
+	defer c.RUnlock()
+	if c.TrustedProxies == nil {
+		return
+	}
+	for _, p := range *c.TrustedProxies {
+		n, err := ParseTrustedProxy(p)
+		if err != nil {
+			continue
+		}
+		if n == nil {
+			unix = true
+		} else {
+			networks = append(networks, n)
+		}
+	}
+	return
+}
+
+// GetMetricsToken returns the token that can be used to read server metrics, or an empty string if not set
+func (c *Configuration) GetMetricsToken() string {
+	c.RLock()
+	defer c.RUnlock()
+	if c.MetricsToken != nil {
+		return *c.MetricsToken
+	}
+	return ""
+}
+
 // UserIsAdmin checks if the given user is an admin
 func (c *Configuration) UserIsAdmin(username string) bool {
 	c.RLock()
@@ -124,3 +197,46 @@ func (c *Configuration) GetRunTimeout() time.Duration {
 	d, _ := time.ParseDuration(("5s"))
 	return d
 }
+
+// GetShutdownTimeout gets how long to wait for requests to finish when heedy is stopping
+func (c *Configuration) GetShutdownTimeout() time.Duration {
+	c.RLock()
+	defer c.RUnlock()
+	if c.ShutdownTimeout != nil {
+		d, err := time.ParseDuration(*c.ShutdownTimeout)
+		if err == nil {
+			return d
+		}
+	}
+	return 30 * time.Second
+}
+
+// ServesAdminAPI returns whether the admin API is available through the listener
+func (l Listener) ServesAdminAPI() bool {
+	return l.AdminAPI == nil || *l.AdminAPI
+}
+
+// IsAdminOnly returns whether the listener only serves the admin API
+func (l Listener) IsAdminOnly() bool {
+	return l.AdminOnly != nil && *l.AdminOnly
+}
+
+// ParseTrustedProxy parses an entry of trusted_proxies, which is either an IP address, a CIDR range,
+// or "unix" to trust requests coming through unix socket listeners. The unix entry is returned as a nil network.
+func ParseTrustedProxy(p string) (*net.IPNet, error) {
+	if p == "unix" {
+		return nil, nil
+	}
+	if ip := net.ParseIP(p); ip != nil {
+		bits := 8 * net.IPv4len
+		if ip.To4() == nil {
+			bits = 8 * net.IPv6len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, n, err := net.ParseCIDR(p)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid trusted proxy '%s': must be an IP address, a CIDR range or unix", p)
+	}
+	return n, nil
+}
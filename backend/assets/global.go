@@ -25,12 +25,12 @@ func Get() *Assets {
 
 // Config returns the global configuration
 func Config() *Configuration {
-	return Get().Config
+	return Get().GetConfig()
 }
 
 // FS returns the current filesystem
 func FS() afero.Fs {
-	return Get().FS
+	return Get().GetFS()
 }
 
 // SetGlobal sets the global assets to the given values
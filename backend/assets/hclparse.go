@@ -27,6 +27,12 @@ type hclRun struct {
 	Enabled *bool   `hcl:"enabled" json:"enabled,omitempty"`
 	Cron    *string `hcl:"cron" json:"cron,omitempty"`
 
+	Restart      *string `hcl:"restart" json:"restart,omitempty"`
+	RestartDelay *string `hcl:"restart_delay" json:"restart_delay,omitempty"`
+	MaxRestarts  *int    `hcl:"max_restarts" json:"max_restarts,omitempty"`
+
+	Sandbox *Sandbox `hcl:"sandbox,block" json:"sandbox,omitempty"`
+
 	// Everything that remains is settings specific to the runner
 	Settings hcl.Body `hcl:",remain"`
 }
@@ -80,10 +86,12 @@ type hclPlugin struct {
 	Frontend *string   `hcl:"frontend" json:"frontend"`
 	Preload  *[]string `json:"preload,omitempty" hcl:"preload"`
 
-	Routes *map[string]string `hcl:"routes" json:"routes"`
-	Events *map[string]string `hcl:"events" json:"events,omitempty"`
+	Routes      *map[string]string `hcl:"routes" json:"routes"`
+	Events      *map[string]string `hcl:"events" json:"events,omitempty"`
+	AdminRoutes *[]string          `hcl:"admin_routes" json:"admin_routes,omitempty"`
 
 	SettingSchema *cty.Value `hcl:"settings_schema"`
+	OpenAPI       *cty.Value `hcl:"openapi"`
 
 	Run []hclRun `hcl:"run,block"`
 
@@ -103,8 +111,10 @@ type hclObjectType struct {
 
 	Routes *map[string]string `json:"routes,omitempty" hcl:"routes" cty:"routes"`
 
-	Meta  *cty.Value         `hcl:"meta,attr"`
-	Scope *map[string]string `json:"scope,omitempty" hcl:"scope" cty:"scope"`
+	Meta    *cty.Value         `hcl:"meta,attr"`
+	Scope   *map[string]string `json:"scope,omitempty" hcl:"scope" cty:"scope"`
+	OpenAPI *cty.Value         `hcl:"openapi,attr"`
+	GraphQL *cty.Value         `hcl:"graphql,attr"`
 }
 
 type hclRunType struct {
@@ -113,6 +123,14 @@ type hclRunType struct {
 	API    *string    `json:"api,omitempty" hcl:"api" cty:"api"`
 }
 
+type hclListener struct {
+	Label       string  `hcl:"label,label"`
+	Address     *string `hcl:"address"`
+	Permissions *string `hcl:"permissions"`
+	AdminAPI    *bool   `hcl:"admin_api"`
+	AdminOnly   *bool   `hcl:"admin_only"`
+}
+
 type hclConfiguration struct {
 	URL            *string   `hcl:"url" json:"url,omitempty"`
 	Host           *string   `hcl:"host" json:"host,omitempty"`
@@ -129,7 +147,8 @@ type hclConfiguration struct {
 	Frontend *string   `hcl:"frontend"`
 	Preload  *[]string `json:"preload,omitempty" hcl:"preload"`
 
-	RunTimeout *string `hcl:"run_timeout"`
+	RunTimeout      *string `hcl:"run_timeout"`
+	ShutdownTimeout *string `hcl:"shutdown_timeout"`
 
 	Scope       *map[string]string `json:"scope,omitempty" hcl:"scope"`
 	NewAppScope *[]string          `json:"new_app_scope,omitempty" hcl:"new_app_scope"`
@@ -140,6 +159,19 @@ type hclConfiguration struct {
 	RequestBodyByteLimit *int64 `hcl:"request_body_byte_limit" json:"request_body_byte_limit,omitempty"`
 	AllowPublicWebsocket *bool  `hcl:"allow_public_websocket" json:"allow_public_websocket,omitempty"`
 
+	MetricsToken *string `hcl:"metrics_token" json:"metrics_token,omitempty"`
+
+	TLSCert      *string `hcl:"tls_cert"`
+	TLSKey       *string `hcl:"tls_key"`
+	ACME         *ACME   `hcl:"acme,block"`
+	RedirectPort *uint16 `hcl:"redirect_port"`
+	HSTS         *string `hcl:"hsts"`
+
+	Listeners []hclListener `hcl:"listener,block"`
+
+	BasePath       *string   `hcl:"base_path"`
+	TrustedProxies *[]string `hcl:"trusted_proxies"`
+
 	Plugins []hclPlugin `hcl:"plugin,block"`
 
 	LogLevel *string `json:"log_level" hcl:"log_level"`
@@ -283,6 +315,21 @@ func loadConfigFromHcl(f *hcl.File, filename string) (*Configuration, error) {
 		if err != nil {
 			return nil, err
 		}
+		t.OpenAPI, err = loadJSONObject(ht.OpenAPI)
+		if err != nil {
+			return nil, err
+		}
+		if ht.GraphQL != nil {
+			b, err := json.Marshal(ctyjson.SimpleJSONValue{Value: *ht.GraphQL})
+			if err != nil {
+				return nil, err
+			}
+			gqlFields := make(map[string]GraphQLField)
+			if err = json.Unmarshal(b, &gqlFields); err != nil {
+				return nil, fmt.Errorf("%s: type %s graphql: %w", filename, ht.Label, err)
+			}
+			t.GraphQL = &gqlFields
+		}
 
 		c.ObjectTypes[ht.Label] = t
 	}
@@ -304,6 +351,12 @@ func loadConfigFromHcl(f *hcl.File, filename string) (*Configuration, error) {
 		c.RunTypes[v.Label] = r
 	}
 
+	for _, v := range hc.Listeners {
+		l := Listener{}
+		CopyStructIfPtrSet(&l, &v)
+		c.Listeners[v.Label] = l
+	}
+
 	// Loop through the plugins
 	for i := range hc.Plugins {
 		hp := hc.Plugins[i]
@@ -355,6 +408,13 @@ func loadConfigFromHcl(f *hcl.File, filename string) (*Configuration, error) {
 			}
 			p.SettingsSchema = *sobj
 		}
+		if hp.OpenAPI != nil {
+			oobj, err := loadJSONObject(hp.OpenAPI)
+			if err != nil {
+				return nil, err
+			}
+			p.OpenAPI = oobj
+		}
 
 		// Load the apps that the plugin wants to set up
 		for j := range hp.Apps {
@@ -1,10 +1,13 @@
 package assets
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"net"
 	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/afero"
@@ -224,3 +227,38 @@ func GetOutboundIP() string {
 
 	return localAddr.IP.String()
 }
+
+var byteUnits = map[string]int64{
+	"":  1,
+	"B": 1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// ParseBytes parses a size such as "512M" or "2G" into bytes. Units are powers of 1024.
+func ParseBytes(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "IB"), "B")
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	unit := ""
+	if i >= 0 {
+		unit = s[i:]
+		s = s[:i]
+	}
+	mult, ok := byteUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unrecognized size unit '%s'", unit)
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if v < 0 {
+		return 0, errors.New("size can't be negative")
+	}
+	return int64(v * float64(mult)), nil
+}
@@ -3,10 +3,16 @@ package assets
 import (
 	"errors"
 	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// Names in graphql must match this regex
+var graphQLName = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
 // The http verbs to permit in router
 var httpVerbs = map[string]bool{
 	"GET":    true,
@@ -83,6 +89,126 @@ func isValidTarget(c *Configuration, plugin string, s string) error {
 	return nil
 }
 
+// The top-level keys permitted in openapi fragments of plugins and object types
+var openAPIFragmentKeys = map[string]bool{
+	"paths":      true,
+	"components": true,
+	"tags":       true,
+}
+
+func isValidOpenAPIFragment(fragment *map[string]interface{}) error {
+	if fragment == nil {
+		return nil
+	}
+	for k, v := range *fragment {
+		if !openAPIFragmentKeys[k] {
+			return fmt.Errorf("openapi: unrecognized key '%s'", k)
+		}
+		if k == "tags" {
+			if _, ok := v.([]interface{}); !ok {
+				return errors.New("openapi: tags must be an array")
+			}
+		} else if _, ok := v.(map[string]interface{}); !ok {
+			return fmt.Errorf("openapi: %s must be an object", k)
+		}
+	}
+	return nil
+}
+
+// The scalar types that can be returned by graphql fields of object types
+var graphQLScalars = map[string]bool{
+	"Int":     true,
+	"Float":   true,
+	"String":  true,
+	"Boolean": true,
+	"JSON":    true,
+}
+
+// IsValidGraphQLType checks whether the given type is a scalar, optionally wrapped in a list, and optionally non-null
+func IsValidGraphQLType(t string) error {
+	t = strings.TrimSuffix(t, "!")
+	if strings.HasPrefix(t, "[") && strings.HasSuffix(t, "]") {
+		t = strings.TrimSuffix(t[1:len(t)-1], "!")
+	}
+	if !graphQLScalars[t] {
+		return fmt.Errorf("graphql: unrecognized type '%s'", t)
+	}
+	return nil
+}
+
+func isValidGraphQLField(name string, f GraphQLField) error {
+	if !graphQLName.MatchString(name) {
+		return fmt.Errorf("graphql: invalid field name '%s'", name)
+	}
+	if err := IsValidGraphQLType(f.Type); err != nil {
+		return err
+	}
+	if err := isValidRoute(f.Route); err != nil {
+		return fmt.Errorf("graphql: %w", err)
+	}
+	for aname, atype := range f.Args {
+		if !graphQLName.MatchString(aname) {
+			return fmt.Errorf("graphql: invalid argument name '%s'", aname)
+		}
+		if err := IsValidGraphQLType(atype); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isValidRestart checks the restart policy of a runner
+func isValidRestart(r *Run) error {
+	if r.Restart != nil {
+		switch *r.Restart {
+		case RestartAlways, RestartOnFailure, RestartNever:
+		default:
+			return fmt.Errorf("invalid restart policy '%s'", *r.Restart)
+		}
+	}
+	if r.RestartDelay != nil {
+		if _, err := time.ParseDuration(*r.RestartDelay); err != nil {
+			return fmt.Errorf("invalid restart_delay: %w", err)
+		}
+	}
+	if r.MaxRestarts != nil && *r.MaxRestarts < 0 {
+		return errors.New("max_restarts can't be negative")
+	}
+	return nil
+}
+
+// isValidSandbox checks the sandbox settings of a runner
+func isValidSandbox(s *Sandbox) error {
+	if s == nil {
+		return nil
+	}
+	if s.Memory != nil {
+		if _, err := ParseBytes(*s.Memory); err != nil {
+			return fmt.Errorf("invalid sandbox memory: %w", err)
+		}
+	}
+	if s.CPU != nil && *s.CPU <= 0 {
+		return errors.New("sandbox cpu must be positive")
+	}
+	if s.CPUTime != nil {
+		if d, err := time.ParseDuration(*s.CPUTime); err != nil || d < time.Second {
+			return errors.New("sandbox cpu_time must be a duration of at least 1s")
+		}
+	}
+	if s.Processes != nil && *s.Processes <= 0 {
+		return errors.New("sandbox processes must be positive")
+	}
+	if s.OpenFiles != nil && *s.OpenFiles <= 0 {
+		return errors.New("sandbox open_files must be positive")
+	}
+	if s.Dir != nil {
+		if filepath.IsAbs(*s.Dir) || strings.HasPrefix(filepath.Clean(*s.Dir), "..") {
+			return errors.New("sandbox dir must be inside the plugin's folder")
+		}
+	}
+	return nil
+}
+
 func Validate(c *Configuration) error {
 	c.RLock()
 	defer c.RUnlock()
@@ -92,6 +218,19 @@ func Validate(c *Configuration) error {
 		if err != nil {
 			return fmt.Errorf("object %s meta schema invalid: %s", k, err.Error())
 		}
+		if err = isValidOpenAPIFragment(v.OpenAPI); err != nil {
+			return fmt.Errorf("object %s %s", k, err.Error())
+		}
+		if !graphQLName.MatchString(k) && v.GraphQL != nil {
+			return fmt.Errorf("object %s graphql: the type name is not a valid graphql name", k)
+		}
+		if v.GraphQL != nil {
+			for fname, f := range *v.GraphQL {
+				if err = isValidGraphQLField(fname, f); err != nil {
+					return fmt.Errorf("object %s %s", k, err.Error())
+				}
+			}
+		}
 	}
 
 	// Make sure all the active plugins have valid configurations
@@ -122,6 +261,56 @@ func Validate(c *Configuration) error {
 			return errors.New("Invalid exec_timeout")
 		}
 	}
+	hasCert := c.TLSCert != nil && *c.TLSCert != ""
+	if hasCert != (c.TLSKey != nil && *c.TLSKey != "") {
+		return errors.New("tls_cert and tls_key must be set together")
+	}
+	if c.ACME != nil {
+		if len(c.ACME.Domains) == 0 {
+			return errors.New("acme must have at least one domain")
+		}
+		if hasCert {
+			return errors.New("Can't use both acme and tls_cert")
+		}
+	}
+	if c.RedirectPort != nil && *c.RedirectPort != 0 && !c.TLSEnabled() {
+		return errors.New("redirect_port can only be used with tls_cert or acme")
+	}
+
+	for k, v := range c.Listeners {
+		if v.Address == nil || *v.Address == "" || *v.Address == "unix://" {
+			return fmt.Errorf("listener '%s' must have an address", k)
+		}
+		if v.Permissions != nil {
+			if !strings.HasPrefix(*v.Address, "unix://") {
+				return fmt.Errorf("listener '%s' has permissions, which are only used for unix sockets", k)
+			}
+			if _, err := strconv.ParseUint(*v.Permissions, 8, 32); err != nil {
+				return fmt.Errorf("listener '%s' has invalid permissions '%s'", k, *v.Permissions)
+			}
+		}
+		if v.AdminOnly != nil && *v.AdminOnly && v.AdminAPI != nil && !*v.AdminAPI {
+			return fmt.Errorf("listener '%s' can't be admin_only without the admin_api", k)
+		}
+	}
+
+	if c.BasePath != nil && *c.BasePath != "" && (!strings.HasPrefix(*c.BasePath, "/") || strings.ContainsAny(*c.BasePath, "?#")) {
+		return fmt.Errorf("base_path must be a path starting with /, such as /heedy ('%s')", *c.BasePath)
+	}
+	if c.TrustedProxies != nil {
+		for _, p := range *c.TrustedProxies {
+			if _, err := ParseTrustedProxy(p); err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.ShutdownTimeout != nil {
+		_, err := time.ParseDuration(*c.ShutdownTimeout)
+		if err != nil {
+			return errors.New("Invalid shutdown_timeout")
+		}
+	}
 
 	// Now make sure all runners are set up correctly
 	runners := make(map[string]*JSONSchema)
@@ -157,11 +346,20 @@ func Validate(c *Configuration) error {
 			if err := s.ValidateWithDefaults(r.Settings); err != nil {
 				return err
 			}
+			if err := isValidRestart(&r); err != nil {
+				return fmt.Errorf("plugin %s: %w", pname, err)
+			}
+			if err := isValidSandbox(r.Sandbox); err != nil {
+				return fmt.Errorf("plugin %s: %w", pname, err)
+			}
 		}
 	}
 
 	// Ensure that all routes use permitted verbs and start with permitted route prefix
 	for pname, p := range c.Plugins {
+		if err := isValidOpenAPIFragment(p.OpenAPI); err != nil {
+			return fmt.Errorf("plugin %s %s", pname, err.Error())
+		}
 		if p.Routes != nil {
 			for k, v := range *p.Routes {
 				if err := isValidRoute(k); err != nil {
@@ -172,6 +370,13 @@ func Validate(c *Configuration) error {
 				}
 			}
 		}
+		if p.AdminRoutes != nil {
+			for _, r := range *p.AdminRoutes {
+				if !strings.HasPrefix(r, "/") || r == "/" {
+					return fmt.Errorf("plugin %s admin route '%s' must be a path that starts with /", pname, r)
+				}
+			}
+		}
 
 		for _, e := range p.On {
 			if e.Post == nil {
@@ -218,9 +423,20 @@ func Validate(c *Configuration) error {
 
 	// Finally, set the URL if it isn't set
 	if c.URL == nil || *c.URL == "" {
-		if c.Port != nil {
+		if c.ACME != nil && len(c.ACME.Domains) > 0 {
+			myurl := "https://" + c.ACME.Domains[0]
+			if c.Port != nil && *c.Port != 443 {
+				myurl = fmt.Sprintf("%s:%d", myurl, *c.Port)
+			}
+			myurl += c.GetBasePath()
+			c.URL = &myurl
+		} else if c.Port != nil {
 			// If port is not set, it means we're testing
-			myurl := fmt.Sprintf("http://%s:%d", GetOutboundIP(), *c.Port)
+			scheme := "http"
+			if c.TLSEnabled() {
+				scheme = "https"
+			}
+			myurl := fmt.Sprintf("%s://%s:%d%s", scheme, GetOutboundIP(), *c.Port, c.GetBasePath())
 			c.URL = &myurl
 		} else {
 			testurl := "http://localhost"
@@ -217,13 +217,13 @@ func (db *AdminDB) ListUsers(o *ListUsersOptions) (u []*User, err error) {
 
 // CanCreateObject returns whether the given object can be
 func (db *AdminDB) CanCreateObject(s *Object) error {
-	_, _, err := objectCreateQuery(db.Assets().Config, s)
+	_, _, err := objectCreateQuery(db.Assets().GetConfig(), s)
 	return err
 }
 
 // CreateObject creates the object
 func (db *AdminDB) CreateObject(s *Object) (string, error) {
-	sColumns, sValues, err := objectCreateQuery(db.Assets().Config, s)
+	sColumns, sValues, err := objectCreateQuery(db.Assets().GetConfig(), s)
 	if err != nil {
 		return "", err
 	}
@@ -255,6 +255,12 @@ func (db *AdminDB) UpdateObject(s *Object) error {
 	return updateObject(db, s, `SELECT type,'["*"]' AS access FROM objects WHERE id=? LIMIT 1;`, s.ID)
 }
 
+// UpdateObjectTx updates the object within the given transaction, so that plugins can change an object together
+// with their own data. The object type's update hooks are not run, since the caller is expected to have checked the change.
+func (db *AdminDB) UpdateObjectTx(tx TxWrapper, s *Object) error {
+	return updateObjectWith(db, tx, s, false, `SELECT type,'["*"]' AS access FROM objects WHERE id=? LIMIT 1;`, s.ID)
+}
+
 // DelObject deletes the given object
 func (db *AdminDB) DelObject(id string) error {
 	result, err := db.Exec("DELETE FROM objects WHERE id=?;", id)
@@ -159,7 +159,7 @@ func (db *AppDB) ListUsers(o *ListUsersOptions) ([]*User, error) {
 
 // CanCreateObject returns whether the given object can be
 func (db *AppDB) CanCreateObject(s *Object) error {
-	_, _, err := objectCreateQuery(db.adb.Assets().Config, s)
+	_, _, err := objectCreateQuery(db.adb.Assets().GetConfig(), s)
 	if err != nil {
 		return err
 	}
@@ -230,7 +230,7 @@ func (db *AppDB) UpdateObject(s *Object) error {
 		}
 	}
 
-	sColumns, sValues, err := objectUpdateQuery(db.adb.Assets().Config, s, *curs.Type)
+	sColumns, sValues, err := objectUpdateQuery(db.adb.Assets().GetConfig(), s, *curs.Type)
 	if err != nil {
 		return err
 	}
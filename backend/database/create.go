@@ -246,12 +246,12 @@ func AddCreateHook(f func(*AdminDB) error) {
 // Create sets up a new heedy instance
 func Create(a *assets.Assets) error {
 
-	if a.Config.SQL == nil {
+	if a.GetConfig().SQL == nil {
 		return errors.New("Configuration does not specify an sql database")
 	}
 
 	// Split the sql string into database type and app string
-	sqlInfo := strings.SplitAfterN(*a.Config.SQL, "://", 2)
+	sqlInfo := strings.SplitAfterN(*a.GetConfig().SQL, "://", 2)
 	if len(sqlInfo) != 2 {
 		return errors.New("Invalid sql app string")
 	}
@@ -277,7 +277,7 @@ func Create(a *assets.Assets) error {
 		return err
 	}
 
-	if a.Config.Verbose {
+	if a.GetConfig().Verbose {
 		logrus.Debug(schema)
 	}
 	_, err = db.Exec(schema)
@@ -289,7 +289,7 @@ func Create(a *assets.Assets) error {
 		a: a,
 	}
 	adb.SqlxCache.InitCache(db)
-	if a.Config.Verbose {
+	if a.GetConfig().Verbose {
 		adb.SqlxCache.Verbose = true
 	}
 
@@ -17,12 +17,12 @@ import (
 // Open opens the database given assets.
 func Open(a *assets.Assets) (*AdminDB, error) {
 
-	if a.Config.SQL == nil {
+	if a.GetConfig().SQL == nil {
 		return nil, errors.New("No SQL app string specified")
 	}
 
 	// Split the sql string into database type and app string
-	sqlInfo := strings.SplitAfterN(*a.Config.SQL, "://", 2)
+	sqlInfo := strings.SplitAfterN(*a.GetConfig().SQL, "://", 2)
 	if len(sqlInfo) != 2 {
 		return nil, errors.New("Invalid sql app string")
 	}
@@ -55,7 +55,7 @@ func Open(a *assets.Assets) (*AdminDB, error) {
 		a: a,
 	}
 	adminDB.SqlxCache.InitCache(db)
-	if a.Config.Verbose {
+	if a.GetConfig().Verbose {
 		adminDB.SqlxCache.Verbose = true
 	}
 
@@ -118,14 +118,34 @@ func readApp(adb *AdminDB, cid string, o *ReadAppOptions, selectStatement string
 	return c, err
 }
 
+var objectUpdateHooks = make(map[string][]func(*AdminDB, string, map[string]interface{}) error)
+
+// AddObjectUpdateHook adds a check that is run before the metadata of an object of the given type is updated.
+// It gets the object's ID and the metadata update, and returning an error rejects the update.
+func AddObjectUpdateHook(objectType string, f func(adb *AdminDB, id string, meta map[string]interface{}) error) {
+	objectUpdateHooks[objectType] = append(objectUpdateHooks[objectType], f)
+}
+
+// objectUpdater runs the queries of an object update, either directly on the database or in a transaction
+type objectUpdater interface {
+	Get(dest interface{}, query string, args ...interface{}) error
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
 // updateObject uses a select statement that returns the object type if editing is permitted
 func updateObject(adb *AdminDB, s *Object, selectStatement string, args ...interface{}) error {
+	return updateObjectWith(adb, adb, s, true, selectStatement, args...)
+}
+
+// updateObjectWith runs the object update with the given updater. The object type's update hooks
+// are only run if withHooks is set.
+func updateObjectWith(adb *AdminDB, u objectUpdater, s *Object, withHooks bool, selectStatement string, args ...interface{}) error {
 	// Get the object type and scope
 	var sv struct {
 		Stype  string     `db:"type"`
 		Access ScopeArray `db:"access"`
 	}
-	err := adb.Get(&sv, selectStatement, args...)
+	err := u.Get(&sv, selectStatement, args...)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -145,15 +165,23 @@ func updateObject(adb *AdminDB, s *Object, selectStatement string, args ...inter
 		}
 	}
 
-	sColumns, sValues, err := objectUpdateQuery(adb.Assets().Config, s, sv.Stype)
+	meta := s.Meta
+	sColumns, sValues, err := objectUpdateQuery(adb.Assets().GetConfig(), s, sv.Stype)
 	if err != nil {
 		return err
 	}
+	if withHooks && meta != nil {
+		for _, h := range objectUpdateHooks[sv.Stype] {
+			if err = h(adb, s.ID, *meta); err != nil {
+				return err
+			}
+		}
+	}
 
 	sValues = append(sValues, s.ID)
 
 	// Allow updating groups that are not users
-	result, err := adb.Exec(fmt.Sprintf("UPDATE objects SET %s WHERE id=?;", sColumns), sValues...)
+	result, err := u.Exec(fmt.Sprintf("UPDATE objects SET %s WHERE id=?;", sColumns), sValues...)
 	return GetExecError(result, err)
 }
 
@@ -34,7 +34,7 @@ func (db *UserDB) User() (*User, error) {
 }
 
 func (db *UserDB) isAdmin() bool {
-	return db.adb.Assets().Config.UserIsAdmin(db.user)
+	return db.adb.Assets().GetConfig().UserIsAdmin(db.user)
 }
 
 func (db *UserDB) CreateUser(u *User) error {
@@ -80,7 +80,7 @@ func (db *UserDB) ListUsers(o *ListUsersOptions) ([]*User, error) {
 
 // CanCreateObject returns whether the given object can be
 func (db *UserDB) CanCreateObject(s *Object) error {
-	_, _, err := objectCreateQuery(db.adb.Assets().Config, s)
+	_, _, err := objectCreateQuery(db.adb.Assets().GetConfig(), s)
 	if err != nil {
 		return err
 	}
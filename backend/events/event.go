@@ -40,7 +40,7 @@ type EventLogger struct {
 }
 
 func (el EventLogger) Fire(e *Event) {
-	if assets.Get().Config.Verbose {
+	if assets.Get().GetConfig().Verbose {
 		logrus.WithField("stack", database.MiniStack(1)).Debug(e)
 	} else {
 		logrus.Debug(e)
@@ -61,7 +61,7 @@ func connectHook(conn *sqlite3.SQLiteConn) error {
 				Conn:  conn,
 			})
 			if evt != nil {
-				if assets.Get().Config.Verbose {
+				if assets.Get().GetConfig().Verbose {
 					logrus.WithField("stack", database.MiniStack(2)).Debugf("Preparing event %s", evt.String())
 				}
 				elist.PushBack(evt)
@@ -88,7 +88,7 @@ func connectHook(conn *sqlite3.SQLiteConn) error {
 				Conn:  conn,
 			})
 			if evt != nil {
-				if assets.Get().Config.Verbose {
+				if assets.Get().GetConfig().Verbose {
 					logrus.WithField("stack", database.MiniStack(2)).Debugf("Preparing event %s", evt.String())
 				}
 				elist.PushBack(evt)
@@ -102,7 +102,7 @@ func connectHook(conn *sqlite3.SQLiteConn) error {
 
 	conn.RegisterCommitHook(func() int {
 		// The transaction was committed, so fire the events
-		if assets.Get().Config.Verbose {
+		if assets.Get().GetConfig().Verbose {
 			ll := elist.Len()
 			if ll > 0 {
 				logrus.WithField("stack", database.MiniStack(2)).Debugf("Database commit - firing %d prepared event(s)", ll)
@@ -143,7 +143,7 @@ var stmtMutex = sync.RWMutex{}
 var stmtMap = make(map[sqliteConnStmt]driver.Stmt)
 
 func SQLiteSelectConn(c *sqlite3.SQLiteConn, stmt string, vals ...driver.Value) (driver.Rows, error) {
-	if assets.Get().Config.Verbose {
+	if assets.Get().GetConfig().Verbose {
 		logrus.WithField("stack", database.MiniStack(2)).Debug(stmt)
 	}
 	stmtMutex.RLock()
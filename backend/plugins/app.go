@@ -88,7 +88,7 @@ func CreateApp(c *rest.Context, owner string, pluginKey string) (string, string,
 	adb := c.DB.AdminDB()
 	a := adb.Assets()
 
-	p, ok := a.Config.Plugins[pk[0]]
+	p, ok := a.GetConfig().Plugins[pk[0]]
 	if !ok {
 		return "", "", database.ErrBadQuery("invalid app plugin key")
 	}
@@ -100,7 +100,7 @@ func CreateApp(c *rest.Context, owner string, pluginKey string) (string, string,
 
 	// Check if this key is from an *active* plugin
 
-	ap := a.Config.GetActivePlugins()
+	ap := a.GetConfig().GetActivePlugins()
 	hadPlugin := false
 	for _, p := range ap {
 		if p == pk[0] {
@@ -68,7 +68,7 @@ func NewObjectManager(a *assets.Assets, m *run.Manager, h http.Handler) (*Object
 	h = clearChiContext(h)
 
 	// Generate all handlers for the objects that don't use any plugins
-	for sname, sv := range a.Config.ObjectTypes {
+	for sname, sv := range a.GetConfig().ObjectTypes {
 		s := Object{}
 
 		if sv.Routes != nil && len(*sv.Routes) > 0 {
@@ -118,7 +118,7 @@ func NewObjectManager(a *assets.Assets, m *run.Manager, h http.Handler) (*Object
 
 func (sm *ObjectManager) PreparePlugin(plugin string) error {
 	// Generate the handlers for objects that explicitly use runs started by the given plugin
-	for sname, sv := range sm.A.Config.ObjectTypes {
+	for sname, sv := range sm.A.GetConfig().ObjectTypes {
 		s := sm.Objects[sname]
 		if sv.Routes != nil && len(*sv.Routes) > 0 {
 			for r, uri := range *sv.Routes {
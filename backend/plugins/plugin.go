@@ -2,6 +2,8 @@ package plugins
 
 import (
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/heedy/heedy/backend/assets"
@@ -22,6 +24,9 @@ type Plugin struct {
 	Server http.Handler
 
 	EventRouter *events.Router
+
+	// The requests currently being forwarded to the plugin's routes
+	requests sync.WaitGroup
 }
 
 func NewPlugin(db *database.AdminDB, m *run.Manager, heedyServer http.Handler, pname string) (*Plugin, error) {
@@ -56,7 +61,7 @@ func assetEventToEvent(ev assets.Event) events.Event {
 
 func (p *Plugin) Start() error {
 
-	pv := p.DB.Assets().Config.Plugins[p.Name]
+	pv := p.DB.Assets().GetConfig().Plugins[p.Name]
 	for rname, rv := range pv.Run {
 		rv2 := rv // we need to pass a pointer to start, so need to create a new copy
 		err := p.Run.Start(p.Name, rname, &rv2)
@@ -69,7 +74,7 @@ func (p *Plugin) Start() error {
 
 	a := p.DB.Assets()
 
-	psettings := a.Config.Plugins[p.Name]
+	psettings := a.GetConfig().Plugins[p.Name]
 
 	// Set up API forwards
 	if psettings.Routes != nil && len(*psettings.Routes) > 0 {
@@ -82,7 +87,7 @@ func (p *Plugin) Start() error {
 			if err != nil {
 				return err
 			}
-			err = run.Route(mux, rname, h)
+			err = run.Route(mux, rname, p.track(h))
 			if err != nil {
 				return err
 			}
@@ -146,7 +151,7 @@ func (p *Plugin) AfterStart() error {
 
 	a := p.DB.Assets()
 
-	psettings := a.Config.Plugins[p.Name]
+	psettings := a.GetConfig().Plugins[p.Name]
 
 	// Make sure that all apps and objects that need to be auto-created are actually created
 
@@ -202,7 +207,7 @@ func (p *Plugin) AfterStart() error {
 }
 
 func (p *Plugin) OnUserCreate(username string) error {
-	psettings := p.DB.Assets().Config.Plugins[p.Name]
+	psettings := p.DB.Assets().GetConfig().Plugins[p.Name]
 	for cname, cv := range psettings.Apps {
 		if cv.AutoCreate != nil && *cv.AutoCreate {
 			// For each app
@@ -233,6 +238,31 @@ func (p *Plugin) OnUserCreate(username string) error {
 	return nil
 }
 
+// track counts the requests to the given handler, so that they can be drained before the plugin is closed
+func (p *Plugin) track(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.requests.Add(1)
+		defer p.requests.Done()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Drain waits until the requests being forwarded to the plugin's routes are done, or the timeout passes.
+// It returns false on timeout.
+func (p *Plugin) Drain(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		p.requests.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
 func (p *Plugin) Close() error {
 	events.RemoveHandler(p.EventRouter)
 	return p.Run.StopPlugin(p.Name)
@@ -49,6 +49,21 @@ type PluginManager struct {
 
 	// the plugin manager status
 	status int
+	// The error that caused plugin loading to fail
+	startError error
+
+	// The root heedy server, given to plugins when they are started
+	server http.Handler
+	// Whether the configuration is currently being reloaded
+	reloading bool
+}
+
+// Status describes the state of plugin loading
+type Status struct {
+	Status  string   `json:"status"`
+	Error   string   `json:"error,omitempty"`
+	Loading string   `json:"loading,omitempty"`
+	Plugins []string `json:"plugins"`
 }
 
 func NewPluginManager(db *database.AdminDB, h http.Handler) (*PluginManager, error) {
@@ -58,7 +73,7 @@ func NewPluginManager(db *database.AdminDB, h http.Handler) (*PluginManager, err
 		return nil, err
 	}
 
-	plugins := db.Assets().Config.GetActivePlugins()
+	plugins := db.Assets().GetConfig().GetActivePlugins()
 
 	// First, perform a cleanup operation: find any apps that are owned by inactive plugins,
 	// and remove them if they have empty objects
@@ -121,15 +136,26 @@ func (pm *PluginManager) Fire(e *events.Event) {
 	}
 }
 
-func (pm *PluginManager) Start(heedyServer http.Handler) error {
+func (pm *PluginManager) Start(heedyServer http.Handler) (err error) {
+	defer func() {
+		if err != nil {
+			pm.Lock()
+			pm.startError = err
+			pm.Unlock()
+		}
+	}()
+	pm.Lock()
+	pm.server = heedyServer
+	pm.Unlock()
+
 	// First prepare all elements that don't require a plugin
-	err := pm.ObjectManager.PreparePlugin("")
+	err = pm.ObjectManager.PreparePlugin("")
 	if err != nil {
 		pm.Close()
 		return err
 	}
 
-	plugins := pm.ADB.Assets().Config.GetActivePlugins()
+	plugins := pm.ADB.Assets().GetConfig().GetActivePlugins()
 
 	for _, pname := range plugins {
 		p, err := NewPlugin(pm.ADB, pm.RunManager, heedyServer, pname)
@@ -161,23 +187,10 @@ func (pm *PluginManager) Start(heedyServer http.Handler) error {
 			return errors.New("PluginManager was closed during loading")
 		}
 
-		pm.Plugins[pname] = &pluginElement{
-			Plugin: p,
-			Next:   pm.start,
-		}
-		if p.Mux != nil {
-			// The plugin has a router component
-			if pm.start == "none" {
-				p.Mux.NotFound(pm.ObjectManager.ServeHTTP)
-				p.Mux.MethodNotAllowed(pm.ObjectManager.ServeHTTP)
-			} else {
-				p.Mux.NotFound(pm.Plugins[pm.start].Plugin.Mux.ServeHTTP)
-				p.Mux.MethodNotAllowed(pm.Plugins[pm.start].Plugin.Mux.ServeHTTP)
-			}
-			pm.start = pname
-		}
+		pm.add(p)
 		pm.initializingPlugin = nil
 		pm.order = append(pm.order, pname)
+		pm.link()
 		pm.Unlock()
 
 		// Now this plugin's API is active. Set up the object forwards and run the AfterStart handler
@@ -202,6 +215,33 @@ func (pm *PluginManager) Start(heedyServer http.Handler) error {
 	return nil
 }
 
+// Status returns the current state of the plugin manager
+func (pm *PluginManager) Status() Status {
+	pm.RLock()
+	defer pm.RUnlock()
+	s := Status{
+		Plugins: append([]string{}, pm.order...),
+	}
+	if pm.initializingPlugin != nil {
+		s.Loading = pm.initializingPlugin.Name
+	}
+	switch pm.status {
+	case statusLoading:
+		s.Status = "loading"
+	case statusReady:
+		s.Status = "ready"
+	case statusClosing:
+		s.Status = "closing"
+	case statusClosed:
+		s.Status = "closed"
+	}
+	if pm.startError != nil {
+		s.Status = "failed"
+		s.Error = pm.startError.Error()
+	}
+	return s
+}
+
 func (pm *PluginManager) Close() error {
 	pm.Lock()
 	if pm.status == statusClosing {
@@ -273,6 +313,56 @@ func (pm *PluginManager) GetInfoByKey(apikey string) (*run.Info, error) {
 
 }
 
+// add inserts a started plugin into the plugin map. Requests that its router doesn't handle are passed
+// to the plugin that comes before it in the overlay. The manager must be locked.
+func (pm *PluginManager) add(p *Plugin) {
+	pm.Plugins[p.Name] = &pluginElement{
+		Plugin: p,
+		Next:   "none",
+	}
+	if p.Mux != nil {
+		pname := p.Name
+		next := func(w http.ResponseWriter, r *http.Request) {
+			pm.RLock()
+			h := pm.overlay("none")
+			if elem, ok := pm.Plugins[pname]; ok {
+				h = pm.overlay(elem.Next)
+			}
+			pm.RUnlock()
+			h.ServeHTTP(w, r)
+		}
+		p.Mux.NotFound(next)
+		p.Mux.MethodNotAllowed(next)
+	}
+}
+
+// link sets up the overlay from the plugin order: each plugin with a router overlays the ones before it.
+// The manager must be locked.
+func (pm *PluginManager) link() {
+	pm.start = "none"
+	for _, pname := range pm.order {
+		elem, ok := pm.Plugins[pname]
+		if !ok {
+			continue
+		}
+		elem.Next = pm.start
+		if elem.Plugin.Mux != nil {
+			pm.start = pname
+		}
+	}
+}
+
+// overlay returns the handler that starts the overlay at the given plugin. The manager must be read locked.
+func (pm *PluginManager) overlay(pname string) http.Handler {
+	if elem, ok := pm.Plugins[pname]; ok && elem.Plugin.Mux != nil {
+		return elem.Plugin.Mux
+	}
+	if pm.ObjectManager == nil {
+		return pm.Handler
+	}
+	return pm.ObjectManager
+}
+
 func (pm *PluginManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := rest.CTX(r)
 	pm.RLock()
@@ -298,23 +388,22 @@ func (pm *PluginManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		if overlay[0] == "next" {
 			// The overlay is next, so find which plugin we're coming from
-			serveKey = pm.Plugins[ctx.Plugin].Next
+			if elem, ok := pm.Plugins[ctx.Plugin]; ok {
+				serveKey = elem.Next
+			}
 
 		}
 	}
 
 	// The object manager gives the full API, with all objects well-defined
 	if serveKey == "none" {
-		var sm http.Handler = pm.ObjectManager
-		if sm == nil {
-			sm = pm.Handler
-		}
+		sm := pm.overlay("none")
 		pm.RUnlock()
 		sm.ServeHTTP(w, r)
 		return
 	}
 	// If serveKey is not none, serve the given plugin
-	pmux := pm.Plugins[pm.start].Plugin.Mux
+	pmux := pm.overlay(pm.start)
 	pm.RUnlock()
 
 	// Delete the overlay header if we're going to pass through plugins
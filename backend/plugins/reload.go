@@ -0,0 +1,135 @@
+package plugins
+
+import (
+	"errors"
+	"time"
+
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/sirupsen/logrus"
+)
+
+// drainTimeout is how long a reload waits for the requests to a plugin to finish before stopping it
+const drainTimeout = 30 * time.Second
+
+// Reload applies the current configuration of the assets, which was changed from the given old configuration,
+// without restarting heedy. Only the plugins whose configuration changed are restarted: the requests that they are
+// handling are drained before they are closed, and they are started again in the order of the new configuration.
+// Requests to the rest of heedy are answered throughout.
+func (pm *PluginManager) Reload(old *assets.Configuration) (err error) {
+	pm.Lock()
+	if pm.status != statusReady {
+		pm.Unlock()
+		return errors.New("loading: heedy is currently loading plugins")
+	}
+	if pm.reloading {
+		pm.Unlock()
+		return errors.New("reloading: heedy is already reloading")
+	}
+	pm.reloading = true
+	pm.startError = nil
+	pm.Unlock()
+	defer func() {
+		pm.Lock()
+		pm.reloading = false
+		if err != nil {
+			pm.startError = err
+		}
+		pm.Unlock()
+	}()
+
+	a := pm.ADB.Assets()
+	active := a.GetConfig().GetActivePlugins()
+	names := assets.ChangedPlugins(old, a.GetConfig())
+	changed := make(map[string]bool)
+	for _, pname := range names {
+		changed[pname] = true
+	}
+
+	// Stop the changed plugins in the reverse order of creation, removing each from the overlay
+	// before closing it, so that new requests no longer reach it
+	pm.RLock()
+	order := append([]string{}, pm.order...)
+	pm.RUnlock()
+	for i := len(order) - 1; i >= 0; i-- {
+		pname := order[i]
+		if !changed[pname] {
+			continue
+		}
+		pm.Lock()
+		elem, ok := pm.Plugins[pname]
+		delete(pm.Plugins, pname)
+		pm.setOrder(order)
+		pm.Unlock()
+		if !ok {
+			continue
+		}
+		logrus.Infof("Stopping plugin %s", pname)
+		if !elem.Plugin.Drain(drainTimeout) {
+			logrus.Warnf("Requests to plugin %s did not finish in %s, stopping it anyway", pname, drainTimeout)
+		}
+		if cerr := elem.Plugin.Close(); cerr != nil {
+			logrus.Errorf("Failed to stop plugin %s: %v", pname, cerr)
+		}
+	}
+
+	started := []*Plugin{}
+	for _, pname := range active {
+		if !changed[pname] {
+			continue
+		}
+		logrus.Infof("Starting plugin %s", pname)
+		p, err := NewPlugin(pm.ADB, pm.RunManager, pm.server, pname)
+		if err != nil {
+			return err
+		}
+		if err = p.Start(); err != nil {
+			p.Close()
+			return err
+		}
+		pm.Lock()
+		pm.add(p)
+		pm.setOrder(active)
+		pm.Unlock()
+		started = append(started, p)
+	}
+
+	// The object routes are recreated, since they forward to the runners of the restarted plugins,
+	// and object types may have been added or removed
+	sm, err := NewObjectManager(a, pm.RunManager, pm.Handler)
+	if err != nil {
+		return err
+	}
+	if err = sm.PreparePlugin(""); err != nil {
+		return err
+	}
+	for _, pname := range active {
+		if err = sm.PreparePlugin(pname); err != nil {
+			return err
+		}
+	}
+	pm.Lock()
+	pm.ObjectManager = sm
+	pm.Unlock()
+
+	for _, p := range started {
+		if err = p.AfterStart(); err != nil {
+			return err
+		}
+	}
+	if len(names) > 0 {
+		logrus.Infof("Reloaded plugins %v", names)
+	}
+	return nil
+}
+
+// setOrder sets the plugin order to the running plugins in the given order, and relinks the overlay.
+// The manager must be locked.
+func (pm *PluginManager) setOrder(order []string) {
+	pm.order = []string{}
+	for _, pname := range order {
+		if _, ok := pm.Plugins[pname]; ok {
+			pm.order = append(pm.order, pname)
+		}
+	}
+	pm.link()
+}
@@ -87,8 +87,33 @@ func (ah *APIHandler) Run(i *Info) error {
 	if ah.M.DB.Verbose {
 		logrus.Debugf("PATCH %s", *ah.V.API)
 	}
-	_, err := Request(ah.H, "PATCH", "", i, nil)
-	return err
+	b, err := Request(ah.H, "PATCH", "", i, nil)
+	if err != nil {
+		return err
+	}
+	// Runtypes can respond with the status of the finished process
+	var sm StatusMessage
+	if json.Unmarshal(b.Bytes(), &sm) != nil {
+		return nil
+	}
+	return exitError(sm)
+}
+
+// Status asks the runtype's API for the state of the given runner. Runtypes that don't support
+// status queries are assumed to keep their runners running.
+func (ah *APIHandler) Status(apikey string) StatusMessage {
+	if err := ah.setup(); err != nil {
+		return StatusMessage{Status: StatusRunning}
+	}
+	b, err := Request(ah.H, "GET", "/"+url.PathEscape(apikey), nil, nil)
+	if err != nil {
+		return StatusMessage{Status: StatusRunning}
+	}
+	var sm StatusMessage
+	if err = json.Unmarshal(b.Bytes(), &sm); err != nil || sm.Status == "" {
+		return StatusMessage{Status: StatusRunning}
+	}
+	return sm
 }
 
 func (ah *APIHandler) Stop(apikey string) error {
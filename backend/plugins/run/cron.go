@@ -0,0 +1,175 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrJobRunning is returned when triggering a cron job whose previous run is not yet done
+var ErrJobRunning = errors.New("job_running: the job is already running")
+
+// CronJob gives the state of a runner with a cron schedule
+type CronJob struct {
+	Plugin string `json:"plugin"`
+	Name   string `json:"name"`
+
+	// The schedule that the job currently runs on, and the one from its configuration,
+	// which differ if the schedule was changed at runtime
+	Schedule        string `json:"schedule"`
+	DefaultSchedule string `json:"default_schedule"`
+
+	Enabled bool       `json:"enabled"`
+	Running bool       `json:"running"`
+	Next    *time.Time `json:"next,omitempty"`
+	Prev    *time.Time `json:"prev,omitempty"`
+
+	// The most recent run of the job
+	Last *Job `json:"last,omitempty"`
+}
+
+// CronJobUpdate holds the changes to make to a cron job
+type CronJobUpdate struct {
+	Enabled *bool `json:"enabled,omitempty"`
+	// Schedule overrides the job's schedule until heedy restarts. An empty string restores
+	// the schedule from the configuration.
+	Schedule *string `json:"schedule,omitempty"`
+}
+
+// schedule returns the schedule the runner is currently using. The manager must be locked.
+func (r *Runner) schedule() string {
+	if r.scheduleOverride != "" {
+		return r.scheduleOverride
+	}
+	return *r.I.Run.Cron
+}
+
+// findJob returns the runner of the given cron job. The manager must be locked.
+func (m *Manager) findJob(plugin, name string) (*Runner, error) {
+	for _, r := range m.Runners {
+		if r.I.Plugin == plugin && r.I.Name == name && r.I.Run != nil && r.I.Run.Cron != nil {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("not_found: no cron job %s:%s", plugin, name)
+}
+
+func (m *Manager) cronJob(r *Runner) CronJob {
+	j := CronJob{
+		Plugin:          r.I.Plugin,
+		Name:            r.I.Name,
+		Schedule:        r.schedule(),
+		DefaultSchedule: *r.I.Run.Cron,
+		Enabled:         !r.paused,
+		Running:         r.running,
+	}
+	if !r.paused {
+		if e := m.cron.Entry(r.cid); e.Valid() && !e.Next.IsZero() {
+			next := e.Next
+			j.Next = &next
+		}
+	}
+	if jobs := m.jobs.get(r.I.Plugin, r.I.Name); len(jobs) > 0 {
+		j.Last = &jobs[0]
+		prev := jobs[0].Started
+		j.Prev = &prev
+	}
+	return j
+}
+
+// CronJobs returns the state of all cron jobs, sorted by plugin and name
+func (m *Manager) CronJobs() []CronJob {
+	m.RLock()
+	defer m.RUnlock()
+	jobs := []CronJob{}
+	for _, r := range m.Runners {
+		if r.I.Run != nil && r.I.Run.Cron != nil {
+			jobs = append(jobs, m.cronJob(r))
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Plugin == jobs[j].Plugin {
+			return jobs[i].Name < jobs[j].Name
+		}
+		return jobs[i].Plugin < jobs[j].Plugin
+	})
+	return jobs
+}
+
+// GetCronJob returns the state of the given cron job
+func (m *Manager) GetCronJob(plugin, name string) (*CronJob, error) {
+	m.RLock()
+	defer m.RUnlock()
+	r, err := m.findJob(plugin, name)
+	if err != nil {
+		return nil, err
+	}
+	j := m.cronJob(r)
+	return &j, nil
+}
+
+// TriggerCronJob starts a run of the given cron job right away, even if it is paused
+func (m *Manager) TriggerCronJob(plugin, name string) error {
+	m.RLock()
+	r, err := m.findJob(plugin, name)
+	running := err == nil && r.running
+	m.RUnlock()
+	if err != nil {
+		return err
+	}
+	if running {
+		return ErrJobRunning
+	}
+	go r.Run()
+	return nil
+}
+
+// UpdateCronJob pauses, resumes or reschedules the given cron job. The changes only last until
+// heedy is restarted.
+func (m *Manager) UpdateCronJob(plugin, name string, u *CronJobUpdate) error {
+	var schedule cron.Schedule
+	if u.Schedule != nil && *u.Schedule != "" {
+		s, err := cron.ParseStandard(*u.Schedule)
+		if err != nil {
+			return fmt.Errorf("bad_request: invalid schedule: %w", err)
+		}
+		schedule = s
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	r, err := m.findJob(plugin, name)
+	if err != nil {
+		return err
+	}
+	if u.Schedule != nil {
+		r.scheduleOverride = *u.Schedule
+		if schedule == nil {
+			// Restoring the configured schedule, which was validated along with the configuration
+			if schedule, err = cron.ParseStandard(*r.I.Run.Cron); err != nil {
+				return err
+			}
+		}
+	}
+	if u.Enabled != nil {
+		r.paused = !*u.Enabled
+	}
+
+	// The job is removed and added again to use the new schedule
+	m.cron.Remove(r.cid)
+	r.cid = 0
+	if !r.paused {
+		if schedule == nil {
+			if schedule, err = cron.ParseStandard(r.schedule()); err != nil {
+				return err
+			}
+		}
+		r.cid = m.cron.Schedule(schedule, r)
+	}
+	logrus.Debugf("Cron job %s:%s: enabled=%v schedule=%s", plugin, name, !r.paused, r.schedule())
+	return nil
+}
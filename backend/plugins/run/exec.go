@@ -18,10 +18,12 @@ import (
 
 type Cmd struct {
 	Cmd       *exec.Cmd
+	Sandbox   *Sandbox
 	done      bool
 	iswaiting bool
 	sync.Mutex
-	waiter chan error
+	waiter     chan error
+	violations []string
 }
 
 func (c *Cmd) Wait() error {
@@ -36,8 +38,11 @@ func (c *Cmd) Wait() error {
 	}
 
 	err := c.Cmd.Wait()
+	FlushLogs(c.Cmd)
+	violations := c.Sandbox.Exited(c.Cmd.ProcessState)
 	c.Lock()
 	c.done = true
+	c.violations = violations
 	c.Unlock()
 	c.waiter <- err
 	return err
@@ -49,6 +54,22 @@ func (c *Cmd) Done() bool {
 	return c.done
 }
 
+// Status returns the current status of the command, along with its exit code once it has exited
+func (c *Cmd) Status() StatusMessage {
+	c.Lock()
+	done, violations := c.done, c.violations
+	c.Unlock()
+	if !done {
+		return StatusMessage{Status: StatusRunning, Violations: c.Sandbox.Violations()}
+	}
+	sm := StatusMessage{Status: StatusExited, Violations: violations}
+	if c.Cmd.ProcessState != nil {
+		code := c.Cmd.ProcessState.ExitCode()
+		sm.ExitCode = &code
+	}
+	return sm
+}
+
 func NewCmd(c *exec.Cmd) *Cmd {
 	return &Cmd{
 		Cmd:    c,
@@ -115,12 +136,15 @@ func (e *ExecHandler) Start(i *Info) (http.Handler, error) {
 
 	// Now set up the process
 	cmd := exec.Command(cmds[0], cmds[1:]...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	AttachLogs(i, cmd)
 	cmd.Dir = i.PluginDir
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setpgid: true,
 	}
+	sb := NewSandbox(i)
+	if err := sb.Prepare(cmd); err != nil {
+		return nil, err
+	}
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return nil, err
@@ -131,20 +155,23 @@ func (e *ExecHandler) Start(i *Info) (http.Handler, error) {
 		return nil, err
 	}
 
-	if err = cmd.Start(); err != nil {
+	if err = sb.Start(cmd); err != nil {
 		return nil, err
 	}
 	_, err = stdin.Write(infobytes)
 	if err == nil {
 		_, err = stdin.Write([]byte{'\n'})
 	}
-	if err != nil {
+	// A process that exits right away closes its stdin before the info is written, which
+	// is not an error here - its exit status is reported like that of any other process
+	if err != nil && !errors.Is(err, syscall.EPIPE) {
 		// Kill the process if can't write to stdin
 		cmd.Process.Kill()
 		return nil, err
 	}
 
 	c := NewCmd(cmd)
+	c.Sandbox = sb
 	go c.Wait()
 	e.Lock()
 	e.Cmd[i.APIKey] = c
@@ -177,7 +204,16 @@ func (e *ExecHandler) Run(i *Info) error {
 	if !ok {
 		return errors.New("Exec failed to retrieve command")
 	}
-	return cmd.Wait()
+	err = cmd.Wait()
+	e.Lock()
+	if e.Cmd[i.APIKey] == cmd {
+		delete(e.Cmd, i.APIKey)
+	}
+	e.Unlock()
+	if ee := exitError(cmd.Status()); ee != nil {
+		return ee
+	}
+	return err
 }
 
 func (e *ExecHandler) Stop(apikey string) error {
@@ -189,7 +225,7 @@ func (e *ExecHandler) Stop(apikey string) error {
 	}
 	cmd.Cmd.Process.Signal(os.Interrupt)
 
-	d := assets.Get().Config.GetRunTimeout()
+	d := assets.Get().GetConfig().GetRunTimeout()
 
 	sleepDuration := 50 * time.Millisecond
 	for i := time.Duration(0); i < d; i += sleepDuration {
@@ -202,6 +238,18 @@ func (e *ExecHandler) Stop(apikey string) error {
 	return e.Kill(apikey)
 }
 
+// Status returns whether the process started with the given api key is still running,
+// and its exit code if it has exited
+func (e *ExecHandler) Status(apikey string) StatusMessage {
+	e.Lock()
+	cmd, ok := e.Cmd[apikey]
+	e.Unlock()
+	if !ok {
+		return StatusMessage{Status: StatusStopped}
+	}
+	return cmd.Status()
+}
+
 func (e *ExecHandler) Kill(apikey string) error {
 	e.Lock()
 	cmd, ok := e.Cmd[apikey]
@@ -0,0 +1,183 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The number of past runs kept for each cron job
+	jobHistoryLength = 20
+	// The amount of output kept for each run. Only the end of longer output is kept.
+	maxJobOutput = 4 << 10
+)
+
+// The possible results of a job
+const (
+	JobRunning = "running"
+	JobSuccess = "success"
+	JobError   = "error"
+)
+
+// ExitError is returned by runtypes' Run when the process exited with an error
+type ExitError struct {
+	ExitCode   int
+	Violations []string
+}
+
+func (e *ExitError) Error() string {
+	if len(e.Violations) > 0 {
+		return fmt.Sprintf("exited with code %d after exceeding its sandbox limits (%s)", e.ExitCode, strings.Join(e.Violations, ", "))
+	}
+	return fmt.Sprintf("exited with code %d", e.ExitCode)
+}
+
+// exitError returns an ExitError if the given status is of a process that failed
+func exitError(sm StatusMessage) error {
+	if sm.ExitCode == nil || *sm.ExitCode == 0 && len(sm.Violations) == 0 {
+		return nil
+	}
+	return &ExitError{ExitCode: *sm.ExitCode, Violations: sm.Violations}
+}
+
+// Job is a single run of a runner with a cron schedule
+type Job struct {
+	Plugin     string    `json:"plugin"`
+	Name       string    `json:"name"`
+	Started    time.Time `json:"started"`
+	Duration   float64   `json:"duration"`
+	Status     string    `json:"status"`
+	ExitCode   *int      `json:"exit_code,omitempty"`
+	Violations []string  `json:"violations,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Output     string    `json:"output"`
+
+	out *jobOutput
+}
+
+// jobOutput holds the end of a job's output
+type jobOutput struct {
+	sync.Mutex
+	b         []byte
+	truncated bool
+}
+
+func (o *jobOutput) Write(p []byte) (int, error) {
+	o.Lock()
+	defer o.Unlock()
+	o.b = append(o.b, p...)
+	if len(o.b) > maxJobOutput {
+		o.b = append(o.b[:0], o.b[len(o.b)-maxJobOutput:]...)
+		o.truncated = true
+	}
+	return len(p), nil
+}
+
+func (o *jobOutput) String() string {
+	o.Lock()
+	defer o.Unlock()
+	if o.truncated {
+		return "...\n" + string(o.b)
+	}
+	return string(o.b)
+}
+
+var (
+	outputLock sync.Mutex
+	// The outputs of currently running jobs, by the runner's api key, so that
+	// the output of processes started for the job is captured
+	jobOutputs = make(map[string]*jobOutput)
+)
+
+func getJobOutput(apikey string) *jobOutput {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	return jobOutputs[apikey]
+}
+
+// jobHistory holds the most recent jobs of each runner
+type jobHistory struct {
+	sync.Mutex
+	jobs map[string][]*Job
+}
+
+func (h *jobHistory) start(i *Info) *Job {
+	j := &Job{
+		Plugin:  i.Plugin,
+		Name:    i.Name,
+		Started: time.Now(),
+		Status:  JobRunning,
+		out:     &jobOutput{},
+	}
+	outputLock.Lock()
+	jobOutputs[i.APIKey] = j.out
+	outputLock.Unlock()
+
+	key := i.Plugin + ":" + i.Name
+	h.Lock()
+	defer h.Unlock()
+	jobs := append(h.jobs[key], j)
+	if len(jobs) > jobHistoryLength {
+		jobs = jobs[len(jobs)-jobHistoryLength:]
+	}
+	h.jobs[key] = jobs
+	return j
+}
+
+func (h *jobHistory) finish(i *Info, j *Job, err error) {
+	outputLock.Lock()
+	delete(jobOutputs, i.APIKey)
+	outputLock.Unlock()
+
+	h.Lock()
+	defer h.Unlock()
+	j.Duration = time.Since(j.Started).Seconds()
+	j.Output = j.out.String()
+	j.out = nil
+	if err == nil {
+		j.Status = JobSuccess
+		return
+	}
+	j.Status = JobError
+	var ee *ExitError
+	if errors.As(err, &ee) {
+		j.ExitCode = &ee.ExitCode
+		j.Violations = ee.Violations
+	}
+	j.Error = err.Error()
+}
+
+// get returns copies of the given plugin's jobs, most recent first. An empty name returns the jobs of all runners.
+func (h *jobHistory) get(plugin, name string) []Job {
+	h.Lock()
+	defer h.Unlock()
+	res := []Job{}
+	for _, jobs := range h.jobs {
+		for _, j := range jobs {
+			if j.Plugin != plugin || name != "" && j.Name != name {
+				continue
+			}
+			jc := *j
+			if j.out != nil {
+				jc.Output = j.out.String()
+				jc.Duration = time.Since(j.Started).Seconds()
+				jc.out = nil
+			}
+			res = append(res, jc)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Started.After(res[j].Started)
+	})
+	return res
+}
+
+// Jobs returns the recent runs of the given plugin's cron jobs, most recent first.
+// If name is not empty, only runs of the runner with that name are returned.
+func (m *Manager) Jobs(plugin, name string) []Job {
+	return m.jobs.get(plugin, name)
+}
@@ -0,0 +1,45 @@
+package run
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobHistory(t *testing.T) {
+	h := &jobHistory{jobs: make(map[string][]*Job)}
+	i := &Info{Plugin: "myplugin", Name: "job", APIKey: "key"}
+
+	j := h.start(i)
+	getJobOutput("key").Write([]byte("hello\n"))
+	jobs := h.get("myplugin", "")
+	require.Len(t, jobs, 1)
+	require.Equal(t, JobRunning, jobs[0].Status)
+	require.Equal(t, "hello\n", jobs[0].Output)
+	h.finish(i, j, &ExitError{ExitCode: 3})
+	require.Nil(t, getJobOutput("key"))
+
+	j = h.start(i)
+	getJobOutput("key").Write([]byte(strings.Repeat("a", maxJobOutput+10)))
+	h.finish(i, j, nil)
+
+	jobs = h.get("myplugin", "job")
+	require.Len(t, jobs, 2)
+	require.Equal(t, JobSuccess, jobs[0].Status)
+	require.True(t, strings.HasPrefix(jobs[0].Output, "...\n"))
+	require.Len(t, jobs[0].Output, maxJobOutput+4)
+	require.Equal(t, JobError, jobs[1].Status)
+	require.Equal(t, 3, *jobs[1].ExitCode)
+	require.Equal(t, "exited with code 3", jobs[1].Error)
+
+	for k := 0; k < jobHistoryLength; k++ {
+		h.finish(i, h.start(i), errors.New("failed"))
+	}
+	jobs = h.get("myplugin", "job")
+	require.Len(t, jobs, jobHistoryLength)
+	require.Nil(t, jobs[0].ExitCode)
+	require.Len(t, h.get("myplugin", "other"), 0)
+	require.Len(t, h.get("otherplugin", ""), 0)
+}
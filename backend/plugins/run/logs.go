@@ -0,0 +1,259 @@
+package run
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"sync"
+	"time"
+)
+
+const (
+	// Size after which a plugin's log file is rotated
+	maxLogSize = 10 << 20
+	// Number of rotated log files kept for each plugin
+	maxLogFiles = 3
+	// Lines longer than this are split
+	maxLogLine = 64 << 10
+	// Number of lines buffered for each follower of a log
+	logFollowBuffer = 256
+)
+
+// PluginLog is the log file shared by all of a plugin's processes. It is rotated once it grows
+// past maxLogSize, keeping the last maxLogFiles files as <plugin>.log.1, <plugin>.log.2, etc.
+type PluginLog struct {
+	sync.Mutex
+	Path string
+
+	f         *os.File
+	size      int64
+	followers map[chan []byte]struct{}
+}
+
+var (
+	logLock    sync.Mutex
+	pluginLogs = make(map[string]*PluginLog)
+)
+
+// LogPath returns the path to the log file of the given plugin
+func LogPath(dataDir, plugin string) string {
+	return path.Join(dataDir, "logs", plugin+".log")
+}
+
+// GetPluginLog returns the log of the given plugin
+func GetPluginLog(dataDir, plugin string) *PluginLog {
+	p := LogPath(dataDir, plugin)
+	logLock.Lock()
+	defer logLock.Unlock()
+	l, ok := pluginLogs[p]
+	if !ok {
+		l = &PluginLog{
+			Path:      p,
+			followers: make(map[chan []byte]struct{}),
+		}
+		pluginLogs[p] = l
+	}
+	return l
+}
+
+// AttachLogs sends the command's stdout and stderr to its plugin's log, as well as to
+// heedy's own output, with each line tagged by the plugin and runner names. The output of
+// cron jobs is also saved with the job.
+func AttachLogs(i *Info, cmd *exec.Cmd) {
+	l := GetPluginLog(i.DataDir, i.Plugin)
+	tag := i.Plugin + ":" + i.Name
+	var stdout, stderr io.Writer = os.Stdout, os.Stderr
+	if o := getJobOutput(i.APIKey); o != nil {
+		// The process is run as a cron job, whose output is also kept in the job's history
+		stdout, stderr = io.MultiWriter(stdout, o), io.MultiWriter(stderr, o)
+	}
+	cmd.Stdout = &logWriter{l: l, tag: "[" + tag + "] ", out: stdout}
+	cmd.Stderr = &logWriter{l: l, tag: "[" + tag + " stderr] ", out: stderr}
+}
+
+// FlushLogs writes out any partial last line that the command wrote before exiting
+func FlushLogs(cmd *exec.Cmd) {
+	for _, w := range []io.Writer{cmd.Stdout, cmd.Stderr} {
+		if lw, ok := w.(*logWriter); ok {
+			lw.Flush()
+		}
+	}
+}
+
+func (l *PluginLog) open() error {
+	if l.f != nil {
+		return nil
+	}
+	if err := os.MkdirAll(path.Dir(l.Path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f = f
+	l.size = s.Size()
+	return nil
+}
+
+func (l *PluginLog) rotate() error {
+	l.f.Close()
+	l.f = nil
+	for i := maxLogFiles - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.Path, i), fmt.Sprintf("%s.%d", l.Path, i+1))
+	}
+	if err := os.Rename(l.Path, l.Path+".1"); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+// Write adds a single line to the log, and sends it to all followers
+func (l *PluginLog) Write(line []byte) error {
+	l.Lock()
+	defer l.Unlock()
+	err := l.open()
+	if err == nil && l.size+int64(len(line)) > maxLogSize && l.size > 0 {
+		err = l.rotate()
+	}
+	if err != nil {
+		return err
+	}
+	n, err := l.f.Write(line)
+	l.size += int64(n)
+
+	for c := range l.followers {
+		select {
+		case c <- line:
+		default:
+			// The follower isn't keeping up, so it is disconnected rather than holding up the plugin
+			delete(l.followers, c)
+			close(c)
+		}
+	}
+	return err
+}
+
+// Follow returns the last n lines of the log, and a channel to which all new lines are sent.
+// The channel is closed when stop is called, or if the follower doesn't keep up.
+func (l *PluginLog) Follow(n int) (tail []byte, lines chan []byte, stop func(), err error) {
+	l.Lock()
+	defer l.Unlock()
+	tail, err = l.tail(n)
+	if err != nil {
+		return
+	}
+	c := make(chan []byte, logFollowBuffer)
+	l.followers[c] = struct{}{}
+	stop = func() {
+		l.Lock()
+		defer l.Unlock()
+		if _, ok := l.followers[c]; ok {
+			delete(l.followers, c)
+			close(c)
+		}
+	}
+	return tail, c, stop, nil
+}
+
+// Tail returns the last n lines of the log
+func (l *PluginLog) Tail(n int) ([]byte, error) {
+	l.Lock()
+	defer l.Unlock()
+	return l.tail(n)
+}
+
+func (l *PluginLog) tail(n int) ([]byte, error) {
+	f, err := os.Open(l.Path)
+	if os.IsNotExist(err) {
+		return []byte{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Read backwards in chunks until there are enough lines
+	const chunkSize = 32 << 10
+	end := s.Size()
+	buf := []byte{}
+	for end > 0 && bytes.Count(buf, []byte{'\n'}) <= n {
+		start := end - chunkSize
+		if start < 0 {
+			start = 0
+		}
+		chunk := make([]byte, end-start)
+		if _, err = f.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return nil, err
+		}
+		buf = append(chunk, buf...)
+		end = start
+	}
+
+	// Skip all but the last n lines
+	for c := bytes.Count(buf, []byte{'\n'}); c > n; c-- {
+		buf = buf[bytes.IndexByte(buf, '\n')+1:]
+	}
+	return buf, nil
+}
+
+// logWriter splits a process' output into lines, tagging each before writing it to the log
+type logWriter struct {
+	sync.Mutex
+	l   *PluginLog
+	tag string
+	out io.Writer
+	buf []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			if len(w.buf) < maxLogLine {
+				break
+			}
+			i = maxLogLine - 1
+		}
+		w.writeLine(w.buf[:i+1])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes out any partial line
+func (w *logWriter) Flush() {
+	w.Lock()
+	defer w.Unlock()
+	if len(w.buf) > 0 {
+		w.writeLine(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *logWriter) writeLine(b []byte) {
+	line := make([]byte, 0, len(w.tag)+len(b)+22)
+	line = append(line, time.Now().UTC().Format(time.RFC3339)...)
+	line = append(line, ' ')
+	line = append(line, w.tag...)
+	line = append(line, bytes.TrimRight(b, "\n")...)
+	line = append(line, '\n')
+	w.out.Write(line)
+	// The process' output must not be held up by failing to write logs, so errors are ignored
+	w.l.Write(line)
+}
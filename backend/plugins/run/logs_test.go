@@ -0,0 +1,43 @@
+package run
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPluginLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heedy-logs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	i := &Info{Plugin: "myplugin", Name: "server", DataDir: dir}
+	cmd := exec.Command("sh", "-c", "echo hello; echo world >&2; printf partial")
+	AttachLogs(i, cmd)
+
+	l := GetPluginLog(dir, "myplugin")
+	_, lines, stop, err := l.Follow(0)
+	require.NoError(t, err)
+	defer stop()
+
+	require.NoError(t, cmd.Run())
+	FlushLogs(cmd)
+
+	b, err := l.Tail(10)
+	require.NoError(t, err)
+	out := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, out, 3)
+	require.Contains(t, string(b), "[myplugin:server] hello\n")
+	require.Contains(t, string(b), "[myplugin:server stderr] world\n")
+	require.True(t, strings.HasSuffix(out[2], "[myplugin:server] partial"))
+
+	b, err = l.Tail(1)
+	require.NoError(t, err)
+	require.Equal(t, out[2]+"\n", string(b))
+
+	require.Len(t, lines, 3)
+}
@@ -9,7 +9,9 @@ import (
 	"path"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/robfig/cron/v3"
 	"github.com/sirupsen/logrus"
 
@@ -27,6 +29,10 @@ type Info struct {
 	DataDir   string                `json:"data_dir"`
 	PluginDir string                `json:"plugin_dir"`
 	Config    *assets.Configuration `json:"config"`
+
+	// APISocket is the unix socket on which heedy's API can be reached. It is only set for
+	// processes that run without network access, which can't connect to heedy's port.
+	APISocket string `json:"api_socket,omitempty"`
 }
 
 type TypeHandler interface {
@@ -43,17 +49,62 @@ type Runner struct {
 
 	m   *Manager
 	cid cron.EntryID
+
+	// The supervisor's state, protected by the manager's lock
+	started    time.Time
+	exited     time.Time
+	restarts   int
+	restarting bool
+	failed     bool
+
+	// The cron job's state, also protected by the manager's lock
+	running          bool
+	paused           bool
+	scheduleOverride string
+}
+
+// ServeHTTP forwards the request to the runner's current handler, which changes when the runner is restarted
+func (r *Runner) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.m.RLock()
+	h := r.Handler
+	r.m.RUnlock()
+	if h == nil {
+		rest.WriteJSONError(w, req, http.StatusServiceUnavailable, fmt.Errorf("plugin_error: %s:%s is not running", r.I.Plugin, r.I.Name))
+		return
+	}
+	h.ServeHTTP(w, req)
 }
 
 func (r *Runner) Run() {
+	// Jobs can also be triggered manually, so runs are skipped here too if the previous one isn't done
+	r.m.Lock()
+	if r.running {
+		r.m.Unlock()
+		logrus.Warnf("%s: Skipping cron job %s, since it is still running", r.I.Plugin, r.I.Name)
+		return
+	}
+	r.running = true
+	r.m.Unlock()
+	defer func() {
+		r.m.Lock()
+		r.running = false
+		r.m.Unlock()
+	}()
+
 	logrus.Debugf("%s: Running cron job %s", r.I.Plugin, r.I.Name)
 
+	j := r.m.jobs.start(r.I)
+	timer := prometheus.NewTimer(cronDuration.WithLabelValues(r.I.Plugin, r.I.Name))
 	rt := r.m.RunTypes[*r.I.Run.Type]
 	err := rt.Run(r.I)
+	timer.ObserveDuration()
+	r.m.jobs.finish(r.I, j, err)
 	if err != nil {
+		cronRuns.WithLabelValues(r.I.Plugin, r.I.Name, "error").Inc()
 		logrus.Errorf("%s:%s %s", r.I.Plugin, r.I.Name, err)
 		return
 	}
+	cronRuns.WithLabelValues(r.I.Plugin, r.I.Name, "success").Inc()
 }
 
 type Manager struct {
@@ -68,6 +119,11 @@ type Manager struct {
 	CoreKey string
 
 	cron *cron.Cron
+	jobs *jobHistory
+
+	killed bool
+	// done is closed when the manager is killed, stopping the supervisor
+	done chan struct{}
 }
 
 func NewManager(db *database.AdminDB) *Manager {
@@ -97,7 +153,7 @@ func NewManager(db *database.AdminDB) *Manager {
 			HeedyDir:  a.FolderPath,
 			DataDir:   a.DataDir(),
 			PluginDir: a.FolderPath,
-			Config:    a.Config,
+			Config:    a.GetConfig(),
 		},
 	}
 
@@ -107,11 +163,13 @@ func NewManager(db *database.AdminDB) *Manager {
 		RunTypes: runtypes,
 		Runners:  runners,
 		cron:     c,
+		jobs:     &jobHistory{jobs: make(map[string][]*Job)},
 		CoreKey:  apikey,
 		DB:       db,
+		done:     make(chan struct{}),
 	}
 
-	for rt, v := range db.Assets().Config.RunTypes {
+	for rt, v := range db.Assets().GetConfig().RunTypes {
 		var handler TypeHandler
 		if v.API == nil {
 			// These are runtypes built into heedy's core
@@ -131,6 +189,8 @@ func NewManager(db *database.AdminDB) *Manager {
 		runtypes[rt] = handler
 	}
 
+	go m.supervise()
+
 	return m
 }
 
@@ -165,7 +225,10 @@ func (m *Manager) Start(plugin, name string, run *assets.Run) error {
 		HeedyDir:  a.FolderPath,
 		DataDir:   a.DataDir(),
 		PluginDir: path.Join(a.PluginDir(), plugin),
-		Config:    a.Config,
+		Config:    a.GetConfig(),
+	}
+	if run.Sandbox != nil && !run.Sandbox.GetNetwork() {
+		i.APISocket = APISocket(i.DataDir)
 	}
 
 	r := &Runner{
@@ -183,19 +246,10 @@ func (m *Manager) Start(plugin, name string, run *assets.Run) error {
 		if err != nil {
 			return err
 		}
-		r.Handler = h
-		if a.Config.Verbose {
-			r.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-				ctx := rest.CTX(req)
-				if ctx != nil {
-					ctx.Log.Debugf("Forwarding request to %s:%s%s", i.Plugin, i.Name, req.URL.Path)
-				} else {
-					logrus.Debugf("Forwarding request to %s:%s%s", i.Plugin, i.Name, req.URL.Path)
-				}
-
-				h.ServeHTTP(w, req)
-			})
-		}
+		m.Lock()
+		r.Handler = m.wrapHandler(i, h)
+		r.started = time.Now()
+		m.Unlock()
 	} else {
 		logrus.Debugf("Adding cron job %s:%s (%s)", i.Plugin, i.Name, *run.Cron)
 		r.cid, err = m.cron.AddJob(*run.Cron, r)
@@ -208,6 +262,23 @@ func (m *Manager) Start(plugin, name string, run *assets.Run) error {
 	return nil
 }
 
+// wrapHandler adds logging of forwarded requests to a runner's handler in verbose mode
+func (m *Manager) wrapHandler(i *Info, h http.Handler) http.Handler {
+	if h == nil || !m.DB.Assets().GetConfig().Verbose {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := rest.CTX(req)
+		if ctx != nil {
+			ctx.Log.Debugf("Forwarding request to %s:%s%s", i.Plugin, i.Name, req.URL.Path)
+		} else {
+			logrus.Debugf("Forwarding request to %s:%s%s", i.Plugin, i.Name, req.URL.Path)
+		}
+
+		h.ServeHTTP(w, req)
+	})
+}
+
 func (m *Manager) Find(plugin, name string) (*Runner, error) {
 	m.RLock()
 	defer m.RUnlock()
@@ -231,9 +302,14 @@ func (m *Manager) Stop(plugin, name string) error {
 		return fmt.Errorf("Cound not find active runner %s:%s", plugin, name)
 	}
 	delete(m.Runners, r.I.APIKey)
+	running := r.running
 	m.Unlock()
 	if r.I.Run.Cron != nil {
 		m.cron.Remove(r.cid)
+		if !running {
+			// A cron job only has a process while it is running
+			return nil
+		}
 	}
 	logrus.Debugf("Stopping %s:%s", r.I.Plugin, r.I.Name)
 	return m.RunTypes[*r.I.Run.Type].Stop(r.I.APIKey)
@@ -243,6 +319,11 @@ func (m *Manager) Stop(plugin, name string) error {
 func (m *Manager) Kill() error {
 	m.Lock()
 	defer m.Unlock()
+	if !m.killed {
+		m.killed = true
+		close(m.done)
+		m.cron.Stop()
+	}
 	for apikey, r := range m.Runners {
 		if r.I.Run != nil {
 			err := m.RunTypes[*r.I.Run.Type].Kill(apikey)
@@ -300,17 +381,22 @@ func (m *Manager) GetHandler(plugin, uri string) (http.Handler, error) {
 	if err != nil {
 		return nil, err
 	}
-	if r.Handler == nil {
-		err = errors.New("No handler found")
+	m.RLock()
+	h := r.Handler
+	m.RUnlock()
+	if h == nil {
+		return nil, errors.New("No handler found")
 	}
-	if err != nil || hpath == "/" {
-		return r.Handler, err
+	// The runner itself is returned as the handler, so that requests go to the new process
+	// if the runner is restarted
+	if hpath == "/" {
+		return r, nil
 	}
 	// We need to modify the path
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		// https://github.com/golang/go/commit/874a605af0764a8f340c3de65406963f514e21bc
 		req.URL.Path = singleJoiningSlash(hpath, req.URL.EscapedPath())
 		req.URL.RawPath = req.URL.Path
-		r.Handler.ServeHTTP(w, req)
+		r.ServeHTTP(w, req)
 	}), nil
 }
@@ -0,0 +1,54 @@
+package run
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	cronRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "heedy_cron_runs_total",
+		Help: "The number of times each cron job was run, by result",
+	}, []string{"plugin", "name", "result"})
+	cronDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "heedy_cron_run_duration_seconds",
+		Help:    "The time taken by each run of a cron job",
+		Buckets: []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900},
+	}, []string{"plugin", "name"})
+
+	runnerUpDesc = prometheus.NewDesc("heedy_runner_up",
+		"Whether each of the plugins' runners is currently running (1) or has exited (0)",
+		[]string{"plugin", "name", "type"}, nil)
+	cronJobsDesc = prometheus.NewDesc("heedy_cron_jobs",
+		"The number of scheduled cron jobs",
+		nil, nil)
+)
+
+// Describe implements prometheus.Collector, allowing the manager to report the state of plugin processes
+func (m *Manager) Describe(ch chan<- *prometheus.Desc) {
+	ch <- runnerUpDesc
+	ch <- cronJobsDesc
+}
+
+// Collect implements prometheus.Collector
+func (m *Manager) Collect(ch chan<- prometheus.Metric) {
+	m.RLock()
+	defer m.RUnlock()
+	cronJobs := 0
+	for apikey, r := range m.Runners {
+		if r.I.Run == nil {
+			// The heedy core
+			continue
+		}
+		if r.I.Run.Cron != nil {
+			cronJobs++
+			continue
+		}
+		up := 0.0
+		if m.runnerStatus(apikey, r).Status == StatusRunning {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(runnerUpDesc, prometheus.GaugeValue, up, r.I.Plugin, r.I.Name, *r.I.Run.Type)
+	}
+	ch <- prometheus.MustNewConstMetric(cronJobsDesc, prometheus.GaugeValue, float64(cronJobs))
+}
@@ -0,0 +1,108 @@
+package run
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/heedy/heedy/backend/assets"
+)
+
+// APISocket returns the unix socket on which heedy serves its API to plugin processes
+// that run without network access
+func APISocket(datadir string) string {
+	return filepath.Join(datadir, "heedy.sock")
+}
+
+// Sandbox restricts the environment, network access and resources available to a plugin's process,
+// as set up in the sandbox block of its run configuration. It does not restrict access to the filesystem:
+// the process can read and write any file that heedy can. All methods can be called on a nil Sandbox,
+// in which case the process is run unrestricted.
+type Sandbox struct {
+	I *Info
+	S *assets.Sandbox
+
+	// Dir is the private directory given to the process as its HOME and TMPDIR
+	Dir string
+
+	sync.Mutex
+	cgroup string
+}
+
+// NewSandbox returns the sandbox for the given runner, or nil if it has no sandbox configured
+func NewSandbox(i *Info) *Sandbox {
+	if i.Run == nil || i.Run.Sandbox == nil {
+		return nil
+	}
+	return &Sandbox{
+		I:   i,
+		S:   i.Run.Sandbox,
+		Dir: path.Join(i.DataDir, "sandbox", i.Plugin, i.Name),
+	}
+}
+
+// Prepare sets up the command's environment, working directory and network isolation.
+// It must be called before the command is started.
+func (s *Sandbox) Prepare(cmd *exec.Cmd) error {
+	if s == nil {
+		return nil
+	}
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+
+	// Only explicitly allowed environment variables are passed through to the process
+	env := []string{"HOME=" + s.Dir, "TMPDIR=" + s.Dir}
+	for _, k := range s.S.GetEnv() {
+		if v, ok := os.LookupEnv(k); ok {
+			env = append(env, k+"="+v)
+		}
+	}
+	cmd.Env = env
+
+	// The working directory is only where the process starts, it can still access files outside of it
+	if s.S.Dir != nil {
+		cmd.Dir = filepath.Join(s.I.PluginDir, *s.S.Dir)
+	}
+	return s.prepare(cmd)
+}
+
+// Start starts the command, and applies the sandbox's resource limits to the new process.
+// If the limits can't be applied, the process is killed.
+func (s *Sandbox) Start(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil || s == nil {
+		return err
+	}
+	if err := s.limit(cmd.Process.Pid); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		s.cleanup()
+		return err
+	}
+	return nil
+}
+
+// Violations returns the limits that the running process has hit so far
+func (s *Sandbox) Violations() []string {
+	if s == nil {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	return s.violations(nil)
+}
+
+// Exited returns the limits that were hit by the process that exited with the given state,
+// and releases the resources held by the sandbox.
+func (s *Sandbox) Exited(ps *os.ProcessState) []string {
+	if s == nil {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	v := s.violations(ps)
+	s.cleanup()
+	return v
+}
@@ -0,0 +1,232 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	cgroupMount = "/sys/fs/cgroup"
+	cpuPeriod   = 100000
+)
+
+var (
+	cgroupOnce sync.Once
+	cgroupBase string
+	cgroupErr  error
+)
+
+func (s *Sandbox) prepare(cmd *exec.Cmd) error {
+	if s.S.GetNetwork() {
+		return nil
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	// The process gets its own network namespace, which only has a loopback interface
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET
+	if os.Geteuid() != 0 {
+		// Unprivileged users can only create a network namespace inside a new user namespace,
+		// in which the process keeps its own uid and gid
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER
+		cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+		cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+		cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+	}
+	return nil
+}
+
+func (s *Sandbox) limit(pid int) error {
+	if d := s.S.GetCPUTime(); d > 0 {
+		// The process gets SIGXCPU at the soft limit, and SIGKILL if it keeps going
+		sec := uint64(d / time.Second)
+		if err := prlimit(pid, syscall.RLIMIT_CPU, &syscall.Rlimit{Cur: sec, Max: sec + 1}); err != nil {
+			return fmt.Errorf("sandbox: could not limit cpu_time: %w", err)
+		}
+	}
+	if s.S.OpenFiles != nil {
+		n := uint64(*s.S.OpenFiles)
+		if err := prlimit(pid, syscall.RLIMIT_NOFILE, &syscall.Rlimit{Cur: n, Max: n}); err != nil {
+			return fmt.Errorf("sandbox: could not limit open_files: %w", err)
+		}
+	}
+	if s.S.Memory == nil && s.S.CPU == nil && s.S.Processes == nil {
+		return nil
+	}
+
+	err := s.createCgroup(pid)
+	if err == nil {
+		return nil
+	}
+	if s.S.CPU != nil || s.S.Processes != nil {
+		return fmt.Errorf("sandbox: cpu and processes limits require cgroup v2: %w", err)
+	}
+	// Without cgroups, memory is limited by the size of the process' address space,
+	// which is less accurate, since it also counts memory that was mapped but never used
+	logrus.WithField("plugin", s.I.Plugin+":"+s.I.Name).Warnf("Limiting address space instead of memory, since cgroups are not available: %s", err)
+	mem := uint64(s.S.GetMemory())
+	if err = prlimit(pid, syscall.RLIMIT_AS, &syscall.Rlimit{Cur: mem, Max: mem}); err != nil {
+		return fmt.Errorf("sandbox: could not limit memory: %w", err)
+	}
+	return nil
+}
+
+// prlimit sets a resource limit of another process
+func prlimit(pid int, resource int, limit *syscall.Rlimit) error {
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(resource), uintptr(unsafe.Pointer(limit)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// createCgroup moves the process into a new cgroup with the sandbox's limits. The process
+// is already running at this point, so anything it starts before being moved is not limited.
+func (s *Sandbox) createCgroup(pid int) error {
+	base, err := heedyCgroup()
+	if err != nil {
+		return err
+	}
+	cg := filepath.Join(base, "heedy-"+s.I.Plugin+"-"+s.I.Name)
+	if err = os.Mkdir(cg, 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+	s.cgroup = cg
+
+	limits := map[string]string{}
+	if s.S.Memory != nil {
+		limits["memory.max"] = strconv.FormatInt(s.S.GetMemory(), 10)
+		limits["memory.swap.max"] = "0"
+	}
+	if s.S.CPU != nil {
+		limits["cpu.max"] = fmt.Sprintf("%d %d", int64(*s.S.CPU*cpuPeriod), cpuPeriod)
+	}
+	if s.S.Processes != nil {
+		limits["pids.max"] = strconv.Itoa(*s.S.Processes)
+	}
+	for f, v := range limits {
+		if err = ioutil.WriteFile(filepath.Join(cg, f), []byte(v), 0644); err != nil {
+			if f == "memory.swap.max" && os.IsNotExist(err) {
+				// Swap accounting is disabled, so there is no swap to limit
+				continue
+			}
+			return err
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(cg, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644)
+}
+
+// heedyCgroup returns the cgroup in which plugin cgroups are created, enabling the memory,
+// cpu and pids controllers for its children.
+func heedyCgroup() (string, error) {
+	cgroupOnce.Do(func() {
+		cgroupBase, cgroupErr = setupCgroup()
+	})
+	return cgroupBase, cgroupErr
+}
+
+func setupCgroup() (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupMount, "cgroup.controllers")); err != nil {
+		return "", errors.New("no cgroup v2 hierarchy is mounted at " + cgroupMount)
+	}
+	b, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	own := ""
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			own = line[3:]
+		}
+	}
+	if own == "" {
+		return "", errors.New("could not find heedy's cgroup")
+	}
+	base := filepath.Join(cgroupMount, own)
+
+	if err = enableControllers(base); err == nil {
+		return base, nil
+	}
+	// Controllers can't be enabled for children of a non-root cgroup that has processes in it,
+	// so heedy first moves itself into a child cgroup of its own
+	leaf := filepath.Join(base, "heedy")
+	if err = os.Mkdir(leaf, 0755); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	if err = ioutil.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		return "", err
+	}
+	return base, enableControllers(base)
+}
+
+func enableControllers(cg string) error {
+	return ioutil.WriteFile(filepath.Join(cg, "cgroup.subtree_control"), []byte("+memory +cpu +pids"), 0644)
+}
+
+// readEvent returns the value of the given key in a cgroup events file
+func readEvent(fname, key string) int {
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		f := strings.Fields(line)
+		if len(f) == 2 && f[0] == key {
+			v, _ := strconv.Atoi(f[1])
+			return v
+		}
+	}
+	return 0
+}
+
+func (s *Sandbox) violations(ps *os.ProcessState) []string {
+	v := []string{}
+	if s.cgroup != "" {
+		if readEvent(filepath.Join(s.cgroup, "memory.events"), "oom_kill") > 0 {
+			v = append(v, "memory")
+		}
+		if readEvent(filepath.Join(s.cgroup, "pids.events"), "max") > 0 {
+			v = append(v, "processes")
+		}
+	}
+	if ps != nil && s.S.CPUTime != nil {
+		if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			used := ps.UserTime() + ps.SystemTime()
+			if ws.Signal() == syscall.SIGXCPU || ws.Signal() == syscall.SIGKILL && used >= s.S.GetCPUTime() {
+				v = append(v, "cpu_time")
+			}
+		}
+	}
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
+
+func (s *Sandbox) cleanup() {
+	if s.cgroup == "" {
+		return
+	}
+	// Kill anything the process left behind, so that the cgroup can be removed
+	ioutil.WriteFile(filepath.Join(s.cgroup, "cgroup.kill"), []byte("1"), 0644)
+	for i := 0; i < 20; i++ {
+		if err := os.Remove(s.cgroup); err == nil || os.IsNotExist(err) {
+			s.cgroup = ""
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	logrus.WithField("plugin", s.I.Plugin+":"+s.I.Name).Warnf("Could not remove cgroup %s", s.cgroup)
+}
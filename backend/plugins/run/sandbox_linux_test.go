@@ -0,0 +1,38 @@
+package run
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSandboxLimits(t *testing.T) {
+	openFiles := 32
+	cpuTime := "1h"
+	s := NewSandbox(&Info{
+		Plugin:  "myplugin",
+		Name:    "myrunner",
+		DataDir: t.TempDir(),
+		Run:     &assets.Run{Sandbox: &assets.Sandbox{OpenFiles: &openFiles, CPUTime: &cpuTime}},
+	})
+
+	// The limits are applied to the running process
+	var out strings.Builder
+	cmd := exec.Command("sh", "-c", "sleep 0.1; ulimit -n; ulimit -t")
+	cmd.Stdout = &out
+	require.NoError(t, s.Prepare(cmd))
+	require.NoError(t, s.Start(cmd))
+	require.NoError(t, cmd.Wait())
+	require.Equal(t, "32\n3600\n", out.String())
+	require.Nil(t, s.Exited(cmd.ProcessState))
+
+	// A process stopped by the cpu time limit is reported as a violation
+	cmd = exec.Command("sh", "-c", "kill -XCPU $$")
+	require.NoError(t, s.Prepare(cmd))
+	require.NoError(t, s.Start(cmd))
+	require.Error(t, cmd.Wait())
+	require.Equal(t, []string{"cpu_time"}, s.Exited(cmd.ProcessState))
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+// +build !linux
+
+package run
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func (s *Sandbox) prepare(cmd *exec.Cmd) error {
+	if !s.S.GetNetwork() {
+		return errors.New("sandbox: disabling network access is only supported on linux")
+	}
+	if s.S.Memory != nil || s.S.CPU != nil || s.S.CPUTime != nil || s.S.Processes != nil || s.S.OpenFiles != nil {
+		return errors.New("sandbox: resource limits are only supported on linux")
+	}
+	return nil
+}
+
+func (s *Sandbox) limit(pid int) error {
+	return nil
+}
+
+func (s *Sandbox) violations(ps *os.ProcessState) []string {
+	return nil
+}
+
+func (s *Sandbox) cleanup() {}
@@ -0,0 +1,48 @@
+package run
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSandboxEnvironment(t *testing.T) {
+	// Runners without a sandbox block are run unrestricted
+	rtype := "exec"
+	i := &Info{Plugin: "myplugin", Name: "myrunner", Run: &assets.Run{Type: &rtype}}
+	require.Nil(t, NewSandbox(i))
+	cmd := exec.Command("sh", "-c", "true")
+	require.NoError(t, NewSandbox(i).Prepare(cmd))
+	require.Nil(t, cmd.Env)
+	require.NoError(t, NewSandbox(i).Start(cmd))
+	require.NoError(t, cmd.Wait())
+	require.Nil(t, NewSandbox(i).Exited(cmd.ProcessState))
+
+	// Otherwise, the process only sees the allowed environment variables, and gets its own home directory
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "backend"), 0755))
+	os.Setenv("HEEDY_ALLOWED", "yes")
+	os.Setenv("HEEDY_SECRET", "no")
+	defer os.Unsetenv("HEEDY_ALLOWED")
+	defer os.Unsetenv("HEEDY_SECRET")
+	env := []string{"PATH", "HEEDY_ALLOWED", "HEEDY_UNSET"}
+	wd := "backend"
+	i.DataDir = dir
+	i.PluginDir = dir
+	i.Run.Sandbox = &assets.Sandbox{Env: &env, Dir: &wd}
+
+	s := NewSandbox(i)
+	require.Equal(t, filepath.Join(dir, "sandbox", "myplugin", "myrunner"), s.Dir)
+	cmd = exec.Command("sh", "-c", `echo "$HOME $TMPDIR $HEEDY_ALLOWED $HEEDY_SECRET $(pwd)"`)
+	require.NoError(t, s.Prepare(cmd))
+	out, err := cmd.Output()
+	require.NoError(t, err)
+	require.Equal(t, s.Dir+" "+s.Dir+" yes  "+filepath.Join(dir, "backend"), strings.TrimSpace(string(out)))
+	require.DirExists(t, s.Dir)
+	require.Nil(t, s.Exited(cmd.ProcessState))
+}
@@ -0,0 +1,87 @@
+package run
+
+import "sort"
+
+// The possible states of a runner
+const (
+	StatusRunning    = "running"
+	StatusExited     = "exited"
+	StatusStopped    = "stopped"
+	StatusScheduled  = "scheduled"
+	StatusRestarting = "restarting"
+	StatusFailed     = "failed"
+)
+
+// StatusMessage holds the state of a single runner's process. It is also what runtype APIs
+// return when queried for the status of a runner.
+type StatusMessage struct {
+	Status   string `json:"status"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+
+	// Violations lists the sandbox limits that the process hit
+	Violations []string `json:"violations,omitempty"`
+}
+
+// StatusChecker is implemented by runtypes which can tell if the process behind the given
+// api key is still running. Runners of other runtypes are assumed to be running.
+type StatusChecker interface {
+	Status(apikey string) StatusMessage
+}
+
+// RunnerStatus gives the current state of a runner
+type RunnerStatus struct {
+	Plugin     string   `json:"plugin"`
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Cron       *string  `json:"cron,omitempty"`
+	Status     string   `json:"status"`
+	ExitCode   *int     `json:"exit_code,omitempty"`
+	Violations []string `json:"violations,omitempty"`
+	Restarts   int      `json:"restarts"`
+}
+
+func (m *Manager) runnerStatus(apikey string, r *Runner) RunnerStatus {
+	rs := RunnerStatus{
+		Plugin:   r.I.Plugin,
+		Name:     r.I.Name,
+		Type:     *r.I.Run.Type,
+		Cron:     r.I.Run.Cron,
+		Status:   StatusRunning,
+		Restarts: r.restarts,
+	}
+	if rs.Cron != nil {
+		rs.Status = StatusScheduled
+		return rs
+	}
+	if sc, ok := m.RunTypes[rs.Type].(StatusChecker); ok {
+		sm := sc.Status(apikey)
+		rs.Status, rs.ExitCode, rs.Violations = sm.Status, sm.ExitCode, sm.Violations
+	}
+	if r.restarting {
+		rs.Status = StatusRestarting
+	} else if r.failed {
+		rs.Status = StatusFailed
+	}
+	return rs
+}
+
+// Status returns the state of all runners started by plugins
+func (m *Manager) Status() []RunnerStatus {
+	m.RLock()
+	defer m.RUnlock()
+	s := make([]RunnerStatus, 0, len(m.Runners))
+	for apikey, r := range m.Runners {
+		if r.I.Run == nil {
+			// The heedy core
+			continue
+		}
+		s = append(s, m.runnerStatus(apikey, r))
+	}
+	sort.Slice(s, func(i, j int) bool {
+		if s[i].Plugin == s[j].Plugin {
+			return s[i].Name < s[j].Name
+		}
+		return s[i].Plugin < s[j].Plugin
+	})
+	return s
+}
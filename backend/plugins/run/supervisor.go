@@ -0,0 +1,174 @@
+package run
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/events"
+)
+
+const (
+	// How often the supervisor checks whether runners are still running
+	superviseInterval = time.Second
+	// The longest time to wait between restarts
+	maxRestartDelay = time.Minute
+	// If a runner was running for this long before exiting, it counts as a fresh crash rather than
+	// a failure to restart, and the restart count is reset
+	restartResetTime = 5 * time.Minute
+)
+
+// supervise periodically checks the runners, and restarts those whose process exited, following
+// the restart policy given in their run block. It returns once the manager is killed.
+func (m *Manager) supervise() {
+	ticker := time.NewTicker(superviseInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+		}
+		m.RLock()
+		runners := make(map[string]*Runner)
+		for apikey, r := range m.Runners {
+			if r.I.Run != nil && r.I.Run.Cron == nil && !r.restarting && !r.failed {
+				runners[apikey] = r
+			}
+		}
+		m.RUnlock()
+
+		// The status is checked without holding the lock, since API runtypes make requests to plugins
+		for apikey, r := range runners {
+			sc, ok := m.RunTypes[*r.I.Run.Type].(StatusChecker)
+			if !ok {
+				continue
+			}
+			sm := sc.Status(apikey)
+			if sm.Status != StatusExited {
+				continue
+			}
+			m.handleExit(apikey, r, sm.ExitCode, sm.Violations)
+		}
+	}
+}
+
+// handleExit is called when the supervisor finds that a runner's process exited
+func (m *Manager) handleExit(apikey string, r *Runner, exitCode *int, violations []string) {
+	crashed := exitCode == nil || *exitCode != 0 || len(violations) > 0
+	policy := r.I.Run.GetRestart()
+	restart := policy == assets.RestartAlways || policy == assets.RestartOnFailure && crashed
+
+	m.Lock()
+	if _, ok := m.Runners[apikey]; !ok || m.killed {
+		// The runner was stopped in the meantime
+		m.Unlock()
+		return
+	}
+	r.exited = time.Now()
+	if r.exited.Sub(r.started) > restartResetTime {
+		r.restarts = 0
+	}
+	if restart && r.restarts >= r.I.Run.GetMaxRestarts() {
+		restart = false
+	}
+	r.restarting = restart
+	r.failed = !restart
+	restarts := r.restarts
+	m.Unlock()
+
+	l := logrus.WithField("plugin", r.I.Plugin+":"+r.I.Name)
+	if crashed {
+		data := map[string]interface{}{
+			"name":       r.I.Name,
+			"restarts":   restarts,
+			"restarting": restart,
+		}
+		if exitCode != nil {
+			data["exit_code"] = *exitCode
+		}
+		if len(violations) > 0 {
+			data["violations"] = violations
+		}
+		plugin := r.I.Plugin
+		events.Fire(&events.Event{
+			Event:  "plugin_crash",
+			Plugin: &plugin,
+			Data:   data,
+		})
+	}
+	if len(violations) > 0 {
+		l.Errorf("Process exceeded its sandbox limits: %s", strings.Join(violations, ", "))
+	}
+	if !restart {
+		if crashed {
+			l.Errorf("Process exited with code %v, and will not be restarted", exitCodeString(exitCode))
+		}
+		return
+	}
+
+	// Back off exponentially with each consecutive restart
+	delay := r.I.Run.GetRestartDelay()
+	for i := 0; i < restarts && delay < maxRestartDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRestartDelay {
+		delay = maxRestartDelay
+	}
+	l.Warnf("Process exited with code %v, restarting in %s", exitCodeString(exitCode), delay)
+
+	go func() {
+		time.Sleep(delay)
+		m.restart(apikey, r)
+	}()
+}
+
+// restart starts the runner's process again, and points its handler to the new process
+func (m *Manager) restart(apikey string, r *Runner) {
+	l := logrus.WithField("plugin", r.I.Plugin+":"+r.I.Name)
+
+	m.RLock()
+	_, ok := m.Runners[apikey]
+	stopped := !ok || m.killed
+	m.RUnlock()
+	if stopped {
+		return
+	}
+
+	rt := m.RunTypes[*r.I.Run.Type]
+	h, err := rt.Start(r.I)
+
+	m.Lock()
+	r.restarts++
+	r.restarting = false
+	if _, ok = m.Runners[apikey]; !ok || m.killed {
+		// The runner was stopped while restarting, so stop the new process too
+		m.Unlock()
+		if err == nil {
+			rt.Stop(apikey)
+		}
+		return
+	}
+	if err != nil {
+		// Failing to start counts as a crash, so that it is retried if there are restarts left
+		r.started = time.Now()
+		m.Unlock()
+		l.Errorf("Restart failed: %s", err)
+		m.handleExit(apikey, r, nil, nil)
+		return
+	}
+	r.Handler = m.wrapHandler(r.I, h)
+	r.started = time.Now()
+	m.Unlock()
+	l.Info("Restarted")
+}
+
+func exitCodeString(exitCode *int) string {
+	if exitCode == nil {
+		return "unknown"
+	}
+	return strconv.Itoa(*exitCode)
+}
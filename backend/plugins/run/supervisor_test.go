@@ -0,0 +1,149 @@
+package run
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/heedy/heedy/backend/assets"
+)
+
+// testType is a runtype that counts how often its runners were started
+type testType struct {
+	sync.Mutex
+	starts int
+	err    error
+}
+
+func (tt *testType) Start(i *Info) (http.Handler, error) {
+	tt.Lock()
+	defer tt.Unlock()
+	tt.starts++
+	return nil, tt.err
+}
+func (tt *testType) Run(i *Info) error        { return nil }
+func (tt *testType) Stop(apikey string) error { return nil }
+func (tt *testType) Kill(apikey string) error { return nil }
+
+func (tt *testType) getStarts() int {
+	tt.Lock()
+	defer tt.Unlock()
+	return tt.starts
+}
+
+func TestHandleExit(t *testing.T) {
+	tt := &testType{}
+	m := &Manager{
+		RunTypes: map[string]TypeHandler{"test": tt},
+		Runners:  make(map[string]*Runner),
+	}
+	newRunner := func(apikey, restart string, maxRestarts int) *Runner {
+		rtype := "test"
+		delay := "1ms"
+		r := &Runner{
+			I: &Info{Plugin: "myplugin", Name: apikey, APIKey: apikey, Run: &assets.Run{
+				Type:         &rtype,
+				Restart:      &restart,
+				RestartDelay: &delay,
+				MaxRestarts:  &maxRestarts,
+			}},
+			m:       m,
+			started: time.Now(),
+		}
+		m.Lock()
+		m.Runners[apikey] = r
+		m.Unlock()
+		return r
+	}
+	// The supervisor's state is read with the manager's lock, since restarts happen in the background
+	failed := func(r *Runner) bool {
+		m.RLock()
+		defer m.RUnlock()
+		return r.failed
+	}
+	restarting := func(r *Runner) bool {
+		m.RLock()
+		defer m.RUnlock()
+		return r.restarting
+	}
+	code := func(c int) *int { return &c }
+
+	// Runners that aren't to be restarted are marked as failed
+	r := newRunner("never", assets.RestartNever, 5)
+	m.handleExit("never", r, code(1), nil)
+	require.True(t, failed(r))
+	require.False(t, restarting(r))
+
+	r = newRunner("clean", assets.RestartOnFailure, 5)
+	m.handleExit("clean", r, code(0), nil)
+	require.True(t, failed(r))
+
+	// Crashes are restarted until the runner runs out of restarts
+	r = newRunner("crash", assets.RestartOnFailure, 1)
+	m.handleExit("crash", r, nil, nil)
+	require.False(t, failed(r))
+	require.Eventually(t, func() bool { return !restarting(r) }, time.Second, time.Millisecond)
+	require.Equal(t, 1, tt.getStarts())
+	require.Equal(t, 1, r.restarts)
+	m.handleExit("crash", r, code(1), nil)
+	require.True(t, failed(r))
+	require.Equal(t, 1, tt.getStarts())
+
+	// A sandbox violation counts as a crash even if the process exited cleanly
+	r = newRunner("always", assets.RestartAlways, 0)
+	m.handleExit("always", r, code(0), []string{"memory"})
+	require.True(t, failed(r))
+
+	// The restart count is reset once the runner ran for a while
+	r = newRunner("reset", assets.RestartAlways, 1)
+	r.restarts = 1
+	r.started = time.Now().Add(-2 * restartResetTime)
+	m.handleExit("reset", r, code(0), nil)
+	require.False(t, failed(r))
+	require.Eventually(t, func() bool { return tt.getStarts() == 2 }, time.Second, time.Millisecond)
+
+	// Failing to start is a crash, so the restart is retried
+	tt.Lock()
+	tt.err = errors.New("failed to start")
+	tt.Unlock()
+	r = newRunner("badstart", assets.RestartOnFailure, 2)
+	m.handleExit("badstart", r, code(1), nil)
+	require.Eventually(t, func() bool { return failed(r) }, time.Second, time.Millisecond)
+	require.Equal(t, 4, tt.getStarts())
+
+	// Runners that were stopped in the meantime are left alone
+	r = newRunner("stopped", assets.RestartAlways, 5)
+	m.Lock()
+	delete(m.Runners, "stopped")
+	m.Unlock()
+	m.handleExit("stopped", r, code(1), nil)
+	require.False(t, failed(r))
+	require.False(t, restarting(r))
+}
+
+func TestSuperviseStops(t *testing.T) {
+	m := &Manager{
+		RunTypes: map[string]TypeHandler{},
+		Runners:  make(map[string]*Runner),
+		cron:     cron.New(),
+		done:     make(chan struct{}),
+	}
+	stopped := make(chan struct{})
+	go func() {
+		m.supervise()
+		close(stopped)
+	}()
+	require.NoError(t, m.Kill())
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the supervisor kept running after the manager was killed")
+	}
+	// Killing the manager again doesn't close the channel twice
+	require.NoError(t, m.Kill())
+}
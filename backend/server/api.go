@@ -42,6 +42,11 @@ func APIMux() (*chi.Mux, error) {
 	apiMux.Get("/server/scope", GetAppScope)
 	apiMux.Get("/server/apps", GetPluginApps)
 	apiMux.Get("/server/version", GetVersion)
+	apiMux.Get("/server/metrics", GetMetrics)
+	apiMux.Get("/server/plugins/{plugin}/logs", GetPluginLogs)
+	apiMux.Get("/openapi.json", GetOpenAPI)
+	apiMux.Get("/graphql", GraphQLHandler)
+	apiMux.Post("/graphql", GraphQL)
 
 	apiMux.Get("/server/admin", GetAdminUsers)
 	apiMux.Post("/server/admin/{username}", AddAdminUser)
@@ -46,7 +46,7 @@ func (eh *WebsocketEventHandler) Fire(e *events.Event) {
 		ctx, cancel := context.WithTimeout(eh.R.Context(), time.Second*10)
 		defer cancel()
 		c := rest.CTX(eh.R)
-		if c.DB.AdminDB().Assets().Config.Verbose {
+		if c.DB.AdminDB().Assets().GetConfig().Verbose {
 			c.Log.Debugf("<- %s", e.String())
 		}
 		err := wsjson.Write(ctx, eh.Ws, e)
@@ -72,16 +72,21 @@ type wsMessage struct {
 
 func EventWebsocket(w http.ResponseWriter, r *http.Request) {
 	c := rest.CTX(r)
-	cfg := c.DB.AdminDB().Assets().Config
+	cfg := c.DB.AdminDB().Assets().GetConfig()
 	if c.DB.ID() == "public" && cfg.AllowPublicWebsocket != nil && !*cfg.AllowPublicWebsocket {
 		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("The public is not allowed to access event websockets"))
 		return
 	}
-	ws, err := websocket.Accept(w, r, nil)
-	if err != nil {
-		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+	ws, closed := acceptWebsocket(w, r)
+	if ws == nil {
 		return
 	}
+	defer closed()
+	activeWebsockets.WithLabelValues("events").Inc()
+	defer activeWebsockets.WithLabelValues("events").Dec()
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go closeOnShutdown(ctx, ws)
 
 	haderror := make(chan error, 1)
 
@@ -102,7 +107,7 @@ func EventWebsocket(w http.ResponseWriter, r *http.Request) {
 		for {
 			var err error
 			var b []byte
-			if c.DB.AdminDB().Assets().Config.Verbose {
+			if c.DB.AdminDB().Assets().GetConfig().Verbose {
 				_, b, err = ws.Read(r.Context())
 				if err == nil {
 					c.Log.Debugf("-> %s", string(b))
@@ -149,12 +154,12 @@ func EventWebsocket(w http.ResponseWriter, r *http.Request) {
 			}
 
 		}
-		if c.DB.AdminDB().Assets().Config.Verbose {
+		if c.DB.AdminDB().Assets().GetConfig().Verbose {
 			c.Log.Debug("Closing websocket reader")
 		}
 	}()
 
-	err = <-haderror
+	err := <-haderror
 	events.RemoveHandler(eventRouter)
 	c.Log.Debug("Closing websocket")
 
@@ -26,7 +26,7 @@ func GetObjectScope(w http.ResponseWriter, r *http.Request) {
 	}
 	a := rest.CTX(r).DB.AdminDB().Assets()
 	stype := chi.URLParam(r, "objecttype")
-	scope, err := a.Config.GetObjectScope(stype)
+	scope, err := a.GetConfig().GetObjectScope(stype)
 	rest.WriteJSON(w, r, scope, err)
 }
 
@@ -59,7 +59,7 @@ func GetAppScope(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate the object type scope
-	for stype := range a.Config.ObjectTypes {
+	for stype := range a.GetConfig().ObjectTypes {
 		smap[fmt.Sprintf("objects.%s", stype)] = fmt.Sprintf("All permissions for objects of type '%s'", stype)
 		smap[fmt.Sprintf("objects.%s:read", stype)] = fmt.Sprintf("Read access for your objects of type '%s'", stype)
 		smap[fmt.Sprintf("objects.%s:delete", stype)] = fmt.Sprintf("Can delete your objects of type '%s'", stype)
@@ -70,7 +70,7 @@ func GetAppScope(w http.ResponseWriter, r *http.Request) {
 		smap[fmt.Sprintf("self.objects.%s", stype)] = fmt.Sprintf("Allows the app to create and manage its own objects of type '%s'", stype)
 
 		// And now generate the per-type scope
-		stypemap := a.Config.ObjectTypes[stype].Scope
+		stypemap := a.GetConfig().ObjectTypes[stype].Scope
 		if stypemap != nil {
 			for sscope := range *stypemap {
 				smap[fmt.Sprintf("objects.%s:%s", stype, sscope)] = (*stypemap)[sscope]
@@ -100,7 +100,7 @@ func GetPluginApps(w http.ResponseWriter, r *http.Request) {
 
 	appmap := make(map[string]pluginApp)
 
-	for pname, p := range a.Config.Plugins {
+	for pname, p := range a.GetConfig().Plugins {
 		for akey, app := range p.Apps {
 			appid := pname + ":" + akey
 			appmap[appid] = pluginApp{
@@ -121,21 +121,21 @@ func GetVersion(w http.ResponseWriter, r *http.Request) {
 func GetAdminUsers(w http.ResponseWriter, r *http.Request) {
 	db := rest.CTX(r).DB
 	a := db.AdminDB().Assets()
-	if db.Type() != database.AdminType && !a.Config.UserIsAdmin(db.ID()) {
+	if db.Type() != database.AdminType && !a.GetConfig().UserIsAdmin(db.ID()) {
 		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("Only admins can list admins"))
 		return
 	}
-	if a.Config.AdminUsers == nil {
+	if a.GetConfig().AdminUsers == nil {
 		rest.WriteJSON(w, r, []string{}, nil)
 		return
 	}
-	rest.WriteJSON(w, r, *a.Config.AdminUsers, nil)
+	rest.WriteJSON(w, r, *a.GetConfig().AdminUsers, nil)
 }
 
 func AddAdminUser(w http.ResponseWriter, r *http.Request) {
 	db := rest.CTX(r).DB
 	a := db.AdminDB().Assets()
-	if db.Type() != database.AdminType && !a.Config.UserIsAdmin(db.ID()) {
+	if db.Type() != database.AdminType && !a.GetConfig().UserIsAdmin(db.ID()) {
 		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("Only admins can add admin users"))
 		return
 	}
@@ -149,7 +149,7 @@ func AddAdminUser(w http.ResponseWriter, r *http.Request) {
 func RemoveAdminUser(w http.ResponseWriter, r *http.Request) {
 	db := rest.CTX(r).DB
 	a := db.AdminDB().Assets()
-	if db.Type() != database.AdminType && !a.Config.UserIsAdmin(db.ID()) {
+	if db.Type() != database.AdminType && !a.GetConfig().UserIsAdmin(db.ID()) {
 		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("Only admins can add remove admin status"))
 		return
 	}
@@ -160,7 +160,7 @@ func RemoveAdminUser(w http.ResponseWriter, r *http.Request) {
 func GetUpdates(w http.ResponseWriter, r *http.Request) {
 	db := rest.CTX(r).DB
 	a := db.AdminDB().Assets()
-	if db.Type() != database.AdminType && !a.Config.UserIsAdmin(db.ID()) {
+	if db.Type() != database.AdminType && !a.GetConfig().UserIsAdmin(db.ID()) {
 		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("Server settings are admin-only"))
 		return
 	}
@@ -171,7 +171,7 @@ func GetUpdates(w http.ResponseWriter, r *http.Request) {
 func ClearUpdates(w http.ResponseWriter, r *http.Request) {
 	db := rest.CTX(r).DB
 	a := db.AdminDB().Assets()
-	if db.Type() != database.AdminType && !a.Config.UserIsAdmin(db.ID()) {
+	if db.Type() != database.AdminType && !a.GetConfig().UserIsAdmin(db.ID()) {
 		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("Server settings are admin-only"))
 		return
 	}
@@ -181,7 +181,7 @@ func ClearUpdates(w http.ResponseWriter, r *http.Request) {
 func GetConfigFile(w http.ResponseWriter, r *http.Request) {
 	db := rest.CTX(r).DB
 	a := db.AdminDB().Assets()
-	if db.Type() != database.AdminType && !a.Config.UserIsAdmin(db.ID()) {
+	if db.Type() != database.AdminType && !a.GetConfig().UserIsAdmin(db.ID()) {
 		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("Server settings are admin-only"))
 		return
 	}
@@ -196,14 +196,14 @@ func GetConfigFile(w http.ResponseWriter, r *http.Request) {
 func PostConfigFile(w http.ResponseWriter, r *http.Request) {
 	db := rest.CTX(r).DB
 	a := db.AdminDB().Assets()
-	if db.Type() != database.AdminType && !a.Config.UserIsAdmin(db.ID()) {
+	if db.Type() != database.AdminType && !a.GetConfig().UserIsAdmin(db.ID()) {
 		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("Server settings are admin-only"))
 		return
 	}
 	defer r.Body.Close()
 
 	//Limit requests to the limit given in configuration
-	b, err := ioutil.ReadAll(io.LimitReader(r.Body, *a.Config.RequestBodyByteLimit))
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, *a.GetConfig().RequestBodyByteLimit))
 	if err != nil {
 		rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
 	}
@@ -213,7 +213,7 @@ func PostConfigFile(w http.ResponseWriter, r *http.Request) {
 func PatchUConfig(w http.ResponseWriter, r *http.Request) {
 	db := rest.CTX(r).DB
 	a := db.AdminDB().Assets()
-	if db.Type() != database.AdminType && !a.Config.UserIsAdmin(db.ID()) {
+	if db.Type() != database.AdminType && !a.GetConfig().UserIsAdmin(db.ID()) {
 		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("Server settings are admin-only"))
 		return
 	}
@@ -231,7 +231,7 @@ func PatchUConfig(w http.ResponseWriter, r *http.Request) {
 func GetUpdateStatus(w http.ResponseWriter, r *http.Request) {
 	db := rest.CTX(r).DB
 	a := db.AdminDB().Assets()
-	if db.Type() != database.AdminType && !a.Config.UserIsAdmin(db.ID()) {
+	if db.Type() != database.AdminType && !a.GetConfig().UserIsAdmin(db.ID()) {
 		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("Server settings are admin-only"))
 		return
 	}
@@ -241,7 +241,7 @@ func GetUpdateStatus(w http.ResponseWriter, r *http.Request) {
 func GetUConfig(w http.ResponseWriter, r *http.Request) {
 	db := rest.CTX(r).DB
 	a := db.AdminDB().Assets()
-	if db.Type() != database.AdminType && !a.Config.UserIsAdmin(db.ID()) {
+	if db.Type() != database.AdminType && !a.GetConfig().UserIsAdmin(db.ID()) {
 		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("Server settings are admin-only"))
 		return
 	}
@@ -252,7 +252,7 @@ func GetUConfig(w http.ResponseWriter, r *http.Request) {
 func GetAllPlugins(w http.ResponseWriter, r *http.Request) {
 	db := rest.CTX(r).DB
 	a := db.AdminDB().Assets()
-	if db.Type() != database.AdminType && !a.Config.UserIsAdmin(db.ID()) {
+	if db.Type() != database.AdminType && !a.GetConfig().UserIsAdmin(db.ID()) {
 		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("Server settings are admin-only"))
 		return
 	}
@@ -263,7 +263,7 @@ func GetAllPlugins(w http.ResponseWriter, r *http.Request) {
 func GetPluginReadme(w http.ResponseWriter, r *http.Request) {
 	db := rest.CTX(r).DB
 	a := db.AdminDB().Assets()
-	if db.Type() != database.AdminType && !a.Config.UserIsAdmin(db.ID()) {
+	if db.Type() != database.AdminType && !a.GetConfig().UserIsAdmin(db.ID()) {
 		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("Server settings are admin-only"))
 		return
 	}
@@ -290,7 +290,7 @@ func GetPluginReadme(w http.ResponseWriter, r *http.Request) {
 func PostPlugin(w http.ResponseWriter, r *http.Request) {
 	db := rest.CTX(r).DB
 	a := db.AdminDB().Assets()
-	if db.Type() != database.AdminType && !a.Config.UserIsAdmin(db.ID()) {
+	if db.Type() != database.AdminType && !a.GetConfig().UserIsAdmin(db.ID()) {
 		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("Server settings are admin-only"))
 		return
 	}
@@ -331,7 +331,7 @@ func PostPlugin(w http.ResponseWriter, r *http.Request) {
 func GetUpdateOptions(w http.ResponseWriter, r *http.Request) {
 	db := rest.CTX(r).DB
 	a := db.AdminDB().Assets()
-	if db.Type() != database.AdminType && !a.Config.UserIsAdmin(db.ID()) {
+	if db.Type() != database.AdminType && !a.GetConfig().UserIsAdmin(db.ID()) {
 		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("Server settings are admin-only"))
 		return
 	}
@@ -342,7 +342,7 @@ func GetUpdateOptions(w http.ResponseWriter, r *http.Request) {
 func PostUpdateOptions(w http.ResponseWriter, r *http.Request) {
 	db := rest.CTX(r).DB
 	a := db.AdminDB().Assets()
-	if db.Type() != database.AdminType && !a.Config.UserIsAdmin(db.ID()) {
+	if db.Type() != database.AdminType && !a.GetConfig().UserIsAdmin(db.ID()) {
 		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("Server settings are admin-only"))
 		return
 	}
@@ -115,7 +115,8 @@ func (a *Auth) Authenticate(w http.ResponseWriter, r *http.Request) (database.DB
 				Value:    "",
 				MaxAge:   -1,
 				SameSite: http.SameSiteLaxMode,
-				Path:     "/",
+				Path:     sitePath("/"),
+				Secure:   isHTTPS(r),
 			})
 		}
 	}
@@ -171,7 +172,8 @@ func (a *Auth) ServeToken(w http.ResponseWriter, r *http.Request) {
 			Value:    tok,
 			Expires:  time.Now().AddDate(5, 0, 0),
 			SameSite: http.SameSiteLaxMode,
-			Path:     "/",
+			Path:     sitePath("/"),
+			Secure:   isHTTPS(r),
 			HttpOnly: true,
 		})
 
@@ -218,7 +220,7 @@ func AuthMux(a *Auth) (*chi.Mux, error) {
 	mux := chi.NewMux()
 
 	// The authorization flow (login/give permissions page)
-	abytes, err := afero.ReadFile(assets.Get().FS, "/public/auth.html")
+	abytes, err := afero.ReadFile(assets.Get().GetFS(), "/public/auth.html")
 	if err != nil {
 		return nil, err
 	}
@@ -250,11 +252,12 @@ func AuthMux(a *Auth) (*chi.Mux, error) {
 			Value:    "",
 			MaxAge:   0,
 			SameSite: http.SameSiteLaxMode,
-			Path:     "/",
+			Path:     sitePath("/"),
+			Secure:   isHTTPS(r),
 		})
 
 		// Should verify that getting correct referrer
-		http.Redirect(w, r, "/", 303)
+		http.Redirect(w, r, sitePath("/"), 303)
 
 		// We use the happy path - this never fails. At worst it
 		v, err := r.Cookie("token")
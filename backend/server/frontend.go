@@ -53,7 +53,7 @@ func (we withExists) Exists(name string) bool {
 func FrontendMux() (*chi.Mux, error) {
 	mux := chi.NewMux()
 
-	frontendFS := afero.NewBasePathFs(assets.Get().FS, "/public")
+	frontendFS := afero.NewBasePathFs(assets.Get().GetFS(), "/public")
 
 	// The main frontend app
 
@@ -143,7 +143,7 @@ func FrontendMux() (*chi.Mux, error) {
 
 		err = fTemplate.Execute(w, &fContext{
 			User:    u,
-			Admin:   ctx.DB.AdminDB().Assets().Config.UserIsAdmin(*u.UserName),
+			Admin:   ctx.DB.AdminDB().Assets().GetConfig().UserIsAdmin(*u.UserName),
 			Plugins: frontendPlugins,
 			Preload: preloads,
 			Verbose: cfg.Verbose,
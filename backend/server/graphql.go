@@ -0,0 +1,770 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/events"
+)
+
+// The GraphQL API resolves everything through the database of the request's context,
+// so that a query has exactly the same permissions as the equivalent REST calls.
+
+// gqlJSON is a scalar that holds arbitrary json
+var gqlJSON = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "JSON",
+	Description: "Arbitrary JSON data",
+	Serialize: func(value interface{}) interface{} {
+		return value
+	},
+	ParseValue: func(value interface{}) interface{} {
+		return value
+	},
+	ParseLiteral: gqlParseLiteral,
+})
+
+func gqlParseLiteral(valueAST ast.Value) interface{} {
+	switch v := valueAST.(type) {
+	case *ast.ObjectValue:
+		m := make(map[string]interface{})
+		for _, f := range v.Fields {
+			m[f.Name.Value] = gqlParseLiteral(f.Value)
+		}
+		return m
+	case *ast.ListValue:
+		l := make([]interface{}, len(v.Values))
+		for i := range v.Values {
+			l[i] = gqlParseLiteral(v.Values[i])
+		}
+		return l
+	case *ast.IntValue:
+		var i int64
+		fmt.Sscan(v.Value, &i)
+		return i
+	case *ast.FloatValue:
+		var f float64
+		fmt.Sscan(v.Value, &f)
+		return f
+	case *ast.BooleanValue:
+		return v.Value
+	case *ast.StringValue:
+		return v.Value
+	case *ast.EnumValue:
+		return v.Value
+	}
+	return nil
+}
+
+var gqlScalars = map[string]graphql.Type{
+	"Int":     graphql.Int,
+	"Float":   graphql.Float,
+	"String":  graphql.String,
+	"Boolean": graphql.Boolean,
+	"JSON":    gqlJSON,
+}
+
+// gqlType converts a type string from the configuration (such as "[Int]!") into a graphql type
+func gqlType(t string) graphql.Type {
+	nonNull := strings.HasSuffix(t, "!")
+	t = strings.TrimSuffix(t, "!")
+	var gt graphql.Type
+	if strings.HasPrefix(t, "[") && strings.HasSuffix(t, "]") {
+		gt = graphql.NewList(gqlType(t[1 : len(t)-1]))
+	} else {
+		gt = gqlScalars[t]
+	}
+	if nonNull {
+		gt = graphql.NewNonNull(gt)
+	}
+	return gt
+}
+
+// gqlCTX returns the heedy request context of a resolver
+func gqlCTX(ctx context.Context) *rest.Context {
+	return ctx.Value(rest.HeedyContext).(*rest.Context)
+}
+
+// gqlMap converts the given struct to a map using its json representation, so that the fields
+// of the GraphQL API are identical to the fields of the REST API
+func gqlMap(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var res interface{}
+	err = json.Unmarshal(b, &res)
+	return res, err
+}
+
+func gqlString(args map[string]interface{}, name string) *string {
+	v, ok := args[name].(string)
+	if !ok {
+		return nil
+	}
+	return &v
+}
+
+func gqlBool(args map[string]interface{}, name string) bool {
+	v, ok := args[name].(bool)
+	return ok && v
+}
+
+func gqlSourceString(p graphql.ResolveParams, name string) string {
+	m, ok := p.Source.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	s, _ := m[name].(string)
+	return s
+}
+
+// gqlObjectFieldResolver resolves a field defined by an object type in its configuration,
+// by querying the given route of the object through heedy's API as the current request's user.
+func gqlObjectFieldResolver(objecttype string, f assets.GraphQLField) graphql.FieldResolveFn {
+	method := "GET"
+	route := f.Route
+	if ss := strings.Fields(f.Route); len(ss) == 2 {
+		method = ss[0]
+		route = ss[1]
+	}
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		m, ok := p.Source.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		oid, _ := m["id"].(string)
+		otype, _ := m["type"].(string)
+		if otype != objecttype {
+			return nil, nil
+		}
+		c := gqlCTX(p.Context)
+
+		query := url.Values{}
+		for k, v := range p.Args {
+			query.Set(k, fmt.Sprint(v))
+		}
+		path := "/api/objects/" + url.PathEscape(oid) + route
+		if len(query) > 0 {
+			path = path + "?" + query.Encode()
+		}
+		r, err := c.Request(c, method, path, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		var res interface{}
+		err = json.Unmarshal(b, &res)
+		return res, err
+	}
+}
+
+// The number of events buffered for each graphql subscription
+const graphQLEventBuffer = 256
+
+// chanEventHandler forwards events to a channel, which is used to back graphql subscriptions.
+// Events are buffered in order, and a subscriber that doesn't keep up has its channel closed,
+// which ends the subscription rather than holding up the events of everyone else.
+type chanEventHandler struct {
+	sync.Mutex
+	c      chan interface{}
+	closed bool
+}
+
+func newChanEventHandler() *chanEventHandler {
+	return &chanEventHandler{c: make(chan interface{}, graphQLEventBuffer)}
+}
+
+func (h *chanEventHandler) Fire(e *events.Event) {
+	ev, err := gqlMap(e)
+	if err != nil {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	if h.closed {
+		return
+	}
+	select {
+	case h.c <- ev:
+	default:
+		h.closed = true
+		close(h.c)
+	}
+}
+
+// NewGraphQLSchema generates the GraphQL schema of heedy with the given configuration. The core types are
+// described here, and each object type can add fields to objects with the graphql option in its configuration.
+func NewGraphQLSchema(c *assets.Configuration) (graphql.Schema, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	var userType, appType, objectType *graphql.Object
+
+	listObjects := func(p graphql.ResolveParams, o *database.ListObjectsOptions) (interface{}, error) {
+		o.Type = gqlString(p.Args, "type")
+		o.Tags = gqlString(p.Args, "tags")
+		o.Key = gqlString(p.Args, "key")
+		o.Icon = gqlBool(p.Args, "icon")
+		if l, ok := p.Args["limit"].(int); ok {
+			o.Limit = &l
+		}
+		ol, err := gqlCTX(p.Context).DB.ListObjects(o)
+		if err != nil {
+			return nil, err
+		}
+		return gqlMap(ol)
+	}
+	objectListArgs := graphql.FieldConfigArgument{
+		"type":  &graphql.ArgumentConfig{Type: graphql.String},
+		"tags":  &graphql.ArgumentConfig{Type: graphql.String},
+		"key":   &graphql.ArgumentConfig{Type: graphql.String},
+		"limit": &graphql.ArgumentConfig{Type: graphql.Int},
+		"icon":  &graphql.ArgumentConfig{Type: graphql.Boolean},
+	}
+	readUser := func(p graphql.ResolveParams, username string) (interface{}, error) {
+		u, err := gqlCTX(p.Context).DB.ReadUser(username, &database.ReadUserOptions{
+			Icon: gqlBool(p.Args, "icon"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return gqlMap(u)
+	}
+	iconArgs := graphql.FieldConfigArgument{
+		"icon": &graphql.ArgumentConfig{Type: graphql.Boolean},
+	}
+
+	userType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"username":    &graphql.Field{Type: graphql.String},
+				"name":        &graphql.Field{Type: graphql.String},
+				"description": &graphql.Field{Type: graphql.String},
+				"icon":        &graphql.Field{Type: graphql.String},
+				"public_read": &graphql.Field{Type: graphql.Boolean},
+				"users_read":  &graphql.Field{Type: graphql.Boolean},
+				"apps": &graphql.Field{
+					Type: graphql.NewList(appType),
+					Args: graphql.FieldConfigArgument{
+						"plugin": &graphql.ArgumentConfig{Type: graphql.String},
+						"icon":   &graphql.ArgumentConfig{Type: graphql.Boolean},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						owner := gqlSourceString(p, "username")
+						al, err := gqlCTX(p.Context).DB.ListApps(&database.ListAppOptions{
+							ReadAppOptions: database.ReadAppOptions{Icon: gqlBool(p.Args, "icon")},
+							Owner:          &owner,
+							Plugin:         gqlString(p.Args, "plugin"),
+						})
+						if err != nil {
+							return nil, err
+						}
+						return gqlMap(al)
+					},
+				},
+				"objects": &graphql.Field{
+					Type: graphql.NewList(objectType),
+					Args: objectListArgs,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						owner := gqlSourceString(p, "username")
+						return listObjects(p, &database.ListObjectsOptions{Owner: &owner})
+					},
+				},
+			}
+		}),
+	})
+
+	appType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "App",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":               &graphql.Field{Type: graphql.String},
+				"name":             &graphql.Field{Type: graphql.String},
+				"description":      &graphql.Field{Type: graphql.String},
+				"icon":             &graphql.Field{Type: graphql.String},
+				"owner":            &graphql.Field{Type: graphql.String},
+				"plugin":           &graphql.Field{Type: graphql.String},
+				"enabled":          &graphql.Field{Type: graphql.Boolean},
+				"created_date":     &graphql.Field{Type: graphql.String},
+				"last_access_date": &graphql.Field{Type: graphql.String},
+				"scope":            &graphql.Field{Type: graphql.String},
+				"settings":         &graphql.Field{Type: gqlJSON},
+				"settings_schema":  &graphql.Field{Type: gqlJSON},
+				"user": &graphql.Field{
+					Type: userType,
+					Args: iconArgs,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return readUser(p, gqlSourceString(p, "owner"))
+					},
+				},
+				"objects": &graphql.Field{
+					Type: graphql.NewList(objectType),
+					Args: objectListArgs,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						app := gqlSourceString(p, "id")
+						return listObjects(p, &database.ListObjectsOptions{App: &app})
+					},
+				},
+			}
+		}),
+	})
+
+	objectFields := graphql.Fields{
+		"id":            &graphql.Field{Type: graphql.String},
+		"name":          &graphql.Field{Type: graphql.String},
+		"description":   &graphql.Field{Type: graphql.String},
+		"icon":          &graphql.Field{Type: graphql.String},
+		"owner":         &graphql.Field{Type: graphql.String},
+		"app":           &graphql.Field{Type: graphql.String},
+		"tags":          &graphql.Field{Type: graphql.String},
+		"key":           &graphql.Field{Type: graphql.String},
+		"type":          &graphql.Field{Type: graphql.String},
+		"meta":          &graphql.Field{Type: gqlJSON},
+		"created_date":  &graphql.Field{Type: graphql.String},
+		"last_modified": &graphql.Field{Type: graphql.String},
+		"owner_scope":   &graphql.Field{Type: graphql.String},
+		"access":        &graphql.Field{Type: graphql.String},
+	}
+
+	// Each object type with graphql fields gets its own field in objects, which is null
+	// for objects of other types
+	otypes := make([]string, 0, len(c.ObjectTypes))
+	for k := range c.ObjectTypes {
+		otypes = append(otypes, k)
+	}
+	sort.Strings(otypes)
+	for _, otype := range otypes {
+		ot := c.ObjectTypes[otype]
+		if ot.GraphQL == nil || len(*ot.GraphQL) == 0 {
+			continue
+		}
+		if _, ok := objectFields[otype]; ok {
+			return graphql.Schema{}, fmt.Errorf("graphql: object type '%s' conflicts with a builtin object field", otype)
+		}
+		fields := graphql.Fields{}
+		for fname, f := range *ot.GraphQL {
+			args := graphql.FieldConfigArgument{}
+			for aname, atype := range f.Args {
+				args[aname] = &graphql.ArgumentConfig{Type: gqlType(atype)}
+			}
+			gf := &graphql.Field{
+				Type:    gqlType(f.Type),
+				Args:    args,
+				Resolve: gqlObjectFieldResolver(otype, f),
+			}
+			if f.Description != nil {
+				gf.Description = *f.Description
+			}
+			fields[fname] = gf
+		}
+		typeObject := graphql.NewObject(graphql.ObjectConfig{
+			Name:   strings.ToUpper(otype[:1]) + otype[1:] + "Fields",
+			Fields: fields,
+		})
+		otypeName := otype
+		objectFields[otype] = &graphql.Field{
+			Type:        typeObject,
+			Description: fmt.Sprintf("Fields specific to objects of type '%s'", otype),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if gqlSourceString(p, "type") != otypeName {
+					return nil, nil
+				}
+				return p.Source, nil
+			},
+		}
+	}
+	objectFields["user"] = &graphql.Field{
+		Type: userType,
+		Args: iconArgs,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return readUser(p, gqlSourceString(p, "owner"))
+		},
+	}
+	objectFields["app_info"] = &graphql.Field{
+		Type: appType,
+		Args: iconArgs,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			appid := gqlSourceString(p, "app")
+			if appid == "" {
+				return nil, nil
+			}
+			a, err := gqlCTX(p.Context).DB.ReadApp(appid, &database.ReadAppOptions{
+				Icon: gqlBool(p.Args, "icon"),
+			})
+			if err != nil {
+				return nil, err
+			}
+			return gqlMap(a)
+		},
+	}
+	objectType = graphql.NewObject(graphql.ObjectConfig{
+		Name:   "Object",
+		Fields: objectFields,
+	})
+
+	eventType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Event",
+		Fields: graphql.Fields{
+			"event":  &graphql.Field{Type: graphql.String},
+			"user":   &graphql.Field{Type: graphql.String},
+			"app":    &graphql.Field{Type: graphql.String},
+			"object": &graphql.Field{Type: graphql.String},
+			"plugin": &graphql.Field{Type: graphql.String},
+			"key":    &graphql.Field{Type: graphql.String},
+			"type":   &graphql.Field{Type: graphql.String},
+			"tags":   &graphql.Field{Type: graphql.String},
+			"data":   &graphql.Field{Type: gqlJSON},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"user": &graphql.Field{
+				Type: userType,
+				Args: graphql.FieldConfigArgument{
+					"username": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"icon":     &graphql.ArgumentConfig{Type: graphql.Boolean},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return readUser(p, p.Args["username"].(string))
+				},
+			},
+			"users": &graphql.Field{
+				Type: graphql.NewList(userType),
+				Args: iconArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					ul, err := gqlCTX(p.Context).DB.ListUsers(&database.ListUsersOptions{
+						ReadUserOptions: database.ReadUserOptions{Icon: gqlBool(p.Args, "icon")},
+					})
+					if err != nil {
+						return nil, err
+					}
+					return gqlMap(ul)
+				},
+			},
+			"app": &graphql.Field{
+				Type: appType,
+				Args: graphql.FieldConfigArgument{
+					"id":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"icon": &graphql.ArgumentConfig{Type: graphql.Boolean},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					a, err := gqlCTX(p.Context).DB.ReadApp(p.Args["id"].(string), &database.ReadAppOptions{
+						Icon: gqlBool(p.Args, "icon"),
+					})
+					if err != nil {
+						return nil, err
+					}
+					return gqlMap(a)
+				},
+			},
+			"apps": &graphql.Field{
+				Type: graphql.NewList(appType),
+				Args: graphql.FieldConfigArgument{
+					"owner":  &graphql.ArgumentConfig{Type: graphql.String},
+					"plugin": &graphql.ArgumentConfig{Type: graphql.String},
+					"icon":   &graphql.ArgumentConfig{Type: graphql.Boolean},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					al, err := gqlCTX(p.Context).DB.ListApps(&database.ListAppOptions{
+						ReadAppOptions: database.ReadAppOptions{Icon: gqlBool(p.Args, "icon")},
+						Owner:          gqlString(p.Args, "owner"),
+						Plugin:         gqlString(p.Args, "plugin"),
+					})
+					if err != nil {
+						return nil, err
+					}
+					return gqlMap(al)
+				},
+			},
+			"object": &graphql.Field{
+				Type: objectType,
+				Args: graphql.FieldConfigArgument{
+					"id":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"icon": &graphql.ArgumentConfig{Type: graphql.Boolean},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					o, err := gqlCTX(p.Context).DB.ReadObject(p.Args["id"].(string), &database.ReadObjectOptions{
+						Icon: gqlBool(p.Args, "icon"),
+					})
+					if err != nil {
+						return nil, err
+					}
+					return gqlMap(o)
+				},
+			},
+			"objects": &graphql.Field{
+				Type: graphql.NewList(objectType),
+				Args: graphql.FieldConfigArgument{
+					"owner": &graphql.ArgumentConfig{Type: graphql.String},
+					"app":   &graphql.ArgumentConfig{Type: graphql.String},
+					"type":  &graphql.ArgumentConfig{Type: graphql.String},
+					"tags":  &graphql.ArgumentConfig{Type: graphql.String},
+					"key":   &graphql.ArgumentConfig{Type: graphql.String},
+					"limit": &graphql.ArgumentConfig{Type: graphql.Int},
+					"icon":  &graphql.ArgumentConfig{Type: graphql.Boolean},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return listObjects(p, &database.ListObjectsOptions{
+						Owner: gqlString(p.Args, "owner"),
+						App:   gqlString(p.Args, "app"),
+					})
+				},
+			},
+		},
+	})
+
+	subscriptionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Subscription",
+		Fields: graphql.Fields{
+			"events": &graphql.Field{
+				Type:        eventType,
+				Description: "Subscribe to events, with the same targeting as the event websocket",
+				Args: graphql.FieldConfigArgument{
+					"event":  &graphql.ArgumentConfig{Type: graphql.String},
+					"user":   &graphql.ArgumentConfig{Type: graphql.String},
+					"app":    &graphql.ArgumentConfig{Type: graphql.String},
+					"object": &graphql.ArgumentConfig{Type: graphql.String},
+					"type":   &graphql.ArgumentConfig{Type: graphql.String},
+					"plugin": &graphql.ArgumentConfig{Type: graphql.String},
+					"key":    &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+					e := events.Event{
+						Plugin: gqlString(p.Args, "plugin"),
+						Key:    gqlString(p.Args, "key"),
+					}
+					if v := gqlString(p.Args, "event"); v != nil {
+						e.Event = *v
+					}
+					if v := gqlString(p.Args, "user"); v != nil {
+						e.User = *v
+					}
+					if v := gqlString(p.Args, "app"); v != nil {
+						e.App = *v
+					}
+					if v := gqlString(p.Args, "object"); v != nil {
+						e.Object = *v
+					}
+					if v := gqlString(p.Args, "type"); v != nil {
+						e.Type = *v
+					}
+					if err := events.CanSubscribe(gqlCTX(p.Context).DB, &e); err != nil {
+						return nil, err
+					}
+					h := newChanEventHandler()
+					router := events.NewRouter()
+					if err := router.Subscribe(e, h); err != nil {
+						return nil, err
+					}
+					events.AddHandler(router)
+					go func() {
+						<-p.Context.Done()
+						events.RemoveHandler(router)
+					}()
+					return h.c, nil
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:        queryType,
+		Subscription: subscriptionType,
+	})
+}
+
+// The schema is cached for the active configuration
+var (
+	gqlSchemaLock   sync.Mutex
+	gqlSchema       *graphql.Schema
+	gqlSchemaConfig *assets.Configuration
+)
+
+func getGraphQLSchema(c *assets.Configuration) (*graphql.Schema, error) {
+	gqlSchemaLock.Lock()
+	defer gqlSchemaLock.Unlock()
+	if gqlSchema == nil || gqlSchemaConfig != c {
+		s, err := NewGraphQLSchema(c)
+		if err != nil {
+			return nil, err
+		}
+		gqlSchema = &s
+		gqlSchemaConfig = c
+	}
+	return gqlSchema, nil
+}
+
+type graphQLRequest struct {
+	ID            string                 `json:"id,omitempty"`
+	Type          string                 `json:"type,omitempty"`
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+type graphQLMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload *graphql.Result `json:"payload,omitempty"`
+}
+
+// GraphQL runs a GraphQL query. Queries can be sent either as POST with a json body, or as GET with
+// query, operationName and variables url params.
+func GraphQL(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	schema, err := getGraphQLSchema(c.DB.AdminDB().Assets().GetConfig())
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	var q graphQLRequest
+	if r.Method == http.MethodPost {
+		if err = rest.UnmarshalRequest(r, &q); err != nil {
+			rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		qv := r.URL.Query()
+		q.Query = qv.Get("query")
+		q.OperationName = qv.Get("operationName")
+		if v := qv.Get("variables"); v != "" {
+			if err = json.Unmarshal([]byte(v), &q.Variables); err != nil {
+				rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+	}
+	res := graphql.Do(graphql.Params{
+		Schema:         *schema,
+		RequestString:  q.Query,
+		OperationName:  q.OperationName,
+		VariableValues: q.Variables,
+		Context:        r.Context(),
+	})
+	rest.WriteJSON(w, r, res, nil)
+}
+
+// GraphQLWebsocket runs GraphQL subscriptions over a websocket. Each message sent by the client is a query
+// with an id (type "start"), or a message of type "stop" with the id of a running subscription.
+// The server responds with messages of type "data" holding the results, and "complete" once a
+// subscription finishes.
+func GraphQLWebsocket(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	cfg := c.DB.AdminDB().Assets().GetConfig()
+	if c.DB.ID() == "public" && cfg.AllowPublicWebsocket != nil && !*cfg.AllowPublicWebsocket {
+		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("The public is not allowed to access event websockets"))
+		return
+	}
+	schema, err := getGraphQLSchema(cfg)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	ws, closed := acceptWebsocket(w, r)
+	if ws == nil {
+		return
+	}
+	defer closed()
+	activeWebsockets.WithLabelValues("graphql").Inc()
+	defer activeWebsockets.WithLabelValues("graphql").Dec()
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go closeOnShutdown(ctx, ws)
+
+	var wlock sync.Mutex
+	write := func(m *graphQLMessage) error {
+		wlock.Lock()
+		defer wlock.Unlock()
+		wctx, wcancel := context.WithTimeout(ctx, 10*time.Second)
+		defer wcancel()
+		return wsjson.Write(wctx, ws, m)
+	}
+
+	var slock sync.Mutex
+	subscriptions := make(map[string]context.CancelFunc)
+
+	for {
+		var q graphQLRequest
+		if err = wsjson.Read(ctx, ws, &q); err != nil {
+			break
+		}
+		if q.Type == "stop" {
+			slock.Lock()
+			if scancel, ok := subscriptions[q.ID]; ok {
+				scancel()
+				delete(subscriptions, q.ID)
+			}
+			slock.Unlock()
+			continue
+		}
+		sctx, scancel := context.WithCancel(ctx)
+		slock.Lock()
+		if oldcancel, ok := subscriptions[q.ID]; ok {
+			oldcancel()
+		}
+		subscriptions[q.ID] = scancel
+		slock.Unlock()
+
+		go func(q graphQLRequest) {
+			resc := graphql.Subscribe(graphql.Params{
+				Schema:         *schema,
+				RequestString:  q.Query,
+				OperationName:  q.OperationName,
+				VariableValues: q.Variables,
+				Context:        sctx,
+			})
+			for res := range resc {
+				if err := write(&graphQLMessage{ID: q.ID, Type: "data", Payload: res}); err != nil {
+					c.Log.Debug("GraphQL websocket write error: ", err)
+					scancel()
+					return
+				}
+			}
+			write(&graphQLMessage{ID: q.ID, Type: "complete"})
+		}(q)
+	}
+
+	cancel()
+	var cerr websocket.CloseError
+	if !errors.As(err, &cerr) {
+		c.Log.Debug("GraphQL websocket closed: ", err)
+		ws.Close(websocket.StatusInternalError, err.Error())
+		return
+	}
+	ws.Close(websocket.StatusNormalClosure, "")
+}
+
+// GraphQLHandler serves GraphQL queries, upgrading to a websocket for subscriptions
+func GraphQLHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		GraphQLWebsocket(w, r)
+		return
+	}
+	GraphQL(w, r)
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/events"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func newDBWithUser(t *testing.T) (*database.AdminDB, func()) {
+	a, err := assets.Open("", nil)
+	require.NoError(t, err)
+	os.RemoveAll("./test_db")
+	a.FolderPath = "./test_db"
+	sqla := "sqlite3://heedy.db?_journal=WAL&_fk=1"
+	a.Config.SQL = &sqla
+	cleanup := func() {
+		os.RemoveAll("./test_db")
+	}
+
+	err = database.Create(a)
+	if err != nil {
+		cleanup()
+	}
+	require.NoError(t, err)
+	adb, err := database.Open(a)
+	require.NoError(t, err)
+
+	name := "test"
+	passwd := "test"
+	require.NoError(t, adb.CreateUser(&database.User{
+		UserName: &name,
+		Password: &passwd,
+	}))
+	return adb, cleanup
+}
+
+// withContext returns the request with a heedy request context that accesses the given database
+func withContext(r *http.Request, db database.DB) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), rest.HeedyContext, &rest.Context{
+		Log: logrus.WithField("test", true),
+		DB:  db,
+	}))
+}
+
+func TestGraphQL(t *testing.T) {
+	adb, cleanup := newDBWithUser(t)
+	defer cleanup()
+	db := database.NewUserDB(adb, "test")
+
+	oname := "myobject"
+	otype := "timeseries"
+	uname := "test"
+	_, err := db.CreateObject(&database.Object{
+		Details: database.Details{Name: &oname},
+		Type:    &otype,
+		Owner:   &uname,
+	})
+	require.NoError(t, err)
+
+	query := func(r *http.Request) map[string]interface{} {
+		rec := httptest.NewRecorder()
+		GraphQLHandler(rec, withContext(r, db))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var res map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		return res
+	}
+
+	// Queries can be posted as json, and include the relations of users
+	res := query(httptest.NewRequest(http.MethodPost, "/api/graphql",
+		strings.NewReader(`{"query": "query q($u: String!) { user(username: $u) { username objects { name } } }", "variables": {"u": "test"}}`)))
+	require.Nil(t, res["errors"])
+	require.Equal(t, map[string]interface{}{
+		"user": map[string]interface{}{
+			"username": "test",
+			"objects":  []interface{}{map[string]interface{}{"name": "myobject"}},
+		},
+	}, res["data"])
+
+	// or given in the url
+	v := url.Values{}
+	v.Set("query", "query q($u: String!) { user(username: $u) { username } }")
+	v.Set("variables", `{"u": "test"}`)
+	res = query(httptest.NewRequest(http.MethodGet, "/api/graphql?"+v.Encode(), nil))
+	require.Equal(t, map[string]interface{}{"user": map[string]interface{}{"username": "test"}}, res["data"])
+
+	// Errors of the query are returned in the result
+	res = query(httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(`{"query": "{ user(username: \"nobody\") { username } }"}`)))
+	require.NotEmpty(t, res["errors"])
+
+	// Queries run with the permissions of the requester
+	rec := httptest.NewRecorder()
+	GraphQLHandler(rec, withContext(httptest.NewRequest(http.MethodPost, "/api/graphql",
+		strings.NewReader(`{"query": "{ objects { name } }"}`)), database.NewPublicDB(adb)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotContains(t, rec.Body.String(), "myobject")
+
+	rec = httptest.NewRecorder()
+	GraphQLHandler(rec, withContext(httptest.NewRequest(http.MethodGet, "/api/graphql?variables=notjson", nil), db))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestChanEventHandler(t *testing.T) {
+	h := newChanEventHandler()
+
+	// Events are delivered in the order they were fired
+	for _, e := range []string{"first", "second", "third"} {
+		h.Fire(&events.Event{Event: e})
+	}
+	for _, e := range []string{"first", "second", "third"} {
+		ev := <-h.c
+		require.Equal(t, e, ev.(map[string]interface{})["event"])
+	}
+
+	// A subscriber that doesn't keep up is dropped, without blocking the events
+	for i := 0; i < graphQLEventBuffer+10; i++ {
+		h.Fire(&events.Event{Event: "overflow"})
+	}
+	n := 0
+	for range h.c {
+		n++
+	}
+	require.Equal(t, graphQLEventBuffer, n)
+	h.Fire(&events.Event{Event: "closed"})
+}
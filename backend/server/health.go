@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/plugins"
+	"github.com/heedy/heedy/backend/plugins/run"
+	"github.com/heedy/heedy/backend/updater"
+)
+
+// DatabaseStatus shows whether the database can be queried
+type DatabaseStatus struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// UpdateStatus shows whether there are updates waiting for a restart, and the error of the last failed update
+type UpdateStatus struct {
+	Pending bool   `json:"pending"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ReadyStatus is returned from /api/server/ready to admins. Everyone else only gets whether heedy is ready.
+type ReadyStatus struct {
+	Ready    bool               `json:"ready"`
+	Plugins  plugins.Status     `json:"plugins"`
+	Runners  []run.RunnerStatus `json:"runners"`
+	Database DatabaseStatus     `json:"database"`
+	Updates  UpdateStatus       `json:"updates"`
+}
+
+// exitedCleanly returns whether the runner's process finished successfully, and was not restarted
+// because its restart policy didn't ask for it
+func exitedCleanly(s run.RunnerStatus) bool {
+	return (s.Status == run.StatusExited || s.Status == run.StatusFailed) && s.ExitCode != nil && *s.ExitCode == 0 && len(s.Violations) == 0
+}
+
+// GetReadyStatus checks whether heedy is ready to serve requests
+func GetReadyStatus(r *http.Request, db *database.AdminDB, pm *plugins.PluginManager) *ReadyStatus {
+	rs := &ReadyStatus{
+		Plugins: pm.Status(),
+		Runners: pm.RunManager.Status(),
+	}
+	rs.Ready = rs.Plugins.Status == "ready"
+
+	var one int
+	if err := db.DB.GetContext(r.Context(), &one, "SELECT 1;"); err != nil {
+		rs.Database.Error = err.Error()
+		rs.Ready = false
+	} else {
+		rs.Database.OK = true
+	}
+
+	for _, s := range rs.Runners {
+		if s.Status != run.StatusRunning && s.Status != run.StatusScheduled && !exitedCleanly(s) {
+			rs.Ready = false
+		}
+	}
+
+	folder := db.Assets().FolderPath
+	rs.Updates.Pending = updater.Available(folder)
+	if err := updater.Status(folder); err != nil {
+		rs.Updates.Error = err.Error()
+	}
+	return rs
+}
+
+// HealthMiddleware serves /api/server/health and /api/server/ready. They don't require authentication,
+// and are available while plugins are loading, so that they can be used by service managers and container health checks.
+// The status of the plugins, database and updates is only shown to admins.
+func HealthMiddleware(db *database.AdminDB, auth *Auth, pm *plugins.PluginManager, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			switch r.URL.Path {
+			case "/api/server/health":
+				// If heedy can respond, it is alive
+				rest.WriteJSON(w, r, map[string]string{"status": "ok"}, nil)
+				return
+			case "/api/server/ready":
+				rs := GetReadyStatus(r, db, pm)
+				status := http.StatusOK
+				if !rs.Ready {
+					status = http.StatusServiceUnavailable
+				}
+				if rdb, err := auth.Authenticate(w, r); err != nil || !isAdminDB(rdb) {
+					rest.WriteJSONStatus(w, r, map[string]bool{"ready": rs.Ready}, status)
+					return
+				}
+				rest.WriteJSONStatus(w, r, rs, status)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
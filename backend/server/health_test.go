@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/heedy/heedy/backend/plugins"
+	"github.com/heedy/heedy/backend/plugins/run"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthMiddleware(t *testing.T) {
+	adb, cleanup := newDBWithUser(t)
+	defer cleanup()
+	pm, err := plugins.NewPluginManager(adb, http.NotFoundHandler())
+	require.NoError(t, err)
+	defer pm.Close()
+
+	h := HealthMiddleware(adb, NewAuth(adb), pm, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	serve := func(method, path, token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			r.AddCookie(&http.Cookie{Name: "token", Value: token})
+		}
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	// heedy is alive as soon as it responds
+	rec := serve(http.MethodGet, "/api/server/health", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"status": "ok"}`, rec.Body.String())
+
+	// but isn't ready while its plugins are loading. The public and other users only see that it isn't ready.
+	rec = serve(http.MethodGet, "/api/server/ready", "")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.JSONEq(t, `{"ready": false}`, rec.Body.String())
+	token, err := adb.AddLoginToken("test", "test")
+	require.NoError(t, err)
+	rec = serve(http.MethodGet, "/api/server/ready", token)
+	require.JSONEq(t, `{"ready": false}`, rec.Body.String())
+
+	// while admins get the details
+	admins := []string{"test"}
+	adb.Assets().Config.AdminUsers = &admins
+	rec = serve(http.MethodGet, "/api/server/ready", token)
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var rs ReadyStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rs))
+	require.False(t, rs.Ready)
+	require.Equal(t, "loading", rs.Plugins.Status)
+	require.True(t, rs.Database.OK)
+	require.False(t, rs.Updates.Pending)
+
+	// Other requests are passed on
+	require.Equal(t, http.StatusTeapot, serve(http.MethodPost, "/api/server/ready", "").Code)
+	require.Equal(t, http.StatusTeapot, serve(http.MethodGet, "/api/server/version", "").Code)
+}
+
+func TestExitedCleanly(t *testing.T) {
+	code := func(c int) *int { return &c }
+	require.True(t, exitedCleanly(run.RunnerStatus{Status: run.StatusFailed, ExitCode: code(0)}))
+	require.True(t, exitedCleanly(run.RunnerStatus{Status: run.StatusExited, ExitCode: code(0)}))
+	require.False(t, exitedCleanly(run.RunnerStatus{Status: run.StatusFailed, ExitCode: code(1)}))
+	require.False(t, exitedCleanly(run.RunnerStatus{Status: run.StatusFailed}))
+	require.False(t, exitedCleanly(run.RunnerStatus{Status: run.StatusFailed, ExitCode: code(0), Violations: []string{"memory"}}))
+	require.False(t, exitedCleanly(run.RunnerStatus{Status: run.StatusRestarting, ExitCode: code(0)}))
+}
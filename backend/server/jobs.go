@@ -0,0 +1,123 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/plugins/run"
+)
+
+// AddRunnerRoutes adds the API routes that need access to the plugins' runners. They are added
+// separately from APIMux, since the run manager is created after the API.
+func AddRunnerRoutes(apiMux *chi.Mux, m *run.Manager) {
+	apiMux.Get("/server/plugins/{plugin}/jobs", func(w http.ResponseWriter, r *http.Request) {
+		GetPluginJobs(w, r, m)
+	})
+	apiMux.Get("/server/jobs", func(w http.ResponseWriter, r *http.Request) {
+		ListCronJobs(w, r, m)
+	})
+	apiMux.Get("/server/jobs/{plugin}/{name}", func(w http.ResponseWriter, r *http.Request) {
+		ReadCronJob(w, r, m)
+	})
+	apiMux.Patch("/server/jobs/{plugin}/{name}", func(w http.ResponseWriter, r *http.Request) {
+		UpdateCronJob(w, r, m)
+	})
+	apiMux.Post("/server/jobs/{plugin}/{name}/run", func(w http.ResponseWriter, r *http.Request) {
+		TriggerCronJob(w, r, m)
+	})
+}
+
+// isAdminDB returns whether the database belongs to an admin
+func isAdminDB(db database.DB) bool {
+	return db.Type() == database.AdminType || db.AdminDB().Assets().GetConfig().UserIsAdmin(db.ID())
+}
+
+// isAdmin writes an error to the response if the request doesn't come from an admin
+func isAdmin(w http.ResponseWriter, r *http.Request, what string) bool {
+	if !isAdminDB(rest.CTX(r).DB) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, fmt.Errorf("%s are admin-only", what))
+		return false
+	}
+	return true
+}
+
+// writeCronJob writes the cron job, or the error of the request, with a status that matches the error
+func writeCronJob(w http.ResponseWriter, r *http.Request, j *run.CronJob, err error) {
+	switch {
+	case err == nil:
+		rest.WriteJSON(w, r, j, nil)
+	case err == run.ErrJobRunning:
+		rest.WriteJSONError(w, r, http.StatusConflict, err)
+	case strings.HasPrefix(err.Error(), "not_found:"):
+		rest.WriteJSONError(w, r, http.StatusNotFound, err)
+	default:
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+	}
+}
+
+// ListCronJobs returns all scheduled jobs, with their next and previous run times and last result
+func ListCronJobs(w http.ResponseWriter, r *http.Request, m *run.Manager) {
+	if isAdmin(w, r, "Cron jobs") {
+		rest.WriteJSON(w, r, m.CronJobs(), nil)
+	}
+}
+
+// ReadCronJob returns a single cron job
+func ReadCronJob(w http.ResponseWriter, r *http.Request, m *run.Manager) {
+	if isAdmin(w, r, "Cron jobs") {
+		j, err := m.GetCronJob(chi.URLParam(r, "plugin"), chi.URLParam(r, "name"))
+		writeCronJob(w, r, j, err)
+	}
+}
+
+// UpdateCronJob pauses, resumes or changes the schedule of a cron job until heedy is restarted
+func UpdateCronJob(w http.ResponseWriter, r *http.Request, m *run.Manager) {
+	if !isAdmin(w, r, "Cron jobs") {
+		return
+	}
+	var u run.CronJobUpdate
+	if err := rest.UnmarshalRequest(r, &u); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	plugin, name := chi.URLParam(r, "plugin"), chi.URLParam(r, "name")
+	if err := m.UpdateCronJob(plugin, name, &u); err != nil {
+		writeCronJob(w, r, nil, err)
+		return
+	}
+	j, err := m.GetCronJob(plugin, name)
+	writeCronJob(w, r, j, err)
+}
+
+// TriggerCronJob starts a run of a cron job right away
+func TriggerCronJob(w http.ResponseWriter, r *http.Request, m *run.Manager) {
+	if !isAdmin(w, r, "Cron jobs") {
+		return
+	}
+	err := m.TriggerCronJob(chi.URLParam(r, "plugin"), chi.URLParam(r, "name"))
+	if err != nil {
+		writeCronJob(w, r, nil, err)
+		return
+	}
+	rest.WriteResult(w, r, nil)
+}
+
+// GetPluginJobs returns the recent runs of a plugin's cron jobs, most recent first. The runs
+// of a single job can be requested with the name query parameter.
+func GetPluginJobs(w http.ResponseWriter, r *http.Request, m *run.Manager) {
+	if !isAdmin(w, r, "Plugin jobs") {
+		return
+	}
+	pluginName := chi.URLParam(r, "plugin")
+	if _, ok := rest.CTX(r).DB.AdminDB().Assets().GetConfig().Plugins[pluginName]; !ok {
+		rest.WriteJSONError(w, r, http.StatusNotFound, errors.New("Plugin not found"))
+		return
+	}
+	rest.WriteJSON(w, r, m.Jobs(pluginName, r.URL.Query().Get("name")), nil)
+}
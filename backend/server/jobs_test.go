@@ -0,0 +1,169 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/plugins/run"
+)
+
+// testRunType is a runtype whose jobs succeed unless they are named "fail". Jobs named "slow"
+// keep running until release is closed.
+type testRunType struct {
+	release chan struct{}
+}
+
+func (tt testRunType) Start(i *run.Info) (http.Handler, error) { return nil, nil }
+func (tt testRunType) Run(i *run.Info) error {
+	switch i.Name {
+	case "fail":
+		return errors.New("failed")
+	case "slow":
+		<-tt.release
+	}
+	return nil
+}
+func (tt testRunType) Stop(apikey string) error { return nil }
+func (tt testRunType) Kill(apikey string) error { return nil }
+
+// newJobManager returns a run manager with the given cron jobs of the plugin testy
+func newJobManager(t *testing.T, adb *database.AdminDB, rt testRunType, jobs ...string) *run.Manager {
+	adb.Assets().Config.Plugins["testy"] = &assets.Plugin{}
+	m := run.NewManager(adb)
+	m.RunTypes["test"] = rt
+	for _, name := range jobs {
+		rtype := "test"
+		schedule := "@every 1h"
+		require.NoError(t, m.Start("testy", name, &assets.Run{Type: &rtype, Cron: &schedule}))
+	}
+	return m
+}
+
+// runnerRequest makes a request to the runner routes with the given database, returning the
+// response code, and decoding the response into v on success
+func runnerRequest(t *testing.T, m *run.Manager, db database.DB, method, path, body string, v interface{}) int {
+	apiMux := chi.NewMux()
+	AddRunnerRoutes(apiMux, m)
+	rec := httptest.NewRecorder()
+	apiMux.ServeHTTP(rec, withContext(httptest.NewRequest(method, path, strings.NewReader(body)), db))
+	if rec.Code == http.StatusOK && v != nil {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v))
+	}
+	return rec.Code
+}
+
+func TestGetPluginJobs(t *testing.T) {
+	adb, cleanup := newDBWithUser(t)
+	defer cleanup()
+	m := newJobManager(t, adb, testRunType{}, "job", "fail")
+	defer m.Kill()
+
+	for _, name := range []string{"job", "fail", "job"} {
+		r, err := m.Find("testy", name)
+		require.NoError(t, err)
+		r.Run()
+	}
+
+	var jobs []run.Job
+	require.Equal(t, http.StatusOK, runnerRequest(t, m, adb, http.MethodGet, "/server/plugins/testy/jobs", "", &jobs))
+	require.Len(t, jobs, 3)
+	require.Equal(t, "job", jobs[0].Name)
+	require.Equal(t, run.JobSuccess, jobs[0].Status)
+	require.Equal(t, "fail", jobs[1].Name)
+	require.Equal(t, run.JobError, jobs[1].Status)
+	require.Equal(t, "failed", jobs[1].Error)
+
+	jobs = nil
+	require.Equal(t, http.StatusOK, runnerRequest(t, m, adb, http.MethodGet, "/server/plugins/testy/jobs?name=fail", "", &jobs))
+	require.Len(t, jobs, 1)
+
+	require.Equal(t, http.StatusNotFound, runnerRequest(t, m, adb, http.MethodGet, "/server/plugins/notaplugin/jobs", "", nil))
+	require.Equal(t, http.StatusForbidden, runnerRequest(t, m, database.NewUserDB(adb, "test"), http.MethodGet, "/server/plugins/testy/jobs", "", nil))
+}
+
+func TestCronJobs(t *testing.T) {
+	adb, cleanup := newDBWithUser(t)
+	defer cleanup()
+	rt := testRunType{release: make(chan struct{})}
+	m := newJobManager(t, adb, rt, "job", "slow")
+	defer m.Kill()
+
+	var jobs []run.CronJob
+	require.Equal(t, http.StatusOK, runnerRequest(t, m, adb, http.MethodGet, "/server/jobs", "", &jobs))
+	require.Len(t, jobs, 2)
+	require.Equal(t, "job", jobs[0].Name)
+	require.Equal(t, "slow", jobs[1].Name)
+	require.True(t, jobs[0].Enabled)
+	require.NotNil(t, jobs[0].Next)
+	require.Nil(t, jobs[0].Last)
+
+	patch := func(body string) (*run.CronJob, int) {
+		var j run.CronJob
+		code := runnerRequest(t, m, adb, http.MethodPatch, "/server/jobs/testy/job", body, &j)
+		return &j, code
+	}
+
+	// Jobs can be paused
+	j, code := patch(`{"enabled": false}`)
+	require.Equal(t, http.StatusOK, code)
+	require.False(t, j.Enabled)
+	require.Nil(t, j.Next)
+
+	// and rescheduled, which keeps them paused
+	j, code = patch(`{"schedule": "*/5 * * * *"}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "*/5 * * * *", j.Schedule)
+	require.Equal(t, "@every 1h", j.DefaultSchedule)
+	require.False(t, j.Enabled)
+
+	j, code = patch(`{"enabled": true, "schedule": ""}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "@every 1h", j.Schedule)
+	require.True(t, j.Enabled)
+	require.NotNil(t, j.Next)
+
+	_, code = patch(`{"schedule": "not a schedule"}`)
+	require.Equal(t, http.StatusBadRequest, code)
+	_, code = patch(`notjson`)
+	require.Equal(t, http.StatusBadRequest, code)
+
+	// Jobs that don't exist aren't found
+	require.Equal(t, http.StatusNotFound, runnerRequest(t, m, adb, http.MethodGet, "/server/jobs/testy/notajob", "", nil))
+	require.Equal(t, http.StatusNotFound, runnerRequest(t, m, adb, http.MethodPatch, "/server/jobs/testy/notajob", `{"enabled": false}`, nil))
+	require.Equal(t, http.StatusNotFound, runnerRequest(t, m, adb, http.MethodPost, "/server/jobs/testy/notajob/run", "", nil))
+
+	// Jobs can be triggered manually
+	require.Equal(t, http.StatusOK, runnerRequest(t, m, adb, http.MethodPost, "/server/jobs/testy/job/run", "", nil))
+	require.Eventually(t, func() bool {
+		j := &run.CronJob{}
+		runnerRequest(t, m, adb, http.MethodGet, "/server/jobs/testy/job", "", j)
+		return j.Last != nil && j.Last.Status == run.JobSuccess && j.Prev != nil
+	}, time.Second, 10*time.Millisecond)
+
+	// but not while they are already running
+	require.Equal(t, http.StatusOK, runnerRequest(t, m, adb, http.MethodPost, "/server/jobs/testy/slow/run", "", nil))
+	require.Eventually(t, func() bool {
+		j := &run.CronJob{}
+		runnerRequest(t, m, adb, http.MethodGet, "/server/jobs/testy/slow", "", j)
+		return j.Running
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, http.StatusConflict, runnerRequest(t, m, adb, http.MethodPost, "/server/jobs/testy/slow/run", "", nil))
+	close(rt.release)
+
+	// The cron job routes are admin-only
+	udb := database.NewUserDB(adb, "test")
+	require.Equal(t, http.StatusForbidden, runnerRequest(t, m, udb, http.MethodGet, "/server/jobs", "", nil))
+	require.Equal(t, http.StatusForbidden, runnerRequest(t, m, udb, http.MethodGet, "/server/jobs/testy/job", "", nil))
+	require.Equal(t, http.StatusForbidden, runnerRequest(t, m, udb, http.MethodPatch, "/server/jobs/testy/job", `{"enabled": false}`, nil))
+	require.Equal(t, http.StatusForbidden, runnerRequest(t, m, udb, http.MethodPost, "/server/jobs/testy/job/run", "", nil))
+}
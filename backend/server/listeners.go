@@ -0,0 +1,114 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/plugins/run"
+)
+
+// adminAPI holds the routes of heedy's admin API, which can be kept off listeners that are exposed publicly.
+// Active plugins add their own admin routes with admin_routes in their configuration.
+var adminAPI = []string{
+	"/api/server/admin",
+	"/api/server/updates",
+	"/api/server/metrics",
+	"/api/server/plugins",
+	"/api/server/jobs",
+	"/api/server/restart",
+	"/api/server/reload",
+}
+
+// adminOnlyAllowed are the routes other than the admin API that are served on admin-only listeners,
+// so that admins can log in and check on the server
+var adminOnlyAllowed = map[string]bool{
+	"/auth/token":         true,
+	"/api/server/health":  true,
+	"/api/server/ready":   true,
+	"/api/server/version": true,
+}
+
+func hasRoutePrefix(path string, routes []string) bool {
+	for _, p := range routes {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isAdminAPI returns whether the path belongs to heedy's admin API, or to the admin routes of an active plugin
+func isAdminAPI(c *assets.Configuration, path string) bool {
+	if hasRoutePrefix(path, adminAPI) {
+		return true
+	}
+	for _, pname := range c.GetActivePlugins() {
+		if p, ok := c.Plugins[pname]; ok && p.AdminRoutes != nil && hasRoutePrefix(path, *p.AdminRoutes) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListenerMiddleware restricts the routes served on a listener: listeners without the admin API
+// don't serve it, and admin-only listeners serve nothing else.
+func ListenerMiddleware(a *assets.Assets, l assets.Listener, h http.Handler) http.Handler {
+	if !l.IsAdminOnly() && l.ServesAdminAPI() {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admin := isAdminAPI(a.GetConfig(), r.URL.Path)
+		if l.IsAdminOnly() && !admin && !adminOnlyAllowed[r.URL.Path] || !l.ServesAdminAPI() && admin {
+			rest.WriteJSONError(w, r, http.StatusNotFound, errors.New("not_found: The given endpoint is not available"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// listen opens the address of a listener. Unix sockets are given the configured permissions,
+// and a socket file left over from a previous run is replaced.
+func listen(a *assets.Assets, l assets.Listener) (ln net.Listener, isUnix bool, err error) {
+	if !strings.HasPrefix(*l.Address, "unix://") {
+		ln, err = net.Listen("tcp", *l.Address)
+		return
+	}
+	sockfile, _, err := run.ParseUnixSock(a.FolderPath, *l.Address)
+	if err != nil {
+		return nil, true, err
+	}
+	if fi, serr := os.Stat(sockfile); serr == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, true, fmt.Errorf("Can't listen on %s: the file exists and is not a socket", sockfile)
+		}
+		if err = os.Remove(sockfile); err != nil {
+			return nil, true, err
+		}
+	}
+	ln, err = net.Listen("unix", sockfile)
+	if err != nil || l.Permissions == nil {
+		return ln, true, err
+	}
+	perm, _ := strconv.ParseUint(*l.Permissions, 8, 32)
+	if err = os.Chmod(sockfile, os.FileMode(perm)); err != nil {
+		ln.Close()
+		return nil, true, err
+	}
+	return ln, true, nil
+}
+
+// listenPluginAPI opens the unix socket on which plugin processes without network access reach heedy's API.
+// Only heedy's own user can connect to it.
+func listenPluginAPI(a *assets.Assets) (net.Listener, error) {
+	addr := "unix://" + run.APISocket(a.DataDir())
+	perm := "0600"
+	ln, _, err := listen(a, assets.Listener{Address: &addr, Permissions: &perm})
+	return ln, err
+}
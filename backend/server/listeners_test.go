@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heedy/heedy/backend/assets"
+)
+
+func TestListenerMiddleware(t *testing.T) {
+	a, err := assets.Open("", nil)
+	require.NoError(t, err)
+	yes, no := true, false
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	serves := func(l assets.Listener, path string) bool {
+		rec := httptest.NewRecorder()
+		ListenerMiddleware(a, l, ok).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code == http.StatusTeapot
+	}
+
+	// By default, listeners serve everything
+	for _, p := range []string{"/", "/api/users/test", "/api/server/updates/status", "/api/server/jobs", "/api/timeseries/compact"} {
+		require.True(t, serves(assets.Listener{}, p), p)
+		require.True(t, serves(assets.Listener{AdminAPI: &yes}, p), p)
+	}
+
+	// Public listeners can leave out the admin API
+	public := assets.Listener{AdminAPI: &no}
+	for _, p := range []string{"/api/server/admin", "/api/server/updates/heedy.conf", "/api/server/metrics", "/api/server/plugins/testy/logs", "/api/server/jobs/testy/job/run", "/api/server/restart", "/api/server/reload", "/api/timeseries/compact"} {
+		require.False(t, serves(public, p), p)
+	}
+	for _, p := range []string{"/", "/auth/token", "/api/users/test", "/api/server/version", "/api/server/health", "/api/server/updatesandmore", "/api/timeseries/dataset"} {
+		require.True(t, serves(public, p), p)
+	}
+
+	// while admin-only listeners serve the admin API, and what admins need to log in and check the server
+	admin := assets.Listener{AdminOnly: &yes}
+	for _, p := range []string{"/api/server/admin/test", "/api/server/updates", "/api/server/metrics", "/auth/token", "/api/server/ready", "/api/server/version"} {
+		require.True(t, serves(admin, p), p)
+	}
+	for _, p := range []string{"/", "/api/users/test", "/api/objects/123", "/api/server/scope"} {
+		require.False(t, serves(admin, p), p)
+	}
+
+	// An admin-only listener without the admin API serves only the allowed routes
+	require.False(t, serves(assets.Listener{AdminOnly: &yes, AdminAPI: &no}, "/api/server/updates"))
+	require.True(t, serves(assets.Listener{AdminOnly: &yes, AdminAPI: &no}, "/api/server/health"))
+
+	// Plugins declare their own admin routes, which are only part of the admin API while the plugin is active
+	require.False(t, serves(public, "/api/timeseries/compact/all"))
+	active := []string{"notifications", "registry", "python", "kv"}
+	a.Config.ActivePlugins = &active
+	require.True(t, serves(public, "/api/timeseries/compact"))
+
+	rec := httptest.NewRecorder()
+	ListenerMiddleware(a, public, ok).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/server/admin", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Contains(t, rec.Body.String(), "not_found")
+}
+
+func TestListenUnix(t *testing.T) {
+	dir := t.TempDir()
+	a := &assets.Assets{FolderPath: dir}
+	addr := "unix://admin.sock"
+	perm := "0600"
+	l := assets.Listener{Address: &addr, Permissions: &perm}
+	sockfile := filepath.Join(dir, "admin.sock")
+
+	ln, isUnix, err := listen(a, l)
+	require.NoError(t, err)
+	require.True(t, isUnix)
+	fi, err := os.Stat(sockfile)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	// A socket left over from a previous run is replaced
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	require.FileExists(t, sockfile)
+	ln, _, err = listen(a, l)
+	require.NoError(t, err)
+	ln.Close()
+
+	// but other files aren't
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "file.sock"), []byte("hi"), 0644))
+	addr = "unix://file.sock"
+	_, _, err = listen(a, l)
+	require.Error(t, err)
+
+	addr = "127.0.0.1:0"
+	ln, isUnix, err = listen(a, l)
+	require.NoError(t, err)
+	require.False(t, isUnix)
+	ln.Close()
+}
+
+func TestListenPluginAPI(t *testing.T) {
+	dir := t.TempDir()
+	a := &assets.Assets{FolderPath: dir}
+	require.NoError(t, os.Mkdir(a.DataDir(), 0755))
+
+	ln, err := listenPluginAPI(a)
+	require.NoError(t, err)
+	defer ln.Close()
+	sockfile := filepath.Join(dir, "data", "heedy.sock")
+	fi, err := os.Stat(sockfile)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	// Plugins reach the API through the socket
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	c := http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sockfile)
+		},
+	}}
+	res, err := c.Get("http://heedy/api/server/version")
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusTeapot, res.StatusCode)
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/plugins/run"
+)
+
+// The number of lines returned from a plugin's log if not specified in the request
+const defaultLogLines = 100
+
+// GetPluginLogs returns the last lines of a plugin's log. If follow=true, the request is kept open,
+// and lines are streamed as they are written.
+func GetPluginLogs(w http.ResponseWriter, r *http.Request) {
+	db := rest.CTX(r).DB
+	a := db.AdminDB().Assets()
+	if db.Type() != database.AdminType && !a.GetConfig().UserIsAdmin(db.ID()) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("Plugin logs are admin-only"))
+		return
+	}
+	pluginName := chi.URLParam(r, "plugin")
+	if strings.ContainsAny(pluginName, "/.\\") {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("Invalid character in plugin name"))
+		return
+	}
+	l := run.GetPluginLog(a.DataDir(), pluginName)
+	if _, ok := a.GetConfig().Plugins[pluginName]; !ok {
+		// Logs of plugins that were since removed are still available
+		if _, err := os.Stat(l.Path); err != nil {
+			rest.WriteJSONError(w, r, http.StatusNotFound, errors.New("Plugin not found"))
+			return
+		}
+	}
+
+	n := defaultLogLines
+	if v := r.URL.Query().Get("lines"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 {
+			rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("lines must be a non-negative integer"))
+			return
+		}
+		n = i
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	if r.URL.Query().Get("follow") != "true" {
+		tail, err := l.Tail(n)
+		if err != nil {
+			rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		w.Write(tail)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		rest.WriteJSONError(w, r, http.StatusInternalServerError, errors.New("Streaming logs is not supported"))
+		return
+	}
+	tail, lines, stop, err := l.Follow(n)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	defer stop()
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(tail)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+			if _, err = w.Write(line); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/plugins/run"
+)
+
+func TestGetPluginLogs(t *testing.T) {
+	adb, cleanup := newDBWithUser(t)
+	defer cleanup()
+	a := adb.Assets()
+	a.Config.Plugins["testy"] = &assets.Plugin{}
+	l := run.GetPluginLog(a.DataDir(), "testy")
+	require.NoError(t, os.MkdirAll(filepath.Dir(l.Path), 0755))
+	require.NoError(t, ioutil.WriteFile(l.Path, []byte("line 1\nline 2\n"), 0644))
+
+	newRouter := func(db database.DB) http.Handler {
+		router := chi.NewRouter()
+		router.Get("/api/server/plugins/{plugin}/logs", func(w http.ResponseWriter, r *http.Request) {
+			GetPluginLogs(w, withContext(r, db))
+		})
+		return router
+	}
+	router := newRouter(adb)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/api/server/plugins/testy/logs")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "line 1\nline 2\n", rec.Body.String())
+	require.Equal(t, "line 2\n", get("/api/server/plugins/testy/logs?lines=1").Body.String())
+
+	require.Equal(t, http.StatusBadRequest, get("/api/server/plugins/testy/logs?lines=-1").Code)
+	require.Equal(t, http.StatusBadRequest, get("/api/server/plugins/..%2Ftesty/logs").Code)
+	require.Equal(t, http.StatusNotFound, get("/api/server/plugins/notaplugin/logs").Code)
+
+	// The logs of plugins that are no longer in the configuration can still be read
+	delete(a.Config.Plugins, "testy")
+	require.Equal(t, "line 2\n", get("/api/server/plugins/testy/logs?lines=1").Body.String())
+
+	// New lines are streamed to followers
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/server/plugins/testy/logs?lines=1&follow=true", nil)
+	require.NoError(t, err)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	br := bufio.NewReader(res.Body)
+	line, err := br.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "line 2\n", line)
+	require.NoError(t, l.Write([]byte("line 3\n")))
+	line, err = br.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "line 3\n", line)
+	cancel()
+	_, err = ioutil.ReadAll(res.Body)
+	require.Error(t, err)
+
+	// Logs are admin-only
+	router = newRouter(database.NewUserDB(adb, "test"))
+	require.Equal(t, http.StatusForbidden, get("/api/server/plugins/testy/logs").Code)
+}
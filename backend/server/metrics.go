@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/events"
+	"github.com/heedy/heedy/backend/plugins"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "heedy_http_requests_total",
+		Help: "The number of HTTP requests handled, by route and status code",
+	}, []string{"method", "route", "code"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "heedy_http_request_duration_seconds",
+		Help:    "The time taken to handle HTTP requests, by route",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	httpActiveRequests = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "heedy_http_active_requests",
+		Help: "The number of HTTP requests currently being handled",
+	})
+	activeWebsockets = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "heedy_websockets_active",
+		Help: "The number of open websockets",
+	}, []string{"endpoint"})
+	eventsFired = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "heedy_events_fired_total",
+		Help: "The number of events fired, by event and object type",
+	}, []string{"event", "type"})
+
+	sqliteSizeDesc = prometheus.NewDesc("heedy_sqlite_size_bytes",
+		"The size of the heedy database",
+		nil, nil)
+	sqliteFreeDesc = prometheus.NewDesc("heedy_sqlite_freelist_bytes",
+		"The size of unused pages in the heedy database",
+		nil, nil)
+)
+
+// metricsRoute returns the route label of a request path. Identifiers of users, apps and objects are replaced
+// with placeholders, and paths are truncated, so that the number of distinct routes stays small.
+func metricsRoute(path string) string {
+	s := strings.Split(strings.Trim(path, "/"), "/")
+	if s[0] != "api" && s[0] != "auth" {
+		// All other requests are served by the frontend
+		return "/"
+	}
+	maxlen := 3
+	if len(s) > 2 {
+		switch s[1] {
+		case "objects":
+			s[2] = "{objectid}"
+			maxlen = 4
+		case "users":
+			s[2] = "{username}"
+		case "apps":
+			s[2] = "{appid}"
+		}
+	}
+	if len(s) > maxlen {
+		s = s[:maxlen]
+	}
+	return "/" + strings.Join(s, "/")
+}
+
+// statusRecorder records the status code of a response. It passes through hijacking and flushing,
+// so that websockets and streaming responses still work.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	if sr.status == 0 {
+		sr.status = code
+	}
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("The response writer does not support hijacking")
+	}
+	// A hijacked connection is used for websockets
+	sr.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// observeRequest records the metrics of a finished request
+func observeRequest(method, route string, status int, duration time.Duration) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// eventCounter counts all events fired in heedy
+type eventCounter struct{}
+
+func (eventCounter) Fire(e *events.Event) {
+	eventsFired.WithLabelValues(e.Event, e.Type).Inc()
+}
+
+// sqliteCollector reports statistics of the sqlite database file
+type sqliteCollector struct {
+	db *database.AdminDB
+}
+
+func (sc sqliteCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sqliteSizeDesc
+	ch <- sqliteFreeDesc
+}
+
+func (sc sqliteCollector) Collect(ch chan<- prometheus.Metric) {
+	var pageSize, pageCount, freeCount int64
+	err := sc.db.Get(&pageSize, "PRAGMA page_size;")
+	if err == nil {
+		err = sc.db.Get(&pageCount, "PRAGMA page_count;")
+	}
+	if err == nil {
+		err = sc.db.Get(&freeCount, "PRAGMA freelist_count;")
+	}
+	if err != nil {
+		logrus.Warnf("Failed to get database metrics: %s", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(sqliteSizeDesc, prometheus.GaugeValue, float64(pageSize*pageCount))
+	ch <- prometheus.MustNewConstMetric(sqliteFreeDesc, prometheus.GaugeValue, float64(pageSize*freeCount))
+}
+
+// RegisterMetrics adds the metrics of the database and plugin processes to those reported at /api/server/metrics
+func RegisterMetrics(db *database.AdminDB, pm *plugins.PluginManager) error {
+	for _, c := range []prometheus.Collector{
+		collectors.NewDBStatsCollector(db.DB.DB, "heedy"),
+		sqliteCollector{db},
+		pm.RunManager,
+	} {
+		if err := prometheus.Register(c); err != nil {
+			if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+				return err
+			}
+		}
+	}
+	events.AddHandler(eventCounter{})
+	return nil
+}
+
+var metricsHandler = promhttp.Handler()
+
+// GetMetrics returns the server's metrics in the Prometheus text format
+func GetMetrics(w http.ResponseWriter, r *http.Request) {
+	db := rest.CTX(r).DB
+	a := db.AdminDB().Assets()
+	if db.Type() != database.AdminType && !a.GetConfig().UserIsAdmin(db.ID()) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("Server metrics are admin-only"))
+		return
+	}
+	metricsHandler.ServeHTTP(w, r)
+}
+
+// MetricsTokenMiddleware allows metrics to be scraped with the metrics_token from the configuration,
+// given as a bearer token. The token is not a valid app token, so these requests are served before
+// reaching authentication.
+func MetricsTokenMiddleware(db *database.AdminDB, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/server/metrics" {
+			token := db.Assets().GetConfig().GetMetricsToken()
+			if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) == 1 {
+				metricsHandler.ServeHTTP(w, r)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
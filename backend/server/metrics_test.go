@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsRoute(t *testing.T) {
+	for path, route := range map[string]string{
+		"/":                               "/",
+		"/static/main.js":                 "/",
+		"/api/users/test":                 "/api/users/{username}",
+		"/api/apps/1234":                  "/api/apps/{appid}",
+		"/api/objects/1234":               "/api/objects/{objectid}",
+		"/api/objects/1234/timeseries":    "/api/objects/{objectid}/timeseries",
+		"/api/objects/1234/timeseries/a/": "/api/objects/{objectid}/timeseries",
+		"/api/server/metrics":             "/api/server/metrics",
+		"/api/kv/users/test/ns/key":       "/api/kv/users",
+		"/auth/token":                     "/auth/token",
+	} {
+		require.Equal(t, route, metricsRoute(path), path)
+	}
+}
+
+func TestGetMetrics(t *testing.T) {
+	adb, cleanup := newDBWithUser(t)
+	defer cleanup()
+	token := "mytoken"
+	adb.Assets().Config.MetricsToken = &token
+
+	get := func(db database.DB, auth string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/server/metrics", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		MetricsTokenMiddleware(adb, http.HandlerFunc(GetMetrics)).ServeHTTP(rec, withContext(r, db))
+		return rec
+	}
+
+	// Metrics are admin-only
+	require.Equal(t, http.StatusForbidden, get(database.NewUserDB(adb, "test"), "").Code)
+	require.Equal(t, http.StatusForbidden, get(database.NewPublicDB(adb), "Bearer wrongtoken").Code)
+
+	rec := get(adb, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "heedy_http_active_requests")
+
+	// but can be scraped with the metrics token
+	rec = get(database.NewPublicDB(adb), "Bearer mytoken")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "heedy_http_active_requests")
+}
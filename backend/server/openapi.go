@@ -0,0 +1,646 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/buildinfo"
+)
+
+// The OpenAPI document is built from plain maps, so that fragments coming from the configuration
+// (which are decoded from json) can be merged in directly.
+type oaObject = map[string]interface{}
+
+func oaRef(name string) oaObject {
+	return oaObject{"$ref": "#/components/schemas/" + name}
+}
+
+func oaArray(items oaObject) oaObject {
+	return oaObject{"type": "array", "items": items}
+}
+
+func oaPathParam(name, description string) oaObject {
+	return oaObject{
+		"name":        name,
+		"in":          "path",
+		"required":    true,
+		"description": description,
+		"schema":      oaObject{"type": "string"},
+	}
+}
+
+func oaQueryParam(name, ptype, description string) oaObject {
+	return oaObject{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"schema":      oaObject{"type": ptype},
+	}
+}
+
+func oaJSONContent(schema oaObject) oaObject {
+	return oaObject{"application/json": oaObject{"schema": schema}}
+}
+
+// oaOperation generates an operation which returns the given schema on success. A nil body
+// means that the operation has no request body.
+func oaOperation(tag, summary string, params []oaObject, body oaObject, result oaObject) oaObject {
+	op := oaObject{
+		"tags":    []interface{}{tag},
+		"summary": summary,
+		"responses": oaObject{
+			"200": oaObject{
+				"description": "Success",
+				"content":     oaJSONContent(result),
+			},
+			"default": oaObject{
+				"description": "Error",
+				"content":     oaJSONContent(oaRef("Error")),
+			},
+		},
+	}
+	if len(params) > 0 {
+		iparams := make([]interface{}, len(params))
+		for i := range params {
+			iparams[i] = params[i]
+		}
+		op["parameters"] = iparams
+	}
+	if body != nil {
+		op["requestBody"] = oaObject{
+			"required": true,
+			"content":  oaJSONContent(body),
+		}
+	}
+	return op
+}
+
+// oaTextOperation generates an operation whose request body (if bodyType is set) and successful response (if resultType
+// is set) are raw content of the given media types rather than json. Operations without a raw response return a Result.
+func oaTextOperation(tag, summary string, params []oaObject, bodyType, resultType string) oaObject {
+	var body oaObject
+	if bodyType != "" {
+		body = oaObject{}
+	}
+	op := oaOperation(tag, summary, params, body, oaRef("Result"))
+	if bodyType != "" {
+		op["requestBody"].(oaObject)["content"] = oaObject{bodyType: oaObject{"schema": oaObject{"type": "string"}}}
+	}
+	if resultType != "" {
+		op["responses"].(oaObject)["200"].(oaObject)["content"] = oaObject{resultType: oaObject{"schema": oaObject{"type": "string"}}}
+	}
+	return op
+}
+
+// oaSchema converts the heedy shorthand json schema used for meta and settings_schema
+// into a standard json schema object
+func oaSchema(schema *map[string]interface{}) (oaObject, error) {
+	if schema == nil {
+		return oaObject{"type": "object"}, nil
+	}
+	s, err := assets.NewSchema(*schema)
+	if err != nil {
+		return nil, err
+	}
+	return s.Schema, nil
+}
+
+// coreOpenAPIPaths describes the REST API built into heedy's core
+func coreOpenAPIPaths() oaObject {
+	username := oaPathParam("username", "The user's username")
+	appid := oaPathParam("appid", "The app's ID")
+	objectid := oaPathParam("objectid", "The object's ID")
+	icon := oaQueryParam("icon", "boolean", "Whether to include the icon in the response")
+	result := oaRef("Result")
+	srv := "server"
+
+	// Plugins are uploaded as a zip file in a form
+	uploadPlugin := oaOperation(srv, "Upload a zipped plugin, which is installed on the next restart", nil, oaObject{}, result)
+	uploadPlugin["requestBody"].(oaObject)["content"] = oaObject{"multipart/form-data": oaObject{"schema": oaObject{
+		"type": "object",
+		"properties": oaObject{
+			"zipfile": oaObject{"type": "string", "format": "binary"},
+		},
+	}}}
+
+	// The health checks don't require authentication
+	health := oaOperation(srv, "Check whether heedy is running", nil, nil, oaObject{
+		"type":       "object",
+		"properties": oaObject{"status": oaObject{"type": "string", "enum": []interface{}{"ok"}}},
+	})
+	health["security"] = []interface{}{}
+	ready := oaOperation(srv, "Check whether heedy is ready to serve requests, returning 503 if it is not. Only admins get the status of plugins, runners, the database and updates.", nil, nil, oaRef("ReadyStatus"))
+	ready["security"] = []interface{}{}
+
+	return oaObject{
+		"/api/users": oaObject{
+			"get":  oaOperation("users", "List users", []oaObject{icon}, nil, oaArray(oaRef("User"))),
+			"post": oaOperation("users", "Create a user", nil, oaRef("User"), result),
+		},
+		"/api/users/{username}": oaObject{
+			"get":    oaOperation("users", "Read a user", []oaObject{username, icon}, nil, oaRef("User")),
+			"patch":  oaOperation("users", "Update a user", []oaObject{username}, oaRef("User"), result),
+			"delete": oaOperation("users", "Delete a user", []oaObject{username}, nil, result),
+		},
+		"/api/apps": oaObject{
+			"get": oaOperation("apps", "List apps", []oaObject{
+				icon,
+				oaQueryParam("token", "boolean", "Whether to include the access token"),
+				oaQueryParam("owner", "string", "Only list apps owned by the given user"),
+				oaQueryParam("plugin", "string", "Only list apps with the given plugin key"),
+			}, nil, oaArray(oaRef("App"))),
+			"post": oaOperation("apps", "Create an app", nil, oaRef("App"), oaRef("App")),
+		},
+		"/api/apps/{appid}": oaObject{
+			"get": oaOperation("apps", "Read an app", []oaObject{
+				appid, icon,
+				oaQueryParam("token", "boolean", "Whether to include the access token"),
+			}, nil, oaRef("App")),
+			"patch":  oaOperation("apps", "Update an app", []oaObject{appid}, oaRef("App"), result),
+			"delete": oaOperation("apps", "Delete an app", []oaObject{appid}, nil, result),
+		},
+		"/api/objects": oaObject{
+			"get": oaOperation("objects", "List objects", []oaObject{
+				icon,
+				oaQueryParam("owner", "string", "Only list objects owned by the given user"),
+				oaQueryParam("app", "string", "Only list objects belonging to the given app"),
+				oaQueryParam("key", "string", "Only list objects with the given key"),
+				oaQueryParam("tags", "string", "Only list objects with all of the given tags"),
+				oaQueryParam("type", "string", "Only list objects of the given type"),
+				oaQueryParam("limit", "integer", "The maximum number of objects to return"),
+			}, nil, oaArray(oaRef("Object"))),
+			"post": oaOperation("objects", "Create an object", []oaObject{icon}, oaRef("Object"), oaRef("Object")),
+		},
+		"/api/objects/{objectid}": oaObject{
+			"get":    oaOperation("objects", "Read an object", []oaObject{objectid, icon}, nil, oaRef("Object")),
+			"patch":  oaOperation("objects", "Update an object", []oaObject{objectid}, oaRef("Object"), result),
+			"delete": oaOperation("objects", "Delete an object", []oaObject{objectid}, nil, result),
+		},
+		"/api/events": oaObject{
+			"post": oaOperation("events", "Fire an event (plugins only)", nil, oaRef("Event"), result),
+		},
+		"/api/graphql": oaObject{
+			"get": oaOperation("graphql", "Run a GraphQL query given in the url, or open a websocket for subscriptions", []oaObject{
+				oaQueryParam("query", "string", "The GraphQL query"),
+				oaQueryParam("operationName", "string", "The operation in the query to run"),
+				oaQueryParam("variables", "string", "The json encoded variables of the query"),
+			}, nil, oaRef("GraphQLResult")),
+			"post": oaOperation("graphql", "Run a GraphQL query", nil, oaRef("GraphQLRequest"), oaRef("GraphQLResult")),
+		},
+		"/api/server/version": oaObject{
+			"get": oaOperation(srv, "Get the heedy version", nil, nil, oaObject{"type": "string"}),
+		},
+		"/api/server/metrics": oaObject{
+			"get": oaTextOperation(srv, "Get the server's metrics in the Prometheus text format (admin only, or with the metrics_token)", nil, "", "text/plain"),
+		},
+		"/api/server/health": oaObject{
+			"get": health,
+		},
+		"/api/server/ready": oaObject{
+			"get": ready,
+		},
+		"/api/server/scope": oaObject{
+			"get": oaOperation(srv, "Get all app scopes with their descriptions", nil, nil, oaObject{
+				"type":                 "object",
+				"additionalProperties": oaObject{"type": "string"},
+			}),
+		},
+		"/api/server/scope/{objecttype}": oaObject{
+			"get": oaOperation(srv, "Get the scopes of an object type", []oaObject{
+				oaPathParam("objecttype", "The object type"),
+			}, nil, oaObject{
+				"type":                 "object",
+				"additionalProperties": oaObject{"type": "string"},
+			}),
+		},
+		"/api/server/apps": oaObject{
+			"get": oaOperation(srv, "List the apps that plugins can create", nil, nil, oaObject{
+				"type":                 "object",
+				"additionalProperties": oaRef("App"),
+			}),
+		},
+		"/api/server/admin": oaObject{
+			"get": oaOperation(srv, "List admin users", nil, nil, oaArray(oaObject{"type": "string"})),
+		},
+		"/api/server/admin/{username}": oaObject{
+			"post":   oaOperation(srv, "Give a user admin permissions", []oaObject{username}, nil, result),
+			"delete": oaOperation(srv, "Remove admin permissions from a user", []oaObject{username}, nil, result),
+		},
+		"/api/server/updates": oaObject{
+			"get":    oaOperation(srv, "Get the pending updates, which are applied on restart", nil, nil, oaRef("UpdateInfo")),
+			"delete": oaOperation(srv, "Remove all pending updates", nil, nil, result),
+		},
+		"/api/server/updates/status": oaObject{
+			"get": oaOperation(srv, "Get the error of the last update if it was reverted", nil, nil, result),
+		},
+		"/api/server/updates/heedy.conf": oaObject{
+			"get":  oaTextOperation(srv, "Read the pending heedy.conf, or the current one if there is no pending update", nil, "", "text/plain"),
+			"post": oaTextOperation(srv, "Set the heedy.conf that is applied on the next restart", nil, "text/plain", ""),
+		},
+		"/api/server/updates/config": oaObject{
+			"get":   oaOperation(srv, "Read the configuration in the pending heedy.conf", nil, nil, oaObject{"type": "object"}),
+			"patch": oaOperation(srv, "Modify the configuration in the pending heedy.conf", nil, oaObject{"type": "object"}, result),
+		},
+		"/api/server/updates/plugins": oaObject{
+			"get": oaOperation(srv, "List installed plugins, including pending plugin updates", nil, nil, oaObject{
+				"type":                 "object",
+				"additionalProperties": oaObject{"type": "object"},
+			}),
+			"post": uploadPlugin,
+		},
+		"/api/server/updates/plugins/{pluginname}/README.md": oaObject{
+			"get": oaTextOperation(srv, "Read the README of an installed plugin", []oaObject{
+				oaPathParam("pluginname", "The plugin's name"),
+			}, "", "text/markdown"),
+		},
+		"/api/server/updates/options": oaObject{
+			"get":  oaOperation(srv, "Get the options of the pending update", nil, nil, oaRef("UpdateOptions")),
+			"post": oaOperation(srv, "Set the options of the pending update", nil, oaRef("UpdateOptions"), result),
+		},
+		"/api/server/plugins/{plugin}/logs": oaObject{
+			"get": oaTextOperation(srv, "Read the last lines of a plugin's log, streaming new lines as they are written if follow is set", []oaObject{
+				oaPathParam("plugin", "The plugin's name"),
+				oaQueryParam("lines", "integer", "The number of lines to return, 100 by default"),
+				oaQueryParam("follow", "boolean", "Whether to keep the request open, and stream new lines"),
+			}, "", "text/plain"),
+		},
+		"/api/server/plugins/{plugin}/jobs": oaObject{
+			"get": oaOperation(srv, "List the recent runs of a plugin's cron jobs, most recent first", []oaObject{
+				oaPathParam("plugin", "The plugin's name"),
+				oaQueryParam("name", "string", "Only list the runs of the given job"),
+			}, nil, oaArray(oaRef("Job"))),
+		},
+		"/api/server/jobs": oaObject{
+			"get": oaOperation(srv, "List the cron jobs of all plugins", nil, nil, oaArray(oaRef("CronJob"))),
+		},
+		"/api/server/jobs/{plugin}/{name}": oaObject{
+			"parameters": []interface{}{
+				oaPathParam("plugin", "The plugin's name"),
+				oaPathParam("name", "The name of the job's runner"),
+			},
+			"get":   oaOperation(srv, "Get a cron job", nil, nil, oaRef("CronJob")),
+			"patch": oaOperation(srv, "Pause, resume or reschedule a cron job until heedy is restarted", nil, oaRef("CronJobUpdate"), oaRef("CronJob")),
+		},
+		"/api/server/jobs/{plugin}/{name}/run": oaObject{
+			"post": oaOperation(srv, "Run a cron job right away, failing with 409 if it is already running", []oaObject{
+				oaPathParam("plugin", "The plugin's name"),
+				oaPathParam("name", "The name of the job's runner"),
+			}, nil, result),
+		},
+		"/api/server/restart": oaObject{
+			"post": oaOperation(srv, "Restart heedy, applying any pending updates", nil, nil, result),
+		},
+		"/api/server/reload": oaObject{
+			"post": oaOperation(srv, "Apply a pending update to heedy.conf without restarting, restarting only the plugins whose configuration changed", nil, nil, result),
+		},
+	}
+}
+
+func coreOpenAPISchemas() oaObject {
+	nstring := oaObject{"type": "string", "nullable": true}
+	return oaObject{
+		"Error": oaObject{
+			"type": "object",
+			"properties": oaObject{
+				"error":             oaObject{"type": "string"},
+				"error_description": oaObject{"type": "string"},
+				"id":                oaObject{"type": "string"},
+			},
+			"required": []interface{}{"error", "error_description"},
+		},
+		"Result": oaObject{
+			"type": "object",
+			"properties": oaObject{
+				"result": oaObject{"type": "string", "enum": []interface{}{"ok"}},
+			},
+		},
+		"User": oaObject{
+			"type": "object",
+			"properties": oaObject{
+				"username":    oaObject{"type": "string"},
+				"name":        oaObject{"type": "string"},
+				"description": oaObject{"type": "string"},
+				"icon":        oaObject{"type": "string"},
+				"public_read": oaObject{"type": "boolean"},
+				"users_read":  oaObject{"type": "boolean"},
+				"password":    oaObject{"type": "string", "writeOnly": true},
+			},
+		},
+		"App": oaObject{
+			"type": "object",
+			"properties": oaObject{
+				"id":               oaObject{"type": "string", "readOnly": true},
+				"name":             oaObject{"type": "string"},
+				"description":      oaObject{"type": "string"},
+				"icon":             oaObject{"type": "string"},
+				"owner":            oaObject{"type": "string"},
+				"plugin":           oaObject{"type": "string"},
+				"enabled":          oaObject{"type": "boolean"},
+				"access_token":     oaObject{"type": "string"},
+				"created_date":     oaObject{"type": "string", "format": "date", "readOnly": true},
+				"last_access_date": nstring,
+				"scope":            oaArray(oaObject{"type": "string"}),
+				"settings":         oaObject{"type": "object"},
+				"settings_schema":  oaObject{"type": "object"},
+			},
+		},
+		"Object": oaObject{
+			"type": "object",
+			"properties": oaObject{
+				"id":            oaObject{"type": "string", "readOnly": true},
+				"name":          oaObject{"type": "string"},
+				"description":   oaObject{"type": "string"},
+				"icon":          oaObject{"type": "string"},
+				"owner":         oaObject{"type": "string"},
+				"app":           nstring,
+				"tags":          oaObject{"type": "string"},
+				"key":           nstring,
+				"type":          oaObject{"type": "string"},
+				"meta":          oaObject{"type": "object"},
+				"created_date":  oaObject{"type": "string", "format": "date", "readOnly": true},
+				"last_modified": nstring,
+				"owner_scope":   oaArray(oaObject{"type": "string"}),
+				"access":        oaArray(oaObject{"type": "string"}),
+			},
+		},
+		"ReadyStatus": oaObject{
+			"type": "object",
+			"properties": oaObject{
+				"ready": oaObject{"type": "boolean"},
+				"plugins": oaObject{
+					"type": "object",
+					"properties": oaObject{
+						"status":  oaObject{"type": "string", "enum": []interface{}{"loading", "ready", "closing", "closed", "failed"}},
+						"error":   oaObject{"type": "string"},
+						"loading": oaObject{"type": "string"},
+						"plugins": oaArray(oaObject{"type": "string"}),
+					},
+				},
+				"runners": oaArray(oaObject{"type": "object"}),
+				"database": oaObject{
+					"type": "object",
+					"properties": oaObject{
+						"ok":    oaObject{"type": "boolean"},
+						"error": oaObject{"type": "string"},
+					},
+				},
+				"updates": oaObject{
+					"type": "object",
+					"properties": oaObject{
+						"pending": oaObject{"type": "boolean"},
+						"error":   oaObject{"type": "string"},
+					},
+				},
+			},
+		},
+		"Job": oaObject{
+			"type": "object",
+			"properties": oaObject{
+				"plugin":     oaObject{"type": "string"},
+				"name":       oaObject{"type": "string"},
+				"started":    oaObject{"type": "string", "format": "date-time"},
+				"duration":   oaObject{"type": "number", "description": "The run's duration in seconds"},
+				"status":     oaObject{"type": "string", "enum": []interface{}{"running", "success", "error"}},
+				"exit_code":  oaObject{"type": "integer"},
+				"violations": oaArray(oaObject{"type": "string"}),
+				"error":      oaObject{"type": "string"},
+				"output":     oaObject{"type": "string"},
+			},
+		},
+		"CronJob": oaObject{
+			"type": "object",
+			"properties": oaObject{
+				"plugin":           oaObject{"type": "string"},
+				"name":             oaObject{"type": "string"},
+				"schedule":         oaObject{"type": "string"},
+				"default_schedule": oaObject{"type": "string"},
+				"enabled":          oaObject{"type": "boolean"},
+				"running":          oaObject{"type": "boolean"},
+				"next":             oaObject{"type": "string", "format": "date-time"},
+				"prev":             oaObject{"type": "string", "format": "date-time"},
+				"last":             oaRef("Job"),
+			},
+		},
+		"CronJobUpdate": oaObject{
+			"type": "object",
+			"properties": oaObject{
+				"enabled":  oaObject{"type": "boolean"},
+				"schedule": oaObject{"type": "string", "description": "The job's schedule until heedy is restarted, with an empty string restoring the configured schedule"},
+			},
+		},
+		"GraphQLRequest": oaObject{
+			"type": "object",
+			"properties": oaObject{
+				"query":         oaObject{"type": "string"},
+				"operationName": oaObject{"type": "string"},
+				"variables":     oaObject{"type": "object"},
+			},
+			"required": []interface{}{"query"},
+		},
+		"GraphQLResult": oaObject{
+			"type": "object",
+			"properties": oaObject{
+				"data":   oaObject{"type": "object", "nullable": true},
+				"errors": oaArray(oaObject{"type": "object"}),
+			},
+		},
+		"UpdateOptions": oaObject{
+			"type": "object",
+			"properties": oaObject{
+				"backup":  oaObject{"type": "boolean", "description": "Whether to back up the data before updating"},
+				"deleted": oaArray(oaObject{"type": "string"}),
+			},
+		},
+		"UpdateInfo": oaObject{
+			"type": "object",
+			"properties": oaObject{
+				"heedy":   oaObject{"type": "boolean"},
+				"config":  oaObject{"type": "boolean"},
+				"plugins": oaArray(oaObject{"type": "string"}),
+				"options": oaRef("UpdateOptions"),
+			},
+		},
+		"Event": oaObject{
+			"type": "object",
+			"properties": oaObject{
+				"event":  oaObject{"type": "string"},
+				"user":   oaObject{"type": "string"},
+				"app":    oaObject{"type": "string"},
+				"object": oaObject{"type": "string"},
+				"plugin": oaObject{"type": "string"},
+				"key":    oaObject{"type": "string"},
+				"type":   oaObject{"type": "string"},
+				"tags":   oaObject{"type": "string"},
+				"data":   oaObject{},
+			},
+			"required": []interface{}{"event"},
+		},
+	}
+}
+
+// mergeOpenAPIFragment merges an openapi fragment from the configuration into the document.
+// Paths in the fragment are prefixed with the given prefix.
+func mergeOpenAPIFragment(doc oaObject, fragment *map[string]interface{}, prefix string, source string) error {
+	if fragment == nil {
+		return nil
+	}
+	paths := doc["paths"].(oaObject)
+	components := doc["components"].(oaObject)
+
+	if fpaths, ok := (*fragment)["paths"].(map[string]interface{}); ok {
+		for p, pv := range fpaths {
+			pvm, ok := pv.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s: openapi path '%s' must be an object", source, p)
+			}
+			fullPath := prefix + p
+			cur, ok := paths[fullPath].(oaObject)
+			if !ok {
+				cur = oaObject{}
+				paths[fullPath] = cur
+			}
+			for method, op := range pvm {
+				cur[method] = op
+			}
+		}
+	}
+	if fcomponents, ok := (*fragment)["components"].(map[string]interface{}); ok {
+		for ctype, cv := range fcomponents {
+			cvm, ok := cv.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s: openapi components.%s must be an object", source, ctype)
+			}
+			target, ok := components[ctype].(oaObject)
+			if !ok {
+				target = oaObject{}
+				components[ctype] = target
+			}
+			for k, v := range cvm {
+				target[k] = v
+			}
+		}
+	}
+	if tags, ok := (*fragment)["tags"].([]interface{}); ok {
+		doc["tags"] = append(doc["tags"].([]interface{}), tags...)
+	}
+	return nil
+}
+
+// GenerateOpenAPI creates an OpenAPI 3 document describing the REST API of the server with the given configuration.
+// The core API is described here, and each active plugin and object type can add its own routes
+// with the openapi field in its configuration.
+func GenerateOpenAPI(c *assets.Configuration) (map[string]interface{}, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	serverURL := "/"
+	if c.URL != nil && *c.URL != "" {
+		serverURL = *c.URL
+	}
+
+	schemas := coreOpenAPISchemas()
+	doc := oaObject{
+		"openapi": "3.0.3",
+		"info": oaObject{
+			"title":   "heedy",
+			"version": buildinfo.Version,
+		},
+		"servers": []interface{}{oaObject{"url": serverURL}},
+		"tags":    []interface{}{},
+		"paths":   coreOpenAPIPaths(),
+		"components": oaObject{
+			"schemas": schemas,
+			"securitySchemes": oaObject{
+				"token": oaObject{
+					"type":   "http",
+					"scheme": "bearer",
+				},
+				"cookie": oaObject{
+					"type": "apiKey",
+					"in":   "cookie",
+					"name": "token",
+				},
+			},
+		},
+		"security": []interface{}{
+			oaObject{"token": []interface{}{}},
+			oaObject{"cookie": []interface{}{}},
+		},
+	}
+
+	// Sort the object types and plugins so that the document is stable between requests
+	otypes := make([]string, 0, len(c.ObjectTypes))
+	for k := range c.ObjectTypes {
+		otypes = append(otypes, k)
+	}
+	sort.Strings(otypes)
+	for _, k := range otypes {
+		ot := c.ObjectTypes[k]
+		meta, err := oaSchema(ot.Meta)
+		if err != nil {
+			return nil, fmt.Errorf("type %s: %w", k, err)
+		}
+		schemas[k+"_meta"] = meta
+		if err = mergeOpenAPIFragment(doc, ot.OpenAPI, "/api/objects/{objectid}", "type "+k); err != nil {
+			return nil, err
+		}
+	}
+
+	// The configuration is already locked, so we can't use GetActivePlugins here
+	activePlugins := []string{}
+	if c.ActivePlugins != nil {
+		activePlugins = *c.ActivePlugins
+	}
+	for _, pname := range activePlugins {
+		p, ok := c.Plugins[pname]
+		if !ok {
+			continue
+		}
+		if len(p.SettingsSchema) > 0 {
+			settings, err := oaSchema(&p.SettingsSchema)
+			if err != nil {
+				return nil, fmt.Errorf("plugin %s: %w", pname, err)
+			}
+			schemas[pname+"_settings"] = settings
+		}
+		if err := mergeOpenAPIFragment(doc, p.OpenAPI, "", "plugin "+pname); err != nil {
+			return nil, err
+		}
+	}
+
+	// Object type routes are given with the object ID as a parameter, which needs to be
+	// declared along with any parameters of the route itself
+	for p, pv := range doc["paths"].(oaObject) {
+		if !strings.HasPrefix(p, "/api/objects/{objectid}/") {
+			continue
+		}
+		pvm := pv.(oaObject)
+		params, _ := pvm["parameters"].([]interface{})
+		declared := false
+		for _, param := range params {
+			if pm, ok := param.(map[string]interface{}); ok && pm["name"] == "objectid" && pm["in"] == "path" {
+				declared = true
+			}
+		}
+		if !declared {
+			// The parameters are copied, so that the fragment in the configuration is not modified
+			pvm["parameters"] = append([]interface{}{oaPathParam("objectid", "The object's ID")}, params...)
+		}
+	}
+
+	return doc, nil
+}
+
+// GetOpenAPI returns the OpenAPI document describing the server's REST API
+func GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	doc, err := GenerateOpenAPI(rest.CTX(r).DB.AdminDB().Assets().GetConfig())
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	rest.WriteJSON(w, r, doc, nil)
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/stretchr/testify/require"
+)
+
+var oaPathTemplate = regexp.MustCompile(`{([^}]+)}`)
+
+var oaMethods = map[string]bool{"get": true, "put": true, "post": true, "delete": true, "options": true, "head": true, "patch": true, "trace": true}
+
+// validateOpenAPI checks the structure of the OpenAPI document: each operation has responses, each path parameter
+// is declared, and each local reference points to an existing component
+func validateOpenAPI(t *testing.T, d map[string]interface{}) {
+	b, err := json.Marshal(d)
+	require.NoError(t, err)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &doc))
+
+	require.Equal(t, "3.0.3", doc["openapi"])
+	info := doc["info"].(map[string]interface{})
+	require.IsType(t, "", info["title"])
+	require.IsType(t, "", info["version"])
+	components := doc["components"].(map[string]interface{})
+
+	resolve := func(v interface{}) map[string]interface{} {
+		m := v.(map[string]interface{})
+		ref, ok := m["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#/") {
+			// External references, such as to the json schema meta-schema, aren't checked
+			return m
+		}
+		parts := strings.Split(strings.TrimPrefix(ref, "#/components/"), "/")
+		require.Len(t, parts, 2, ref)
+		c, ok := components[parts[0]].(map[string]interface{})
+		require.True(t, ok, ref)
+		target, ok := c[parts[1]].(map[string]interface{})
+		require.True(t, ok, "unresolved reference %s", ref)
+		return target
+	}
+
+	// Every reference in the document must resolve
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch vv := v.(type) {
+		case map[string]interface{}:
+			if _, ok := vv["$ref"].(string); ok {
+				resolve(vv)
+			}
+			for _, e := range vv {
+				walk(e)
+			}
+		case []interface{}:
+			for _, e := range vv {
+				walk(e)
+			}
+		}
+	}
+	walk(doc)
+
+	pathParams := func(params interface{}) map[string]bool {
+		res := make(map[string]bool)
+		if params == nil {
+			return res
+		}
+		for _, p := range params.([]interface{}) {
+			pm := resolve(p)
+			if pm["in"] == "path" {
+				require.Equal(t, true, pm["required"], "path parameter %v must be required", pm["name"])
+				res[pm["name"].(string)] = true
+			}
+		}
+		return res
+	}
+
+	for p, pv := range doc["paths"].(map[string]interface{}) {
+		require.True(t, strings.HasPrefix(p, "/"), p)
+		pm := pv.(map[string]interface{})
+		declared := pathParams(pm["parameters"])
+		for method, op := range pm {
+			if method == "parameters" || method == "summary" || method == "description" {
+				continue
+			}
+			require.True(t, oaMethods[method], "%s has unknown method %s", p, method)
+			opm := op.(map[string]interface{})
+			responses, ok := opm["responses"].(map[string]interface{})
+			require.True(t, ok && len(responses) > 0, "%s %s has no responses", method, p)
+			for code, r := range responses {
+				_, ok := resolve(r)["description"].(string)
+				require.True(t, ok, "%s %s response %s has no description", method, p, code)
+			}
+			opParams := pathParams(opm["parameters"])
+			for _, m := range oaPathTemplate.FindAllStringSubmatch(p, -1) {
+				require.True(t, declared[m[1]] || opParams[m[1]], "%s %s doesn't declare path parameter %s", method, p, m[1])
+			}
+		}
+	}
+}
+
+func TestGenerateOpenAPI(t *testing.T) {
+	a, err := assets.Open("", nil)
+	require.NoError(t, err)
+	c := a.Config
+
+	c.Plugins["testy"] = &assets.Plugin{
+		OpenAPI: &map[string]interface{}{
+			"paths": map[string]interface{}{
+				"/api/testy/{id}": map[string]interface{}{
+					"parameters": []interface{}{
+						map[string]interface{}{"name": "id", "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"}},
+					},
+					"get": map[string]interface{}{
+						"tags":    []interface{}{"testy"},
+						"summary": "Returns testy",
+						"responses": map[string]interface{}{
+							"200": map[string]interface{}{
+								"description": "ok",
+								"content": map[string]interface{}{
+									"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Testy"}},
+								},
+							},
+						},
+					},
+				},
+			},
+			"components": map[string]interface{}{
+				"schemas": map[string]interface{}{
+					"Testy": map[string]interface{}{"type": "object"},
+				},
+			},
+			"tags": []interface{}{map[string]interface{}{"name": "testy"}},
+		},
+	}
+	active := append(*c.ActivePlugins, "testy", "notinstalled")
+	c.ActivePlugins = &active
+	c.ObjectTypes["testy"] = assets.ObjectType{
+		OpenAPI: &map[string]interface{}{
+			"paths": map[string]interface{}{
+				"/testy": map[string]interface{}{
+					"get": map[string]interface{}{"responses": map[string]interface{}{"200": map[string]interface{}{"description": "ok"}}},
+				},
+			},
+		},
+	}
+
+	doc, err := GenerateOpenAPI(c)
+	require.NoError(t, err)
+	validateOpenAPI(t, doc)
+
+	paths := doc["paths"].(oaObject)
+	components := doc["components"].(oaObject)
+
+	// The core routes, and the routes of builtin plugins and types are included
+	require.Contains(t, paths, "/api/users/{username}")
+	require.Contains(t, paths, "/api/server/updates/heedy.conf")
+	require.Contains(t, paths, "/api/graphql")
+	require.Contains(t, paths, "/api/server/metrics")
+	require.Contains(t, paths, "/api/server/plugins/{plugin}/logs")
+	require.Contains(t, paths, "/api/server/plugins/{plugin}/jobs")
+	require.Contains(t, paths["/api/server/jobs/{plugin}/{name}"], "patch")
+	require.Contains(t, paths, "/api/server/jobs/{plugin}/{name}/run")
+	require.Equal(t, []interface{}{}, paths["/api/server/ready"].(oaObject)["get"].(oaObject)["security"])
+	require.Contains(t, paths, "/api/timeseries/dataset")
+	require.Contains(t, paths["/api/objects/{objectid}/timeseries"], "parameters")
+	// The object ID is added to the parameters that a route declares itself
+	require.Len(t, paths["/api/objects/{objectid}/timeseries/annotations/{annotationid}"].(oaObject)["parameters"], 2)
+
+	// The plugin's fragment is merged into the document
+	require.Contains(t, paths["/api/testy/{id}"], "get")
+	require.Contains(t, components["schemas"], "Testy")
+	require.Contains(t, doc["tags"], map[string]interface{}{"name": "testy"})
+
+	// Object type routes are relative to the object, and have its ID as a parameter
+	require.Contains(t, paths, "/api/objects/{objectid}/testy")
+	require.Contains(t, paths["/api/objects/{objectid}/testy"], "parameters")
+	require.Contains(t, components["schemas"], "testy_meta")
+}
+
+func TestMergeOpenAPIFragment(t *testing.T) {
+	doc := oaObject{
+		"tags":       []interface{}{},
+		"paths":      coreOpenAPIPaths(),
+		"components": oaObject{"schemas": coreOpenAPISchemas()},
+	}
+
+	// Methods are added to existing paths without removing the others
+	require.NoError(t, mergeOpenAPIFragment(doc, &map[string]interface{}{
+		"paths": map[string]interface{}{
+			"/users": map[string]interface{}{
+				"put": map[string]interface{}{"responses": map[string]interface{}{"200": map[string]interface{}{"description": "ok"}}},
+			},
+		},
+		"components": map[string]interface{}{
+			"parameters": map[string]interface{}{
+				"q": map[string]interface{}{"name": "q", "in": "query"},
+			},
+		},
+	}, "/api", "plugin testy"))
+	users := doc["paths"].(oaObject)["/api/users"].(oaObject)
+	require.Contains(t, users, "get")
+	require.Contains(t, users, "put")
+	require.Contains(t, doc["components"].(oaObject)["parameters"], "q")
+	require.Contains(t, doc["components"].(oaObject)["schemas"], "User")
+
+	require.NoError(t, mergeOpenAPIFragment(doc, nil, "", "plugin empty"))
+
+	err := mergeOpenAPIFragment(doc, &map[string]interface{}{
+		"paths": map[string]interface{}{"/bad": "not an object"},
+	}, "", "plugin bad")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "plugin bad")
+	require.Error(t, mergeOpenAPIFragment(doc, &map[string]interface{}{
+		"components": map[string]interface{}{"schemas": []interface{}{}},
+	}, "", "plugin bad"))
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/heedy/heedy/backend/assets"
+)
+
+// forwardedHeaders are the headers that proxies use to pass on the client's address and scheme
+var forwardedHeaders = []string{"X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "X-Real-IP", "Forwarded"}
+
+// isHTTPS returns whether the client made the request with https, either directly or through a trusted proxy
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || r.URL.Scheme == "https"
+}
+
+// sitePath returns the path at which the given heedy path is accessed by clients, which includes the base path
+func sitePath(p string) string {
+	return assets.Config().GetBasePath() + p
+}
+
+func isTrustedIP(networks []*net.IPNet, addr string) bool {
+	ip := net.ParseIP(strings.TrimSpace(addr))
+	if ip == nil {
+		return false
+	}
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProxyMiddleware makes the client address and scheme of requests from trusted proxies available as the request's
+// RemoteAddr and URL scheme, taking them from the X-Forwarded-For (or X-Real-IP) and X-Forwarded-Proto headers.
+// The forwarded headers are removed from all requests, so that clients that aren't proxies can't spoof them.
+func ProxyMiddleware(a *assets.Assets, unix bool, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		networks, trustUnix := a.GetConfig().GetTrustedProxies()
+		trusted := unix && trustUnix
+		if !unix {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			trusted = err == nil && isTrustedIP(networks, host)
+		}
+		if trusted {
+			// The client is the last address that isn't itself a trusted proxy
+			client := ""
+			if fwdFor := r.Header.Get("X-Forwarded-For"); fwdFor != "" {
+				addrs := strings.Split(fwdFor, ",")
+				for i := len(addrs) - 1; i >= 0; i-- {
+					client = strings.TrimSpace(addrs[i])
+					if !isTrustedIP(networks, client) {
+						break
+					}
+				}
+			} else {
+				client = strings.TrimSpace(r.Header.Get("X-Real-IP"))
+			}
+			if net.ParseIP(client) != nil {
+				r.RemoteAddr = net.JoinHostPort(client, "0")
+			}
+			if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+				r.URL.Scheme = strings.ToLower(strings.TrimSpace(strings.Split(proto, ",")[0]))
+			}
+		}
+		for _, hdr := range forwardedHeaders {
+			r.Header.Del(hdr)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// BasePathMiddleware serves heedy at the configured base path. The base path is removed from request paths,
+// so that the routers see the same paths as when heedy is served at the root. Requests without the base path
+// are also accepted, since plugins connect to heedy directly, and proxies can remove the path themselves.
+func BasePathMiddleware(a *assets.Assets, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bp := a.GetConfig().GetBasePath()
+		if bp != "" {
+			if r.URL.Path == bp {
+				// The frontend uses relative paths, so it must be loaded from a path ending in a slash
+				u := bp + "/"
+				if r.URL.RawQuery != "" {
+					u += "?" + r.URL.RawQuery
+				}
+				http.Redirect(w, r, u, http.StatusMovedPermanently)
+				return
+			}
+			if strings.HasPrefix(r.URL.Path, bp+"/") {
+				r.URL.Path = r.URL.Path[len(bp):]
+				r.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, bp)
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// networkHandler wraps the request handler with the middleware for requests that come from the network,
+// which are not needed by the requests that plugins make internally
+func networkHandler(a *assets.Assets, st *serverTLS, unix bool, h http.Handler) http.Handler {
+	h = BasePathMiddleware(a, h)
+	if st != nil && !unix {
+		h = st.Middleware(a, h)
+	}
+	return ProxyMiddleware(a, unix, h)
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heedy/heedy/backend/assets"
+)
+
+func TestProxyMiddleware(t *testing.T) {
+	proxies := []string{"10.0.0.0/8", "192.0.2.1", "unix"}
+	a := &assets.Assets{Config: &assets.Configuration{TrustedProxies: &proxies}}
+
+	// serve returns the request as seen by the handler
+	serve := func(unix bool, remote string, headers map[string]string) *http.Request {
+		var seen *http.Request
+		h := ProxyMiddleware(a, unix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = r
+		}))
+		r := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		r.RemoteAddr = remote
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		require.NotNil(t, seen)
+		for _, hdr := range forwardedHeaders {
+			require.Empty(t, seen.Header.Get(hdr), hdr)
+		}
+		return seen
+	}
+	fwd := map[string]string{
+		"X-Forwarded-For":   "203.0.113.7, 10.1.2.3",
+		"X-Forwarded-Proto": "https",
+		"Forwarded":         "for=203.0.113.7",
+	}
+
+	// The client's address and scheme are taken from trusted proxies, skipping the proxies in the chain
+	r := serve(false, "10.0.0.1:5000", fwd)
+	require.Equal(t, "203.0.113.7:0", r.RemoteAddr)
+	require.True(t, isHTTPS(r))
+	r = serve(false, "192.0.2.1:5000", map[string]string{"X-Real-IP": "198.51.100.2", "X-Forwarded-Proto": "HTTP"})
+	require.Equal(t, "198.51.100.2:0", r.RemoteAddr)
+	require.False(t, isHTTPS(r))
+	r = serve(false, "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "10.0.0.5, 10.0.0.6"})
+	require.Equal(t, "10.0.0.5:0", r.RemoteAddr)
+	r = serve(false, "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "notanip"})
+	require.Equal(t, "10.0.0.1:5000", r.RemoteAddr)
+
+	// Requests through unix sockets are trusted if "unix" is in the trusted proxies
+	r = serve(true, "@", fwd)
+	require.Equal(t, "203.0.113.7:0", r.RemoteAddr)
+	require.True(t, isHTTPS(r))
+
+	// Other clients can't spoof their address or scheme
+	r = serve(false, "192.0.2.2:5000", fwd)
+	require.Equal(t, "192.0.2.2:5000", r.RemoteAddr)
+	require.False(t, isHTTPS(r))
+	proxies = []string{"10.0.0.0/8"}
+	r = serve(true, "@", fwd)
+	require.Equal(t, "@", r.RemoteAddr)
+	require.False(t, isHTTPS(r))
+}
+
+func TestBasePathMiddleware(t *testing.T) {
+	bp := "/heedy/"
+	a := &assets.Assets{Config: &assets.Configuration{BasePath: &bp}}
+	serve := func(target string) (*httptest.ResponseRecorder, string) {
+		path := ""
+		h := BasePathMiddleware(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.EscapedPath()
+		}))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec, path
+	}
+
+	// The base path is removed from requests
+	_, p := serve("/heedy/api/users/test")
+	require.Equal(t, "/api/users/test", p)
+	_, p = serve("/heedy/api/kv/users/test/a%2Fb")
+	require.Equal(t, "/api/kv/users/test/a%2Fb", p)
+	_, p = serve("/heedy/")
+	require.Equal(t, "/", p)
+
+	// and the frontend is redirected to the path with a slash
+	rec, p := serve("/heedy?a=b")
+	require.Equal(t, http.StatusMovedPermanently, rec.Code)
+	require.Equal(t, "/heedy/?a=b", rec.Header().Get("Location"))
+	require.Empty(t, p)
+
+	// Requests without the base path are still accepted
+	_, p = serve("/api/users/test")
+	require.Equal(t, "/api/users/test", p)
+	_, p = serve("/heedyish/api")
+	require.Equal(t, "/heedyish/api", p)
+
+	bp = ""
+	_, p = serve("/heedy/api")
+	require.Equal(t, "/heedy/api", p)
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/plugins"
+	"github.com/heedy/heedy/backend/updater"
+	"github.com/sirupsen/logrus"
+)
+
+// reloadableHandler serves a handler that can be replaced while heedy is running
+type reloadableHandler struct {
+	sync.RWMutex
+	h http.Handler
+}
+
+func (rh *reloadableHandler) Set(h http.Handler) {
+	rh.Lock()
+	rh.h = h
+	rh.Unlock()
+}
+
+func (rh *reloadableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rh.RLock()
+	h := rh.h
+	rh.RUnlock()
+	h.ServeHTTP(w, r)
+}
+
+// Reloader applies changes to the configuration and active plugins while heedy is running
+type Reloader struct {
+	sync.Mutex
+	A        *assets.Assets
+	PM       *plugins.PluginManager
+	Frontend *reloadableHandler
+}
+
+// Reload applies any pending update to heedy.conf, and restarts the plugins whose configuration changed.
+// Changes to settings that are used when the server starts, such as its port or database, give a
+// restart_required error, and leave the update pending. If a plugin fails to start with the new
+// configuration, the previous configuration and plugins are restored, and the update stays pending.
+func (rl *Reloader) Reload() error {
+	rl.Lock()
+	defer rl.Unlock()
+
+	a := rl.A
+	err := updater.ApplyConfig(a.FolderPath, func() error {
+		// The new configuration is loaded and validated separately first, so that the running assets
+		// are only modified if it is valid
+		na, err := assets.Open(a.FolderPath, a.ConfigOverride)
+		if err != nil {
+			return err
+		}
+		old := a.GetConfig()
+		if s := assets.RestartSettings(old, na.Config); len(s) > 0 {
+			return fmt.Errorf("restart_required: changing %s requires restarting heedy", strings.Join(s, ", "))
+		}
+
+		prev := a.Replace(na)
+		if err = rl.PM.Reload(old); err != nil {
+			logrus.Errorf("Reload failed, restoring the previous configuration: %v", err)
+			a.Replace(prev)
+			if rerr := rl.PM.Reload(na.Config); rerr != nil {
+				logrus.Errorf("Failed to restore the previous plugins: %v", rerr)
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The frontend is recreated, since it is served from the assets of the active plugins
+	fMux, err := FrontendMux()
+	if err != nil {
+		return err
+	}
+	rl.Frontend.Set(fMux)
+	logrus.Info("Reloaded configuration")
+	return nil
+}
+
+// ServeHTTP reloads heedy when requested by an admin
+func (rl *Reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r, "Server settings") {
+		return
+	}
+	rest.CTX(r).Log.Info("Reload requested")
+	err := rl.Reload()
+	if err != nil && strings.HasPrefix(err.Error(), "restart_required:") {
+		rest.WriteJSONError(w, r, http.StatusConflict, err)
+		return
+	}
+	rest.WriteResult(w, r, err)
+}
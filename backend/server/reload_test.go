@@ -0,0 +1,100 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/plugins"
+)
+
+func TestReloadableHandler(t *testing.T) {
+	rh := &reloadableHandler{h: http.NotFoundHandler()}
+	rec := httptest.NewRecorder()
+	rh.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rh.Set(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	rec = httptest.NewRecorder()
+	rh.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusTeapot, rec.Code)
+}
+
+func TestReloaderRestartRequired(t *testing.T) {
+	adb, cleanup := newDBWithUser(t)
+	defer cleanup()
+	a := adb.Assets()
+	rl := &Reloader{A: a}
+
+	reload := func(db database.DB) int {
+		rec := httptest.NewRecorder()
+		rl.ServeHTTP(rec, withContext(httptest.NewRequest(http.MethodPost, "/api/server/reload", nil), db))
+		return rec.Code
+	}
+	require.Equal(t, http.StatusForbidden, reload(database.NewUserDB(adb, "test")))
+
+	// Changing the port can't be done while heedy is running, so the update is left pending
+	conf := filepath.Join(a.FolderPath, "heedy.conf")
+	update := filepath.Join(a.FolderPath, "updates", "heedy.conf")
+	require.NoError(t, ioutil.WriteFile(conf, []byte("\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Dir(update), 0755))
+	require.NoError(t, ioutil.WriteFile(update, []byte("port = 8765\n"), 0644))
+
+	require.Equal(t, http.StatusConflict, reload(adb))
+	b, err := ioutil.ReadFile(conf)
+	require.NoError(t, err)
+	require.Equal(t, "\n", string(b))
+	require.FileExists(t, update)
+	require.NotEqual(t, 8765, *a.Config.Port)
+}
+
+func TestReloaderRollback(t *testing.T) {
+	adb, cleanup := newDBWithUser(t)
+	defer cleanup()
+	a := adb.Assets()
+
+	// heedy runs without the builtin plugins, and a plugin that fails to start is then activated
+	conf := filepath.Join(a.FolderPath, "heedy.conf")
+	update := filepath.Join(a.FolderPath, "updates", "heedy.conf")
+	noplugins := `active_plugins = ["-notifications", "-timeseries", "-registry", "-python", "-kv"]` + "\n"
+	require.NoError(t, ioutil.WriteFile(conf, []byte(noplugins), 0644))
+	require.NoError(t, a.Reload())
+	require.NoError(t, os.MkdirAll(filepath.Join(a.FolderPath, "plugins", "broken"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(a.FolderPath, "plugins", "broken", "heedy.conf"), []byte(`
+plugin "broken" {
+	run "server" {
+		type = "exec"
+		cmd = ["./does-not-exist"]
+	}
+}
+`), 0644))
+
+	pm, err := plugins.NewPluginManager(adb, http.NotFoundHandler())
+	require.NoError(t, err)
+	defer pm.Close()
+	require.NoError(t, pm.Start(http.NotFoundHandler()))
+
+	rl := &Reloader{A: a, PM: pm, Frontend: &reloadableHandler{h: http.NotFoundHandler()}}
+	old := a.GetConfig()
+	require.NoError(t, os.MkdirAll(filepath.Dir(update), 0755))
+	require.NoError(t, ioutil.WriteFile(update, []byte(`active_plugins = ["-notifications", "-timeseries", "-registry", "-python", "-kv", "broken"]`+"\n"), 0644))
+	require.Error(t, rl.Reload())
+
+	// The previous configuration is restored, and the update stays pending
+	require.True(t, old == a.GetConfig())
+	require.Empty(t, a.GetConfig().GetActivePlugins())
+	b, err := ioutil.ReadFile(conf)
+	require.NoError(t, err)
+	require.Equal(t, noplugins, string(b))
+	require.FileExists(t, update)
+	_, ok := pm.Plugins["broken"]
+	require.False(t, ok)
+}
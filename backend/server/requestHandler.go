@@ -52,7 +52,13 @@ func (a *RequestHandler) serve(w http.ResponseWriter, r *http.Request, requestSt
 	a.Lock()
 	a.activeRequests[c.ID] = c
 	a.Unlock()
-	a.Plugins.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), rest.HeedyContext, c)))
+	httpActiveRequests.Inc()
+	// The route is found before serving, since handlers can modify the request's path
+	method, route := r.Method, metricsRoute(r.URL.Path)
+	sr := &statusRecorder{ResponseWriter: w}
+	a.Plugins.ServeHTTP(sr, r.WithContext(context.WithValue(r.Context(), rest.HeedyContext, c)))
+	httpActiveRequests.Dec()
+	observeRequest(method, route, sr.status, time.Since(requestStart))
 	a.Lock()
 	delete(a.activeRequests, c.ID)
 	a.Unlock()
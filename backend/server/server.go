@@ -3,9 +3,11 @@ package server
 import (
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi"
@@ -14,6 +16,7 @@ import (
 	"github.com/heedy/heedy/backend/assets"
 	"github.com/heedy/heedy/backend/database"
 	"github.com/heedy/heedy/backend/plugins"
+	"github.com/heedy/heedy/backend/plugins/run"
 	"github.com/heedy/heedy/backend/updater"
 
 	"github.com/sirupsen/logrus"
@@ -32,7 +35,7 @@ func Run(a *assets.Assets, o *RunOptions) error {
 
 	auth := NewAuth(db)
 
-	serverAddress := fmt.Sprintf("%s:%d", a.Config.GetHost(), a.Config.GetPort())
+	serverAddress := fmt.Sprintf("%s:%d", a.GetConfig().GetHost(), a.GetConfig().GetPort())
 
 	apiMux, err := APIMux()
 	if err != nil {
@@ -47,55 +50,128 @@ func Run(a *assets.Assets, o *RunOptions) error {
 		return err
 	}
 
+	frontend := &reloadableHandler{h: fMux}
+
 	mux := chi.NewMux()
 	mux.Mount("/api", apiMux)
 	mux.Mount("/auth", authMux)
-	mux.Mount("/", fMux)
+	mux.Mount("/", frontend)
 
 	pm, err := plugins.NewPluginManager(db, http.Handler(mux))
 	if err != nil {
 		return err
 	}
 
-	requestHandler := http.Handler(NewRequestHandler(auth, pm))
+	if err = RegisterMetrics(db, pm); err != nil {
+		return err
+	}
+	AddRunnerRoutes(apiMux, pm.RunManager)
+
+	requestHandler := HealthMiddleware(db, auth, pm, MetricsTokenMiddleware(db, NewRequestHandler(auth, pm)))
 
-	if a.Config.Verbose {
+	if a.GetConfig().Verbose {
 		logrus.Warn("Running in verbose mode")
 		requestHandler = VerboseLoggingMiddleware(requestHandler, nil)
 	}
 
-	err = nil
+	st, err := newServerTLS(a)
+	if err != nil {
+		return err
+	}
+	// The https redirect, base path and proxy headers are only handled for requests coming from the network,
+	// not for those made internally by plugins
 	srv := &http.Server{
 		Addr:    serverAddress,
-		Handler: requestHandler,
+		Handler: networkHandler(a, st, false, requestHandler),
+	}
+	var redirectSrv *http.Server
+	if st != nil {
+		if rp := a.GetConfig().RedirectPort; rp != nil && *rp != 0 {
+			redirectSrv = &http.Server{
+				Addr:    fmt.Sprintf("%s:%d", a.GetConfig().GetHost(), *rp),
+				Handler: st.RedirectHandler(a.GetConfig().GetPort()),
+			}
+		}
 	}
 
-	// Now load the plugins (so that the server is ready when they are loaded)
-	go func() {
-		logrus.Info("Initializing plugins...")
-		err = pm.Start(requestHandler)
-		if err != nil {
-			srv.Close()
-			return
+	// The configured listeners are opened before starting, so that heedy fails right away if one is unavailable.
+	// Unix sockets are only reachable from the machine running heedy, so they are always served without https.
+	servers := []*http.Server{srv}
+	var lns []net.Listener
+	for name, l := range a.GetConfig().GetListeners() {
+		ln, isUnix, lerr := listen(a, l)
+		if lerr != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return fmt.Errorf("Could not open listener %s: %w", name, lerr)
 		}
-		logrus.Infof("Running heedy on %s", serverAddress)
-	}()
+		if st != nil && !isUnix {
+			ln = st.Listener(ln)
+		}
+		servers = append(servers, &http.Server{
+			Addr:    *l.Address,
+			Handler: networkHandler(a, st, isUnix, ListenerMiddleware(a, l, requestHandler)),
+		})
+		lns = append(lns, ln)
+	}
 
+	// Plugins that run without network access reach the API over a unix socket
+	pln, err := listenPluginAPI(a)
+	if err != nil {
+		for _, ln := range lns {
+			ln.Close()
+		}
+		return fmt.Errorf("Could not open the plugin API socket: %w", err)
+	}
+	servers = append(servers, &http.Server{
+		Addr:    run.APISocket(a.DataDir()),
+		Handler: networkHandler(a, st, true, requestHandler),
+	})
+	lns = append(lns, pln)
+
+	// Heedy is stopped on SIGINT/SIGTERM, as well as when restarting or when plugins fail to start.
+	// The server stops accepting connections, and once the requests in progress are done, the plugins are stopped.
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	stop := func() {
+		select {
+		case c <- os.Interrupt:
+		default:
+		}
+	}
+	stopped := make(chan struct{})
 	go func() {
 		<-c
-		srv.Close()
-
-		// If there is another ctrl c, kill the program
-		<-c
-		logrus.Error("Killing")
+		logrus.Info("Shutting down...")
 		go func() {
-			time.Sleep(2)
+			// If there is another ctrl c, kill the program
+			<-c
+			logrus.Error("Killing")
+			go func() {
+				time.Sleep(2)
+				os.Exit(1)
+			}()
+			pm.Kill()
 			os.Exit(1)
 		}()
-		pm.Kill()
-		os.Exit(1)
+
+		if redirectSrv != nil {
+			redirectSrv.Close()
+		}
+		Shutdown(a.GetConfig().GetShutdownTimeout(), servers...)
+		close(stopped)
+	}()
+
+	// Now load the plugins (so that the server is ready when they are loaded)
+	go func() {
+		logrus.Info("Initializing plugins...")
+		err = pm.Start(requestHandler)
+		if err != nil {
+			stop()
+			return
+		}
+		logrus.Infof("Running heedy on %s", serverAddress)
 	}()
 
 	// We add a special handler to allow restarting the server
@@ -104,21 +180,56 @@ func Run(a *assets.Assets, o *RunOptions) error {
 	mux.HandleFunc("/api/server/restart", func(w http.ResponseWriter, r *http.Request) {
 		db := rest.CTX(r).DB
 		a := db.AdminDB().Assets()
-		if db.ID() != "heedy" && !a.Config.UserIsAdmin(db.ID()) {
+		if db.ID() != "heedy" && !a.GetConfig().UserIsAdmin(db.ID()) {
 			rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("Only admins can restart heedy"))
 			return
 		}
 		rest.CTX(r).Log.Warn("Restart requested")
 		restartServer = true
 		applyUpdates = true
-		c <- os.Interrupt
+		stop()
 
 		rest.WriteResult(w, r, nil)
 	})
 
-	serr := srv.ListenAndServe()
+	// Configuration changes that don't need a restart can be applied with a reload
+	mux.Post("/api/server/reload", (&Reloader{
+		A:        a,
+		PM:       pm,
+		Frontend: frontend,
+	}).ServeHTTP)
+
+	if redirectSrv != nil {
+		go func() {
+			logrus.Infof("Redirecting http on %s to https", redirectSrv.Addr)
+			if rerr := redirectSrv.ListenAndServe(); rerr != http.ErrServerClosed {
+				logrus.Errorf("Failed to redirect http to https: %v", rerr)
+			}
+		}()
+	}
+
+	for i, ln := range lns {
+		go func(lsrv *http.Server, ln net.Listener) {
+			logrus.Infof("Listening on %s", lsrv.Addr)
+			if lerr := lsrv.Serve(ln); lerr != http.ErrServerClosed {
+				logrus.Errorf("Stopped listening on %s: %v", lsrv.Addr, lerr)
+			}
+		}(servers[i+1], ln)
+	}
+
+	ln, serr := net.Listen("tcp", serverAddress)
+	if serr == nil {
+		if st != nil {
+			// Plain http connections are accepted alongside TLS, since plugins connect to heedy with http
+			ln = st.Listener(ln)
+		}
+		serr = srv.Serve(ln)
+	}
 	if serr != http.ErrServerClosed {
 		err = serr
+	} else {
+		// Wait until the requests in progress are done
+		<-stopped
 	}
 	logrus.Info("Stopping plugins...")
 	pm.Close()
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/sirupsen/logrus"
+	"nhooyr.io/websocket"
+)
+
+var (
+	// shuttingDown is canceled when heedy starts shutting down, so that open websockets are closed
+	shuttingDown, startShutdown = context.WithCancel(context.Background())
+	// openWebsockets tracks the websockets that have not yet been closed. Websockets are hijacked
+	// connections, so the http server does not wait for them when shutting down.
+	openWebsockets = newWebsocketTracker()
+
+	errShuttingDown = errors.New("unavailable: heedy is shutting down")
+)
+
+// websocketTracker counts open websockets. Once it is closed, no new websockets are accepted,
+// so that shutting down doesn't race with websockets being opened.
+type websocketTracker struct {
+	sync.Mutex
+	open   int
+	closed bool
+	done   chan struct{}
+}
+
+func newWebsocketTracker() *websocketTracker {
+	return &websocketTracker{done: make(chan struct{})}
+}
+
+// Add counts a new websocket, returning false if heedy is shutting down. Each successful
+// call must be followed by a call to Done once the websocket is closed.
+func (wt *websocketTracker) Add() bool {
+	wt.Lock()
+	defer wt.Unlock()
+	if wt.closed {
+		return false
+	}
+	wt.open++
+	return true
+}
+
+// Done marks a websocket as closed
+func (wt *websocketTracker) Done() {
+	wt.Lock()
+	defer wt.Unlock()
+	wt.open--
+	if wt.closed && wt.open == 0 {
+		close(wt.done)
+	}
+}
+
+// Close refuses new websockets, and returns a channel that is closed once all open websockets are done
+func (wt *websocketTracker) Close() <-chan struct{} {
+	wt.Lock()
+	defer wt.Unlock()
+	if !wt.closed {
+		wt.closed = true
+		if wt.open == 0 {
+			close(wt.done)
+		}
+	}
+	return wt.done
+}
+
+// acceptWebsocket accepts a websocket connection that is tracked until shutdown. The returned
+// function must be called once the websocket is closed. If heedy is shutting down, or the
+// connection can't be upgraded, an error is written, and nil is returned.
+func acceptWebsocket(w http.ResponseWriter, r *http.Request) (*websocket.Conn, func()) {
+	if !openWebsockets.Add() {
+		rest.WriteJSONError(w, r, http.StatusServiceUnavailable, errShuttingDown)
+		return nil, nil
+	}
+	ws, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		openWebsockets.Done()
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return nil, nil
+	}
+	return ws, openWebsockets.Done
+}
+
+// closeOnShutdown closes the websocket with a going away status if heedy shuts down before ctx is done
+func closeOnShutdown(ctx context.Context, ws *websocket.Conn) {
+	select {
+	case <-shuttingDown.Done():
+		ws.Close(websocket.StatusGoingAway, "heedy is shutting down")
+	case <-ctx.Done():
+	}
+}
+
+// Shutdown stops the servers gracefully: they stop accepting connections, a close frame is sent to
+// open websockets, and requests in progress are given until the timeout to finish. Connections that
+// are still open after the timeout are closed.
+func Shutdown(timeout time.Duration, servers ...*http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	startShutdown()
+	done := openWebsockets.Close()
+	errc := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			errc <- srv.Shutdown(ctx)
+		}(srv)
+	}
+	var err error
+	for range servers {
+		if serr := <-errc; serr != nil {
+			err = serr
+		}
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	if err != nil {
+		logrus.Warnf("Requests were still in progress after %s, closing them", timeout)
+		for _, srv := range servers {
+			srv.Close()
+		}
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+)
+
+// TestShutdown shuts down heedy's global state, so it is the only test that can call Shutdown
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ws":
+			ws, closed := acceptWebsocket(w, r)
+			if ws == nil {
+				return
+			}
+			defer closed()
+			go closeOnShutdown(r.Context(), ws)
+			started <- struct{}{}
+			ws.Read(context.Background())
+		case "/slow":
+			started <- struct{}{}
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte("done"))
+		default:
+			started <- struct{}{}
+			<-release
+		}
+	}))
+	defer srv.Close()
+
+	ws, _, err := websocket.Dial(context.Background(), "ws"+srv.URL[len("http"):]+"/ws", nil)
+	require.NoError(t, err)
+	<-started
+
+	// Requests in progress are given time to finish, and open websockets are closed
+	res := make(chan string)
+	go func() {
+		r, err := http.Get(srv.URL + "/slow")
+		if err != nil {
+			res <- err.Error()
+			return
+		}
+		defer r.Body.Close()
+		b, _ := ioutil.ReadAll(r.Body)
+		res <- string(b)
+	}()
+	<-started
+	require.NoError(t, Shutdown(time.Second, srv.Config))
+	require.Equal(t, "done", <-res)
+	_, _, err = ws.Read(context.Background())
+	require.Equal(t, websocket.StatusGoingAway, websocket.CloseStatus(err))
+
+	// Connections still open after the timeout are closed
+	srv2 := httptest.NewServer(srv.Config.Handler)
+	defer srv2.Close()
+
+	// and no new websockets are opened once shutdown started
+	_, res2, err := websocket.Dial(context.Background(), "ws"+srv2.URL[len("http"):]+"/ws", nil)
+	require.Error(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, res2.StatusCode)
+
+	// The hanging handler is released before the servers are closed
+	defer close(release)
+	errc := make(chan error)
+	go func() {
+		_, err := http.Get(srv2.URL + "/hang")
+		errc <- err
+	}()
+	<-started
+	require.Error(t, Shutdown(50*time.Millisecond, srv2.Config))
+	require.Error(t, <-errc)
+}
+
+func TestWebsocketTracker(t *testing.T) {
+	wt := newWebsocketTracker()
+	require.True(t, wt.Add())
+	require.True(t, wt.Add())
+	wt.Done()
+	done := wt.Close()
+	select {
+	case <-done:
+		t.Fatal("shutdown didn't wait for the open websocket")
+	default:
+	}
+	// New websockets are refused once shutdown started
+	require.False(t, wt.Add())
+	wt.Done()
+	<-done
+	// and closing again is fine
+	<-wt.Close()
+
+	<-newWebsocketTracker().Close()
+}
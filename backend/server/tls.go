@@ -0,0 +1,252 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// serverTLS holds the certificates of a server that uses https
+type serverTLS struct {
+	Config *tls.Config
+
+	// acme is nil if the certificate is given in the configuration
+	acme *autocert.Manager
+}
+
+// configPath returns the absolute path of a file given in the configuration, which can be relative to the heedy folder
+func configPath(a *assets.Assets, p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return a.Abs(p)
+}
+
+// newServerTLS sets up https for the server, with either the certificate from the configuration, or one
+// from the configured ACME server. It returns nil if https is not enabled.
+func newServerTLS(a *assets.Assets) (*serverTLS, error) {
+	c := a.GetConfig()
+	if !c.TLSEnabled() {
+		return nil, nil
+	}
+	// Websockets need http/1.1, so http/2 is not offered
+	nextProtos := []string{"http/1.1"}
+	if c.ACME == nil {
+		cert, err := tls.LoadX509KeyPair(configPath(a, *c.TLSCert), configPath(a, *c.TLSKey))
+		if err != nil {
+			return nil, fmt.Errorf("Could not load TLS certificate: %w", err)
+		}
+		return &serverTLS{
+			Config: &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				NextProtos:   nextProtos,
+			},
+		}, nil
+	}
+
+	client := &acme.Client{
+		DirectoryURL: autocert.DefaultACMEDirectory,
+	}
+	if c.ACME.DirectoryURL != nil && *c.ACME.DirectoryURL != "" {
+		client.DirectoryURL = *c.ACME.DirectoryURL
+	}
+	if c.ACME.CARoot != nil && *c.ACME.CARoot != "" {
+		b, err := ioutil.ReadFile(configPath(a, *c.ACME.CARoot))
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("No certificates found in %s", *c.ACME.CARoot)
+		}
+		client.HTTPClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		}
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(c.ACME.Domains...),
+		Cache:      autocert.DirCache(a.DataAbs("acme")),
+		Client:     client,
+	}
+	if c.ACME.Email != nil {
+		m.Email = *c.ACME.Email
+	}
+	logrus.Infof("Using certificates from %s for %v", client.DirectoryURL, c.ACME.Domains)
+
+	config := m.TLSConfig()
+	config.NextProtos = append(nextProtos, acme.ALPNProto)
+	return &serverTLS{
+		Config: config,
+		acme:   m,
+	}, nil
+}
+
+// isLocalRequest returns whether the request comes from the machine running heedy
+func isLocalRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// httpsRedirect redirects requests to the same url with https on the given port
+func httpsRedirect(port uint16) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, fmt.Sprint(port))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	}
+}
+
+// Middleware redirects plain http requests to https, and adds the HSTS header to https responses.
+// Requests that reached a trusted proxy with https are treated as https requests.
+// Plain http requests from the local machine are still answered, since plugins use them to access the API.
+func (st *serverTLS) Middleware(a *assets.Assets, h http.Handler) http.Handler {
+	redirect := httpsRedirect(a.GetConfig().GetPort())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isHTTPS(r) {
+			if !isLocalRequest(r) {
+				redirect(w, r)
+				return
+			}
+		} else if hsts := a.GetConfig().GetHSTS(); hsts != "" {
+			w.Header().Set("Strict-Transport-Security", hsts)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// RedirectHandler is served on the redirect port: it redirects all requests to https on the given port,
+// and answers ACME http challenges.
+func (st *serverTLS) RedirectHandler(port uint16) http.Handler {
+	if st.acme != nil {
+		return st.acme.HTTPHandler(httpsRedirect(port))
+	}
+	return httpsRedirect(port)
+}
+
+// Listener returns a listener that accepts both TLS and plain http connections
+func (st *serverTLS) Listener(l net.Listener) net.Listener {
+	sl := &sniffListener{
+		Listener: l,
+		config:   st.Config,
+		conns:    make(chan net.Conn),
+		errc:     make(chan error),
+		done:     make(chan struct{}),
+	}
+	go sl.run()
+	return sl
+}
+
+var errListenerClosed = errors.New("listener closed")
+
+// sniffListener serves both TLS and plain http connections on the same port. It tells them apart
+// by the first byte sent by the client, which is a handshake record for TLS connections.
+type sniffListener struct {
+	net.Listener
+	config *tls.Config
+
+	conns     chan net.Conn
+	errc      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *sniffListener) run() {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.errc <- err:
+			case <-l.done:
+				return
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		go l.sniff(c)
+	}
+}
+
+func (l *sniffListener) sniff(c net.Conn) {
+	// The first byte is read separately from the http server, so clients that connect without
+	// sending anything are timed out here
+	first := make([]byte, 1)
+	c.SetReadDeadline(time.Now().Add(10 * time.Second))
+	n, err := c.Read(first)
+	c.SetReadDeadline(time.Time{})
+	if err != nil || n == 0 {
+		c.Close()
+		return
+	}
+	var conn net.Conn = &peekedConn{Conn: c, first: first}
+	if first[0] == 0x16 {
+		conn = tls.Server(conn, l.config)
+	}
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *sniffListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case err := <-l.errc:
+		return nil, err
+	case <-l.done:
+		return nil, errListenerClosed
+	}
+}
+
+func (l *sniffListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+	return l.Listener.Close()
+}
+
+// peekedConn is a connection whose first byte was already read
+type peekedConn struct {
+	net.Conn
+	first []byte
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	if len(c.first) > 0 {
+		n := copy(b, c.first)
+		c.first = c.first[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
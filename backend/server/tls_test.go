@@ -0,0 +1,121 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heedy/heedy/backend/assets"
+)
+
+// testCertificate returns a self-signed certificate for 127.0.0.1
+func testCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "heedy test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestSniffListener(t *testing.T) {
+	st := &serverTLS{Config: &tls.Config{Certificates: []tls.Certificate{testCertificate(t)}}}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	sl := st.Listener(ln)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			w.Write([]byte("https"))
+		} else {
+			w.Write([]byte("http"))
+		}
+	})}
+	go srv.Serve(sl)
+	defer srv.Close()
+
+	get := func(c *http.Client, url string) string {
+		res, err := c.Get(url)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		b, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return string(b)
+	}
+	addr := ln.Addr().String()
+	tlsClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+
+	// A client that connects without sending anything doesn't hold up other connections
+	idle, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer idle.Close()
+
+	// Plain and TLS connections are served on the same port
+	require.Equal(t, "http", get(http.DefaultClient, "http://"+addr))
+	require.Equal(t, "https", get(tlsClient, "https://"+addr))
+	require.Equal(t, "http", get(http.DefaultClient, "http://"+addr))
+
+	// Clients that disconnect right away are dropped
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	c.Close()
+	require.Equal(t, "https", get(tlsClient, "https://"+addr))
+
+	require.NoError(t, sl.Close())
+	_, err = sl.Accept()
+	require.Equal(t, errListenerClosed, err)
+}
+
+func TestTLSMiddleware(t *testing.T) {
+	port := uint16(8443)
+	hsts := "max-age=63072000"
+	a := &assets.Assets{Config: &assets.Configuration{Port: &port, HSTS: &hsts}}
+	st := &serverTLS{}
+	h := st.Middleware(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	serve := func(r *http.Request, remote string) *httptest.ResponseRecorder {
+		r.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	// Plain http requests from the network are redirected to https
+	rec := serve(httptest.NewRequest(http.MethodGet, "http://example.com:1324/api/users?q=1", nil), "192.0.2.1:1234")
+	require.Equal(t, http.StatusMovedPermanently, rec.Code)
+	require.Equal(t, "https://example.com:8443/api/users?q=1", rec.Header().Get("Location"))
+
+	// but are still served to plugins on the local machine
+	rec = serve(httptest.NewRequest(http.MethodGet, "http://localhost:1324/api/users", nil), "127.0.0.1:1234")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Header().Get("Strict-Transport-Security"))
+
+	rec = serve(httptest.NewRequest(http.MethodGet, "https://example.com:8443/api/users", nil), "192.0.2.1:1234")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, hsts, rec.Header().Get("Strict-Transport-Security"))
+
+	// The redirect port sends everything to https
+	rec = httptest.NewRecorder()
+	(&serverTLS{}).RedirectHandler(443).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/login", nil))
+	require.Equal(t, "https://example.com/login", rec.Header().Get("Location"))
+}
@@ -101,6 +101,45 @@ func ReadConfig(configDir string) (*assets.Configuration, error) {
 	return assets.LoadConfigFile(updateHeedy)
 }
 
+// ApplyConfig moves a pending update of heedy.conf into place without restarting heedy, and calls apply
+// to load it. If apply fails, the previous heedy.conf is restored and the update stays pending.
+// Updates to the heedy executable or plugins, and updates that back up or delete data, can only
+// be applied by restarting.
+func ApplyConfig(configDir string, apply func() error) error {
+	ui, err := GetInfo(configDir)
+	if err != nil {
+		return err
+	}
+	if ui.Heedy || len(ui.Plugins) > 0 || ui.Options != nil && (ui.Options.BackupData || len(ui.Options.DeletedPlugins) > 0) {
+		return errors.New("restart_required: the pending updates can only be applied by restarting heedy")
+	}
+	if !ui.Config {
+		return apply()
+	}
+
+	configHeedy := path.Join(configDir, "heedy.conf")
+	updateHeedy := path.Join(configDir, "updates", "heedy.conf")
+	b, err := ioutil.ReadFile(updateHeedy)
+	if err != nil {
+		return err
+	}
+	old, err := ioutil.ReadFile(configHeedy)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(configHeedy, b, os.ModePerm); err != nil {
+		return err
+	}
+	if err = apply(); err != nil {
+		if rerr := ioutil.WriteFile(configHeedy, old, os.ModePerm); rerr != nil {
+			logrus.Errorf("Failed to restore heedy.conf: %v", rerr)
+		}
+		return err
+	}
+	logrus.Info("Applied update to heedy.conf")
+	return ClearUpdates(configDir)
+}
+
 func EnablePlugins(configDir string, pname []string) error {
 	c, err := ReadConfig(configDir)
 	if err != nil {
@@ -1,6 +1,7 @@
 package updater
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -109,3 +110,34 @@ func TestBackupData(t *testing.T) {
 	require.Equal(t, string(b), "blah")
 
 }
+
+func TestApplyConfig(t *testing.T) {
+	logrus.SetLevel(logrus.DebugLevel)
+	require.NoError(t, os.MkdirAll("./tester/updates", 0775))
+	defer os.RemoveAll("./tester")
+
+	ioutil.WriteFile("./tester/heedy.conf", []byte("current"), 0664)
+	ioutil.WriteFile("./tester/updates/heedy.conf", []byte("next"), 0664)
+
+	// A failed apply restores the current configuration, and leaves the update pending
+	require.Error(t, ApplyConfig("tester", func() error {
+		b, err := ioutil.ReadFile("./tester/heedy.conf")
+		require.NoError(t, err)
+		require.Equal(t, string(b), "next")
+		return errors.New("failed")
+	}))
+	b, err := ioutil.ReadFile("./tester/heedy.conf")
+	require.NoError(t, err)
+	require.Equal(t, string(b), "current")
+	require.True(t, Available("tester"))
+
+	require.NoError(t, ApplyConfig("tester", func() error { return nil }))
+	b, err = ioutil.ReadFile("./tester/heedy.conf")
+	require.NoError(t, err)
+	require.Equal(t, string(b), "next")
+	require.False(t, Available("tester"))
+
+	// Plugin updates need a restart
+	require.NoError(t, os.MkdirAll("./tester/updates/plugins/testy", 0775))
+	require.Error(t, ApplyConfig("tester", func() error { return nil }))
+}
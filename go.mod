@@ -9,10 +9,10 @@ require (
 	github.com/dkumor/revhttpfs v0.0.0-20190804203940-8dd55c115095
 	github.com/go-chi/chi v4.1.2+incompatible
 	github.com/golang/gddo v0.0.0-20200831202555-721e228c7686
-	github.com/google/go-cmp v0.5.2 // indirect
 	github.com/google/go-github/v24 v24.0.1
 	github.com/google/uuid v1.1.2
 	github.com/gorilla/schema v1.2.0
+	github.com/graphql-go/graphql v0.8.1
 	github.com/hashicorp/hcl/v2 v2.6.0
 	github.com/heedy/pipescript v0.0.0-20201010172239-10f2d7b90935
 	github.com/jmoiron/sqlx v1.2.0
@@ -28,6 +28,7 @@ require (
 	github.com/mitchellh/mapstructure v1.3.3
 	github.com/patrickmn/go-cache v2.1.0+incompatible
 	github.com/philhofer/fwd v1.0.0 // indirect
+	github.com/prometheus/client_golang v1.11.1
 	github.com/rakyll/statik v0.1.7
 	github.com/robfig/cron/v3 v3.0.1
 	github.com/rs/xid v1.2.1
@@ -44,7 +45,6 @@ require (
 	golang.org/x/crypto v0.0.0-20201002170205-7f63de1d35b0
 	golang.org/x/net v0.0.0-20201009032441-dbdefad45b89 // indirect
 	golang.org/x/oauth2 v0.0.0-20200902213428-5d25da1a8d43
-	golang.org/x/sys v0.0.0-20201009025420-dfb3f7c4e634 // indirect
 	golang.org/x/tools v0.0.0-20201010145503-6e5c6d77ddcc // indirect
 	gopkg.in/yaml.v2 v2.3.0 // indirect
 	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776 // indirect
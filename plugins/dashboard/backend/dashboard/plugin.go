@@ -19,7 +19,7 @@ func StartDashboard(db *database.AdminDB, i *run.Info, h run.BuiltinHelper) erro
 	}
 
 	// Set up the global Dashboard object
-	dplugin, ok := db.Assets().Config.Plugins["dashboard"]
+	dplugin, ok := db.Assets().GetConfig().Plugins["dashboard"]
 	if !ok {
 		return errors.New("Could not find dashboard plugin configuration")
 	}
@@ -26,7 +26,7 @@ function setup(frontend) {
       description: "Display data from multiple sources",
       icon: "dashboard",
       fn: async () => {
-        let res = await frontend.rest("POST", "/api/objects", {
+        let res = await frontend.rest("POST", "api/objects", {
           name: "My Dashboard",
           type: "dashboard",
         });
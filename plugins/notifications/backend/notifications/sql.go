@@ -472,7 +472,7 @@ func WriteNotification(db database.DB, n *Notification) error {
 	if dbid == "heedy" || *u.UserName == dbid {
 		cNames = append(cNames, "user")
 		cValues = append(cValues, *u.UserName)
-		_, err := db.AdminDB().Exec(fmt.Sprintf("INSERT INTO notifications_user(%s) VALUES (%s) ON CONFLICT(user,app,object,key) DO UPDATE SET %s;", strings.Join(cNames, ","), database.QQ(len(cNames)), eS),
+		_, err := db.AdminDB().Exec(fmt.Sprintf("INSERT INTO notifications_user(%s) VALUES (%s) ON CONFLICT(user,key) DO UPDATE SET %s;", strings.Join(cNames, ","), database.QQ(len(cNames)), eS),
 			cValues...)
 		return err
 	}
@@ -0,0 +1,78 @@
+package notifications
+
+import (
+	"os"
+	"testing"
+
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/stretchr/testify/require"
+)
+
+func newDBWithUser(t *testing.T) (*database.AdminDB, func()) {
+	a, err := assets.Open("", nil)
+	require.NoError(t, err)
+	os.RemoveAll("./test_db")
+	a.FolderPath = "./test_db"
+	sqla := "sqlite3://heedy.db?_journal=WAL&_fk=1"
+	a.Config.SQL = &sqla
+	assets.SetGlobal(a)
+	cleanup := func() {
+		os.RemoveAll("./test_db")
+	}
+
+	err = database.Create(a)
+	if err != nil {
+		cleanup()
+	}
+	require.NoError(t, err)
+	adb, err := database.Open(a)
+	require.NoError(t, err)
+
+	name := "test"
+	passwd := "test"
+	require.NoError(t, adb.CreateUser(&database.User{
+		UserName: &name,
+		Password: &passwd,
+	}))
+	return adb, cleanup
+}
+
+func TestUserNotificationUpsert(t *testing.T) {
+	adb, cleanup := newDBWithUser(t)
+	defer cleanup()
+
+	user := "test"
+	title := "Hello"
+	description := "first"
+	require.NoError(t, WriteNotification(adb, &Notification{
+		Key:         "mykey",
+		User:        &user,
+		Title:       &title,
+		Description: &description,
+	}))
+
+	// Writing the same key again updates the existing notification
+	title2 := "Hello again"
+	require.NoError(t, WriteNotification(adb, &Notification{
+		Key:   "mykey",
+		User:  &user,
+		Title: &title2,
+	}))
+
+	ns, err := ReadNotifications(adb, &NotificationsQuery{User: &user})
+	require.NoError(t, err)
+	require.Len(t, ns, 1)
+	require.Equal(t, title2, *ns[0].Title)
+	require.Equal(t, description, *ns[0].Description)
+
+	// A different key is a separate notification
+	require.NoError(t, WriteNotification(adb, &Notification{
+		Key:   "otherkey",
+		User:  &user,
+		Title: &title,
+	}))
+	ns, err = ReadNotifications(adb, &NotificationsQuery{User: &user})
+	require.NoError(t, err)
+	require.Len(t, ns, 2)
+}
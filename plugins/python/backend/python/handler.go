@@ -41,7 +41,7 @@ var (
 // Start checks the currently set python path to make sure that it is valid
 func Start(db *database.AdminDB, i *run.Info, h run.BuiltinHelper) error {
 
-	pyplugin, ok := db.Assets().Config.Plugins["python"]
+	pyplugin, ok := db.Assets().GetConfig().Plugins["python"]
 	if !ok {
 		return errors.New("Could not find python plugin configuration")
 	}
@@ -85,16 +85,18 @@ func Start(db *database.AdminDB, i *run.Info, h run.BuiltinHelper) error {
 	return err
 }
 
-func StartPython(w http.ResponseWriter, r *http.Request) {
+// startPython starts the python process described in the request. If it fails, an error is written
+// to the response, and a nil command is returned.
+func startPython(w http.ResponseWriter, r *http.Request) (*run.Info, *run.Cmd, *run.StartMessage) {
 	if !settings.IsEnabled {
 		rest.WriteJSONError(w, r, http.StatusFailedDependency, errors.New("No python interpreter is set up. Please check your heedy configuration."))
-		return
+		return nil, nil, nil
 	}
 	var i run.Info
 	err := rest.UnmarshalRequest(r, &i)
 	if err != nil {
 		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
-		return
+		return nil, nil, nil
 	}
 
 	// Prepare the API message
@@ -104,7 +106,7 @@ func StartPython(w http.ResponseWriter, r *http.Request) {
 		apis, ok := apii.(string)
 		if !ok {
 			rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("plugin 'api' must be string"))
-			return
+			return nil, nil, nil
 		}
 		sm.API = apis
 	}
@@ -113,12 +115,12 @@ func StartPython(w http.ResponseWriter, r *http.Request) {
 	filenamei, ok := i.Run.Settings["path"]
 	if !ok {
 		rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("The path to a python file must be specified"))
-		return
+		return nil, nil, nil
 	}
 	filename, ok := filenamei.(string)
 	if !ok {
 		rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("The 'path' argument must be a string"))
-		return
+		return nil, nil, nil
 	}
 
 	// Extract args
@@ -128,14 +130,14 @@ func StartPython(w http.ResponseWriter, r *http.Request) {
 		argsa, ok := argsi.([]interface{})
 		if !ok {
 			rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("The 'args' argument must be an array of strings"))
-			return
+			return nil, nil, nil
 		}
 		args = make([]string, 0, len(argsa))
 		for i := range argsa {
 			s, ok := argsa[i].(string)
 			if !ok {
 				rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("The 'args' argument must be an array of strings"))
-				return
+				return nil, nil, nil
 			}
 			args = append(args, s)
 		}
@@ -145,64 +147,65 @@ func StartPython(w http.ResponseWriter, r *http.Request) {
 	_, err = os.Stat(fp)
 	if err != nil {
 		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
-		return
+		return nil, nil, nil
 	}
+	// Plugins with requirements get their own virtualenv, so that their dependencies don't conflict
+	python := settings.Path
 	requirementsFile := path.Join(filepath.Dir(fp), "requirements.txt")
 	_, err = os.Stat(requirementsFile)
 	if err == nil {
-		l.Debugf("Setting up requirements from %s", requirementsFile)
-		fullargs := append([]string{"-m", "pip", "install", "-r", requirementsFile}, settings.PipArgs...)
-		if settings.DB.Verbose {
-			l.Debugf("%s %s", settings.Path, strings.Join(fullargs, " "))
-		}
-		cmd := exec.Command(settings.Path, fullargs...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		err = cmd.Run()
+		python, err = SetupVenv(&i, requirementsFile)
 		if err != nil {
 			rest.WriteJSONError(w, r, http.StatusBadRequest, err)
-			return
+			return nil, nil, nil
 		}
 	}
 	fullargs := append([]string{fp}, args...)
 	if settings.DB.Verbose {
-		l.Debugf("%s %s", settings.Path, strings.Join(fullargs, " "))
+		l.Debugf("%s %s", python, strings.Join(fullargs, " "))
 	}
-	cmd := exec.Command(settings.Path, fullargs...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd := exec.Command(python, fullargs...)
+	run.AttachLogs(&i, cmd)
 	cmd.Dir = i.PluginDir
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setpgid: true,
 	}
+	sb := run.NewSandbox(&i)
+	if err = sb.Prepare(cmd); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return nil, nil, nil
+	}
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
-		return
+		return nil, nil, nil
 	}
 	// Prepare the input
 	infobytes, err := json.Marshal(i)
 	if err != nil {
 		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
-		return
+		return nil, nil, nil
 	}
 
-	if err = cmd.Start(); err != nil {
+	if err = sb.Start(cmd); err != nil {
 		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
-		return
+		return nil, nil, nil
 	}
 	_, err = stdin.Write(infobytes)
 	if err == nil {
 		_, err = stdin.Write([]byte{'\n'})
 	}
-	if err != nil {
+	// A process that exits right away closes its stdin before the info is written, which
+	// is not an error here - its exit status is reported like that of any other process
+	if err != nil && !errors.Is(err, syscall.EPIPE) {
 		// Kill the process if can't write to stdin
 		cmd.Process.Kill()
 		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
-		return
+		return nil, nil, nil
 	}
 
 	c := run.NewCmd(cmd)
+	c.Sandbox = sb
 	go c.Wait()
 	settings.Lock()
 	settings.Cmd[i.APIKey] = c
@@ -219,16 +222,33 @@ func StartPython(w http.ResponseWriter, r *http.Request) {
 			settings.Unlock()
 			cmd.Process.Kill()
 			rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
-			return
+			return nil, nil, nil
 		}
 	}
 
-	rest.WriteJSON(w, r, &sm, nil)
+	return &i, c, &sm
 }
 
+func StartPython(w http.ResponseWriter, r *http.Request) {
+	if _, c, sm := startPython(w, r); c != nil {
+		rest.WriteJSON(w, r, sm, nil)
+	}
+}
+
+// RunPython runs a python file to completion, responding with its exit code. It is used for cron jobs.
 func RunPython(w http.ResponseWriter, r *http.Request) {
-	// TODO: should modify to wait for the process to finish
-	StartPython(w, r)
+	i, c, _ := startPython(w, r)
+	if c == nil {
+		return
+	}
+	c.Wait()
+	settings.Lock()
+	if settings.Cmd[i.APIKey] == c {
+		delete(settings.Cmd, i.APIKey)
+	}
+	settings.Unlock()
+	sm := c.Status()
+	rest.WriteJSON(w, r, &sm, nil)
 }
 
 func StopPython(w http.ResponseWriter, r *http.Request) {
@@ -250,7 +270,7 @@ func StopPython(w http.ResponseWriter, r *http.Request) {
 	}
 	cmd.Cmd.Process.Signal(os.Interrupt)
 
-	d := assets.Get().Config.GetRunTimeout()
+	d := assets.Get().GetConfig().GetRunTimeout()
 
 	sleepDuration := 50 * time.Millisecond
 	for i := time.Duration(0); i < d; i += sleepDuration {
@@ -264,6 +284,24 @@ func StopPython(w http.ResponseWriter, r *http.Request) {
 	KillPython(w, r)
 }
 
+// PythonStatus returns whether the given python process is still running
+func PythonStatus(w http.ResponseWriter, r *http.Request) {
+	apikey, err := url.PathUnescape(chi.URLParam(r, "apikey"))
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	settings.Lock()
+	cmd, ok := settings.Cmd[apikey]
+	settings.Unlock()
+	if !ok {
+		rest.WriteJSON(w, r, &run.StatusMessage{Status: run.StatusStopped}, nil)
+		return
+	}
+	sm := cmd.Status()
+	rest.WriteJSON(w, r, &sm, nil)
+}
+
 func KillPython(w http.ResponseWriter, r *http.Request) {
 	apikey, err := url.PathUnescape(chi.URLParam(r, "apikey"))
 	if err != nil {
@@ -286,6 +324,8 @@ var Handler = func() *chi.Mux {
 	mux.NotFound(rest.NotFoundHandler)
 	mux.MethodNotAllowed(rest.NotFoundHandler)
 	mux.Post("/runtypes/python", StartPython)
+	mux.Patch("/runtypes/python", RunPython)
+	mux.Get("/runtypes/python/{apikey}", PythonStatus)
 	mux.Delete("/runtypes/python/{apikey}", StopPython)
 	return mux
 }()
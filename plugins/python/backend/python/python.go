@@ -67,6 +67,10 @@ try:
 		"pip"
 	]
 	pkg_resources.require(requirements)
+
+	# Plugins with requirements are run in their own virtualenv
+	import venv
+	import ensurepip
 	print("OK")
 except Exception as e:
 	print(e)
@@ -0,0 +1,135 @@
+package python
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/heedy/heedy/backend/plugins/run"
+)
+
+// venvStateFile is stored in each virtualenv, and records what it was set up with
+const venvStateFile = "heedy_venv.json"
+
+// venvState is used to find out whether a virtualenv needs to be recreated or its requirements reinstalled
+type venvState struct {
+	// The interpreter that the virtualenv was created with
+	Python string `json:"python"`
+	// sha256 hashes of the installed requirements files, by their path relative to the plugin folder
+	Requirements map[string]string `json:"requirements"`
+}
+
+// Virtualenvs are only set up one at a time, so that runners of the same plugin don't install into it at once
+var venvLock sync.Mutex
+
+// VenvDir returns the folder holding the given plugin's virtualenv
+func VenvDir(dataDir, plugin string) string {
+	return path.Join(dataDir, "python", plugin, "venv")
+}
+
+// venvPython returns the path to the python interpreter in the given virtualenv
+func venvPython(dir string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(dir, "Scripts", "python.exe")
+	}
+	return filepath.Join(dir, "bin", "python")
+}
+
+func readVenvState(dir string) *venvState {
+	vs := &venvState{}
+	b, err := ioutil.ReadFile(path.Join(dir, venvStateFile))
+	if err != nil || json.Unmarshal(b, vs) != nil {
+		return nil
+	}
+	if vs.Requirements == nil {
+		vs.Requirements = make(map[string]string)
+	}
+	return vs
+}
+
+// SetupVenv makes sure that the plugin's virtualenv exists and has the given requirements installed,
+// returning the path of the virtualenv's interpreter. The virtualenv is created once, and reused by
+// all of the plugin's runners. Requirements are only reinstalled when the requirements file changes.
+func SetupVenv(i *run.Info, requirementsFile string) (string, error) {
+	venvLock.Lock()
+	defer venvLock.Unlock()
+
+	b, err := ioutil.ReadFile(requirementsFile)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(b)
+	hash := hex.EncodeToString(h[:])
+	reqname, err := filepath.Rel(i.PluginDir, requirementsFile)
+	if err != nil {
+		reqname = requirementsFile
+	}
+
+	dir := VenvDir(i.DataDir, i.Plugin)
+	python := venvPython(dir)
+	vs := readVenvState(dir)
+	if vs == nil || vs.Python != settings.Path {
+		// The virtualenv doesn't exist yet, or was created with a different interpreter
+		l.Infof("Creating virtualenv for %s at %s", i.Plugin, dir)
+		if err = os.RemoveAll(dir); err != nil {
+			return "", err
+		}
+		if err = os.MkdirAll(path.Dir(dir), 0755); err != nil {
+			return "", err
+		}
+		cmd := exec.Command(settings.Path, "-m", "venv", dir)
+		run.AttachLogs(i, cmd)
+		err = cmd.Run()
+		run.FlushLogs(cmd)
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("Could not create virtualenv for %s: %w", i.Plugin, err)
+		}
+		vs = &venvState{
+			Python:       settings.Path,
+			Requirements: make(map[string]string),
+		}
+	} else if vs.Requirements[reqname] == hash {
+		return python, nil
+	}
+
+	l.Debugf("Setting up requirements from %s", requirementsFile)
+	fullargs := append([]string{"-m", "pip", "install", "-r", requirementsFile}, venvPipArgs()...)
+	if settings.DB.Verbose {
+		l.Debugf("%s %s", python, strings.Join(fullargs, " "))
+	}
+	cmd := exec.Command(python, fullargs...)
+	run.AttachLogs(i, cmd)
+	err = cmd.Run()
+	run.FlushLogs(cmd)
+	if err != nil {
+		return "", err
+	}
+
+	vs.Requirements[reqname] = hash
+	b, err = json.Marshal(vs)
+	if err != nil {
+		return "", err
+	}
+	return python, ioutil.WriteFile(path.Join(dir, venvStateFile), b, 0644)
+}
+
+// venvPipArgs returns the configured pip_args, without --user, which pip refuses inside a virtualenv
+func venvPipArgs() []string {
+	args := make([]string, 0, len(settings.PipArgs))
+	for _, a := range settings.PipArgs {
+		if a != "--user" {
+			args = append(args, a)
+		}
+	}
+	return args
+}
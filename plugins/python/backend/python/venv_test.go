@@ -0,0 +1,58 @@
+package python
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heedy/heedy/backend/plugins/run"
+)
+
+func TestVenvPipArgs(t *testing.T) {
+	oldArgs := settings.PipArgs
+	defer func() { settings.PipArgs = oldArgs }()
+	settings.PipArgs = []string{"--user", "--no-cache-dir", "--quiet"}
+	require.Equal(t, []string{"--no-cache-dir", "--quiet"}, venvPipArgs())
+}
+
+func TestSetupVenv(t *testing.T) {
+	oldPath := settings.Path
+	defer func() { settings.Path = oldPath }()
+	settings.Path = "/heedy/nonexistent/python3"
+
+	dir := t.TempDir()
+	i := &run.Info{Plugin: "myplugin", Name: "server", DataDir: dir, PluginDir: filepath.Join(dir, "plugin")}
+	require.NoError(t, os.MkdirAll(i.PluginDir, 0755))
+	reqfile := filepath.Join(i.PluginDir, "requirements.txt")
+	require.NoError(t, ioutil.WriteFile(reqfile, []byte("requests\n"), 0644))
+	h := sha256.Sum256([]byte("requests\n"))
+
+	// A virtualenv that was already set up with the same interpreter and requirements is reused as-is
+	venv := VenvDir(dir, "myplugin")
+	require.NoError(t, os.MkdirAll(venv, 0755))
+	b, err := json.Marshal(&venvState{
+		Python:       settings.Path,
+		Requirements: map[string]string{"requirements.txt": hex.EncodeToString(h[:])},
+	})
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path.Join(venv, venvStateFile), b, 0644))
+	python, err := SetupVenv(i, reqfile)
+	require.NoError(t, err)
+	require.Equal(t, venvPython(venv), python)
+
+	// It is recreated when the interpreter changes, and removed if that fails
+	settings.Path = "/heedy/nonexistent/python3.9"
+	_, err = SetupVenv(i, reqfile)
+	require.Error(t, err)
+	require.NoDirExists(t, venv)
+
+	_, err = SetupVenv(i, filepath.Join(i.PluginDir, "missing.txt"))
+	require.Error(t, err)
+}
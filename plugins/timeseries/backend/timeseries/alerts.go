@@ -0,0 +1,508 @@
+package timeseries
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/events"
+	"github.com/heedy/heedy/backend/plugins/run"
+	"github.com/heedy/heedy/plugins/notifications/backend/notifications"
+	"github.com/sirupsen/logrus"
+)
+
+// sqlAlertsSchema is added in version 3 of the timeseries database
+const sqlAlertsSchema = `
+CREATE TABLE timeseries_alerts (
+	id VARCHAR(36) NOT NULL PRIMARY KEY,
+	tsid VARCHAR(36) NOT NULL,
+
+	name VARCHAR NOT NULL DEFAULT '',
+	-- above/below compare the most recent datapoint to the threshold, rate compares the change per second
+	-- between the two most recent datapoints, and missing fires when no data was written for threshold seconds
+	condition VARCHAR NOT NULL,
+	threshold REAL NOT NULL,
+	-- The type of the notification shown while the alert fires: info, warning or error
+	severity VARCHAR NOT NULL DEFAULT 'warning',
+
+	enabled BOOLEAN NOT NULL DEFAULT true,
+
+	-- The state of the alert when it was last evaluated
+	firing BOOLEAN NOT NULL DEFAULT false,
+	fired_time REAL DEFAULT NULL,
+	value REAL DEFAULT NULL,
+	error VARCHAR DEFAULT NULL,
+
+	CONSTRAINT timeseries_fk
+		FOREIGN KEY(tsid)
+		REFERENCES objects(id)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE,
+	CONSTRAINT valid_condition CHECK (condition IN ('above','below','rate','missing')),
+	CONSTRAINT valid_severity CHECK (severity IN ('info','warning','error'))
+);
+CREATE INDEX timeseries_alerts_tsid ON timeseries_alerts(tsid);
+`
+
+// Alert is a condition on the data of a timeseries. While the condition holds, the owner of the timeseries
+// is shown a notification, which is removed once the condition resolves.
+type Alert struct {
+	ID         string   `json:"id" db:"id"`
+	Timeseries string   `json:"timeseries" db:"tsid"`
+	Name       *string  `json:"name,omitempty" db:"name"`
+	Condition  *string  `json:"condition,omitempty" db:"condition"`
+	Threshold  *float64 `json:"threshold,omitempty" db:"threshold"`
+	Severity   *string  `json:"severity,omitempty" db:"severity"`
+	Enabled    *bool    `json:"enabled,omitempty" db:"enabled"`
+
+	// These are set when the alert is evaluated, and can't be modified
+	Firing    bool     `json:"firing" db:"firing"`
+	FiredTime *float64 `json:"fired_time,omitempty" db:"fired_time"`
+	Value     *float64 `json:"value,omitempty" db:"value"`
+	Error     *string  `json:"error,omitempty" db:"error"`
+}
+
+// notificationKey is the key of the notification shown while the alert fires
+func (a *Alert) notificationKey() string {
+	return "timeseries_alert_" + a.Timeseries + "_" + a.ID
+}
+
+func validateAlert(a *Alert) error {
+	if a.Condition == nil {
+		return errors.New("bad_request: An alert must have a condition")
+	}
+	switch *a.Condition {
+	case "above", "below", "rate", "missing":
+	default:
+		return fmt.Errorf("bad_request: Unrecognized alert condition '%s'", *a.Condition)
+	}
+	if a.Threshold == nil || math.IsNaN(*a.Threshold) || math.IsInf(*a.Threshold, 0) {
+		return errors.New("bad_request: An alert must have a threshold")
+	}
+	if *a.Condition == "missing" && *a.Threshold <= 0 {
+		return errors.New("bad_request: The threshold of a missing data alert is a positive number of seconds")
+	}
+	if a.Severity != nil {
+		switch *a.Severity {
+		case "info", "warning", "error":
+		default:
+			return errors.New("bad_request: An alert's severity must be info, warning or error")
+		}
+	}
+	return nil
+}
+
+// ReadAlerts returns all of the alerts of the given timeseries
+func ReadAlerts(adb *database.AdminDB, tsid string) ([]Alert, error) {
+	alerts := []Alert{}
+	err := adb.Select(&alerts, "SELECT * FROM timeseries_alerts WHERE tsid=? ORDER BY rowid ASC", tsid)
+	return alerts, err
+}
+
+// ReadAlert returns the given alert of the timeseries
+func ReadAlert(adb *database.AdminDB, tsid string, aid string) (*Alert, error) {
+	var a Alert
+	err := adb.Get(&a, "SELECT * FROM timeseries_alerts WHERE id=? AND tsid=?", aid, tsid)
+	if err == sql.ErrNoRows {
+		return nil, database.ErrNotFound
+	}
+	return &a, err
+}
+
+// CreateAlert adds an alert to the timeseries, and evaluates it on the timeseries' current data
+func CreateAlert(adb *database.AdminDB, a *Alert) (string, error) {
+	if err := validateAlert(a); err != nil {
+		return "", err
+	}
+	if a.Name == nil {
+		name := ""
+		a.Name = &name
+	}
+	if a.Severity == nil {
+		severity := "warning"
+		a.Severity = &severity
+	}
+	if a.Enabled == nil {
+		enabled := true
+		a.Enabled = &enabled
+	}
+	a.ID = uuid.New().String()
+	res, err := adb.Exec("INSERT INTO timeseries_alerts(id,tsid,name,condition,threshold,severity,enabled) VALUES (?,?,?,?,?,?,?)",
+		a.ID, a.Timeseries, a.Name, a.Condition, a.Threshold, a.Severity, a.Enabled)
+	err = database.GetExecError(res, err)
+	if err == nil && Alerts != nil {
+		Alerts.refresh(a.Timeseries)
+		Alerts.queue(a.Timeseries)
+	}
+	return a.ID, err
+}
+
+// UpdateAlert modifies the values of the alert that are set. The alert's notification is removed,
+// and the alert is evaluated again with its new values.
+func UpdateAlert(adb *database.AdminDB, a *Alert) error {
+	cur, err := ReadAlert(adb, a.Timeseries, a.ID)
+	if err != nil {
+		return err
+	}
+	if a.Name != nil {
+		cur.Name = a.Name
+	}
+	if a.Condition != nil {
+		cur.Condition = a.Condition
+	}
+	if a.Threshold != nil {
+		cur.Threshold = a.Threshold
+	}
+	if a.Severity != nil {
+		cur.Severity = a.Severity
+	}
+	if a.Enabled != nil {
+		cur.Enabled = a.Enabled
+	}
+	if err = validateAlert(cur); err != nil {
+		return err
+	}
+	if err = clearAlert(adb, cur); err != nil {
+		return err
+	}
+	res, err := adb.Exec("UPDATE timeseries_alerts SET name=?,condition=?,threshold=?,severity=?,enabled=?,firing=false,fired_time=NULL,value=NULL,error=NULL WHERE id=? AND tsid=?",
+		cur.Name, cur.Condition, cur.Threshold, cur.Severity, cur.Enabled, cur.ID, cur.Timeseries)
+	err = database.GetExecError(res, err)
+	if err == nil && Alerts != nil {
+		Alerts.refresh(cur.Timeseries)
+		Alerts.queue(cur.Timeseries)
+	}
+	return err
+}
+
+// DeleteAlert removes the alert from the timeseries, along with its notification
+func DeleteAlert(adb *database.AdminDB, tsid string, aid string) error {
+	a, err := ReadAlert(adb, tsid, aid)
+	if err != nil {
+		return err
+	}
+	if err = clearAlert(adb, a); err != nil {
+		return err
+	}
+	res, err := adb.Exec("DELETE FROM timeseries_alerts WHERE id=? AND tsid=?", aid, tsid)
+	err = database.GetExecError(res, err)
+	if err == nil && Alerts != nil {
+		Alerts.refresh(tsid)
+	}
+	return err
+}
+
+// clearAlert removes the notification of a firing alert
+func clearAlert(adb *database.AdminDB, a *Alert) error {
+	if !a.Firing {
+		return nil
+	}
+	var owner string
+	if err := adb.Get(&owner, "SELECT owner FROM objects WHERE id=?", a.Timeseries); err != nil {
+		return err
+	}
+	key := a.notificationKey()
+	return notifications.DeleteNotification(adb, &notifications.NotificationsQuery{
+		User: &owner,
+		Key:  &key,
+	})
+}
+
+// AlertProcessor evaluates the alerts of timeseries when data is written to them, and periodically
+// checks for timeseries that stopped receiving data.
+type AlertProcessor struct {
+	DB *database.AdminDB
+
+	sync.Mutex
+	// The timeseries that have enabled alerts
+	sources map[string]bool
+	// The timeseries whose alerts need to be evaluated
+	pending map[string]bool
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+// Alerts is the global AlertProcessor, initialized when the plugin starts
+var Alerts *AlertProcessor
+
+// NewAlertProcessor prepares to evaluate the alerts of all timeseries
+func NewAlertProcessor(db *database.AdminDB) (*AlertProcessor, error) {
+	var sources []string
+	if err := db.Select(&sources, "SELECT DISTINCT tsid FROM timeseries_alerts WHERE enabled"); err != nil {
+		return nil, err
+	}
+	ap := &AlertProcessor{
+		DB:      db,
+		sources: make(map[string]bool),
+		pending: make(map[string]bool),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	for _, s := range sources {
+		ap.sources[s] = true
+	}
+	return ap, nil
+}
+
+// refresh checks whether the given timeseries still has enabled alerts
+func (ap *AlertProcessor) refresh(tsid string) {
+	var count int
+	if err := ap.DB.Get(&count, "SELECT COUNT(*) FROM timeseries_alerts WHERE tsid=? AND enabled", tsid); err != nil {
+		logrus.WithFields(logrus.Fields{"plugin": PluginName, "object": tsid}).Errorf("Failed to read timeseries alerts: %v", err)
+		return
+	}
+	ap.Lock()
+	if count > 0 {
+		ap.sources[tsid] = true
+	} else {
+		delete(ap.sources, tsid)
+	}
+	ap.Unlock()
+}
+
+// queue marks the alerts of the timeseries to be evaluated in the background
+func (ap *AlertProcessor) queue(tsid string) {
+	ap.Lock()
+	ap.pending[tsid] = true
+	ap.Unlock()
+	select {
+	case ap.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Fire queues the alerts of timeseries whose data changed
+func (ap *AlertProcessor) Fire(e *events.Event) {
+	switch e.Event {
+	case "timeseries_data_write", "timeseries_data_delete":
+		ap.Lock()
+		ok := ap.sources[e.Object]
+		ap.Unlock()
+		if ok {
+			ap.queue(e.Object)
+		}
+	case "object_delete":
+		ap.Lock()
+		ok := ap.sources[e.Object]
+		delete(ap.sources, e.Object)
+		delete(ap.pending, e.Object)
+		ap.Unlock()
+		if !ok || e.User == "" {
+			return
+		}
+		// The alerts were removed with the object, but their notifications belong to its owner
+		ns, err := notifications.ReadNotifications(ap.DB, &notifications.NotificationsQuery{User: &e.User})
+		if err != nil {
+			logrus.WithFields(logrus.Fields{"plugin": PluginName, "object": e.Object}).Errorf("Failed to read alert notifications: %v", err)
+			return
+		}
+		prefix := "timeseries_alert_" + e.Object + "_"
+		for i := range ns {
+			if strings.HasPrefix(ns[i].Key, prefix) {
+				notifications.DeleteNotification(ap.DB, &notifications.NotificationsQuery{
+					User: &e.User,
+					Key:  &ns[i].Key,
+				})
+			}
+		}
+	}
+}
+
+// Run evaluates the queued alerts until the processor is stopped
+func (ap *AlertProcessor) Run() {
+	for {
+		select {
+		case <-ap.done:
+			return
+		case <-ap.wake:
+		}
+		for {
+			ap.Lock()
+			var tsid string
+			for tsid = range ap.pending {
+				delete(ap.pending, tsid)
+				break
+			}
+			ap.Unlock()
+			if tsid == "" {
+				break
+			}
+			ap.process(tsid, "")
+		}
+	}
+}
+
+// Close stops the processor
+func (ap *AlertProcessor) Close() {
+	close(ap.done)
+}
+
+// CheckMissing evaluates all enabled missing data alerts, since they fire when data is not written
+func (ap *AlertProcessor) CheckMissing() error {
+	var sources []string
+	if err := ap.DB.Select(&sources, "SELECT DISTINCT tsid FROM timeseries_alerts WHERE enabled AND condition='missing'"); err != nil {
+		return err
+	}
+	for _, tsid := range sources {
+		ap.process(tsid, "missing")
+	}
+	return nil
+}
+
+// process evaluates the enabled alerts of the timeseries. If condition is set, only alerts with the given condition are evaluated.
+func (ap *AlertProcessor) process(tsid string, condition string) {
+	log := logrus.WithFields(logrus.Fields{"plugin": PluginName, "object": tsid})
+	var alerts []Alert
+	var err error
+	if condition != "" {
+		err = ap.DB.Select(&alerts, "SELECT * FROM timeseries_alerts WHERE tsid=? AND enabled AND condition=? ORDER BY rowid ASC", tsid, condition)
+	} else {
+		err = ap.DB.Select(&alerts, "SELECT * FROM timeseries_alerts WHERE tsid=? AND enabled ORDER BY rowid ASC", tsid)
+	}
+	if err != nil {
+		log.Errorf("Failed to read timeseries alerts: %v", err)
+		return
+	}
+	if len(alerts) == 0 {
+		return
+	}
+	obj, err := ap.DB.ReadObject(tsid, &database.ReadObjectOptions{})
+	if err != nil {
+		log.Errorf("Failed to read timeseries: %v", err)
+		return
+	}
+
+	// Only the two most recent datapoints are needed to evaluate the alerts
+	i1 := int64(-2)
+	di, err := TSDB.Query(&Query{Timeseries: tsid, I1: &i1})
+	var data DatapointArray
+	if err == nil {
+		data, err = NewArrayFromIterator(di)
+		di.Close()
+	}
+	if err != nil {
+		log.Errorf("Failed to read timeseries data: %v", err)
+		return
+	}
+
+	now := float64(time.Now().UnixNano()) * 1e-9
+	for i := range alerts {
+		if err = ap.evaluate(obj, &alerts[i], data, now); err != nil {
+			log.WithField("alert", alerts[i].ID).Errorf("Failed to update alert: %v", err)
+		}
+	}
+}
+
+// Evaluate returns whether the alert's condition holds for the given most recent datapoints of its timeseries,
+// along with the value that was compared to the threshold.
+func (a *Alert) Evaluate(data DatapointArray, now float64) (bool, *float64, error) {
+	if len(data) == 0 {
+		return false, nil, nil
+	}
+	last := data[len(data)-1]
+	if *a.Condition == "missing" {
+		v := now - last.EndTime()
+		return v > *a.Threshold, &v, nil
+	}
+	d, ok := last.Data.(float64)
+	if !ok {
+		return false, nil, errors.New("The alert's condition requires numeric data")
+	}
+	switch *a.Condition {
+	case "above":
+		return d > *a.Threshold, &d, nil
+	case "below":
+		return d < *a.Threshold, &d, nil
+	}
+	// The rate of change needs two datapoints
+	if len(data) < 2 {
+		return false, nil, nil
+	}
+	prev := data[len(data)-2]
+	pd, ok := prev.Data.(float64)
+	if !ok {
+		return false, nil, errors.New("The alert's condition requires numeric data")
+	}
+	if last.Timestamp == prev.Timestamp {
+		return false, nil, nil
+	}
+	v := (d - pd) / (last.Timestamp - prev.Timestamp)
+	return math.Abs(v) > *a.Threshold, &v, nil
+}
+
+// evaluate updates the alert's state, and writes or removes its notification
+func (ap *AlertProcessor) evaluate(obj *database.Object, a *Alert, data DatapointArray, now float64) error {
+	firing, value, aerr := a.Evaluate(data, now)
+	if aerr != nil {
+		if a.Error != nil && *a.Error == aerr.Error() {
+			return nil
+		}
+		_, err := ap.DB.Exec("UPDATE timeseries_alerts SET error=? WHERE id=?", aerr.Error(), a.ID)
+		return err
+	}
+	if !firing {
+		if !a.Firing && a.Error == nil {
+			return nil
+		}
+		if err := clearAlert(ap.DB, a); err != nil {
+			return err
+		}
+		_, err := ap.DB.Exec("UPDATE timeseries_alerts SET firing=false,fired_time=NULL,value=?,error=NULL WHERE id=?", value, a.ID)
+		return err
+	}
+
+	firedTime := now
+	if a.Firing && a.FiredTime != nil {
+		firedTime = *a.FiredTime
+	}
+	title := *a.Name
+	if title == "" {
+		title = *obj.Name + " alert"
+	}
+	var description string
+	switch *a.Condition {
+	case "above":
+		description = fmt.Sprintf("The value of %s is %v, which is above %v", *obj.Name, *value, *a.Threshold)
+	case "below":
+		description = fmt.Sprintf("The value of %s is %v, which is below %v", *obj.Name, *value, *a.Threshold)
+	case "rate":
+		description = fmt.Sprintf("%s is changing by %.4g per second, which is faster than %v", *obj.Name, *value, *a.Threshold)
+	case "missing":
+		description = fmt.Sprintf("No data was written to %s for %s", *obj.Name, time.Duration(*value*float64(time.Second)).Round(time.Second))
+	}
+	dismissible := true
+	actions := notifications.ActionArray{{
+		Title: "View",
+		Icon:  "timeline",
+		Href:  "#/objects/" + obj.ID,
+	}}
+	err := notifications.WriteNotification(ap.DB, &notifications.Notification{
+		Key:         a.notificationKey(),
+		User:        obj.Owner,
+		Type:        a.Severity,
+		Title:       &title,
+		Description: &description,
+		Actions:     &actions,
+		Dismissible: &dismissible,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = ap.DB.Exec("UPDATE timeseries_alerts SET firing=true,fired_time=?,value=?,error=NULL WHERE id=?", firedTime, value, a.ID)
+	return err
+}
+
+// StartAlerts is run by heedy's scheduler to check for timeseries that stopped receiving data
+func StartAlerts(db *database.AdminDB, i *run.Info, h run.BuiltinHelper) error {
+	if Alerts == nil {
+		return errors.New("Timeseries alerts are not running")
+	}
+	return Alerts.CheckMissing()
+}
@@ -0,0 +1,105 @@
+package timeseries
+
+import (
+	"testing"
+
+	"github.com/heedy/heedy/backend/events"
+	"github.com/heedy/heedy/plugins/notifications/backend/notifications"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlerts(t *testing.T) {
+	adb, oid1, _, cleanup := newDBWithObjects(t)
+	defer cleanup()
+	sd := TimeseriesDB{DB: adb,
+		BatchSize:             3,
+		MaxBatchSize:          5,
+		BatchCompressionLevel: 3}
+	TSDB = sd
+
+	cond := "unknown"
+	threshold := 4.0
+	_, err := CreateAlert(adb, &Alert{Timeseries: oid1, Condition: &cond, Threshold: &threshold})
+	require.Error(t, err)
+	cond = "above"
+	aid, err := CreateAlert(adb, &Alert{Timeseries: oid1, Condition: &cond, Threshold: &threshold})
+	require.NoError(t, err)
+
+	ap, err := NewAlertProcessor(adb)
+	require.NoError(t, err)
+	user := "test"
+	alertNotifications := func() []notifications.Notification {
+		ns, err := notifications.ReadNotifications(adb, &notifications.NotificationsQuery{User: &user})
+		require.NoError(t, err)
+		return ns
+	}
+	write := func(data DatapointArray) {
+		ii := NewInfoIterator(NewDatapointArrayIterator(data))
+		require.NoError(t, sd.Insert(oid1, ii, &InsertQuery{}))
+		ap.Fire(&events.Event{
+			Event:  "timeseries_data_write",
+			Object: oid1,
+			Data:   &TimeseriesWriteEvent{T1: ii.Tstart, T2: ii.Tend, Count: ii.Count},
+		})
+		ap.Lock()
+		require.Equal(t, map[string]bool{oid1: true}, ap.pending)
+		ap.pending = make(map[string]bool)
+		ap.Unlock()
+		ap.process(oid1, "")
+	}
+
+	write(DatapointArray{&Datapoint{Timestamp: 1, Data: 1.}})
+	require.Len(t, alertNotifications(), 0)
+
+	// The alert fires with a notification for the owner
+	write(DatapointArray{&Datapoint{Timestamp: 2, Data: 5.}})
+	ns := alertNotifications()
+	require.Len(t, ns, 1)
+	require.Equal(t, "timeseries_alert_"+oid1+"_"+aid, ns[0].Key)
+	require.Equal(t, "warning", *ns[0].Type)
+	a, err := ReadAlert(adb, oid1, aid)
+	require.NoError(t, err)
+	require.True(t, a.Firing)
+	require.EqualValues(t, 5, *a.Value)
+
+	// and the notification is removed when the condition resolves
+	write(DatapointArray{&Datapoint{Timestamp: 3, Data: 3.}})
+	require.Len(t, alertNotifications(), 0)
+	a, err = ReadAlert(adb, oid1, aid)
+	require.NoError(t, err)
+	require.False(t, a.Firing)
+
+	// A rate alert fires on fast changes in either direction
+	cond = "rate"
+	require.NoError(t, UpdateAlert(adb, &Alert{ID: aid, Timeseries: oid1, Condition: &cond}))
+	write(DatapointArray{&Datapoint{Timestamp: 4, Data: -3.}})
+	require.Len(t, alertNotifications(), 1)
+
+	// Modifying or deleting the alert removes its notification
+	threshold = 10
+	require.NoError(t, UpdateAlert(adb, &Alert{ID: aid, Timeseries: oid1, Threshold: &threshold}))
+	require.Len(t, alertNotifications(), 0)
+	threshold = 1
+	require.NoError(t, UpdateAlert(adb, &Alert{ID: aid, Timeseries: oid1, Threshold: &threshold}))
+	ap.process(oid1, "")
+	require.Len(t, alertNotifications(), 1)
+	require.NoError(t, DeleteAlert(adb, oid1, aid))
+	require.Len(t, alertNotifications(), 0)
+
+	// Missing data alerts are checked periodically
+	cond = "missing"
+	threshold = 60
+	aid, err = CreateAlert(adb, &Alert{Timeseries: oid1, Condition: &cond, Threshold: &threshold})
+	require.NoError(t, err)
+	require.NoError(t, ap.CheckMissing())
+	require.Len(t, alertNotifications(), 1)
+
+	// Alerts on non-numeric data record an error
+	cond = "below"
+	require.NoError(t, UpdateAlert(adb, &Alert{ID: aid, Timeseries: oid1, Condition: &cond}))
+	write(DatapointArray{&Datapoint{Timestamp: 5, Data: "hi"}})
+	a, err = ReadAlert(adb, oid1, aid)
+	require.NoError(t, err)
+	require.NotNil(t, a.Error)
+	require.False(t, a.Firing)
+}
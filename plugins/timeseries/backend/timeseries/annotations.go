@@ -0,0 +1,235 @@
+package timeseries
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/heedy/heedy/backend/database"
+)
+
+// sqlAnnotationsSchema is added in version 7 of the timeseries database
+const sqlAnnotationsSchema = `
+CREATE TABLE timeseries_annotations (
+	id VARCHAR(36) NOT NULL PRIMARY KEY,
+	tsid VARCHAR(36) NOT NULL,
+
+	-- The annotated time range starts at timestamp and lasts duration seconds, where 0 marks a single moment
+	timestamp REAL NOT NULL,
+	duration REAL NOT NULL DEFAULT 0,
+	text VARCHAR NOT NULL DEFAULT '',
+	tags VARCHAR NOT NULL DEFAULT '[]',
+
+	-- The user or app that created the annotation
+	author VARCHAR NOT NULL,
+
+	CONSTRAINT timeseries_fk
+		FOREIGN KEY(tsid)
+		REFERENCES objects(id)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE,
+	CONSTRAINT valid_duration CHECK (duration >= 0),
+	CONSTRAINT valid_tags CHECK (json_valid(tags) AND json_type(tags)='array')
+);
+CREATE INDEX timeseries_annotations_range ON timeseries_annotations(tsid,timestamp);
+`
+
+// The events fired on a timeseries when its annotations change. Their data is the annotation.
+const (
+	AnnotationCreateEvent = "timeseries_annotation_create"
+	AnnotationUpdateEvent = "timeseries_annotation_update"
+	AnnotationDeleteEvent = "timeseries_annotation_delete"
+)
+
+var annotationEvents = []string{AnnotationCreateEvent, AnnotationUpdateEvent, AnnotationDeleteEvent}
+
+// Annotation marks a time range of a timeseries, such as a period of travel or illness
+type Annotation struct {
+	ID         string                `json:"id" db:"id"`
+	Timeseries string                `json:"timeseries" db:"tsid"`
+	Timestamp  *float64              `json:"t,omitempty" db:"timestamp"`
+	Duration   *float64              `json:"dt,omitempty" db:"duration"`
+	Text       *string               `json:"text,omitempty" db:"text"`
+	Tags       *database.StringArray `json:"tags,omitempty" db:"tags"`
+
+	// The author is set when the annotation is created, and can't be modified
+	Author string `json:"author" db:"author"`
+}
+
+func validateAnnotation(a *Annotation) error {
+	if a.Timestamp == nil || math.IsNaN(*a.Timestamp) || math.IsInf(*a.Timestamp, 0) {
+		return errors.New("bad_request: An annotation must have a timestamp")
+	}
+	if a.Duration != nil && (*a.Duration < 0 || math.IsNaN(*a.Duration) || math.IsInf(*a.Duration, 0)) {
+		return errors.New("bad_request: An annotation's duration must be a non-negative number of seconds")
+	}
+	return nil
+}
+
+// ReadAnnotations returns the annotations of the given timeseries that overlap the range from t1 to t2, ordered by time
+func ReadAnnotations(adb *database.AdminDB, tsids []string, t1, t2 float64) ([]Annotation, error) {
+	annotations := []Annotation{}
+	if len(tsids) == 0 {
+		return annotations, nil
+	}
+	args := make([]interface{}, 0, len(tsids)+2)
+	for _, id := range tsids {
+		args = append(args, id)
+	}
+	args = append(args, t2, t1)
+	err := adb.Select(&annotations, "SELECT * FROM timeseries_annotations WHERE tsid IN ("+database.QQ(len(tsids))+") AND timestamp < ? AND timestamp+duration >= ? ORDER BY timestamp ASC, rowid ASC", args...)
+	return annotations, err
+}
+
+// ReadAnnotation returns the given annotation of the timeseries
+func ReadAnnotation(adb *database.AdminDB, tsid string, aid string) (*Annotation, error) {
+	var a Annotation
+	err := adb.Get(&a, "SELECT * FROM timeseries_annotations WHERE id=? AND tsid=?", aid, tsid)
+	if err == sql.ErrNoRows {
+		return nil, database.ErrNotFound
+	}
+	return &a, err
+}
+
+// CreateAnnotation adds an annotation to the timeseries
+func CreateAnnotation(adb *database.AdminDB, a *Annotation) (string, error) {
+	if err := validateAnnotation(a); err != nil {
+		return "", err
+	}
+	if a.Duration == nil {
+		duration := 0.0
+		a.Duration = &duration
+	}
+	if a.Text == nil {
+		text := ""
+		a.Text = &text
+	}
+	if a.Tags == nil {
+		a.Tags = &database.StringArray{Strings: []string{}}
+	}
+	a.ID = uuid.New().String()
+	res, err := adb.Exec("INSERT INTO timeseries_annotations(id,tsid,timestamp,duration,text,tags,author) VALUES (?,?,?,?,?,?,?)",
+		a.ID, a.Timeseries, a.Timestamp, a.Duration, a.Text, a.Tags, a.Author)
+	return a.ID, database.GetExecError(res, err)
+}
+
+// UpdateAnnotation modifies the values of the annotation that are set
+func UpdateAnnotation(adb *database.AdminDB, a *Annotation) error {
+	cur, err := ReadAnnotation(adb, a.Timeseries, a.ID)
+	if err != nil {
+		return err
+	}
+	if a.Timestamp != nil {
+		cur.Timestamp = a.Timestamp
+	}
+	if a.Duration != nil {
+		cur.Duration = a.Duration
+	}
+	if a.Text != nil {
+		cur.Text = a.Text
+	}
+	if a.Tags != nil {
+		cur.Tags = a.Tags
+	}
+	if err = validateAnnotation(cur); err != nil {
+		return err
+	}
+	res, err := adb.Exec("UPDATE timeseries_annotations SET timestamp=?,duration=?,text=?,tags=? WHERE id=? AND tsid=?",
+		cur.Timestamp, cur.Duration, cur.Text, cur.Tags, cur.ID, cur.Timeseries)
+	return database.GetExecError(res, err)
+}
+
+// DeleteAnnotation removes the annotation from the timeseries
+func DeleteAnnotation(adb *database.AdminDB, tsid string, aid string) error {
+	res, err := adb.Exec("DELETE FROM timeseries_annotations WHERE id=? AND tsid=?", aid, tsid)
+	return database.GetExecError(res, err)
+}
+
+// annotationRange returns the time range of the query that annotations are read from. A query for the datapoint at t
+// includes the annotations that overlap t. Since the times of the datapoints at indices are not known before the query
+// is run, queries by index can't include annotations.
+func (q *Query) annotationRange() (t1, t2 float64, err error) {
+	if q.I != nil || q.I1 != nil || q.I2 != nil {
+		return 0, 0, errors.New("bad_query: Annotations can't be included in queries by index")
+	}
+	if q.T != nil {
+		if t1, err = q.ParseTime(q.T); err != nil {
+			return
+		}
+		return t1, math.Nextafter(t1, math.Inf(1)), nil
+	}
+	t1, t2 = math.Inf(-1), math.Inf(1)
+	if q.T1 != nil {
+		if t1, err = q.ParseTime(q.T1); err != nil {
+			return
+		}
+	}
+	if q.T2 != nil {
+		t2, err = q.ParseTime(q.T2)
+	}
+	return
+}
+
+// queryAnnotations returns the annotations of the given timeseries in the time range of the query
+func queryAnnotations(adb *database.AdminDB, q *Query, tsids []string) ([]Annotation, error) {
+	t1, t2, err := q.annotationRange()
+	if err != nil {
+		return nil, err
+	}
+	return ReadAnnotations(adb, tsids, t1, t2)
+}
+
+// annotations returns the annotations of all timeseries in the dataset. The annotations of each timeseries are
+// read from the time range of the query that includes it, within the dataset's time range.
+func (d *Dataset) annotations(db database.DB) ([]Annotation, error) {
+	t1, t2, err := d.Query.annotationRange()
+	if err != nil {
+		return nil, err
+	}
+	queries := append([]*Query{&d.Query}, d.Merge...)
+	for _, e := range d.Dataset {
+		queries = append(append(queries, &e.Query), e.Merge...)
+	}
+
+	readable := make(map[string]bool)
+	found := make(map[string]bool)
+	annotations := []Annotation{}
+	for _, q := range queries {
+		if q.Timeseries == "" {
+			continue
+		}
+		if !readable[q.Timeseries] {
+			obj, err := db.ReadObject(q.Timeseries, &database.ReadObjectOptions{
+				Icon: false,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if !obj.Access.HasScope("read") {
+				return nil, errors.New("access_denied: The given object can't be read")
+			}
+			readable[q.Timeseries] = true
+		}
+		qt1, qt2, err := q.annotationRange()
+		if err != nil {
+			return nil, err
+		}
+		a, err := ReadAnnotations(db.AdminDB(), []string{q.Timeseries}, math.Max(t1, qt1), math.Min(t2, qt2))
+		if err != nil {
+			return nil, err
+		}
+		// A timeseries can be in multiple queries of the dataset, so its annotations are only added once
+		for _, ai := range a {
+			if !found[ai.ID] {
+				found[ai.ID] = true
+				annotations = append(annotations, ai)
+			}
+		}
+	}
+	sort.SliceStable(annotations, func(i, j int) bool {
+		return *annotations[i].Timestamp < *annotations[j].Timestamp
+	})
+	return annotations, nil
+}
@@ -0,0 +1,129 @@
+package timeseries
+
+import (
+	"math"
+	"testing"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotations(t *testing.T) {
+	adb, oid1, oid2, cleanup := newDBWithObjects(t)
+	defer cleanup()
+
+	ts := func(v float64) *float64 { return &v }
+	text := func(v string) *string { return &v }
+	tags := func(v string) *database.StringArray {
+		s := &database.StringArray{}
+		s.Load(v)
+		return s
+	}
+
+	_, err := CreateAnnotation(adb, &Annotation{Timeseries: oid1, Text: text("no time")})
+	require.Error(t, err)
+	_, err = CreateAnnotation(adb, &Annotation{Timeseries: oid1, Timestamp: ts(1), Duration: ts(-1)})
+	require.Error(t, err)
+
+	sick, err := CreateAnnotation(adb, &Annotation{Timeseries: oid1, Timestamp: ts(10), Duration: ts(5), Text: text("sick"), Tags: tags("health"), Author: "test"})
+	require.NoError(t, err)
+	_, err = CreateAnnotation(adb, &Annotation{Timeseries: oid1, Timestamp: ts(20), Text: text("new medication"), Author: "test"})
+	require.NoError(t, err)
+	_, err = CreateAnnotation(adb, &Annotation{Timeseries: oid2, Timestamp: ts(12), Duration: ts(30), Text: text("travel"), Author: "test/app"})
+	require.NoError(t, err)
+
+	a, err := ReadAnnotation(adb, oid1, sick)
+	require.NoError(t, err)
+	require.Equal(t, "sick", *a.Text)
+	require.Equal(t, []string{"health"}, a.Tags.Strings)
+	require.Equal(t, "test", a.Author)
+	_, err = ReadAnnotation(adb, oid2, sick)
+	require.Error(t, err)
+
+	texts := func(t1, t2 float64, tsids ...string) []string {
+		annotations, err := ReadAnnotations(adb, tsids, t1, t2)
+		require.NoError(t, err)
+		res := []string{}
+		for _, a := range annotations {
+			res = append(res, *a.Text)
+		}
+		return res
+	}
+	inf := math.Inf(1)
+	require.Equal(t, []string{"sick", "new medication"}, texts(-inf, inf, oid1))
+	require.Equal(t, []string{"sick", "travel", "new medication"}, texts(-inf, inf, oid1, oid2))
+	// Annotations that overlap the range are included
+	require.Equal(t, []string{"sick", "travel"}, texts(14, 20, oid1, oid2))
+	require.Equal(t, []string{"travel", "new medication"}, texts(20, 21, oid1, oid2))
+	require.Equal(t, []string{}, texts(0, 10, oid1))
+	require.Equal(t, []string{}, texts(-inf, inf))
+
+	// Unset values are kept when updating
+	require.NoError(t, UpdateAnnotation(adb, &Annotation{ID: sick, Timeseries: oid1, Duration: ts(2)}))
+	a, err = ReadAnnotation(adb, oid1, sick)
+	require.NoError(t, err)
+	require.Equal(t, 10., *a.Timestamp)
+	require.Equal(t, 2., *a.Duration)
+	require.Equal(t, "sick", *a.Text)
+	require.Error(t, UpdateAnnotation(adb, &Annotation{ID: sick, Timeseries: oid1, Duration: ts(math.Inf(1))}))
+	require.Equal(t, []string{"travel"}, texts(14, 20, oid1, oid2))
+
+	q := &Query{T1: 14., T2: 20.}
+	annotations, err := queryAnnotations(adb, q, []string{oid1, oid2})
+	require.NoError(t, err)
+	require.Len(t, annotations, 1)
+	annotations, err = queryAnnotations(adb, &Query{}, []string{oid1})
+	require.NoError(t, err)
+	require.Len(t, annotations, 2)
+	// A query for a single datapoint includes the annotations that overlap it
+	annotations, err = queryAnnotations(adb, &Query{T: 12.}, []string{oid1, oid2})
+	require.NoError(t, err)
+	require.Len(t, annotations, 2)
+	annotations, err = queryAnnotations(adb, &Query{T: 20.}, []string{oid1})
+	require.NoError(t, err)
+	require.Len(t, annotations, 1)
+	require.Equal(t, "new medication", *annotations[0].Text)
+	annotations, err = queryAnnotations(adb, &Query{T: 13.}, []string{oid1})
+	require.NoError(t, err)
+	require.Len(t, annotations, 0)
+	// The times of indices are not known, so queries by index can't include annotations
+	i1 := int64(0)
+	_, err = queryAnnotations(adb, &Query{I1: &i1}, []string{oid1})
+	require.Error(t, err)
+
+	// Datasets include the annotations of all of their timeseries that can be read
+	d := &Dataset{
+		Query: Query{Timeseries: oid1, T1: 14.},
+		Dataset: map[string]*DatasetElement{
+			"y": &DatasetElement{Query: Query{Timeseries: oid2}},
+		},
+	}
+	annotations, err = d.annotations(database.NewUserDB(adb, "test"))
+	require.NoError(t, err)
+	require.Len(t, annotations, 2)
+	_, err = d.annotations(database.NewPublicDB(adb))
+	require.Error(t, err)
+
+	// The annotations of each element are restricted to the element's own time range
+	d = &Dataset{
+		Query: Query{T1: 0., T2: 100.},
+		Dt:    10.,
+		Dataset: map[string]*DatasetElement{
+			"x": &DatasetElement{Query: Query{Timeseries: oid1, T1: 15.}},
+			"y": &DatasetElement{Query: Query{Timeseries: oid2, T2: 11.}},
+		},
+	}
+	require.NoError(t, d.Validate())
+	annotations, err = d.annotations(database.NewUserDB(adb, "test"))
+	require.NoError(t, err)
+	require.Len(t, annotations, 1)
+	require.Equal(t, "new medication", *annotations[0].Text)
+
+	require.NoError(t, DeleteAnnotation(adb, oid1, sick))
+	require.Error(t, DeleteAnnotation(adb, oid1, sick))
+	require.Equal(t, []string{"new medication"}, texts(-inf, inf, oid1))
+
+	// Annotations are removed with their timeseries
+	require.NoError(t, adb.DelObject(oid2))
+	require.Equal(t, []string{}, texts(-inf, inf, oid2))
+}
@@ -0,0 +1,379 @@
+package timeseries
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/heedy/heedy/backend/database"
+)
+
+// BatchCodec is the format that the datapoints of a batch are encoded in
+type BatchCodec byte
+
+const (
+	// MsgpackCodec encodes batches as a msgpack array of datapoints, compressed with zstd unless compression is off
+	MsgpackCodec BatchCodec = 0
+	// ColumnarCodec encodes the timestamps of numeric batches with delta-of-delta encoding, and their durations
+	// and values with Gorilla XOR encoding. It is only used for batches where all data are numbers without actors.
+	ColumnarCodec BatchCodec = 1
+)
+
+// Batches written with a codec start with a header of 3 bytes: batchMarker, the codec, and flags.
+// Batches written before codecs existed are either a zstd frame or a msgpack array, and neither can start
+// with 0xc1, which is never used in msgpack.
+const batchMarker = 0xc1
+
+// batchZstd is the header flag for batches whose encoded data is compressed with zstd
+const batchZstd = 1
+
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// batchCodec returns the codec used for new batches of the timeseries. Timeseries with a numeric schema
+// are stored in columns.
+func (ts *TimeseriesDB) batchCodec(tx database.TxWrapper, tsid string) (BatchCodec, error) {
+	var stype *string
+	err := tx.Get(&stype, "SELECT json_extract(meta,'$.schema.type') FROM objects WHERE id=?", tsid)
+	if err != nil {
+		return MsgpackCodec, err
+	}
+	if stype != nil && (*stype == "number" || *stype == "integer") {
+		return ColumnarCodec, nil
+	}
+	return MsgpackCodec, nil
+}
+
+// batchEncoding returns the codec of a newly encoded batch, and the compression level that is recorded for it.
+// Msgpack batches have the configured zstd level, or -1 if they are not compressed, and columnar batches have
+// no level, since they are not compressed with zstd.
+func (ts *TimeseriesDB) batchEncoding(b []byte) (BatchCodec, *int) {
+	codec := BatchCodec(b[1])
+	if codec != MsgpackCodec {
+		return codec, nil
+	}
+	level := -1
+	if b[2]&batchZstd != 0 {
+		level = ts.BatchCompressionLevel
+	}
+	return codec, &level
+}
+
+// isNumeric returns whether all datapoints of the array can be encoded by the ColumnarCodec
+func (dpa DatapointArray) isNumeric() bool {
+	for _, dp := range dpa {
+		if _, ok := dp.Data.(float64); !ok || dp.Actor != "" {
+			return false
+		}
+	}
+	return len(dpa) > 0
+}
+
+// ToBytes encodes the batch with the MsgpackCodec
+func (dpa DatapointArray) ToBytes() ([]byte, error) {
+	return dpa.Encode(MsgpackCodec)
+}
+
+// Encode returns the bytes stored for the batch. The ColumnarCodec falls back to the MsgpackCodec for batches
+// that have non-numeric data.
+func (dpa DatapointArray) Encode(codec BatchCodec) ([]byte, error) {
+	if codec == ColumnarCodec && dpa.isNumeric() {
+		return dpa.encodeColumns(), nil
+	}
+	b, err := dpa.MarshalMsg([]byte{batchMarker, byte(MsgpackCodec), 0})
+	if err != nil || zencoder == nil {
+		return b, err
+	}
+	res := make([]byte, 0, 3+len(b)/2)
+	res = append(res, batchMarker, byte(MsgpackCodec), batchZstd)
+	return zencoder.EncodeAll(b[3:], res), nil
+}
+
+// DatapointArrayFromBytes decodes a batch written with any codec, including batches written before codecs were added
+func DatapointArrayFromBytes(b []byte) (dpa DatapointArray, err error) {
+	if len(b) == 0 || b[0] != batchMarker {
+		// The batch was written before codecs were added
+		if bytes.HasPrefix(b, zstdMagic) {
+			if b, err = zdecoder.DecodeAll(b, make([]byte, 0, len(b)*10)); err != nil {
+				return nil, err
+			}
+		}
+		_, err = dpa.UnmarshalMsg(b)
+		return
+	}
+	if len(b) < 3 {
+		return nil, errors.New("Invalid batch header")
+	}
+	codec, flags, b := BatchCodec(b[1]), b[2], b[3:]
+	if flags&batchZstd != 0 {
+		if b, err = zdecoder.DecodeAll(b, make([]byte, 0, len(b)*10)); err != nil {
+			return nil, err
+		}
+	}
+	switch codec {
+	case MsgpackCodec:
+		_, err = dpa.UnmarshalMsg(b)
+		return
+	case ColumnarCodec:
+		return decodeColumns(b)
+	}
+	return nil, fmt.Errorf("Unrecognized batch codec %d", codec)
+}
+
+// bitWriter appends bits to a byte slice, most significant bit first
+type bitWriter struct {
+	b     []byte
+	avail uint // The number of unused bits in the last byte
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.avail == 0 {
+		w.b = append(w.b, 0)
+		w.avail = 8
+	}
+	w.avail--
+	if bit {
+		w.b[len(w.b)-1] |= 1 << w.avail
+	}
+}
+
+// writeBits writes the n least significant bits of v
+func (w *bitWriter) writeBits(v uint64, n uint) {
+	for n > 0 {
+		if w.avail == 0 {
+			w.b = append(w.b, 0)
+			w.avail = 8
+		}
+		k := n
+		if k > w.avail {
+			k = w.avail
+		}
+		n -= k
+		w.avail -= k
+		w.b[len(w.b)-1] |= byte((v>>n)&(1<<k-1)) << w.avail
+	}
+}
+
+var errBatchEnd = errors.New("Unexpected end of columnar batch")
+
+// bitReader reads the bits written by a bitWriter
+type bitReader struct {
+	b   []byte
+	pos uint
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= uint(len(r.b))*8 {
+		return false, errBatchEnd
+	}
+	bit := r.b[r.pos/8]&(0x80>>(r.pos%8)) != 0
+	r.pos++
+	return bit, nil
+}
+
+func (r *bitReader) readBits(n uint) (uint64, error) {
+	if r.pos+n > uint(len(r.b))*8 {
+		return 0, errBatchEnd
+	}
+	var v uint64
+	for n > 0 {
+		avail := 8 - r.pos%8
+		k := n
+		if k > avail {
+			k = avail
+		}
+		cur := uint64(r.b[r.pos/8]>>(avail-k)) & (1<<k - 1)
+		v = v<<k | cur
+		n -= k
+		r.pos += k
+	}
+	return v, nil
+}
+
+// The bucket sizes used for delta-of-delta timestamps. A delta of delta of 0 is written as a single 0 bit. Otherwise,
+// the value in bucket i is prefixed by i+1 one bits and a zero bit, except for the last bucket, which has no zero bit.
+var dodBuckets = []uint{7, 9, 12, 32, 64}
+
+// The timestamps are encoded using the bits of their float64 representation as integers. For timestamps of similar size,
+// these are ordered like the timestamps, and regularly spaced timestamps have a constant delta, just like integers.
+func (w *bitWriter) writeTimestamps(dpa DatapointArray) {
+	prev := math.Float64bits(dpa[0].Timestamp)
+	w.writeBits(prev, 64)
+	var prevDelta uint64
+	for _, dp := range dpa[1:] {
+		cur := math.Float64bits(dp.Timestamp)
+		delta := cur - prev
+		dod := int64(delta - prevDelta)
+		prev, prevDelta = cur, delta
+		if dod == 0 {
+			w.writeBit(false)
+			continue
+		}
+		// zigzag encoding puts small negative and positive values near 0
+		zz := uint64(dod<<1) ^ uint64(dod>>63)
+		for i, size := range dodBuckets {
+			if size == 64 || zz < 1<<size {
+				w.writeBits(1<<(i+1)-1, uint(i+1))
+				if size != 64 {
+					w.writeBit(false)
+				}
+				w.writeBits(zz, size)
+				break
+			}
+		}
+	}
+}
+
+func (r *bitReader) readTimestamps(dpa DatapointArray) error {
+	prev, err := r.readBits(64)
+	if err != nil {
+		return err
+	}
+	dpa[0].Timestamp = math.Float64frombits(prev)
+	var prevDelta uint64
+	for _, dp := range dpa[1:] {
+		size := uint(0)
+		for i := range dodBuckets {
+			bit, err := r.readBit()
+			if err != nil {
+				return err
+			}
+			if !bit {
+				break
+			}
+			size = dodBuckets[i]
+		}
+		var dod int64
+		if size > 0 {
+			zz, err := r.readBits(size)
+			if err != nil {
+				return err
+			}
+			dod = int64(zz>>1) ^ -int64(zz&1)
+		}
+		prevDelta += uint64(dod)
+		prev += prevDelta
+		dp.Timestamp = math.Float64frombits(prev)
+	}
+	return nil
+}
+
+// writeFloats uses the XOR encoding from Facebook's Gorilla paper, which stores repeated and slowly changing values in few bits
+func (w *bitWriter) writeFloats(dpa DatapointArray, get func(*Datapoint) float64) {
+	prev := math.Float64bits(get(dpa[0]))
+	w.writeBits(prev, 64)
+	leading, trailing := uint(65), uint(0)
+	for _, dp := range dpa[1:] {
+		cur := math.Float64bits(get(dp))
+		xor := cur ^ prev
+		prev = cur
+		if xor == 0 {
+			w.writeBit(false)
+			continue
+		}
+		w.writeBit(true)
+		l, t := uint(bits.LeadingZeros64(xor)), uint(bits.TrailingZeros64(xor))
+		if l > 31 {
+			l = 31
+		}
+		if leading <= l && trailing <= t {
+			// The meaningful bits fit in the previous window
+			w.writeBit(false)
+			w.writeBits(xor>>trailing, 64-leading-trailing)
+			continue
+		}
+		leading, trailing = l, t
+		w.writeBit(true)
+		w.writeBits(uint64(leading), 5)
+		// The number of meaningful bits is between 1 and 64, and 64 is stored as 0
+		w.writeBits(uint64(64-leading-trailing)&63, 6)
+		w.writeBits(xor>>trailing, 64-leading-trailing)
+	}
+}
+
+func (r *bitReader) readFloats(dpa DatapointArray, set func(*Datapoint, float64)) error {
+	prev, err := r.readBits(64)
+	if err != nil {
+		return err
+	}
+	set(dpa[0], math.Float64frombits(prev))
+	var leading, trailing uint
+	for _, dp := range dpa[1:] {
+		changed, err := r.readBit()
+		if err != nil {
+			return err
+		}
+		if changed {
+			newWindow, err := r.readBit()
+			if err != nil {
+				return err
+			}
+			if newWindow {
+				l, err := r.readBits(5)
+				if err != nil {
+					return err
+				}
+				m, err := r.readBits(6)
+				if err != nil {
+					return err
+				}
+				if m == 0 {
+					m = 64
+				}
+				if l+m > 64 {
+					return errors.New("Invalid columnar batch")
+				}
+				leading, trailing = uint(l), uint(64-l-m)
+			}
+			v, err := r.readBits(64 - leading - trailing)
+			if err != nil {
+				return err
+			}
+			prev ^= v << trailing
+		}
+		set(dp, math.Float64frombits(prev))
+	}
+	return nil
+}
+
+// encodeColumns encodes a numeric batch with the ColumnarCodec: the number of datapoints as a uvarint,
+// followed by the bit-packed timestamps, durations and values.
+func (dpa DatapointArray) encodeColumns() []byte {
+	var n [binary.MaxVarintLen64]byte
+	w := &bitWriter{b: []byte{batchMarker, byte(ColumnarCodec), 0}}
+	w.b = append(w.b, n[:binary.PutUvarint(n[:], uint64(len(dpa)))]...)
+	w.writeTimestamps(dpa)
+	w.avail = 0
+	w.writeFloats(dpa, func(dp *Datapoint) float64 { return dp.Duration })
+	w.avail = 0
+	w.writeFloats(dpa, func(dp *Datapoint) float64 { return dp.Data.(float64) })
+	return w.b
+}
+
+func decodeColumns(b []byte) (DatapointArray, error) {
+	n, k := binary.Uvarint(b)
+	if k <= 0 || n == 0 || n > uint64(len(b))*8 {
+		return nil, errors.New("Invalid columnar batch")
+	}
+	dpa := make(DatapointArray, n)
+	dps := make([]Datapoint, n)
+	for i := range dpa {
+		dpa[i] = &dps[i]
+	}
+	r := &bitReader{b: b[k:]}
+	if err := r.readTimestamps(dpa); err != nil {
+		return nil, err
+	}
+	// Each column starts at a new byte
+	r.pos = (r.pos + 7) / 8 * 8
+	if err := r.readFloats(dpa, func(dp *Datapoint, v float64) { dp.Duration = v }); err != nil {
+		return nil, err
+	}
+	r.pos = (r.pos + 7) / 8 * 8
+	if err := r.readFloats(dpa, func(dp *Datapoint, v float64) { dp.Data = v }); err != nil {
+		return nil, err
+	}
+	return dpa, nil
+}
@@ -0,0 +1,124 @@
+package timeseries
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func numericArray(n int) DatapointArray {
+	dpa := make(DatapointArray, n)
+	for i := range dpa {
+		dpa[i] = &Datapoint{Timestamp: 1.6e9 + float64(i)*60, Data: 20 + math.Round(10*math.Sin(float64(i)/50))/10}
+	}
+	return dpa
+}
+
+func TestCodecs(t *testing.T) {
+	irregular := DatapointArray{}
+	ts := -1000.5
+	for i := 0; i < 500; i++ {
+		ts += rand.ExpFloat64() * math.Pow(10, float64(rand.Intn(8)-2))
+		irregular = append(irregular, &Datapoint{Timestamp: ts, Duration: float64(rand.Intn(3)), Data: rand.NormFloat64() * 1e6})
+	}
+	arrays := []DatapointArray{dpa4, dpa6, numericArray(1000), irregular,
+		{&Datapoint{Timestamp: 0, Data: 0.}, &Datapoint{Timestamp: math.MaxFloat64, Duration: math.Inf(1), Data: math.Inf(-1)}}}
+
+	for _, compressed := range []bool{false, true} {
+		zencoder = nil
+		if compressed {
+			zencoder, _ = zstd.NewWriter(nil)
+		}
+		for _, dpa := range arrays {
+			for _, codec := range []BatchCodec{MsgpackCodec, ColumnarCodec} {
+				b, err := dpa.Encode(codec)
+				require.NoError(t, err)
+				require.EqualValues(t, batchMarker, b[0])
+				require.EqualValues(t, codec, b[1])
+				res, err := DatapointArrayFromBytes(b)
+				require.NoError(t, err)
+				require.True(t, dpa.IsEqual(res), "%s different from %s", dpa.String(), res.String())
+			}
+		}
+
+		// Non-numeric batches are written with msgpack
+		for _, dpa := range []DatapointArray{dpa1, dpa5, dpa7, {&Datapoint{Timestamp: 1, Data: 1., Actor: "me"}}} {
+			b, err := dpa.Encode(ColumnarCodec)
+			require.NoError(t, err)
+			require.EqualValues(t, MsgpackCodec, b[1])
+			res, err := DatapointArrayFromBytes(b)
+			require.NoError(t, err)
+			require.True(t, dpa.IsEqual(res))
+		}
+	}
+	zencoder, _ = zstd.NewWriter(nil)
+
+	// Truncated columnar batches give an error
+	b, err := irregular.Encode(ColumnarCodec)
+	require.NoError(t, err)
+	for _, l := range []int{3, 4, 20, len(b) / 2, len(b) - 1} {
+		_, err = DatapointArrayFromBytes(b[:l])
+		require.Error(t, err)
+	}
+}
+
+func TestCodecLegacyBatches(t *testing.T) {
+	// Batches written before codecs were added are read both with and without compression
+	raw, err := dpa7.MarshalMsg(nil)
+	require.NoError(t, err)
+	res, err := DatapointArrayFromBytes(raw)
+	require.NoError(t, err)
+	require.True(t, dpa7.IsEqual(res))
+
+	zencoder, _ = zstd.NewWriter(nil)
+	res, err = DatapointArrayFromBytes(zencoder.EncodeAll(raw, nil))
+	require.NoError(t, err)
+	require.True(t, dpa7.IsEqual(res))
+}
+
+func TestCodecSize(t *testing.T) {
+	zencoder, _ = zstd.NewWriter(nil)
+	dpa := numericArray(1024)
+	mb, err := dpa.Encode(MsgpackCodec)
+	require.NoError(t, err)
+	cb, err := dpa.Encode(ColumnarCodec)
+	require.NoError(t, err)
+	t.Logf("1024 numeric datapoints: msgpack+zstd %d bytes, columnar %d bytes", len(mb), len(cb))
+	require.Less(t, len(cb), len(mb))
+}
+
+func TestNumericTimeseriesCodec(t *testing.T) {
+	adb, oid1, oid2, cleanup := newDBWithObjects(t)
+	defer cleanup()
+	sd := TimeseriesDB{DB: adb,
+		BatchSize:             3,
+		MaxBatchSize:          5,
+		BatchCompressionLevel: 2}
+	zencoder, _ = zstd.NewWriter(nil)
+
+	// Batches written before codecs were added are read, and rewritten with the timeseries' codec when modified
+	raw, err := dpa6[:2].MarshalMsg(nil)
+	require.NoError(t, err)
+	_, err = adb.Exec("INSERT INTO timeseries(tsid,tstart,tend,length,data) VALUES (?,1,2,2,?)", oid1, zencoder.EncodeAll(raw, nil))
+	require.NoError(t, err)
+	cmpQuery(t, sd, &Query{Timeseries: oid1}, dpa6[:2])
+	require.NoError(t, adb.UpdateObject(&database.Object{
+		Details: database.Details{ID: oid1},
+		Meta:    &database.JSONObject{"schema": map[string]interface{}{"type": "number"}},
+	}))
+	require.NoError(t, sd.Insert(oid1, NewDatapointArrayIterator(dpa6[2:]), &InsertQuery{}))
+	require.NoError(t, sd.Insert(oid2, NewDatapointArrayIterator(dpa6), &InsertQuery{}))
+
+	codecs := func(tsid string) (c []string) {
+		require.NoError(t, adb.Select(&c, "SELECT hex(substr(data,1,2)) FROM timeseries WHERE tsid=? ORDER BY tstart ASC", tsid))
+		return
+	}
+	require.Equal(t, []string{"C101"}, codecs(oid1))
+	require.Equal(t, []string{"C100"}, codecs(oid2))
+	cmpQuery(t, sd, &Query{Timeseries: oid1}, dpa6)
+	cmpQuery(t, sd, &Query{Timeseries: oid2}, dpa6)
+}
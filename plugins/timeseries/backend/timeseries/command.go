@@ -0,0 +1,66 @@
+package timeseries
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/cmd"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/plugins/run"
+	"github.com/spf13/cobra"
+)
+
+var compactTimeseries string
+
+// TimeseriesCmd groups the commands that manage the timeseries stored in a database
+var TimeseriesCmd = &cobra.Command{
+	Use:   "timeseries",
+	Short: "Manages the data stored in timeseries",
+}
+
+// CompactCmd compacts the batches of timeseries directly in a database
+var CompactCmd = &cobra.Command{
+	Use:   "compact [location of database]",
+	Short: "Compacts the stored batches of timeseries",
+	Long: `Merges adjacent small batches of datapoints toward the configured batch size, and recompresses batches that were
+written with a different compression level or before batch codecs were added. All batches are compacted, without the
+per-run limit of the weekly compact job. The data of the timeseries is not modified. Compaction can also be run
+by an admin on a running server with a POST to /api/timeseries/compact.`,
+	RunE: func(c *cobra.Command, args []string) error {
+		directory, err := cmd.GetDirectory(args)
+		if err != nil {
+			return err
+		}
+		a, err := assets.Open(directory, nil)
+		if err != nil {
+			return err
+		}
+		db, err := database.Open(a)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		if err = run.WithNilInfo(run.WithVersion(PluginName, SQLVersion, SQLUpdater))(db); err != nil {
+			return err
+		}
+		if err = configure(db); err != nil {
+			return err
+		}
+		stats, err := TSDB.Compact(compactTimeseries, 0)
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(stats, "", "  ")
+		if err == nil {
+			fmt.Println(string(b))
+		}
+		return err
+	},
+}
+
+func init() {
+	CompactCmd.Flags().StringVar(&compactTimeseries, "timeseries", "", "Only compact the timeseries with the given id")
+	TimeseriesCmd.AddCommand(CompactCmd)
+	cmd.RootCmd.AddCommand(TimeseriesCmd)
+}
@@ -0,0 +1,234 @@
+package timeseries
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/plugins/run"
+	"github.com/sirupsen/logrus"
+)
+
+// sqlCompressionSchema is added in version 4 of the timeseries database. Batches written before
+// the compression level was recorded have a NULL level.
+const sqlCompressionSchema = `
+ALTER TABLE timeseries ADD COLUMN compression INTEGER DEFAULT NULL;
+ALTER TABLE timeseries_actions ADD COLUMN compression INTEGER DEFAULT NULL;
+`
+
+// sqlCodecSchema is added in version 8 of the timeseries database. The codec of existing batches is read from
+// their header, and is NULL for batches written before codecs were added. Columnar batches have no compression level.
+const sqlCodecSchema = `
+ALTER TABLE timeseries ADD COLUMN codec INTEGER DEFAULT NULL;
+ALTER TABLE timeseries_actions ADD COLUMN codec INTEGER DEFAULT NULL;
+UPDATE timeseries SET codec=CASE hex(substr(data,2,1)) WHEN '00' THEN 0 WHEN '01' THEN 1 END WHERE hex(substr(data,1,1))='C1';
+UPDATE timeseries_actions SET codec=CASE hex(substr(data,2,1)) WHEN '00' THEN 0 WHEN '01' THEN 1 END WHERE hex(substr(data,1,1))='C1';
+UPDATE timeseries SET compression=NULL WHERE codec=1;
+UPDATE timeseries_actions SET compression=NULL WHERE codec=1;
+`
+
+// BatchStats gives the amount of data stored in timeseries batches
+type BatchStats struct {
+	Batches    int64 `json:"batches" db:"batches"`
+	Datapoints int64 `json:"datapoints" db:"datapoints"`
+	Bytes      int64 `json:"bytes" db:"bytes"`
+}
+
+// CompactionStats is the result of compacting timeseries
+type CompactionStats struct {
+	Before BatchStats `json:"before"`
+	After  BatchStats `json:"after"`
+	// The number of timeseries whose batches were rewritten
+	Timeseries int `json:"timeseries"`
+	// The number of batches that were merged into the batch before them
+	Merged int `json:"merged"`
+	// The number of batches that were recompressed with the current compression level, without being merged
+	Recompressed int `json:"recompressed"`
+	// Whether compaction stopped at the limit of rewritten batches before all batches were compacted
+	Incomplete bool `json:"incomplete,omitempty"`
+	// The number of seconds that compaction took
+	Duration float64 `json:"duration"`
+}
+
+func (ts *TimeseriesDB) batchStats(tsid string) (s BatchStats, err error) {
+	for _, table := range []string{"timeseries", "timeseries_actions"} {
+		var ts2 BatchStats
+		q := "SELECT COUNT(*) AS batches, COALESCE(SUM(length),0) AS datapoints, COALESCE(SUM(LENGTH(data)),0) AS bytes FROM " + table
+		if tsid != "" {
+			err = ts.DB.Get(&ts2, q+" WHERE tsid=?", tsid)
+		} else {
+			err = ts.DB.Get(&ts2, q)
+		}
+		if err != nil {
+			return
+		}
+		s.Batches += ts2.Batches
+		s.Datapoints += ts2.Datapoints
+		s.Bytes += ts2.Bytes
+	}
+	return
+}
+
+type batchInfo struct {
+	Tstart      float64     `db:"tstart"`
+	Length      int         `db:"length"`
+	Codec       *BatchCodec `db:"codec"`
+	Compression *int        `db:"compression"`
+}
+
+// compactionGroups splits the batches of a timeseries into runs of adjacent batches that are merged into one batch.
+// Small batches are merged with the following batches until the merged batch reaches the batch size, without going
+// over the max batch size. Groups of a single batch are only returned if the batch needs to be recompressed.
+func (ts *TimeseriesDB) compactionGroups(batches []batchInfo) [][]batchInfo {
+	needsRecompression := func(b batchInfo) bool {
+		if b.Codec == nil {
+			// The batch was written before codecs were added
+			return true
+		}
+		if *b.Codec != MsgpackCodec {
+			return false
+		}
+		return b.Compression == nil || *b.Compression != ts.BatchCompressionLevel
+	}
+	groups := [][]batchInfo{}
+	for i := 0; i < len(batches); {
+		length := batches[i].Length
+		j := i + 1
+		for length < ts.BatchSize && j < len(batches) && length+batches[j].Length <= ts.MaxBatchSize {
+			length += batches[j].Length
+			j++
+		}
+		if j-i > 1 || needsRecompression(batches[i]) {
+			groups = append(groups, batches[i:j])
+		}
+		i = j
+	}
+	return groups
+}
+
+// compactGroup merges the group of batches into a single batch. The batches are checked again in the transaction,
+// and the group is skipped if they were modified since the group was planned.
+func (ts *TimeseriesDB) compactGroup(table, tsid string, group []batchInfo) (bool, error) {
+	tx, err := ts.DB.Beginx()
+	if err != nil {
+		return false, err
+	}
+	rows, err := tx.Queryx(fmt.Sprintf("SELECT tstart,length,data FROM %s WHERE tsid=? AND tstart>=? AND tstart<=? ORDER BY tstart ASC", table),
+		tsid, group[0].Tstart, group[len(group)-1].Tstart)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	merged := DatapointArray{}
+	i := 0
+	unchanged := true
+	for ; rows.Next(); i++ {
+		var tstart float64
+		var length int
+		var raw sql.RawBytes
+		if err = rows.Scan(&tstart, &length, &raw); err != nil {
+			break
+		}
+		if i >= len(group) || group[i].Tstart != tstart || group[i].Length != length {
+			unchanged = false
+			break
+		}
+		var da DatapointArray
+		if da, err = DatapointArrayFromBytes(raw); err != nil {
+			break
+		}
+		merged = append(merged, da...)
+	}
+	rows.Close()
+	if err != nil || !unchanged || i != len(group) {
+		tx.Rollback()
+		return false, err
+	}
+	if _, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE tsid=? AND tstart>=? AND tstart<=?", table), tsid, group[0].Tstart, group[len(group)-1].Tstart); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if err = ts.writeBatch(tx, table, tsid, merged); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// Compact merges adjacent small batches of the given timeseries toward the batch size, and recompresses batches that
+// were written with a different compression level or before codecs were added. If tsid is empty, all timeseries are
+// compacted. At most limit batches are rewritten, so that compacting a large database can be spread over multiple
+// runs, each continuing where the last one stopped. A limit of 0 compacts all batches.
+// The data of the timeseries is not modified, so no events are fired.
+func (ts *TimeseriesDB) Compact(tsid string, limit int) (*CompactionStats, error) {
+	start := time.Now()
+	var err error
+	stats := &CompactionStats{}
+	if stats.Before, err = ts.batchStats(tsid); err != nil {
+		return nil, err
+	}
+	compacted := make(map[string]bool)
+	rewritten := 0
+tables:
+	for _, table := range []string{"timeseries", "timeseries_actions"} {
+		var tsids []string
+		if tsid != "" {
+			tsids = []string{tsid}
+		} else if err = ts.DB.Select(&tsids, "SELECT DISTINCT tsid FROM "+table); err != nil {
+			return nil, err
+		}
+		for _, id := range tsids {
+			var batches []batchInfo
+			if err = ts.DB.Select(&batches, fmt.Sprintf("SELECT tstart,length,codec,compression FROM %s WHERE tsid=? ORDER BY tstart ASC", table), id); err != nil {
+				return nil, err
+			}
+			for _, g := range ts.compactionGroups(batches) {
+				if limit > 0 && rewritten > 0 && rewritten+len(g) > limit {
+					stats.Incomplete = true
+					break tables
+				}
+				rewritten += len(g)
+				ok, err := ts.compactGroup(table, id, g)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					logrus.WithFields(logrus.Fields{"plugin": PluginName, "object": id}).Debug("Skipping compaction of batches modified during compaction")
+					continue
+				}
+				compacted[id] = true
+				if len(g) > 1 {
+					stats.Merged += len(g) - 1
+				} else {
+					stats.Recompressed++
+				}
+			}
+		}
+	}
+	if stats.After, err = ts.batchStats(tsid); err != nil {
+		return nil, err
+	}
+	stats.Timeseries = len(compacted)
+	stats.Duration = time.Since(start).Seconds()
+	return stats, nil
+}
+
+// StartCompaction is run by heedy's scheduler to compact all timeseries
+func StartCompaction(db *database.AdminDB, i *run.Info, h run.BuiltinHelper) error {
+	if TSDB.DB == nil {
+		return errors.New("The timeseries plugin is not running")
+	}
+	stats, err := TSDB.Compact("", TSDB.CompactionLimit)
+	if err != nil {
+		return err
+	}
+	log := logrus.WithField("plugin", PluginName)
+	log.Infof("Compacted %d timeseries from %d to %d batches (%d to %d bytes) in %.1fs",
+		stats.Timeseries, stats.Before.Batches, stats.After.Batches, stats.Before.Bytes, stats.After.Bytes, stats.Duration)
+	if stats.Incomplete {
+		log.Infof("Compaction stopped after rewriting %d batches, and continues on the next run", TSDB.CompactionLimit)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package timeseries
+
+import (
+	"testing"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompact(t *testing.T) {
+	adb, oid1, oid2, cleanup := newDBWithObjects(t)
+	defer cleanup()
+	sd := TimeseriesDB{DB: adb,
+		BatchSize:             4,
+		MaxBatchSize:          6,
+		BatchCompressionLevel: 2}
+
+	// Each datapoint is written in its own batch
+	data := DatapointArray{}
+	tx, err := adb.Beginx()
+	require.NoError(t, err)
+	for i := 1; i <= 10; i++ {
+		dp := &Datapoint{Timestamp: float64(i), Data: float64(i)}
+		data = append(data, dp)
+		require.NoError(t, sd.writeBatch(tx, "timeseries", oid1, DatapointArray{dp}))
+	}
+	require.NoError(t, tx.Commit())
+	// Batches written with another compression level are recompressed
+	other := sd
+	other.BatchCompressionLevel = 3
+	require.NoError(t, other.Insert(oid2, NewDatapointArrayIterator(dpa6), &InsertQuery{}))
+
+	stats, err := sd.Compact("", 0)
+	require.NoError(t, err)
+	require.EqualValues(t, 15, stats.Before.Datapoints)
+	require.EqualValues(t, 15, stats.After.Datapoints)
+	require.Equal(t, 2, stats.Timeseries)
+	require.Equal(t, 1, stats.Recompressed)
+	require.Less(t, stats.After.Batches, stats.Before.Batches)
+
+	cmpQuery(t, sd, &Query{Timeseries: oid1}, data)
+	cmpQuery(t, sd, &Query{Timeseries: oid2}, dpa6)
+	var lengths []int
+	require.NoError(t, adb.Select(&lengths, "SELECT length FROM timeseries WHERE tsid=? ORDER BY tstart ASC", oid1))
+	require.Equal(t, []int{4, 4, 2}, lengths)
+
+	// Compacting again does nothing
+	stats, err = sd.Compact(oid1, 0)
+	require.NoError(t, err)
+	require.Equal(t, 0, stats.Timeseries)
+	require.Equal(t, stats.Before, stats.After)
+
+	// Batches written before codecs were added are rewritten
+	_, err = adb.Exec("UPDATE timeseries SET codec=NULL WHERE tsid=?", oid1)
+	require.NoError(t, err)
+	stats, err = sd.Compact(oid1, 0)
+	require.NoError(t, err)
+	require.Equal(t, 3, stats.Recompressed)
+	cmpQuery(t, sd, &Query{Timeseries: oid1}, data)
+}
+
+func TestCompactLimit(t *testing.T) {
+	adb, oid1, oid2, cleanup := newDBWithObjects(t)
+	defer cleanup()
+	sd := TimeseriesDB{DB: adb,
+		BatchSize:             4,
+		MaxBatchSize:          6,
+		BatchCompressionLevel: 2}
+	require.NoError(t, adb.UpdateObject(&database.Object{
+		Details: database.Details{ID: oid2},
+		Meta:    &database.JSONObject{"schema": map[string]interface{}{"type": "number"}},
+	}))
+
+	tx, err := adb.Beginx()
+	require.NoError(t, err)
+	for i := 1; i <= 8; i++ {
+		require.NoError(t, sd.writeBatch(tx, "timeseries", oid1, DatapointArray{&Datapoint{Timestamp: float64(i), Data: "hi"}}))
+		require.NoError(t, sd.writeBatch(tx, "timeseries", oid2, DatapointArray{&Datapoint{Timestamp: float64(i), Data: float64(i)}}))
+	}
+	require.NoError(t, tx.Commit())
+
+	// Columnar batches record their codec, and have no compression level
+	var codecs []BatchCodec
+	require.NoError(t, adb.Select(&codecs, "SELECT DISTINCT codec FROM timeseries WHERE tsid=? AND compression IS NULL", oid2))
+	require.Equal(t, []BatchCodec{ColumnarCodec}, codecs)
+
+	// Each run rewrites at most the limit of batches, and continues where the last one stopped
+	stats, err := sd.Compact("", 10)
+	require.NoError(t, err)
+	require.True(t, stats.Incomplete)
+	require.Equal(t, 6, stats.Merged)
+	stats, err = sd.Compact("", 10)
+	require.NoError(t, err)
+	require.False(t, stats.Incomplete)
+	require.Equal(t, 6, stats.Merged)
+	require.EqualValues(t, 4, stats.After.Batches)
+
+	// Columnar batches are not recompressed on each run
+	stats, err = sd.Compact("", 0)
+	require.NoError(t, err)
+	require.Equal(t, 0, stats.Timeseries)
+	require.Equal(t, 0, stats.Recompressed)
+}
@@ -38,7 +38,7 @@ of the direct approach.
 
 */
 
-var SQLVersion = 1
+var SQLVersion = 8
 
 // sqlSchema is initialized in plugin.go (SQLUpdater)
 const sqlSchema = `
@@ -147,37 +147,16 @@ func (dpa DatapointArray) IsEqual(d DatapointArray) bool {
 var zencoder *zstd.Encoder
 var zdecoder, _ = zstd.NewReader(nil)
 
-func (dpa DatapointArray) ToBytes() ([]byte, error) {
-	//b, err := easyjson.Marshal(dpa)
-	b, err := dpa.MarshalMsg(nil)
-
-	if err != nil || zencoder == nil {
-		return b, err
-	}
-
-	b = zencoder.EncodeAll(b, make([]byte, 0, len(b)/2))
-	return b, err
-}
-
-//DatapointArrayFromBytes decompresses a gzipped byte array for the compressed representation of a DatapointArray
-func DatapointArrayFromBytes(b []byte) (dpa DatapointArray, err error) {
-	if zencoder != nil {
-		b, err = zdecoder.DecodeAll(b, make([]byte, 0, len(b)*10))
-		if err != nil {
-			return nil, err
-		}
-	}
-	//easyjson.Unmarshal(b, &dpa)
-	_, err = dpa.UnmarshalMsg(b)
-	return
-}
-
 type TimeseriesDB struct {
 	DB                    *database.AdminDB `mapstructure:"-"`
 	BatchSize             int               `mapstructure:"batch_size"`
 	MaxBatchSize          int               `mapstructure:"max_batch_size"`
 	BatchCompressionLevel int               `mapstructure:"batch_compression_level"`
 	CompressQueryResponse bool              `mapstructure:"compress_query_response"`
+	QueryWorkers          int               `mapstructure:"query_workers"`
+	ReadAhead             int               `mapstructure:"read_ahead"`
+	UploadKeyExpiration   float64           `mapstructure:"upload_key_expiration"`
+	CompactionLimit       int               `mapstructure:"compaction_limit"`
 }
 
 func (ts *TimeseriesDB) Length(tsid string, actions bool) (l int64, err error) {
@@ -201,6 +180,10 @@ type Query struct {
 	I          *int64      `json:"i,omitempty" schema:"i"`
 	Transform  *string     `json:"transform,omitempty" schema:"transform"`
 	Actions    *bool       `json:"actions,omitempty" schema:"actions"`
+	// The IANA timezone of dates and relative times such as "today" in t1, t2 and t. The default is UTC.
+	Timezone string `json:"tz,omitempty" schema:"tz"`
+	// Whether REST results include the annotations of the queried timeseries along with the data
+	Annotations *bool `json:"annotations,omitempty" schema:"annotations"`
 }
 
 // String returns a json representation of the datapoint
@@ -209,6 +192,15 @@ func (q Query) String() string {
 	return string(b)
 }
 
+// ParseTime parses a timestamp of the query in the query's timezone
+func (q *Query) ParseTime(ts interface{}) (float64, error) {
+	loc, err := LoadTimezone(q.Timezone)
+	if err != nil {
+		return 0, err
+	}
+	return ParseTimestampIn(ts, loc)
+}
+
 func (ts *TimeseriesDB) rawQuery(q *Query) (DatapointIterator, error) {
 	table := "timeseries"
 	if q.Timeseries == "" {
@@ -226,7 +218,7 @@ func (ts *TimeseriesDB) rawQuery(q *Query) (DatapointIterator, error) {
 
 	// The timestamps are parsed here, because they are used in both time range and index queries
 	if q.T1 != nil {
-		t1, err = ParseTimestamp(q.T1)
+		t1, err = q.ParseTime(q.T1)
 		if err != nil {
 			return nil, err
 		}
@@ -234,7 +226,7 @@ func (ts *TimeseriesDB) rawQuery(q *Query) (DatapointIterator, error) {
 		cValues = append(cValues, t1)
 	}
 	if q.T2 != nil {
-		t2, err = ParseTimestamp(q.T2)
+		t2, err = q.ParseTime(q.T2)
 		if err != nil {
 			return nil, err
 		}
@@ -252,7 +244,7 @@ func (ts *TimeseriesDB) rawQuery(q *Query) (DatapointIterator, error) {
 			if q.T1 != nil || q.T2 != nil {
 				return nil, errors.New("bad_query: Cannot query by range and by single timestamp at the same time")
 			}
-			t, err := ParseTimestamp(q.T)
+			t, err := q.ParseTime(q.T)
 			if err != nil {
 				return nil, err
 			}
@@ -280,7 +272,7 @@ func (ts *TimeseriesDB) rawQuery(q *Query) (DatapointIterator, error) {
 		if err != nil {
 			return nil, err
 		}
-		bi := BatchIterator(SQLBatchIterator{rows, nil})
+		bi := ts.readAhead(rows, nil)
 		da, err := bi.NextBatch()
 		if err != nil || da == nil {
 			return EmptyIterator{}, err
@@ -294,7 +286,7 @@ func (ts *TimeseriesDB) rawQuery(q *Query) (DatapointIterator, error) {
 		if q.T2 != nil {
 			bi = BatchEndTime{bi, t2}
 		}
-		return NewBatchDatapointIterator(NewChanBatchIterator(bi), da), nil
+		return NewBatchDatapointIterator(bi, da), nil
 
 	}
 	if q.T != nil {
@@ -418,7 +410,7 @@ func (ts *TimeseriesDB) rawQuery(q *Query) (DatapointIterator, error) {
 		tx.Rollback()
 		return nil, err
 	}
-	bi := BatchIterator(SQLBatchIterator{rows, func() { tx.Commit() }})
+	bi := ts.readAhead(rows, func() { tx.Commit() })
 	if i2 != nil {
 		bi = BatchEndOffset{bi, so2.Tstart, so2.Offset}
 	}
@@ -454,11 +446,12 @@ func (ts *TimeseriesDB) rawQuery(q *Query) (DatapointIterator, error) {
 		}
 	}
 
-	return NewBatchDatapointIterator(NewChanBatchIterator(bi), da), nil
+	return NewBatchDatapointIterator(bi, da), nil
 }
 
 // Query runs the given query, while adding on the transform and limit reading
 func (ts *TimeseriesDB) Query(q *Query) (DatapointIterator, error) {
+	queriesTotal.Inc()
 	it, err := ts.rawQuery(q)
 	if err != nil {
 		return it, err
@@ -473,11 +466,27 @@ func (ts *TimeseriesDB) Query(q *Query) (DatapointIterator, error) {
 	if q.Limit != nil && *q.Limit > 0 {
 		it = NewNumIterator(it, *q.Limit)
 	}
+	if err == nil {
+		it = &countIterator{DatapointIterator: it, counter: readDatapoints}
+	}
 
 	return it, err
 }
 
 func (ts *TimeseriesDB) Delete(q *Query) error {
+	tx, err := ts.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = ts.deleteTx(tx, q); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteTx deletes the queried data within the given transaction
+func (ts *TimeseriesDB) deleteTx(tx database.TxWrapper, q *Query) error {
 	table := "timeseries"
 
 	if q.Timeseries == "" {
@@ -504,24 +513,18 @@ func (ts *TimeseriesDB) Delete(q *Query) error {
 	}
 
 	if q.T1 != nil {
-		t1, err = ParseTimestamp(q.T1)
+		t1, err = q.ParseTime(q.T1)
 		if err != nil {
 			return err
 		}
 	}
 	if q.T2 != nil {
-		t2, err = ParseTimestamp(q.T2)
+		t2, err = q.ParseTime(q.T2)
 		if err != nil {
 			return err
 		}
 	}
 
-	tx, err := ts.DB.Beginx()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
 	// Delete first finds the bounds over which to delete, deletes all internal elements in the range,
 	// and then finally handles the lower and upper bound batches
 
@@ -530,7 +533,7 @@ func (ts *TimeseriesDB) Delete(q *Query) error {
 			return errors.New("bad_query: cannot delete by single timestamp with additional range/index")
 		}
 		// If T is defined, let both t1 and t2 be T, we special-case the t1=t2 situation
-		t1, err = ParseTimestamp(q.T)
+		t1, err = q.ParseTime(q.T)
 		if err != nil {
 			return err
 		}
@@ -710,7 +713,7 @@ func (ts *TimeseriesDB) Delete(q *Query) error {
 
 	}
 
-	return tx.Commit()
+	return nil
 }
 
 // IteratedBatcher is basically like an SQLBatchIterator, but it closes the sql connection in-between calls to NextBatch,
@@ -778,14 +781,32 @@ func (ts *TimeseriesDB) writeBatch(tx database.TxWrapper, table, tsid string, cu
 	if len(curBatch) == 0 {
 		return nil // Don't write an empty batch
 	}
-	b, err := curBatch.ToBytes()
+	codec, err := ts.batchCodec(tx, tsid)
 	if err != nil {
 		return err
 	}
-	if ts.DB.Assets().Config.Verbose {
+	b, err := curBatch.Encode(codec)
+	if err != nil {
+		return err
+	}
+	if ts.DB.Assets().GetConfig().Verbose {
 		logrus.WithField("timeseries", tsid).Debugln("Writing Batch: ", curBatch.String())
 	}
-	_, err = tx.Exec(fmt.Sprintf("INSERT OR REPLACE INTO %s(tsid,tstart,tend,length,data) VALUES (?,?,?,?,?);", table), tsid, curBatch[0].Timestamp, curBatch[len(curBatch)-1].EndTime(), len(curBatch), b)
+	return ts.insertBatch(tx, table, tsid, &batchinfo{
+		tstart: curBatch[0].Timestamp,
+		tend:   curBatch[len(curBatch)-1].EndTime(),
+		length: len(curBatch),
+		data:   b,
+	})
+}
+
+// insertBatch writes an encoded batch to the database
+func (ts *TimeseriesDB) insertBatch(tx database.TxWrapper, table, tsid string, b *batchinfo) error {
+	codec, compression := ts.batchEncoding(b.data)
+	_, err := tx.Exec(fmt.Sprintf("INSERT OR REPLACE INTO %s(tsid,tstart,tend,length,data,codec,compression) VALUES (?,?,?,?,?,?,?);", table), tsid, b.tstart, b.tend, b.length, b.data, codec, compression)
+	if err == nil {
+		batchesWritten.Inc()
+	}
 	return err
 }
 
@@ -948,20 +969,23 @@ func (ts *TimeseriesDB) append(tx database.TxWrapper, table, tsid string, curBat
 	// This is an appending insert. Let's DO THIS, we are now free to go crazy - we can prepare the batches in another thread entirely,
 	// and just use this thread for pure database writes. This helps because in general json marshalling and gzipping takes some time
 
-	var gerr error
+	codec, gerr := ts.batchCodec(tx, tsid)
+	if gerr != nil {
+		return gerr
+	}
 	closer := make(chan bool, 1)
 	batcher := make(chan *batchinfo, 3)
 
 	go func() {
 		for {
 			if dp == nil {
-				b, err := curBatch.ToBytes()
+				b, err := curBatch.Encode(codec)
 				if err != nil {
 					gerr = err
 					batcher <- nil
 					return
 				}
-				if ts.DB.Assets().Config.Verbose {
+				if ts.DB.Assets().GetConfig().Verbose {
 					logrus.WithField("timeseries", tsid).Debugln("Appending Batch: ", curBatch.String())
 				}
 				// Write the remaining elements of this batch, and exit
@@ -980,13 +1004,13 @@ func (ts *TimeseriesDB) append(tx database.TxWrapper, table, tsid string, curBat
 			if len(curBatch) > ts.MaxBatchSize {
 				prevBatch := curBatch[:ts.BatchSize]
 				curBatch = curBatch[ts.BatchSize:]
-				b, err := prevBatch.ToBytes()
+				b, err := prevBatch.Encode(codec)
 				if err != nil {
 					gerr = err
 					batcher <- nil
 					return
 				}
-				if ts.DB.Assets().Config.Verbose {
+				if ts.DB.Assets().GetConfig().Verbose {
 					logrus.WithField("timeseries", tsid).Debugln("Appending Batch: ", prevBatch.String())
 				}
 				select {
@@ -1013,10 +1037,14 @@ func (ts *TimeseriesDB) append(tx database.TxWrapper, table, tsid string, curBat
 
 	}()
 
-	statement := fmt.Sprintf("INSERT OR REPLACE INTO %s(tsid,tstart,tend,length,data) VALUES (?,?,?,?,?);", table)
+	statement := fmt.Sprintf("INSERT OR REPLACE INTO %s(tsid,tstart,tend,length,data,codec,compression) VALUES (?,?,?,?,?,?,?);", table)
 
 	for b := <-batcher; b != nil; b = <-batcher {
-		_, err := tx.Exec(statement, tsid, b.tstart, b.tend, b.length, b.data)
+		codec, compression := ts.batchEncoding(b.data)
+		_, err := tx.Exec(statement, tsid, b.tstart, b.tend, b.length, b.data, codec, compression)
+		if err == nil {
+			batchesWritten.Inc()
+		}
 		if err != nil {
 			closer <- true
 			for b = <-batcher; b != nil; b = <-batcher {
@@ -1031,16 +1059,39 @@ type InsertQuery struct {
 	Actions  *bool `json:"actions,omitempty"`
 	Validate *bool `json:"validate,omitempty"` // Whether or not to validate the insert against the schema
 
-	// insert, append, update - default is update
+	// insert, append, update, merge - default is update
 	Method *string `json:"method,omitempty"`
+
+	// An optional idempotency key. If an insert with the same key was already written to the timeseries,
+	// the data is skipped, so that uploads can be safely retried.
+	Key *string `json:"key,omitempty"`
 }
 
-func (ts *TimeseriesDB) Insert(tsid string, data DatapointIterator, q *InsertQuery) (err error) {
+// Insert writes the data to the timeseries
+func (ts *TimeseriesDB) Insert(tsid string, data DatapointIterator, q *InsertQuery) error {
+	_, err := ts.Write(tsid, data, q)
+	return err
+}
+
+// Write writes the data to the timeseries, and returns the number of datapoints that were inserted,
+// replaced or skipped
+func (ts *TimeseriesDB) Write(tsid string, data DatapointIterator, q *InsertQuery) (res *InsertResult, err error) {
 	table := "timeseries"
 	method := 0 // 0 is update
+	merge := false
+	res = &InsertResult{}
 
 	// Make sure data comes in sorted and without any funny business
-	data = NewSortChecker(data)
+	counter := &countIterator{DatapointIterator: NewSortChecker(data)}
+	data = counter
+	defer func() {
+		if err != nil {
+			insertsTotal.WithLabelValues("error").Inc()
+			return
+		}
+		insertsTotal.WithLabelValues("success").Inc()
+		insertedDatapoints.Add(float64(res.Inserted + res.Replaced))
+	}()
 
 	if q != nil {
 		if q.Actions != nil && *q.Actions {
@@ -1052,25 +1103,28 @@ func (ts *TimeseriesDB) Insert(tsid string, data DatapointIterator, q *InsertQue
 				method = 1
 			} else if *q.Method == "append" {
 				method = 2
+			} else if *q.Method == "merge" {
+				merge = true
 			} else if *q.Method == "update" {
 			} else {
-				return errors.New("bad_query: Unrecognized insert method")
+				return nil, errors.New("bad_query: Unrecognized insert method")
 			}
 		}
+		if q.Key != nil && *q.Key == "" {
+			return nil, errors.New("bad_query: The insert key can't be empty")
+		}
 	}
 
-	delStatement := fmt.Sprintf("DELETE FROM %s WHERE tsid=? AND tstart=?", table)
-
 	var dp *Datapoint
 	dp, err = data.Next()
 	if err != nil || dp == nil {
-		return err
+		return res, err
 	}
 
 	var tx database.TxWrapper
 	tx, err = ts.DB.Beginx()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer func() {
 		if err != nil {
@@ -1080,6 +1134,32 @@ func (ts *TimeseriesDB) Insert(tsid string, data DatapointIterator, q *InsertQue
 		}
 	}()
 
+	if q != nil && q.Key != nil {
+		var dup bool
+		if dup, err = ts.addUploadKey(tx, tsid, *q.Key); err != nil || dup {
+			// The data was already written, so skip all of it
+			for ; dp != nil && err == nil; dp, err = data.Next() {
+				res.Skipped++
+			}
+			return res, err
+		}
+	}
+
+	if merge {
+		err = ts.merge(tx, table, tsid, dp, data, res)
+		return res, err
+	}
+	if err = ts.insertTx(tx, table, tsid, method, dp, data); err != nil {
+		return nil, err
+	}
+	res.Inserted = counter.n
+	return res, nil
+}
+
+// insertTx writes the data starting at dp with the given method: 0 is update, 1 is insert and 2 is append
+func (ts *TimeseriesDB) insertTx(tx database.TxWrapper, table, tsid string, method int, dp *Datapoint, data DatapointIterator) (err error) {
+	delStatement := fmt.Sprintf("DELETE FROM %s WHERE tsid=? AND tstart=?", table)
+
 	// Get the batch immediately preceding the datapoint
 	var rows *sqlx.Rows
 	rows, err = tx.Queryx(fmt.Sprintf("SELECT data FROM %s WHERE tsid=? AND tstart <= ? ORDER BY tstart DESC LIMIT 1", table), tsid, dp.Timestamp)
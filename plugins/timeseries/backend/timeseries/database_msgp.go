@@ -390,6 +390,24 @@ func (z *InsertQuery) DecodeMsg(dc *msgp.Reader) (err error) {
 					return
 				}
 			}
+		case "Validate":
+			if dc.IsNil() {
+				err = dc.ReadNil()
+				if err != nil {
+					err = msgp.WrapError(err, "Validate")
+					return
+				}
+				z.Validate = nil
+			} else {
+				if z.Validate == nil {
+					z.Validate = new(bool)
+				}
+				*z.Validate, err = dc.ReadBool()
+				if err != nil {
+					err = msgp.WrapError(err, "Validate")
+					return
+				}
+			}
 		case "Method":
 			if dc.IsNil() {
 				err = dc.ReadNil()
@@ -408,6 +426,24 @@ func (z *InsertQuery) DecodeMsg(dc *msgp.Reader) (err error) {
 					return
 				}
 			}
+		case "Key":
+			if dc.IsNil() {
+				err = dc.ReadNil()
+				if err != nil {
+					err = msgp.WrapError(err, "Key")
+					return
+				}
+				z.Key = nil
+			} else {
+				if z.Key == nil {
+					z.Key = new(string)
+				}
+				*z.Key, err = dc.ReadString()
+				if err != nil {
+					err = msgp.WrapError(err, "Key")
+					return
+				}
+			}
 		default:
 			err = dc.Skip()
 			if err != nil {
@@ -421,9 +457,9 @@ func (z *InsertQuery) DecodeMsg(dc *msgp.Reader) (err error) {
 
 // EncodeMsg implements msgp.Encodable
 func (z *InsertQuery) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 2
+	// map header, size 4
 	// write "Actions"
-	err = en.Append(0x82, 0xa7, 0x41, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73)
+	err = en.Append(0x84, 0xa7, 0x41, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73)
 	if err != nil {
 		return
 	}
@@ -439,6 +475,23 @@ func (z *InsertQuery) EncodeMsg(en *msgp.Writer) (err error) {
 			return
 		}
 	}
+	// write "Validate"
+	err = en.Append(0xa8, 0x56, 0x61, 0x6c, 0x69, 0x64, 0x61, 0x74, 0x65)
+	if err != nil {
+		return
+	}
+	if z.Validate == nil {
+		err = en.WriteNil()
+		if err != nil {
+			return
+		}
+	} else {
+		err = en.WriteBool(*z.Validate)
+		if err != nil {
+			err = msgp.WrapError(err, "Validate")
+			return
+		}
+	}
 	// write "Method"
 	err = en.Append(0xa6, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64)
 	if err != nil {
@@ -456,20 +509,44 @@ func (z *InsertQuery) EncodeMsg(en *msgp.Writer) (err error) {
 			return
 		}
 	}
+	// write "Key"
+	err = en.Append(0xa3, 0x4b, 0x65, 0x79)
+	if err != nil {
+		return
+	}
+	if z.Key == nil {
+		err = en.WriteNil()
+		if err != nil {
+			return
+		}
+	} else {
+		err = en.WriteString(*z.Key)
+		if err != nil {
+			err = msgp.WrapError(err, "Key")
+			return
+		}
+	}
 	return
 }
 
 // MarshalMsg implements msgp.Marshaler
 func (z *InsertQuery) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 2
+	// map header, size 4
 	// string "Actions"
-	o = append(o, 0x82, 0xa7, 0x41, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73)
+	o = append(o, 0x84, 0xa7, 0x41, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73)
 	if z.Actions == nil {
 		o = msgp.AppendNil(o)
 	} else {
 		o = msgp.AppendBool(o, *z.Actions)
 	}
+	// string "Validate"
+	o = append(o, 0xa8, 0x56, 0x61, 0x6c, 0x69, 0x64, 0x61, 0x74, 0x65)
+	if z.Validate == nil {
+		o = msgp.AppendNil(o)
+	} else {
+		o = msgp.AppendBool(o, *z.Validate)
+	}
 	// string "Method"
 	o = append(o, 0xa6, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64)
 	if z.Method == nil {
@@ -477,6 +554,13 @@ func (z *InsertQuery) MarshalMsg(b []byte) (o []byte, err error) {
 	} else {
 		o = msgp.AppendString(o, *z.Method)
 	}
+	// string "Key"
+	o = append(o, 0xa3, 0x4b, 0x65, 0x79)
+	if z.Key == nil {
+		o = msgp.AppendNil(o)
+	} else {
+		o = msgp.AppendString(o, *z.Key)
+	}
 	return
 }
 
@@ -515,6 +599,23 @@ func (z *InsertQuery) UnmarshalMsg(bts []byte) (o []byte, err error) {
 					return
 				}
 			}
+		case "Validate":
+			if msgp.IsNil(bts) {
+				bts, err = msgp.ReadNilBytes(bts)
+				if err != nil {
+					return
+				}
+				z.Validate = nil
+			} else {
+				if z.Validate == nil {
+					z.Validate = new(bool)
+				}
+				*z.Validate, bts, err = msgp.ReadBoolBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Validate")
+					return
+				}
+			}
 		case "Method":
 			if msgp.IsNil(bts) {
 				bts, err = msgp.ReadNilBytes(bts)
@@ -532,6 +633,23 @@ func (z *InsertQuery) UnmarshalMsg(bts []byte) (o []byte, err error) {
 					return
 				}
 			}
+		case "Key":
+			if msgp.IsNil(bts) {
+				bts, err = msgp.ReadNilBytes(bts)
+				if err != nil {
+					return
+				}
+				z.Key = nil
+			} else {
+				if z.Key == nil {
+					z.Key = new(string)
+				}
+				*z.Key, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Key")
+					return
+				}
+			}
 		default:
 			bts, err = msgp.Skip(bts)
 			if err != nil {
@@ -552,12 +670,24 @@ func (z *InsertQuery) Msgsize() (s int) {
 	} else {
 		s += msgp.BoolSize
 	}
+	s += 9
+	if z.Validate == nil {
+		s += msgp.NilSize
+	} else {
+		s += msgp.BoolSize
+	}
 	s += 7
 	if z.Method == nil {
 		s += msgp.NilSize
 	} else {
 		s += msgp.StringPrefixSize + len(*z.Method)
 	}
+	s += 4
+	if z.Key == nil {
+		s += msgp.NilSize
+	} else {
+		s += msgp.StringPrefixSize + len(*z.Key)
+	}
 	return
 }
 
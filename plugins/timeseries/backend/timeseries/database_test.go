@@ -1,7 +1,11 @@
 package timeseries
 
 import (
+	"fmt"
+	"math"
+	"math/rand"
 	"os"
+	"runtime"
 	"testing"
 
 	"github.com/heedy/heedy/backend/assets"
@@ -43,7 +47,7 @@ func TestArrayEquality(t *testing.T) {
 	require.True(t, dpa5.IsEqual(dpa5))
 }
 
-func newAssets(t *testing.T) (*assets.Assets, func()) {
+func newAssets(t testing.TB) (*assets.Assets, func()) {
 	a, err := assets.Open("", nil)
 	require.NoError(t, err)
 	os.RemoveAll("./test_db")
@@ -57,7 +61,7 @@ func newAssets(t *testing.T) (*assets.Assets, func()) {
 	}
 }
 
-func newDB(t *testing.T) (*database.AdminDB, func()) {
+func newDB(t testing.TB) (*database.AdminDB, func()) {
 	a, cleanup := newAssets(t)
 	a.Config.Verbose = true
 	err := database.Create(a)
@@ -77,7 +81,7 @@ func newDB(t *testing.T) (*database.AdminDB, func()) {
 	return db, cleanup
 }
 
-func newDBWithUser(t *testing.T) (*database.AdminDB, func()) {
+func newDBWithUser(t testing.TB) (*database.AdminDB, func()) {
 	adb, cleanup := newDB(t)
 
 	name := "test"
@@ -89,7 +93,7 @@ func newDBWithUser(t *testing.T) (*database.AdminDB, func()) {
 	return adb, cleanup
 }
 
-func newDBWithObjects(t *testing.T) (*database.AdminDB, string, string, func()) {
+func newDBWithObjects(t testing.TB) (*database.AdminDB, string, string, func()) {
 	db, cleanup := newDBWithUser(t)
 	oname := "myobject"
 	otype := "timeseries"
@@ -666,3 +670,63 @@ func TestDurationUpdate(t *testing.T) {
 
 	require.True(t, output.IsEqual(dpa), "%s different from %s", dpa.String(), output.String())
 }
+
+// benchmarkMerge merges 20 timeseries of 50 batches each, which spends most of its time decompressing batches
+func benchmarkMerge(b *testing.B, workers int, readAhead int) {
+	adb, cleanup := newDBWithUser(b)
+	defer cleanup()
+	logrus.SetLevel(logrus.WarnLevel)
+	s := TimeseriesDB{
+		DB:                    adb,
+		BatchSize:             1024,
+		MaxBatchSize:          2047,
+		BatchCompressionLevel: 2,
+		QueryWorkers:          workers,
+		ReadAhead:             readAhead,
+	}
+	TSDB = s
+
+	otype := "timeseries"
+	uname := "test"
+	q := make([]*Query, 20)
+	for i := range q {
+		oname := fmt.Sprintf("series%d", i)
+		oid, err := adb.CreateObject(&database.Object{
+			Details: database.Details{
+				Name: &oname,
+			},
+			Type:  &otype,
+			Owner: &uname,
+		})
+		require.NoError(b, err)
+		data := make(DatapointArray, 50*1024)
+		for j := range data {
+			data[j] = &Datapoint{Timestamp: float64(j) + float64(i)/20, Data: rand.Float64()}
+		}
+		require.NoError(b, s.Insert(oid, NewDatapointArrayIterator(data), &InsertQuery{}))
+		q[i] = &Query{Timeseries: oid}
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		di, err := GetMerge(adb, q, math.Inf(-1))
+		require.NoError(b, err)
+		it := &TransformIterator{dpi: di, it: di}
+		count := 0
+		dp, err := it.Next()
+		for ; dp != nil && err == nil; dp, err = it.Next() {
+			count++
+		}
+		it.Close()
+		require.NoError(b, err)
+		require.Equal(b, 20*50*1024, count)
+	}
+}
+
+func BenchmarkMergeSerial(b *testing.B) {
+	benchmarkMerge(b, 1, 1)
+}
+
+func BenchmarkMergeParallel(b *testing.B) {
+	benchmarkMerge(b, runtime.NumCPU(), 4)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"time"
 
 	"github.com/heedy/heedy/backend/database"
 	"github.com/heedy/pipescript"
@@ -40,7 +41,7 @@ func (q *Query) Get(db database.DB, tstart float64) (*DatasetIterator, error) {
 	if err != nil {
 		return nil, err
 	}
-	if *obj.Type != "timeseries" {
+	if !isTimeseriesType(*obj.Type) {
 		return nil, fmt.Errorf("bad_query: Object '%s' is not a timeseries", q.Timeseries)
 	}
 	if !obj.Access.HasScope("read") {
@@ -131,6 +132,9 @@ func (d *DatasetElement) Validate() error {
 		if q.T == nil && q.T != nil {
 			q.T = d.T
 		}
+		if q.Timezone == "" {
+			q.Timezone = d.Timezone
+		}
 	}
 	if d.Interpolator == "" {
 		d.Interpolator = "closest"
@@ -234,8 +238,15 @@ func (d *Dataset) Validate() error {
 		if q.T == nil && q.T != nil {
 			q.T = d.T
 		}
+		if q.Timezone == "" {
+			q.Timezone = d.Timezone
+		}
 	}
 	for _, v := range d.Dataset {
+		// The elements of the dataset use its timezone unless they have their own
+		if v.Timezone == "" {
+			v.Timezone = d.Timezone
+		}
 		if err := v.Validate(); err != nil {
 			return err
 		}
@@ -243,6 +254,178 @@ func (d *Dataset) Validate() error {
 	return nil
 }
 
+// from restricts the dataset to the data at or after the given time, and returns the time at which the
+// restricted dataset starts. T-datasets keep their original grid, so they start at the last grid point before t.
+func (d *Dataset) from(t float64) (float64, error) {
+	if unit, ok := d.calendarUnit(); ok {
+		loc, err := LoadTimezone(d.Timezone)
+		if err != nil {
+			return t, err
+		}
+		t1, err := ParseTimestampIn(d.T1, loc)
+		if err != nil {
+			return t, err
+		}
+		// Calendar buckets start at the calendar unit containing t1
+		start := Unix(calendarStart(time.Unix(int64(math.Floor(math.Max(t, t1))), 0).In(loc), unit))
+		d.T1 = start
+		return start, nil
+	}
+	if d.Dt != nil {
+		dt, err := ParseTimestamp(d.Dt)
+		if err != nil {
+			return t, err
+		}
+		t1, err := d.ParseTime(d.T1)
+		if err != nil || t <= t1 || dt <= 0 {
+			return t1, err
+		}
+		t = t1 + math.Floor((t-t1)/dt)*dt
+		d.T1 = t
+		return t, nil
+	}
+	later := func(q *Query) error {
+		if q.T1 != nil {
+			t1, err := q.ParseTime(q.T1)
+			if err != nil || t1 >= t {
+				return err
+			}
+		}
+		q.T1 = t
+		return nil
+	}
+	if err := later(&d.Query); err != nil {
+		return t, err
+	}
+	for _, q := range d.Merge {
+		if err := later(q); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+// until restricts the dataset to the data before the given time, and returns the time at which the
+// restricted dataset ends. T-datasets end two grid points after t, so that the bucket containing t and
+// the point after it are included.
+func (d *Dataset) until(t float64) (float64, error) {
+	if math.IsInf(t, 1) {
+		return t, nil
+	}
+	if unit, ok := d.calendarUnit(); ok {
+		loc, err := LoadTimezone(d.Timezone)
+		if err != nil {
+			return t, err
+		}
+		step := calendarSteps[unit]
+		y, m, day := calendarStart(time.Unix(int64(math.Floor(t)), 0).In(loc), unit).Date()
+		t = Unix(time.Date(y+2*step[0], m+time.Month(2*step[1]), day+2*step[2], 0, 0, 0, 0, loc))
+	} else if d.Dt != nil {
+		dt, err := ParseTimestamp(d.Dt)
+		if err != nil {
+			return t, err
+		}
+		t1, err := d.ParseTime(d.T1)
+		if err != nil || dt <= 0 {
+			return t, err
+		}
+		t = t1 + (math.Floor((t-t1)/dt)+2)*dt
+	}
+	earlier := func(q *Query) error {
+		if q.T2 != nil {
+			t2, err := q.ParseTime(q.T2)
+			if err != nil || t2 <= t {
+				return err
+			}
+		}
+		q.T2 = t
+		return nil
+	}
+	if err := earlier(&d.Query); err != nil {
+		return t, err
+	}
+	if d.Dt == nil {
+		for _, q := range d.Merge {
+			if err := earlier(q); err != nil {
+				return t, err
+			}
+		}
+	}
+	return t, nil
+}
+
+// calendarSteps are the dt values of t-datasets whose points are at the start of each calendar day, week,
+// month or year in the dataset's timezone, given as the years, months and days between points
+var calendarSteps = map[string][3]int{
+	"day":   {0, 0, 1},
+	"week":  {0, 0, 7},
+	"month": {0, 1, 0},
+	"year":  {1, 0, 0},
+}
+
+// calendarUnit returns the calendar unit of a t-dataset whose dt is one of the calendarSteps
+func (d *Dataset) calendarUnit() (string, bool) {
+	unit, ok := d.Dt.(string)
+	if !ok {
+		return "", false
+	}
+	_, ok = calendarSteps[unit]
+	return unit, ok
+}
+
+// calendarIterator generates the points of a t-dataset with calendar buckets. Since the length of days,
+// months and years varies, each point's duration is set to the length of its bucket, which is the interval
+// that aggregating interpolators run on.
+type calendarIterator struct {
+	start time.Time
+	step  [3]int
+	n     int
+	t2    float64
+}
+
+func newCalendarIterator(t1, t2 float64, unit string, loc *time.Location) *calendarIterator {
+	return &calendarIterator{
+		start: calendarStart(time.Unix(int64(math.Floor(t1)), 0).In(loc), unit),
+		step:  calendarSteps[unit],
+		t2:    t2,
+	}
+}
+
+// at returns the start of the nth bucket. It is computed from the first bucket rather than the previous one,
+// so that a midnight skipped by a daylight saving change doesn't shift the following buckets.
+func (ci *calendarIterator) at(n int) time.Time {
+	y, m, d := ci.start.Date()
+	return time.Date(y+n*ci.step[0], m+time.Month(n*ci.step[1]), d+n*ci.step[2], 0, 0, 0, 0, ci.start.Location())
+}
+
+func (ci *calendarIterator) Next(out *pipescript.Datapoint) (*pipescript.Datapoint, error) {
+	t := Unix(ci.at(ci.n))
+	if t >= ci.t2 {
+		return nil, nil
+	}
+	ci.n++
+	out.Timestamp = t
+	out.Duration = Unix(ci.at(ci.n)) - t
+	return out, nil
+}
+
+// interpolator returns the interpolator of a dataset element. In datasets with calendar buckets, PipeScript
+// interpolators such as sum aggregate the data within each point's bucket, from its timestamp to the end of its duration.
+func (d *Dataset) interpolator(name string, reference *pipescript.BufferIterator, stream pipescript.Iterator) (pipescript.Iterator, error) {
+	if _, ok := d.calendarUnit(); ok {
+		datasets.RegistryLock.RLock()
+		_, registered := datasets.InterpolatorRegistry[name]
+		datasets.RegistryLock.RUnlock()
+		if !registered {
+			return datasets.GetInterpolator("transform", map[string]interface{}{
+				"transform": name,
+				"run_on":    "dt",
+			}, reference, stream)
+		}
+	}
+	return datasets.GetInterpolator(name, nil, reference, stream)
+}
+
 func (d *Dataset) populate(db database.DB, dset *datasets.Dataset, tstart float64) (*DatasetIterator, error) {
 	closers := make([]Closer, 0)
 	for k, v := range d.Dataset {
@@ -253,7 +436,7 @@ func (d *Dataset) populate(db database.DB, dset *datasets.Dataset, tstart float6
 			}
 			return nil, err
 		}
-		ipltr, err := datasets.GetInterpolator(v.Interpolator, nil, dset.Reference(), di)
+		ipltr, err := d.interpolator(v.Interpolator, dset.Reference(), di)
 		if err != nil {
 			for j := range closers {
 				closers[j].Close()
@@ -269,6 +452,16 @@ func (d *Dataset) populate(db database.DB, dset *datasets.Dataset, tstart float6
 	}, nil
 }
 
+// iterator returns a DatapointIterator over the dataset's results. Datasets that need PipeScript processing are
+// computed in their own goroutine, so that multiple datasets, and the encoding of their results, run in parallel.
+func (d *Dataset) iterator(di *DatasetIterator) DatapointIterator {
+	ti := &TransformIterator{dpi: di, it: di}
+	if len(d.Dataset) > 0 || len(d.Merge) > 0 || d.Transform != nil || d.PostTransform != "" {
+		return NewChanIterator(ti)
+	}
+	return ti
+}
+
 func (d *Dataset) Get(db database.DB) (*DatasetIterator, error) {
 	err := d.Validate()
 	if err != nil {
@@ -276,19 +469,30 @@ func (d *Dataset) Get(db database.DB) (*DatasetIterator, error) {
 	}
 	if d.Dt != nil {
 		// It is a t-dataset
-		dt, err := ParseTimestamp(d.Dt)
+		t1, err := d.ParseTime(d.T1)
 		if err != nil {
 			return nil, err
 		}
-		t1, err := ParseTimestamp(d.T1)
+		t2, err := d.ParseTime(d.T2)
 		if err != nil {
 			return nil, err
 		}
-		t2, err := ParseTimestamp(d.T2)
-		if err != nil {
-			return nil, err
+		var dset *datasets.Dataset
+		if unit, ok := d.calendarUnit(); ok {
+			loc, err := LoadTimezone(d.Timezone)
+			if err != nil {
+				return nil, err
+			}
+			ci := newCalendarIterator(t1, t2, unit, loc)
+			dset = datasets.NewDataset(ci)
+			t1 = Unix(ci.start)
+		} else {
+			dt, err := ParseTimestamp(d.Dt)
+			if err != nil {
+				return nil, err
+			}
+			dset = datasets.NewTDataset(t1, t2, dt)
 		}
-		dset := datasets.NewTDataset(t1, t2, dt)
 		di, err := d.populate(db, dset, t1)
 		if err != nil {
 			return nil, err
@@ -2,6 +2,7 @@ package timeseries
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -300,3 +301,75 @@ func TestDatasetErrors(t *testing.T) {
 	require.Error(t, err)
 
 }
+
+func TestCalendarDataset(t *testing.T) {
+	adb, oid1, _, cleanup := newDBWithObjects(t)
+	defer cleanup()
+	sd := TimeseriesDB{DB: adb,
+		BatchSize:             3,
+		MaxBatchSize:          5,
+		BatchCompressionLevel: 3}
+	TSDB = sd
+
+	// Hourly datapoints in New York from 2020-03-07 to 2020-03-10, over the start of daylight saving time on the 8th
+	ny, err := LoadTimezone("America/New_York")
+	require.NoError(t, err)
+	start := Unix(time.Date(2020, 3, 7, 0, 0, 0, 0, ny))
+	dpa := DatapointArray{}
+	for h := 0; h < 71; h++ {
+		dpa = append(dpa, &Datapoint{Timestamp: start + float64(h)*3600 + 1, Data: 1.})
+	}
+	require.NoError(t, sd.Insert(oid1, NewDatapointArrayIterator(dpa), &InsertQuery{}))
+
+	ds := func() *Dataset {
+		return &Dataset{
+			Query: Query{
+				T1:       "2020-03-07T10:00:00",
+				T2:       "2020-03-10",
+				Timezone: "America/New_York",
+			},
+			Dt: "day",
+			Dataset: map[string]*DatasetElement{
+				"steps": &DatasetElement{
+					Query:        Query{Timeseries: oid1},
+					Interpolator: "sum",
+				},
+			},
+		}
+	}
+	di, err := ds().Get(adb)
+	require.NoError(t, err)
+	res, err := NewArrayFromIterator(&TransformIterator{dpi: di, it: di})
+	require.NoError(t, err)
+
+	// The buckets start at local midnight, and the sum at each point is of its own day, which has
+	// only 23 hours at the start of daylight saving time
+	day := func(d int) float64 {
+		return Unix(time.Date(2020, 3, d, 0, 0, 0, 0, ny))
+	}
+	result := DatapointArray{
+		&Datapoint{Timestamp: day(7), Duration: 24 * 3600, Data: map[string]interface{}{"steps": 24}},
+		&Datapoint{Timestamp: day(8), Duration: 23 * 3600, Data: map[string]interface{}{"steps": 23}},
+		&Datapoint{Timestamp: day(9), Duration: 24 * 3600, Data: map[string]interface{}{"steps": 24}},
+	}
+	require.True(t, result.IsEqual(res), "%s different from %s", result.String(), res.String())
+
+	// Derived timeseries restrict calendar datasets to whole buckets
+	d := ds()
+	from, err := d.from(day(9) + 3600)
+	require.NoError(t, err)
+	require.Equal(t, day(9), from)
+	from, err = ds().from(0)
+	require.NoError(t, err)
+	require.Equal(t, day(7), from)
+	d = ds()
+	to, err := d.until(day(7) + 3600)
+	require.NoError(t, err)
+	require.Equal(t, day(9), to)
+	require.Equal(t, day(9), d.T2)
+
+	d = ds()
+	d.Timezone = "Mars/Olympus_Mons"
+	_, err = d.Get(adb)
+	require.Error(t, err)
+}
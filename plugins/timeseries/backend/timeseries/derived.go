@@ -0,0 +1,434 @@
+package timeseries
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/events"
+	"github.com/sirupsen/logrus"
+)
+
+// DerivedType is the object type of timeseries whose data is computed from a dataset of other timeseries
+const DerivedType = "derived_timeseries"
+
+// ErrDerived is returned when trying to modify the data of a derived timeseries directly
+var ErrDerived = errors.New("read_only: The data of a derived timeseries is computed from its dataset")
+
+func isTimeseriesType(t string) bool {
+	return t == "timeseries" || t == DerivedType
+}
+
+// DerivedMeta is the meta of a derived timeseries
+type DerivedMeta struct {
+	// The dataset that gives the derived timeseries' data
+	Dataset *Dataset `json:"dataset"`
+	// The number of seconds of data before and after a change to a source timeseries that is also recomputed,
+	// for transforms and interpolators that depend on nearby data
+	Lookback float64 `json:"lookback,omitempty"`
+}
+
+// derivedTimeseries holds a loaded derived timeseries
+type derivedTimeseries struct {
+	// The user or app that the dataset is queried as, so that it can only include readable timeseries
+	as       string
+	dataset  []byte
+	lookback float64
+	sources  map[string]int
+}
+
+// DerivedProcessor materializes derived timeseries in the background. When one of the sources of a derived
+// timeseries is written or deleted, only its data in the time range of the change is recomputed.
+type DerivedProcessor struct {
+	DB *database.AdminDB
+
+	sync.Mutex
+	derived map[string]*derivedTimeseries
+	// The derived timeseries whose definition needs to be loaded, because they were created or updated
+	changed map[string]bool
+	// The derived timeseries that need to be recomputed, and the time range of their data that is recomputed
+	pending map[string]timeRange
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+// Derived is the global DerivedProcessor, initialized when the plugin starts
+var Derived *DerivedProcessor
+
+// NewDerivedProcessor loads the existing derived timeseries. Their data is not recomputed, since it was
+// stored when their sources were last modified.
+func NewDerivedProcessor(db *database.AdminDB) (*DerivedProcessor, error) {
+	dp := &DerivedProcessor{
+		DB:      db,
+		derived: make(map[string]*derivedTimeseries),
+		changed: make(map[string]bool),
+		pending: make(map[string]timeRange),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	var ids []string
+	if err := db.Select(&ids, "SELECT id FROM objects WHERE type=?", DerivedType); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if _, err := dp.load(id); err != nil {
+			logrus.WithFields(logrus.Fields{"plugin": PluginName, "object": id}).Errorf("Invalid derived timeseries: %v", err)
+		}
+	}
+	return dp, nil
+}
+
+func (dp *DerivedProcessor) notify() {
+	select {
+	case dp.wake <- struct{}{}:
+	default:
+	}
+}
+
+// timeRange is the range of time from t1 up to, but not including, t2
+type timeRange struct {
+	t1, t2 float64
+}
+
+// recompute queues the derived timeseries to have its data in the given time range recomputed.
+// The processor must be locked.
+func (dp *DerivedProcessor) recompute(id string, r timeRange) {
+	if cur, ok := dp.pending[id]; ok {
+		r.t1 = math.Min(r.t1, cur.t1)
+		r.t2 = math.Max(r.t2, cur.t2)
+	}
+	dp.pending[id] = r
+}
+
+// Rebuild recomputes all of the data of the given derived timeseries
+func (dp *DerivedProcessor) Rebuild(id string) {
+	dp.Lock()
+	dp.recompute(id, timeRange{math.Inf(-1), math.Inf(1)})
+	dp.Unlock()
+	dp.notify()
+}
+
+// changeRange returns the time range of the data modified by a timeseries write or delete event
+func changeRange(e *events.Event) timeRange {
+	var t1, t2 interface{}
+	q := &Query{}
+	switch d := e.Data.(type) {
+	case *TimeseriesWriteEvent:
+		return timeRange{d.T1, math.Nextafter(d.T2, math.Inf(1))}
+	case Query:
+		if d.I != nil || d.I1 != nil || d.I2 != nil {
+			return timeRange{math.Inf(-1), math.Inf(1)}
+		}
+		t1, t2 = d.T1, d.T2
+		if d.T != nil {
+			t, err := d.ParseTime(d.T)
+			if err != nil {
+				return timeRange{math.Inf(-1), math.Inf(1)}
+			}
+			return timeRange{t, math.Nextafter(t, math.Inf(1))}
+		}
+		q = &d
+	case map[string]interface{}:
+		t1, t2 = d["t1"], d["t2"]
+	}
+	r := timeRange{math.Inf(-1), math.Inf(1)}
+	if t1 != nil {
+		if t, err := q.ParseTime(t1); err == nil {
+			r.t1 = t
+		}
+	}
+	if t2 != nil {
+		if t, err := q.ParseTime(t2); err == nil {
+			r.t2 = t
+		}
+	}
+	return r
+}
+
+// Fire queues the derived timeseries affected by the event to be recomputed
+func (dp *DerivedProcessor) Fire(e *events.Event) {
+	if e.Object == "" {
+		return
+	}
+	switch e.Event {
+	case "object_create", "object_update":
+		if e.Type != DerivedType {
+			return
+		}
+		dp.Lock()
+		dp.changed[e.Object] = true
+		dp.Unlock()
+	case "object_delete":
+		dp.Lock()
+		delete(dp.derived, e.Object)
+		delete(dp.changed, e.Object)
+		delete(dp.pending, e.Object)
+		dp.Unlock()
+		return
+	case "timeseries_data_write", "timeseries_data_delete":
+		r := changeRange(e)
+		dp.Lock()
+		for id, d := range dp.derived {
+			if _, ok := d.sources[e.Object]; ok {
+				dp.recompute(id, timeRange{r.t1 - d.lookback, r.t2 + d.lookback})
+			}
+		}
+		dp.Unlock()
+	default:
+		return
+	}
+	dp.notify()
+}
+
+// dependents returns the derived timeseries that are computed from the given timeseries
+func (dp *DerivedProcessor) dependents(tsid string) []string {
+	dp.Lock()
+	defer dp.Unlock()
+	var ids []string
+	for id, d := range dp.derived {
+		if _, ok := d.sources[tsid]; ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// load reads the definition of the derived timeseries from its meta, and returns whether it changed
+func (dp *DerivedProcessor) load(id string) (bool, error) {
+	obj, err := dp.DB.ReadObject(id, &database.ReadObjectOptions{})
+	if err != nil {
+		return false, err
+	}
+	if obj.Meta == nil || *obj.Type != DerivedType {
+		return false, errors.New("bad_request: not a derived timeseries")
+	}
+	b, err := json.Marshal(*obj.Meta)
+	if err != nil {
+		return false, err
+	}
+	var meta DerivedMeta
+	if err = json.Unmarshal(b, &meta); err != nil {
+		return false, err
+	}
+	if meta.Dataset == nil {
+		return false, errors.New("bad_request: derived timeseries has no dataset")
+	}
+	q := meta.Dataset.Query
+	if q.I != nil || q.I1 != nil || q.I2 != nil || q.T != nil || q.Limit != nil || q.Actions != nil && *q.Actions || q.Annotations != nil && *q.Annotations {
+		return false, errors.New("bad_query: the dataset of a derived timeseries can only restrict its time range")
+	}
+	dataset, err := json.Marshal(meta.Dataset)
+	if err != nil {
+		return false, err
+	}
+	// Validating a copy checks the dataset without setting defaults in the stored definition
+	var ds Dataset
+	json.Unmarshal(dataset, &ds)
+	if err = ds.Validate(); err != nil {
+		return false, err
+	}
+	// Relative times would move the dataset's time range each time it is recomputed, so that the
+	// incrementally materialized data would not match the dataset
+	queries := append([]*Query{&ds.Query}, ds.Merge...)
+	for _, e := range ds.Dataset {
+		queries = append(append(queries, &e.Query), e.Merge...)
+	}
+	for _, dq := range queries {
+		if isRelativeTime(dq.T1) || isRelativeTime(dq.T2) {
+			return false, errors.New("bad_query: the dataset of a derived timeseries can't use relative times")
+		}
+	}
+	sources := ds.GetTimeseries()
+	if len(sources) == 0 {
+		return false, errors.New("bad_query: the dataset of a derived timeseries must include a timeseries")
+	}
+
+	as := *obj.Owner
+	if obj.App != nil && *obj.App != "" {
+		as += "/" + *obj.App
+	}
+	d := &derivedTimeseries{
+		as:       as,
+		dataset:  dataset,
+		lookback: math.Max(meta.Lookback, 0),
+		sources:  sources,
+	}
+
+	if _, ok := sources[id]; ok {
+		return false, errors.New("bad_query: a derived timeseries can't be computed from itself")
+	}
+	for s := range sources {
+		loop, err := feeds(dp.DB, dp, id, s)
+		if err != nil {
+			return false, err
+		}
+		if loop {
+			return false, fmt.Errorf("bad_query: timeseries %s is computed from this derived timeseries", s)
+		}
+	}
+
+	dp.Lock()
+	defer dp.Unlock()
+	cur, ok := dp.derived[id]
+	changed := !ok || string(cur.dataset) != string(dataset) || cur.as != as
+	dp.derived[id] = d
+	return changed, nil
+}
+
+// Materialize recomputes the data of the derived timeseries from the time from up to the time to, and replaces
+// its existing data in that range. Use -Inf and +Inf to recompute all of its data. The computed data is streamed
+// into the timeseries in the same transaction that removes the old data, so readers never see a partial range.
+func (dp *DerivedProcessor) Materialize(id string, from, to float64) error {
+	dp.Lock()
+	d, ok := dp.derived[id]
+	dp.Unlock()
+	if !ok {
+		return nil
+	}
+	db, err := dp.DB.As(d.as)
+	if err != nil {
+		return err
+	}
+	var ds Dataset
+	if err = json.Unmarshal(d.dataset, &ds); err != nil {
+		return err
+	}
+	// Datasets without a timezone are computed in the timezone of the derived timeseries' owner
+	if ds.Timezone == "" {
+		if ds.Timezone, err = userTimezone(db); err != nil {
+			return err
+		}
+	}
+	q := &Query{Timeseries: id}
+	if !math.IsInf(from, -1) {
+		if from, err = ds.from(from); err != nil {
+			return err
+		}
+		q.T1 = from
+	}
+	if !math.IsInf(to, 1) {
+		if to, err = ds.until(to); err != nil {
+			return err
+		}
+		q.T2 = to
+	}
+	di, err := ds.Get(db)
+	if err != nil {
+		return err
+	}
+	ii := NewInfoIterator(NewSortChecker(&TransformIterator{dpi: di, it: di}))
+	defer ii.Close()
+
+	tx, err := TSDB.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = TSDB.deleteTx(tx, q); err != nil {
+		return err
+	}
+	dpt, err := ii.Next()
+	if err != nil {
+		return err
+	}
+	if dpt != nil {
+		if err = TSDB.insertTx(tx, "timeseries", id, 0, dpt, ii); err != nil {
+			return err
+		}
+		ne := database.Date(time.Now().UTC())
+		err = dp.DB.UpdateObjectTx(tx, &database.Object{
+			Details: database.Details{
+				ID: id,
+			},
+			LastModified: &ne,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	// Other derived timeseries and dashboards that use this timeseries are updated in turn
+	fe := events.NewFilledHandler(dp.DB, events.GlobalHandler)
+	fe.Fire(&events.Event{
+		Event:  "timeseries_data_delete",
+		Object: id,
+		Data:   *q,
+	})
+	if ii.Count > 0 {
+		fe.Fire(&events.Event{
+			Event:  "timeseries_data_write",
+			Object: id,
+			Data: &TimeseriesWriteEvent{
+				T1:    ii.Tstart,
+				T2:    ii.Tend,
+				Count: ii.Count,
+			},
+		})
+	}
+	return nil
+}
+
+// Run loads changed derived timeseries and recomputes outdated ones until the processor is stopped
+func (dp *DerivedProcessor) Run() {
+	for {
+		select {
+		case <-dp.done:
+			return
+		case <-dp.wake:
+		}
+		for {
+			dp.Lock()
+			var id string
+			var r timeRange
+			isChanged := false
+			for id = range dp.changed {
+				isChanged = true
+				delete(dp.changed, id)
+				break
+			}
+			if !isChanged {
+				for id, r = range dp.pending {
+					delete(dp.pending, id)
+					break
+				}
+			}
+			dp.Unlock()
+			if id == "" {
+				break
+			}
+			log := logrus.WithFields(logrus.Fields{"plugin": PluginName, "object": id})
+
+			if isChanged {
+				changed, err := dp.load(id)
+				if err != nil {
+					dp.Lock()
+					delete(dp.derived, id)
+					dp.Unlock()
+					log.Errorf("Invalid derived timeseries: %v", err)
+				} else if changed {
+					dp.Rebuild(id)
+				}
+				continue
+			}
+			start := time.Now()
+			if err := dp.Materialize(id, r.t1, r.t2); err != nil {
+				log.Errorf("Failed to compute derived timeseries: %v", err)
+				continue
+			}
+			log.Debugf("Computed derived timeseries from %v to %v in %v", r.t1, r.t2, time.Since(start))
+		}
+	}
+}
+
+// Close stops the processor
+func (dp *DerivedProcessor) Close() {
+	close(dp.done)
+}
@@ -0,0 +1,182 @@
+package timeseries
+
+import (
+	"math"
+	"testing"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/events"
+	"github.com/stretchr/testify/require"
+)
+
+func createDerived(t *testing.T, adb *database.AdminDB, dataset map[string]interface{}) string {
+	oname := "derived"
+	otype := DerivedType
+	uname := "test"
+	id, err := adb.CreateObject(&database.Object{
+		Details: database.Details{
+			Name: &oname,
+		},
+		Type:  &otype,
+		Owner: &uname,
+		Meta:  &database.JSONObject{"dataset": dataset},
+	})
+	require.NoError(t, err)
+	return id
+}
+
+func TestDerived(t *testing.T) {
+	adb, oid1, _, cleanup := newDBWithObjects(t)
+	defer cleanup()
+	sd := TimeseriesDB{DB: adb,
+		BatchSize:             3,
+		MaxBatchSize:          5,
+		BatchCompressionLevel: 3}
+	TSDB = sd
+
+	did := createDerived(t, adb, map[string]interface{}{
+		"timeseries": oid1,
+		"transform":  "$*2",
+	})
+	dp, err := NewDerivedProcessor(adb)
+	require.NoError(t, err)
+
+	require.NoError(t, sd.Insert(oid1, NewDatapointArrayIterator(dpa6), &InsertQuery{}))
+	require.NoError(t, dp.Materialize(did, math.Inf(-1), math.Inf(1)))
+	cmpQuery(t, sd, &Query{Timeseries: did}, DatapointArray{
+		&Datapoint{Timestamp: 1, Data: 2.},
+		&Datapoint{Timestamp: 2, Data: 4.},
+		&Datapoint{Timestamp: 3, Data: 6.},
+		&Datapoint{Timestamp: 4, Data: 8.},
+		&Datapoint{Timestamp: 5, Data: 10.},
+	})
+
+	// Writing to the source only recomputes the data in the written range
+	require.NoError(t, sd.Insert(oid1, NewDatapointArrayIterator(DatapointArray{
+		&Datapoint{Timestamp: 6, Data: 6.},
+	}), &InsertQuery{}))
+	dp.Fire(&events.Event{
+		Event:  "timeseries_data_write",
+		Object: oid1,
+		Data:   &TimeseriesWriteEvent{T1: 6, T2: 6, Count: 1},
+	})
+	dp.Lock()
+	require.Equal(t, map[string]timeRange{did: {6, math.Nextafter(6, math.Inf(1))}}, dp.pending)
+	dp.pending = make(map[string]timeRange)
+	dp.Unlock()
+	require.NoError(t, dp.Materialize(did, 6, math.Nextafter(6, math.Inf(1))))
+	cmpQuery(t, sd, &Query{Timeseries: did, T1: 5.0}, DatapointArray{
+		&Datapoint{Timestamp: 5, Data: 10.},
+		&Datapoint{Timestamp: 6, Data: 12.},
+	})
+
+	// Data outside of the recomputed range is left as is
+	require.NoError(t, sd.Insert(did, NewDatapointArrayIterator(DatapointArray{
+		&Datapoint{Timestamp: 7, Data: 100.},
+	}), &InsertQuery{}))
+	require.NoError(t, sd.Insert(oid1, NewDatapointArrayIterator(DatapointArray{
+		&Datapoint{Timestamp: 3, Data: 30.},
+	}), &InsertQuery{}))
+	require.NoError(t, dp.Materialize(did, 3, 4))
+	cmpQuery(t, sd, &Query{Timeseries: did}, DatapointArray{
+		&Datapoint{Timestamp: 1, Data: 2.},
+		&Datapoint{Timestamp: 2, Data: 4.},
+		&Datapoint{Timestamp: 3, Data: 60.},
+		&Datapoint{Timestamp: 4, Data: 8.},
+		&Datapoint{Timestamp: 5, Data: 10.},
+		&Datapoint{Timestamp: 6, Data: 12.},
+		&Datapoint{Timestamp: 7, Data: 100.},
+	})
+	require.NoError(t, sd.Insert(oid1, NewDatapointArrayIterator(DatapointArray{
+		&Datapoint{Timestamp: 3, Data: 3.},
+	}), &InsertQuery{}))
+	require.NoError(t, dp.Materialize(did, math.Inf(-1), math.Inf(1)))
+
+	// Deleting data removes it from the derived timeseries
+	require.NoError(t, sd.Delete(&Query{Timeseries: oid1, T1: 4.0}))
+	dp.Fire(&events.Event{
+		Event:  "timeseries_data_delete",
+		Object: oid1,
+		Data:   Query{Timeseries: oid1, T1: 4.0},
+	})
+	dp.Lock()
+	require.Equal(t, map[string]timeRange{did: {4, math.Inf(1)}}, dp.pending)
+	dp.Unlock()
+	require.NoError(t, dp.Materialize(did, 4, math.Inf(1)))
+	cmpQuery(t, sd, &Query{Timeseries: did}, DatapointArray{
+		&Datapoint{Timestamp: 1, Data: 2.},
+		&Datapoint{Timestamp: 2, Data: 4.},
+		&Datapoint{Timestamp: 3, Data: 6.},
+	})
+	l, err := sd.Length(did, false)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, l)
+
+	// Events that arrive after the processor is stopped are ignored
+	go dp.Run()
+	dp.Close()
+	dp.Fire(&events.Event{
+		Event:  "timeseries_data_write",
+		Object: oid1,
+		Data:   &TimeseriesWriteEvent{T1: 6, T2: 6, Count: 1},
+	})
+}
+
+func TestDerivedCycle(t *testing.T) {
+	adb, oid1, _, cleanup := newDBWithObjects(t)
+	defer cleanup()
+	TSDB = TimeseriesDB{DB: adb,
+		BatchSize:             3,
+		MaxBatchSize:          5,
+		BatchCompressionLevel: 3}
+
+	did1 := createDerived(t, adb, map[string]interface{}{"timeseries": oid1})
+	did2 := createDerived(t, adb, map[string]interface{}{"timeseries": did1})
+	dp, err := NewDerivedProcessor(adb)
+	require.NoError(t, err)
+
+	// A derived timeseries can't be computed from itself
+	require.NoError(t, adb.UpdateObject(&database.Object{
+		Details: database.Details{ID: did1},
+		Meta:    &database.JSONObject{"dataset": map[string]interface{}{"timeseries": did1}},
+	}))
+	_, err = dp.load(did1)
+	require.Error(t, err)
+
+	// or from a derived timeseries that uses it
+	require.NoError(t, adb.UpdateObject(&database.Object{
+		Details: database.Details{ID: did1},
+		Meta:    &database.JSONObject{"dataset": map[string]interface{}{"timeseries": did2}},
+	}))
+	_, err = dp.load(did1)
+	require.Error(t, err)
+
+	// Only the time range of the dataset can be restricted
+	require.NoError(t, adb.UpdateObject(&database.Object{
+		Details: database.Details{ID: did1},
+		Meta:    &database.JSONObject{"dataset": map[string]interface{}{"timeseries": oid1, "limit": 2}},
+	}))
+	_, err = dp.load(did1)
+	require.Error(t, err)
+
+	// Relative times are resolved when the dataset is computed, so they can't be stored
+	require.NoError(t, adb.UpdateObject(&database.Object{
+		Details: database.Details{ID: did1},
+		Meta:    &database.JSONObject{"dataset": map[string]interface{}{"timeseries": oid1, "t1": "now-1d"}},
+	}))
+	_, err = dp.load(did1)
+	require.Error(t, err)
+	require.NoError(t, adb.UpdateObject(&database.Object{
+		Details: database.Details{ID: did1},
+		Meta: &database.JSONObject{"dataset": map[string]interface{}{"t1": "2020-03-08", "dt": "day", "tz": "America/New_York",
+			"dataset": map[string]interface{}{"x": map[string]interface{}{"timeseries": oid1, "t2": "today"}}}},
+	}))
+	_, err = dp.load(did1)
+	require.Error(t, err)
+	require.NoError(t, adb.UpdateObject(&database.Object{
+		Details: database.Details{ID: did1},
+		Meta:    &database.JSONObject{"dataset": map[string]interface{}{"timeseries": oid1, "t1": "2020-03-08", "t2": 1583668800.}},
+	}))
+	_, err = dp.load(did1)
+	require.NoError(t, err)
+}
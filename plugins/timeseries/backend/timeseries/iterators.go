@@ -66,10 +66,11 @@ func (c *ChanBatchIterator) NextBatch() (DatapointArray, error) {
 }
 
 func NewChanBatchIterator(di BatchIterator) *ChanBatchIterator {
-	closer := make(chan bool)
+	// The closer is buffered, so that closing doesn't block once the goroutine has finished
+	closer := make(chan bool, 1)
 	datapointer := make(chan DatapointArray, 5)
 	ci := &ChanBatchIterator{
-		closer:      make(chan bool, 1),
+		closer:      closer,
 		datapointer: datapointer,
 		err:         nil,
 	}
@@ -218,12 +219,12 @@ func (s *DataValidator) Next() (*Datapoint, error) {
 		return dp, err
 	}
 
-	result, err := s.schema.Validate(gojsonschema.NewGoLoader(dp.Data))
+	v, err := s.Violations(dp.Data)
 	if err != nil {
 		s.data.Close()
 		return dp, err
 	}
-	if !result.Valid() {
+	if v != nil {
 		s.data.Close()
 		return dp, errors.New("bad_query: The data failed schema validation")
 	}
@@ -231,6 +232,19 @@ func (s *DataValidator) Next() (*Datapoint, error) {
 	return dp, nil
 }
 
+// Violations returns the reasons that the data fails schema validation, or nil if the data is valid
+func (s *DataValidator) Violations(data interface{}) ([]string, error) {
+	result, err := s.schema.Validate(gojsonschema.NewGoLoader(data))
+	if err != nil || result.Valid() {
+		return nil, err
+	}
+	v := make([]string, len(result.Errors()))
+	for i, e := range result.Errors() {
+		v[i] = e.String()
+	}
+	return v, nil
+}
+
 // Close closes the underlying timeseries
 func (s *DataValidator) Close() error {
 	return s.data.Close()
@@ -326,10 +340,11 @@ func (c *ChanIterator) Next() (*Datapoint, error) {
 }
 
 func NewChanIterator(di DatapointIterator) *ChanIterator {
-	closer := make(chan bool)
+	// The closer is buffered, so that closing doesn't block once the goroutine has finished
+	closer := make(chan bool, 1)
 	datapointer := make(chan *Datapoint, 10000)
 	ci := &ChanIterator{
-		closer:      make(chan bool, 1),
+		closer:      closer,
 		datapointer: datapointer,
 		err:         nil,
 	}
@@ -0,0 +1,121 @@
+package timeseries
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/heedy/heedy/backend/database"
+)
+
+// sqlUploadsSchema is added in version 5 of the timeseries database. It holds the idempotency keys of inserts,
+// so that retried uploads are not written twice.
+const sqlUploadsSchema = `
+CREATE TABLE timeseries_uploads (
+	tsid VARCHAR(36) NOT NULL,
+	key VARCHAR NOT NULL,
+	timestamp REAL NOT NULL,
+
+	PRIMARY KEY (tsid,key),
+	CONSTRAINT timeseries_fk
+		FOREIGN KEY(tsid)
+		REFERENCES objects(id)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE
+);
+`
+
+// InsertResult gives the number of datapoints of an insert that were written. Only merge inserts distinguish
+// replaced and skipped datapoints - other methods count all written datapoints as inserted.
+type InsertResult struct {
+	Inserted int `json:"inserted"`
+	Replaced int `json:"replaced"`
+	Skipped  int `json:"skipped"`
+}
+
+// addUploadKey records the idempotency key of an insert, and returns true if the key was already used for the timeseries.
+// Keys older than the upload key expiration are removed.
+func (ts *TimeseriesDB) addUploadKey(tx database.TxWrapper, tsid, key string) (bool, error) {
+	now := float64(time.Now().UnixNano()) * 1e-9
+	if ts.UploadKeyExpiration > 0 {
+		if _, err := tx.Exec("DELETE FROM timeseries_uploads WHERE tsid=? AND timestamp<?", tsid, now-ts.UploadKeyExpiration); err != nil {
+			return false, err
+		}
+	}
+	r, err := tx.Exec("INSERT OR IGNORE INTO timeseries_uploads(tsid,key,timestamp) VALUES (?,?,?)", tsid, key, now)
+	if err != nil {
+		return false, err
+	}
+	n, err := r.RowsAffected()
+	return n == 0, err
+}
+
+// merge upserts the data starting at dp by exact timestamp: datapoints with the same timestamp as an existing
+// datapoint replace it, and existing datapoints that are not in the data are kept.
+func (ts *TimeseriesDB) merge(tx database.TxWrapper, table, tsid string, dp *Datapoint, data DatapointIterator, res *InsertResult) error {
+	upload := DatapointArray{}
+	var err error
+	for ; dp != nil; dp, err = data.Next() {
+		upload = append(upload, dp)
+	}
+	if err != nil {
+		return err
+	}
+	// The data was checked to be sorted without intersecting durations, so the last datapoint ends last
+	t1, t2 := upload[0].Timestamp, upload[len(upload)-1].EndTime()
+
+	// Read all existing datapoints within the range of the data
+	rows, err := tx.Queryx(fmt.Sprintf("SELECT data FROM %s WHERE tsid=? AND tend>=? AND tstart<=? ORDER BY tstart ASC", table), tsid, t1, t2)
+	if err != nil {
+		return err
+	}
+	bi := SQLBatchIterator{rows, nil}
+	existing := DatapointArray{}
+	for {
+		batch, err := bi.NextBatch()
+		if err != nil {
+			bi.Close()
+			return err
+		}
+		if batch == nil {
+			break
+		}
+		for _, edp := range batch {
+			if edp.Timestamp >= t1 && edp.Timestamp <= t2 || edp.Timestamp < t1 && edp.EndTime() > t1 {
+				existing = append(existing, edp)
+			}
+		}
+	}
+	bi.Close()
+
+	merged := make(DatapointArray, 0, len(existing)+len(upload))
+	i := 0
+	for _, udp := range upload {
+		for ; i < len(existing) && existing[i].Timestamp < udp.Timestamp; i++ {
+			merged = append(merged, existing[i])
+		}
+		if i < len(existing) && existing[i].Timestamp == udp.Timestamp {
+			if existing[i].IsEqual(udp) {
+				res.Skipped++
+			} else {
+				res.Replaced++
+			}
+			i++
+		} else {
+			res.Inserted++
+		}
+		merged = append(merged, udp)
+	}
+	merged = append(merged, existing[i:]...)
+	if res.Inserted+res.Replaced == 0 {
+		return nil
+	}
+	for j := 1; j < len(merged); j++ {
+		if merged[j-1].EndTime() > merged[j].Timestamp {
+			return errors.New("bad_query: merged datapoints must not intersect the durations of existing datapoints")
+		}
+	}
+
+	// Updating the range with the merged data replaces exactly the existing datapoints that were read
+	return ts.insertTx(tx, table, tsid, 0, merged[0], NewDatapointArrayIterator(merged[1:]))
+}
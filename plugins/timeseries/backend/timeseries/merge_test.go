@@ -0,0 +1,66 @@
+package timeseries
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+	adb, oid1, _, cleanup := newDBWithObjects(t)
+	defer cleanup()
+	sd := TimeseriesDB{DB: adb,
+		BatchSize:             2,
+		MaxBatchSize:          3,
+		BatchCompressionLevel: 2}
+
+	merge := "merge"
+	require.NoError(t, sd.Insert(oid1, NewDatapointArrayIterator(dpa6), &InsertQuery{}))
+
+	// Existing datapoints that are not in the upload are kept, and identical datapoints are skipped
+	res, err := sd.Write(oid1, NewDatapointArrayIterator(DatapointArray{
+		&Datapoint{Timestamp: 1.5, Data: 1.5},
+		&Datapoint{Timestamp: 3, Data: 3.},
+		&Datapoint{Timestamp: 4, Data: 40.},
+		&Datapoint{Timestamp: 6, Data: 6.},
+	}), &InsertQuery{Method: &merge})
+	require.NoError(t, err)
+	require.Equal(t, &InsertResult{Inserted: 2, Replaced: 1, Skipped: 1}, res)
+	cmpQuery(t, sd, &Query{Timeseries: oid1}, DatapointArray{
+		&Datapoint{Timestamp: 1, Data: 1.},
+		&Datapoint{Timestamp: 1.5, Data: 1.5},
+		&Datapoint{Timestamp: 2, Data: 2.},
+		&Datapoint{Timestamp: 3, Data: 3.},
+		&Datapoint{Timestamp: 4, Data: 40.},
+		&Datapoint{Timestamp: 5, Data: 5.},
+		&Datapoint{Timestamp: 6, Data: 6.},
+	})
+
+	// Datapoints whose durations would intersect existing datapoints are not merged
+	_, err = sd.Write(oid1, NewDatapointArrayIterator(DatapointArray{&Datapoint{Timestamp: 4.5, Duration: 1, Data: 4.5}}), &InsertQuery{Method: &merge})
+	require.Error(t, err)
+
+	// Retrying an upload with the same key skips it
+	key := "upload1"
+	upload := DatapointArray{&Datapoint{Timestamp: 2, Data: 20.}, &Datapoint{Timestamp: 7, Data: 7.}}
+	res, err = sd.Write(oid1, NewDatapointArrayIterator(upload), &InsertQuery{Method: &merge, Key: &key})
+	require.NoError(t, err)
+	require.Equal(t, &InsertResult{Inserted: 1, Replaced: 1}, res)
+	require.NoError(t, sd.Insert(oid1, NewDatapointArrayIterator(DatapointArray{&Datapoint{Timestamp: 2, Data: 2.}}), &InsertQuery{}))
+	res, err = sd.Write(oid1, NewDatapointArrayIterator(upload), &InsertQuery{Method: &merge, Key: &key})
+	require.NoError(t, err)
+	require.Equal(t, &InsertResult{Skipped: 2}, res)
+	cmpQuery(t, sd, &Query{Timeseries: oid1, T1: 2., T2: 2.5}, DatapointArray{&Datapoint{Timestamp: 2, Data: 2.}})
+
+	// Expired keys can be used again
+	sd.UploadKeyExpiration = 1
+	_, err = adb.Exec("UPDATE timeseries_uploads SET timestamp=timestamp-10")
+	require.NoError(t, err)
+	res, err = sd.Write(oid1, NewDatapointArrayIterator(upload), &InsertQuery{Method: &merge, Key: &key})
+	require.NoError(t, err)
+	require.Equal(t, &InsertResult{Replaced: 1, Skipped: 1}, res)
+
+	l, err := sd.Length(oid1, false)
+	require.NoError(t, err)
+	require.EqualValues(t, 8, l)
+}
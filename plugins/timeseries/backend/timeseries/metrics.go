@@ -0,0 +1,83 @@
+package timeseries
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	insertsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "heedy_timeseries_inserts_total",
+		Help: "The number of timeseries inserts, by result",
+	}, []string{"result"})
+	insertedDatapoints = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "heedy_timeseries_inserted_datapoints_total",
+		Help: "The number of datapoints written to timeseries",
+	})
+	queriesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "heedy_timeseries_queries_total",
+		Help: "The number of timeseries queries",
+	})
+	readDatapoints = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "heedy_timeseries_read_datapoints_total",
+		Help: "The number of datapoints returned by timeseries queries",
+	})
+	batchesWritten = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "heedy_timeseries_batches_written_total",
+		Help: "The number of datapoint batches written to the database",
+	})
+
+	batchesDesc = prometheus.NewDesc("heedy_timeseries_batches",
+		"The number of datapoint batches stored in the database",
+		[]string{"table"}, nil)
+	datapointsDesc = prometheus.NewDesc("heedy_timeseries_datapoints",
+		"The number of datapoints stored in the database",
+		[]string{"table"}, nil)
+)
+
+// countIterator counts the datapoints that pass through it
+type countIterator struct {
+	DatapointIterator
+	counter prometheus.Counter
+	n       int
+}
+
+func (ci *countIterator) Next() (*Datapoint, error) {
+	dp, err := ci.DatapointIterator.Next()
+	if dp != nil {
+		ci.n++
+		if ci.counter != nil {
+			ci.counter.Inc()
+		}
+	}
+	return dp, err
+}
+
+// batchCollector reports the amount of data stored in the timeseries tables
+type batchCollector struct{}
+
+func (batchCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- batchesDesc
+	ch <- datapointsDesc
+}
+
+func (batchCollector) Collect(ch chan<- prometheus.Metric) {
+	if TSDB.DB == nil {
+		// The plugin was not started
+		return
+	}
+	for _, table := range []string{"timeseries", "timeseries_actions"} {
+		var res struct {
+			Batches    int64 `db:"batches"`
+			Datapoints int64 `db:"datapoints"`
+		}
+		err := TSDB.DB.Get(&res, "SELECT COUNT(*) AS batches, COALESCE(SUM(length),0) AS datapoints FROM "+table)
+		if err != nil {
+			logrus.WithField("plugin", PluginName).Warnf("Failed to get batch metrics: %s", err)
+			return
+		}
+		ch <- prometheus.MustNewConstMetric(batchesDesc, prometheus.GaugeValue, float64(res.Batches), table)
+		ch <- prometheus.MustNewConstMetric(datapointsDesc, prometheus.GaugeValue, float64(res.Datapoints), table)
+	}
+}
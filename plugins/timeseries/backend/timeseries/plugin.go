@@ -4,11 +4,13 @@ import (
 	"errors"
 
 	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/events"
 	"github.com/heedy/heedy/backend/plugins/run"
 	"github.com/heedy/pipescript/datasets/interpolators"
 	"github.com/heedy/pipescript/transforms"
 	"github.com/klauspost/compress/zstd"
 	"github.com/mitchellh/mapstructure"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 )
 
@@ -22,26 +24,63 @@ func SQLUpdater(db *database.AdminDB, i *run.Info, h run.BuiltinHelper, curversi
 	if curversion == SQLVersion {
 		return nil
 	}
-	if curversion != 0 {
+	if curversion > SQLVersion {
 		return errors.New("Timeseries database version incompatible")
 	}
-	_, err := db.ExecUncached(sqlSchema)
+	if curversion == 0 {
+		if _, err := db.ExecUncached(sqlSchema); err != nil {
+			return err
+		}
+	}
+	if curversion < 2 {
+		// Version 2 adds the rules that run on timeseries writes
+		if _, err := db.ExecUncached(sqlRulesSchema); err != nil {
+			return err
+		}
+	}
+	if curversion < 3 {
+		// Version 3 adds alerts that notify the owner of a timeseries
+		if _, err := db.ExecUncached(sqlAlertsSchema); err != nil {
+			return err
+		}
+	}
+	if curversion < 4 {
+		// Version 4 records the compression level of batches, so that compaction can recompress them
+		if _, err := db.ExecUncached(sqlCompressionSchema); err != nil {
+			return err
+		}
+	}
+	if curversion < 5 {
+		// Version 5 adds the idempotency keys of inserts
+		if _, err := db.ExecUncached(sqlUploadsSchema); err != nil {
+			return err
+		}
+	}
+	if curversion < 6 {
+		// Version 6 adds the users' settings, such as their timezone
+		if _, err := db.ExecUncached(sqlSettingsSchema); err != nil {
+			return err
+		}
+	}
+	if curversion < 7 {
+		// Version 7 adds the annotations of timeseries
+		if _, err := db.ExecUncached(sqlAnnotationsSchema); err != nil {
+			return err
+		}
+	}
+	// Version 8 records the codec of batches
+	_, err := db.ExecUncached(sqlCodecSchema)
 	return err
 }
 
-// StartTimeseries prepares the plugin by initializing the database
-func StartTimeseries(db *database.AdminDB, i *run.Info, h run.BuiltinHelper) error {
-	err := run.WithVersion(PluginName, SQLVersion, SQLUpdater)(db, i, h)
-	if err != nil {
-		return err
-	}
-
-	tsc, ok := db.Assets().Config.Plugins["timeseries"]
+// configure sets up the global timeseries DB from the plugin's settings
+func configure(db *database.AdminDB) error {
+	tsc, ok := db.Assets().GetConfig().Plugins["timeseries"]
 	if !ok {
 		return errors.New("Could not find timeseries plugin configuration")
 	}
 
-	err = mapstructure.Decode(tsc.Settings, &TSDB)
+	err := mapstructure.Decode(tsc.Settings, &TSDB)
 	if err != nil {
 		return err
 	}
@@ -58,9 +97,69 @@ func StartTimeseries(db *database.AdminDB, i *run.Info, h run.BuiltinHelper) err
 		return errors.New("Timeseries currently doesn't support compression rates > 3")
 	} else {
 		zencoder, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevel(TSDB.BatchCompressionLevel)))
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	return err
+// StartTimeseries prepares the plugin by initializing the database
+func StartTimeseries(db *database.AdminDB, i *run.Info, h run.BuiltinHelper) error {
+	err := run.WithVersion(PluginName, SQLVersion, SQLUpdater)(db, i, h)
+	if err != nil {
+		return err
+	}
+
+	if err = configure(db); err != nil {
+		return err
+	}
+
+	// Derived timeseries are recomputed when their sources change
+	Derived, err = NewDerivedProcessor(db)
+	if err != nil {
+		return err
+	}
+	events.AddHandler(Derived)
+	go Derived.Run()
+
+	// Rules run on the data written to timeseries
+	Rules, err = NewRuleProcessor(db)
+	if err != nil {
+		return err
+	}
+	events.AddHandler(Rules)
+	go Rules.Run()
+
+	// Alerts are evaluated when data is written, and missing data is checked by the timeseries_alerts job
+	Alerts, err = NewAlertProcessor(db)
+	if err != nil {
+		return err
+	}
+	events.AddHandler(Alerts)
+	go Alerts.Run()
+
+	return nil
+}
+
+// StopTimeseries stops materializing derived timeseries, running rules and evaluating alerts
+func StopTimeseries(db *database.AdminDB, apikey string) error {
+	if Derived != nil {
+		events.RemoveHandler(Derived)
+		Derived.Close()
+		Derived = nil
+	}
+	if Rules != nil {
+		events.RemoveHandler(Rules)
+		Rules.Close()
+		Rules = nil
+	}
+	if Alerts != nil {
+		events.RemoveHandler(Alerts)
+		Alerts.Close()
+		Alerts = nil
+	}
+	return nil
 }
 
 // This is not needed for normal plugins. The init simply registers the plugin with heedy internals
@@ -70,12 +169,26 @@ func init() {
 	transforms.Register()
 	interpolators.Register()
 
+	// Report the stored batches in heedy's metrics
+	prometheus.MustRegister(batchCollector{})
+
 	// Initialize the plugin
 	run.Builtin.Add(&run.BuiltinRunner{
 		Key:     PluginName,
 		Start:   StartTimeseries,
+		Stop:    StopTimeseries,
 		Handler: Handler,
 	})
+	run.Builtin.Add(&run.BuiltinRunner{
+		Key:   "timeseries_alerts",
+		Start: StartAlerts,
+	})
+	run.Builtin.Add(&run.BuiltinRunner{
+		Key:   "timeseries_compact",
+		Start: StartCompaction,
+	})
+	// Schema changes through object updates are checked against the existing data
+	database.AddObjectUpdateHook("timeseries", checkSchemaUpdate)
 	// Runs schema creation on database create instead of on first start
 	database.AddCreateHook(run.WithNilInfo(run.WithVersion(PluginName, SQLVersion, SQLUpdater)))
 }
@@ -0,0 +1,135 @@
+package timeseries
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// decodePool bounds the number of batches that are decompressed at the same time, across all running queries.
+// Each query reads its raw batches in order, and hands them to the pool to be decompressed ahead of the consumer,
+// so that the timeseries merged in a dataset are decompressed in parallel instead of one after the other.
+type decodePool chan struct{}
+
+type decodedBatch struct {
+	da  DatapointArray
+	err error
+}
+
+var (
+	poolLock    sync.Mutex
+	decodePools = make(map[int]decodePool)
+)
+
+// getDecodePool returns the shared pool with the given number of workers. 0 uses the number of CPUs.
+func getDecodePool(workers int) decodePool {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	poolLock.Lock()
+	defer poolLock.Unlock()
+	p, ok := decodePools[workers]
+	if !ok {
+		p = make(decodePool, workers)
+		decodePools[workers] = p
+	}
+	return p
+}
+
+// decode decompresses the batch once a worker is free, and sends the result to res
+func (p decodePool) decode(raw []byte, res chan<- decodedBatch) {
+	p <- struct{}{}
+	go func() {
+		da, err := DatapointArrayFromBytes(raw)
+		<-p
+		res <- decodedBatch{da, err}
+	}()
+}
+
+// ReadAheadIterator reads the raw batches returned by a query in a goroutine, and decompresses up to depth
+// batches ahead of the consumer in a decodePool. The batches are returned in the order of the query.
+type ReadAheadIterator struct {
+	batches chan chan decodedBatch
+	stop    chan struct{}
+	done    bool
+	closed  bool
+}
+
+// NewReadAheadIterator starts reading the query's rows, which contain only the batch data. The closer is called
+// once the rows are closed, either because they were all read, or because the iterator was closed.
+func NewReadAheadIterator(rows *sqlx.Rows, closer func(), pool decodePool, depth int) *ReadAheadIterator {
+	if depth < 1 {
+		depth = 1
+	}
+	ri := &ReadAheadIterator{
+		batches: make(chan chan decodedBatch, depth),
+		stop:    make(chan struct{}),
+	}
+	batches, stop := ri.batches, ri.stop
+	go func() {
+		defer func() {
+			rows.Close()
+			if closer != nil {
+				closer()
+			}
+			close(batches)
+		}()
+		for rows.Next() {
+			res := make(chan decodedBatch, 1)
+			// Scanning into a byte slice copies the data, so it stays valid after the next row is read
+			var raw []byte
+			if err := rows.Scan(&raw); err != nil {
+				res <- decodedBatch{nil, err}
+			} else {
+				pool.decode(raw, res)
+			}
+			select {
+			case batches <- res:
+			case <-stop:
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			res := make(chan decodedBatch, 1)
+			res <- decodedBatch{nil, err}
+			select {
+			case batches <- res:
+			case <-stop:
+			}
+		}
+	}()
+	return ri
+}
+
+// NextBatch returns the next decompressed batch, or nil once all batches were read
+func (ri *ReadAheadIterator) NextBatch() (DatapointArray, error) {
+	if ri.done {
+		return nil, nil
+	}
+	res, ok := <-ri.batches
+	if !ok {
+		ri.done = true
+		return nil, nil
+	}
+	b := <-res
+	if b.err != nil {
+		ri.done = true
+		ri.Close()
+	}
+	return b.da, b.err
+}
+
+// Close stops reading batches. The batches that are already being decompressed are discarded.
+func (ri *ReadAheadIterator) Close() error {
+	if !ri.closed {
+		close(ri.stop)
+		ri.closed = true
+	}
+	return nil
+}
+
+// readAhead returns an iterator over the batches of the query's rows, using the configured concurrency
+func (ts *TimeseriesDB) readAhead(rows *sqlx.Rows, closer func()) BatchIterator {
+	return NewReadAheadIterator(rows, closer, getDecodePool(ts.QueryWorkers), ts.ReadAhead)
+}
@@ -1,6 +1,7 @@
 package timeseries
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"io"
@@ -37,6 +38,14 @@ func GetTimeseriesInfo(r *http.Request) (*TimeseriesInfo, error) {
 	if err != nil {
 		return nil, err
 	}
+	if si.Type == DerivedType {
+		// Derived timeseries don't accept actions, and their data was already validated when written to their sources
+		schemaMap, _ := si.Meta["schema"].(map[string]interface{})
+		return &TimeseriesInfo{
+			ObjectInfo: *si,
+			Schema:     schemaMap,
+		}, nil
+	}
 	schemaInterface, ok := si.Meta["schema"]
 	if !ok {
 		return nil, plugin.ErrPlugin("Timeseries metadata does not include schema")
@@ -60,15 +69,18 @@ func GetTimeseriesInfo(r *http.Request) (*TimeseriesInfo, error) {
 	}, nil
 }
 
-func validateRequest(w http.ResponseWriter, r *http.Request, scope string) (*TimeseriesInfo, bool) {
+// validateRequest returns the info of the requested timeseries, writing an error if the request doesn't have all of the given scopes
+func validateRequest(w http.ResponseWriter, r *http.Request, scopes ...string) (*TimeseriesInfo, bool) {
 	si, err := GetTimeseriesInfo(r)
 	if err != nil {
 		rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
 		return nil, false
 	}
-	if !si.ObjectInfo.Access.HasScope(scope) {
-		rest.WriteJSONError(w, r, http.StatusForbidden, database.ErrAccessDenied("Insufficient permissions"))
-		return nil, false
+	for _, scope := range scopes {
+		if !si.ObjectInfo.Access.HasScope(scope) {
+			rest.WriteJSONError(w, r, http.StatusForbidden, database.ErrAccessDenied("Insufficient permissions"))
+			return nil, false
+		}
 	}
 	return si, true
 }
@@ -98,6 +110,23 @@ func decodeQuery(r *http.Request) (Query, error) {
 	return q.Query, nil
 }
 
+// withUserTimezone sets the timezone of a query that doesn't have one to the timezone of the user making the request
+func withUserTimezone(db database.DB, q *Query) (err error) {
+	if q.Timezone == "" {
+		q.Timezone, err = userTimezone(db)
+	}
+	return
+}
+
+// withAnnotations wraps the JSON array of a query's results in an object that also holds the given annotations
+func withAnnotations(data io.Reader, annotations []Annotation) (io.Reader, error) {
+	b, err := json.Marshal(annotations)
+	if err != nil {
+		return nil, err
+	}
+	return io.MultiReader(strings.NewReader(`{"data":`), data, strings.NewReader(`,"annotations":`), bytes.NewReader(b), strings.NewReader(`}`)), nil
+}
+
 func ReadData(w http.ResponseWriter, r *http.Request, action bool) {
 	c := rest.CTX(r)
 	si, ok := validateRequest(w, r, "read")
@@ -121,6 +150,18 @@ func ReadData(w http.ResponseWriter, r *http.Request, action bool) {
 		return
 	}
 	q.Timeseries = si.ObjectInfo.ID
+	if err = withUserTimezone(c.DB, &q); err != nil {
+		rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	var annotations []Annotation
+	if q.Annotations != nil && *q.Annotations {
+		if annotations, err = queryAnnotations(c.DB.AdminDB(), &q, []string{q.Timeseries}); err != nil {
+			rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
 
 	di, err := TSDB.Query(&q)
 	if err != nil {
@@ -134,14 +175,21 @@ func ReadData(w http.ResponseWriter, r *http.Request, action bool) {
 		return
 	}
 	defer ai.Close()
+	var res io.Reader = ai
+	if annotations != nil {
+		if res, err = withAnnotations(ai, annotations); err != nil {
+			rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
 	if TSDB.CompressQueryResponse {
-		err = rest.WriteCompressAsync(w, r, ai, http.StatusOK)
+		err = rest.WriteCompressAsync(w, r, res, http.StatusOK)
 	} else {
 		w.WriteHeader(http.StatusOK)
-		_, err = io.Copy(w, ai)
+		_, err = io.Copy(w, res)
 	}
 
 	if err != nil {
@@ -160,6 +208,10 @@ func DeleteData(w http.ResponseWriter, r *http.Request, action bool) {
 		rest.WriteJSONError(w, r, http.StatusBadRequest, ErrNotActor)
 		return
 	}
+	if si.Type == DerivedType {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, ErrDerived)
+		return
+	}
 	q, err := decodeQuery(r)
 	if err != nil {
 		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
@@ -171,6 +223,10 @@ func DeleteData(w http.ResponseWriter, r *http.Request, action bool) {
 		return
 	}
 	q.Timeseries = si.ObjectInfo.ID
+	if err = withUserTimezone(c.DB, &q); err != nil {
+		rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
+		return
+	}
 
 	err = TSDB.Delete(&q)
 	if err == nil {
@@ -203,6 +259,12 @@ type TimeseriesWriteEvent struct {
 	DP    *Datapoint `json:"dp,omitempty"`
 }
 
+// writeResult is returned when writing data, and extends the usual {"result":"ok"} with the datapoint counts
+type writeResult struct {
+	Result string `json:"result"`
+	*InsertResult
+}
+
 //UnmarshalEasyRequestNoLimit unmarshals the input data to the given interface without limiting request size
 // This should be replaced at some point probably...
 func UnmarshalEasyRequestNoLimit(request *http.Request, unmarshalTo easyjson.Unmarshaler) error {
@@ -231,6 +293,10 @@ func WriteData(w http.ResponseWriter, r *http.Request, action bool) {
 		rest.WriteJSONError(w, r, http.StatusBadRequest, ErrNotActor)
 		return
 	}
+	if si.Type == DerivedType {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, ErrDerived)
+		return
+	}
 	var iq InsertQuery
 	err := queryDecoder.Decode(&iq, r.URL.Query())
 	if err != nil {
@@ -285,8 +351,8 @@ func WriteData(w http.ResponseWriter, r *http.Request, action bool) {
 	}
 
 	ii := NewInfoIterator(NewDatapointArrayIterator(datapoints))
-	err = TSDB.Insert(si.ObjectInfo.ID, ii, &iq)
-	if err == nil && ii.Count > 0 {
+	res, err := TSDB.Write(si.ObjectInfo.ID, ii, &iq)
+	if err == nil && res.Inserted+res.Replaced > 0 {
 		if shouldUpdateModifed(si.LastModified) {
 			ne := database.Date(time.Now().UTC())
 			// The timeseries is now non-empty, so label it as such
@@ -313,7 +379,7 @@ func WriteData(w http.ResponseWriter, r *http.Request, action bool) {
 		})
 	}
 
-	rest.WriteResult(w, r, err)
+	rest.WriteJSON(w, r, &writeResult{"ok", res}, err)
 }
 
 func DataLength(w http.ResponseWriter, r *http.Request, action bool) {
@@ -329,6 +395,392 @@ func DataLength(w http.ResponseWriter, r *http.Request, action bool) {
 	rest.WriteJSON(w, r, l, err)
 }
 
+// Rebuild recomputes all of the data of a derived timeseries
+func Rebuild(w http.ResponseWriter, r *http.Request) {
+	si, ok := validateRequest(w, r, "write")
+	if !ok {
+		return
+	}
+	if si.Type != DerivedType {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("bad_request: Only derived timeseries can be rebuilt"))
+		return
+	}
+	dp := Derived
+	if dp == nil {
+		rest.WriteJSONError(w, r, http.StatusServiceUnavailable, errors.New("plugin_error: Derived timeseries are not being computed"))
+		return
+	}
+	dp.Rebuild(si.ID)
+	rest.WriteResult(w, r, nil)
+}
+
+// ChangeSchemaHandler checks the timeseries' data against a new schema, and changes the schema unless it is a dry run
+func ChangeSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	si, ok := validateRequest(w, r, "read")
+	if !ok {
+		return
+	}
+	if si.Type == DerivedType {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, ErrDerived)
+		return
+	}
+	var sc SchemaChange
+	if err := rest.UnmarshalRequest(r, &sc); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if !sc.DryRun {
+		// Changing the schema modifies the object's metadata, and a transform also rewrites its data
+		if !si.Access.HasScope("update") && !si.Access.HasScope("update:basic") || sc.Transform != nil && !si.Access.HasScope("write") {
+			rest.WriteJSONError(w, r, http.StatusForbidden, database.ErrAccessDenied("Insufficient permissions"))
+			return
+		}
+	}
+	check, err := TSDB.ChangeSchema(si.ID, &sc)
+	if err == nil && check.replaced != nil {
+		c.Events.Fire(&events.Event{
+			Event:  "timeseries_data_delete",
+			Object: si.ID,
+			Data:   *check.replaced,
+		})
+	}
+	if err == nil && check.last != nil {
+		c.Events.Fire(&events.Event{
+			Event:  "timeseries_data_write",
+			Object: si.ID,
+			Data: &TimeseriesWriteEvent{
+				T1:    check.t1,
+				T2:    check.t2,
+				Count: int64(check.Datapoints),
+				DP:    check.last,
+			},
+		})
+	}
+	rest.WriteJSON(w, r, check, err)
+}
+
+// ReadRulesHandler returns the rules of the timeseries
+func ReadRulesHandler(w http.ResponseWriter, r *http.Request) {
+	si, ok := validateRequest(w, r, "read")
+	if !ok {
+		return
+	}
+	rules, err := ReadRules(rest.CTX(r).DB.AdminDB(), si.ID)
+	rest.WriteJSON(w, r, rules, err)
+}
+
+// CreateRuleHandler adds a rule to the timeseries, and returns the new rule. Since the rule reads
+// the timeseries, creating it requires both the read and write scopes.
+func CreateRuleHandler(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	si, ok := validateRequest(w, r, "read", "write")
+	if !ok {
+		return
+	}
+	var rule Rule
+	err := rest.UnmarshalRequest(r, &rule)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if rule.Timeseries != "" && rule.Timeseries != si.ID {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("bad_request: timeseries is set automatically"))
+		return
+	}
+	rule.Timeseries = si.ID
+	rid, err := CreateRule(c.DB, &rule)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	nr, err := ReadRule(c.DB.AdminDB(), si.ID, rid)
+	rest.WriteJSON(w, r, nr, err)
+}
+
+// ReadRuleHandler returns a single rule of the timeseries
+func ReadRuleHandler(w http.ResponseWriter, r *http.Request) {
+	si, ok := validateRequest(w, r, "read")
+	if !ok {
+		return
+	}
+	rule, err := ReadRule(rest.CTX(r).DB.AdminDB(), si.ID, chi.URLParam(r, "ruleid"))
+	rest.WriteJSON(w, r, rule, err)
+}
+
+// UpdateRuleHandler modifies a rule of the timeseries, which requires the read and write scopes
+func UpdateRuleHandler(w http.ResponseWriter, r *http.Request) {
+	si, ok := validateRequest(w, r, "read", "write")
+	if !ok {
+		return
+	}
+	var rule Rule
+	err := rest.UnmarshalRequest(r, &rule)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	rid := chi.URLParam(r, "ruleid")
+	if rule.ID != "" && rule.ID != rid || rule.Timeseries != "" && rule.Timeseries != si.ID {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("bad_request: The rule's id and timeseries can't be modified"))
+		return
+	}
+	rule.ID = rid
+	rule.Timeseries = si.ID
+	rest.WriteResult(w, r, UpdateRule(rest.CTX(r).DB, &rule))
+}
+
+// DeleteRuleHandler removes a rule from the timeseries
+func DeleteRuleHandler(w http.ResponseWriter, r *http.Request) {
+	si, ok := validateRequest(w, r, "write")
+	if !ok {
+		return
+	}
+	rest.WriteResult(w, r, DeleteRule(rest.CTX(r).DB.AdminDB(), si.ID, chi.URLParam(r, "ruleid")))
+}
+
+// ReadAlertsHandler returns the alerts of the timeseries
+func ReadAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	si, ok := validateRequest(w, r, "read")
+	if !ok {
+		return
+	}
+	alerts, err := ReadAlerts(rest.CTX(r).DB.AdminDB(), si.ID)
+	rest.WriteJSON(w, r, alerts, err)
+}
+
+// CreateAlertHandler adds an alert to the timeseries, and returns the new alert
+func CreateAlertHandler(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	si, ok := validateRequest(w, r, "write")
+	if !ok {
+		return
+	}
+	var alert Alert
+	err := rest.UnmarshalRequest(r, &alert)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if alert.Timeseries != "" && alert.Timeseries != si.ID {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("bad_request: timeseries is set automatically"))
+		return
+	}
+	alert.Timeseries = si.ID
+	aid, err := CreateAlert(c.DB.AdminDB(), &alert)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	na, err := ReadAlert(c.DB.AdminDB(), si.ID, aid)
+	rest.WriteJSON(w, r, na, err)
+}
+
+// ReadAlertHandler returns a single alert of the timeseries
+func ReadAlertHandler(w http.ResponseWriter, r *http.Request) {
+	si, ok := validateRequest(w, r, "read")
+	if !ok {
+		return
+	}
+	alert, err := ReadAlert(rest.CTX(r).DB.AdminDB(), si.ID, chi.URLParam(r, "alertid"))
+	rest.WriteJSON(w, r, alert, err)
+}
+
+// UpdateAlertHandler modifies an alert of the timeseries
+func UpdateAlertHandler(w http.ResponseWriter, r *http.Request) {
+	si, ok := validateRequest(w, r, "write")
+	if !ok {
+		return
+	}
+	var alert Alert
+	err := rest.UnmarshalRequest(r, &alert)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	aid := chi.URLParam(r, "alertid")
+	if alert.ID != "" && alert.ID != aid || alert.Timeseries != "" && alert.Timeseries != si.ID {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("bad_request: The alert's id and timeseries can't be modified"))
+		return
+	}
+	alert.ID = aid
+	alert.Timeseries = si.ID
+	rest.WriteResult(w, r, UpdateAlert(rest.CTX(r).DB.AdminDB(), &alert))
+}
+
+// DeleteAlertHandler removes an alert from the timeseries
+func DeleteAlertHandler(w http.ResponseWriter, r *http.Request) {
+	si, ok := validateRequest(w, r, "write")
+	if !ok {
+		return
+	}
+	rest.WriteResult(w, r, DeleteAlert(rest.CTX(r).DB.AdminDB(), si.ID, chi.URLParam(r, "alertid")))
+}
+
+// ReadAnnotationsHandler returns the annotations of the timeseries in the queried time range
+func ReadAnnotationsHandler(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	si, ok := validateRequest(w, r, "read")
+	if !ok {
+		return
+	}
+	q, err := decodeQuery(r)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err = withUserTimezone(c.DB, &q); err != nil {
+		rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	annotations, err := queryAnnotations(c.DB.AdminDB(), &q, []string{si.ID})
+	rest.WriteJSON(w, r, annotations, err)
+}
+
+// CreateAnnotationHandler adds an annotation to the timeseries, and returns the new annotation
+func CreateAnnotationHandler(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	si, ok := validateRequest(w, r, "write")
+	if !ok {
+		return
+	}
+	var annotation Annotation
+	err := rest.UnmarshalRequest(r, &annotation)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if annotation.Timeseries != "" && annotation.Timeseries != si.ID {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("bad_request: timeseries is set automatically"))
+		return
+	}
+	annotation.Timeseries = si.ID
+	annotation.Author = c.DB.ID()
+	var na *Annotation
+	aid, err := CreateAnnotation(c.DB.AdminDB(), &annotation)
+	if err == nil {
+		if na, err = ReadAnnotation(c.DB.AdminDB(), si.ID, aid); err == nil {
+			c.Events.Fire(&events.Event{
+				Event:  AnnotationCreateEvent,
+				Object: si.ID,
+				Data:   na,
+			})
+		}
+	}
+	rest.WriteJSON(w, r, na, err)
+}
+
+// ReadAnnotationHandler returns a single annotation of the timeseries
+func ReadAnnotationHandler(w http.ResponseWriter, r *http.Request) {
+	si, ok := validateRequest(w, r, "read")
+	if !ok {
+		return
+	}
+	annotation, err := ReadAnnotation(rest.CTX(r).DB.AdminDB(), si.ID, chi.URLParam(r, "annotationid"))
+	rest.WriteJSON(w, r, annotation, err)
+}
+
+// UpdateAnnotationHandler modifies an annotation of the timeseries
+func UpdateAnnotationHandler(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	si, ok := validateRequest(w, r, "write")
+	if !ok {
+		return
+	}
+	var annotation Annotation
+	err := rest.UnmarshalRequest(r, &annotation)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	aid := chi.URLParam(r, "annotationid")
+	if annotation.ID != "" && annotation.ID != aid || annotation.Timeseries != "" && annotation.Timeseries != si.ID {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("bad_request: The annotation's id and timeseries can't be modified"))
+		return
+	}
+	annotation.ID = aid
+	annotation.Timeseries = si.ID
+	err = UpdateAnnotation(c.DB.AdminDB(), &annotation)
+	if err == nil {
+		var na *Annotation
+		if na, err = ReadAnnotation(c.DB.AdminDB(), si.ID, aid); err == nil {
+			c.Events.Fire(&events.Event{
+				Event:  AnnotationUpdateEvent,
+				Object: si.ID,
+				Data:   na,
+			})
+		}
+	}
+	rest.WriteResult(w, r, err)
+}
+
+// DeleteAnnotationHandler removes an annotation from the timeseries
+func DeleteAnnotationHandler(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	si, ok := validateRequest(w, r, "write")
+	if !ok {
+		return
+	}
+	annotation, err := ReadAnnotation(c.DB.AdminDB(), si.ID, chi.URLParam(r, "annotationid"))
+	if err == nil {
+		if err = DeleteAnnotation(c.DB.AdminDB(), si.ID, annotation.ID); err == nil {
+			c.Events.Fire(&events.Event{
+				Event:  AnnotationDeleteEvent,
+				Object: si.ID,
+				Data:   annotation,
+			})
+		}
+	}
+	rest.WriteResult(w, r, err)
+}
+
+// ReadSettingsHandler returns the timeseries settings of the user making the request, or of the app's owner
+func ReadSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	db := rest.CTX(r).DB
+	u := dbUser(db)
+	if u == "" {
+		rest.WriteJSONError(w, r, http.StatusForbidden, database.ErrAccessDenied("Only users and their apps have timeseries settings"))
+		return
+	}
+	if _, err := db.ReadUser(u, nil); err != nil {
+		rest.WriteJSONError(w, r, http.StatusForbidden, err)
+		return
+	}
+	s, err := ReadUserSettings(db.AdminDB(), u)
+	rest.WriteJSON(w, r, s, err)
+}
+
+// UpdateSettingsHandler modifies the given timeseries settings of the user making the request. Only users can change their settings.
+func UpdateSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	db := rest.CTX(r).DB
+	if db.Type() != database.UserType {
+		rest.WriteJSONError(w, r, http.StatusForbidden, database.ErrAccessDenied("Only users can change their timeseries settings"))
+		return
+	}
+	s, err := ReadUserSettings(db.AdminDB(), db.ID())
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if err = rest.UnmarshalRequest(r, s); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	rest.WriteResult(w, r, UpdateUserSettings(db.AdminDB(), db.ID(), s))
+}
+
+// Compact compacts the batches of all timeseries, or of the timeseries given in the query, and returns the before/after stats.
+// Only admins can compact timeseries.
+func Compact(w http.ResponseWriter, r *http.Request) {
+	db := rest.CTX(r).DB
+	if db.Type() != database.AdminType && !db.AdminDB().Assets().GetConfig().UserIsAdmin(db.ID()) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, database.ErrAccessDenied("Only admins can compact timeseries"))
+		return
+	}
+	stats, err := TSDB.Compact(r.URL.Query().Get("timeseries"), 0)
+	rest.WriteJSON(w, r, stats, err)
+}
+
 // Act is given just the data portion of a datapoint, and it is inserted at the current timestamp
 func Act(w http.ResponseWriter, r *http.Request) {
 	c := rest.CTX(r)
@@ -398,22 +850,18 @@ func GenerateDataset(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	readers := make([]*JsonArrayReader, len(d))
+	readers := make([]io.Reader, len(d))
 	for i := range d {
+		if err = withUserTimezone(c.DB, &d[i].Query); err != nil {
+			rest.WriteJSONError(rw, r, http.StatusInternalServerError, err)
+			return
+		}
 		di, err := d[i].Get(c.DB)
 		if err != nil {
 			rest.WriteJSONError(rw, r, http.StatusBadRequest, err)
 			return
 		}
-		var pi DatapointIterator
-		/*
-			if len(d[i].Dataset) > 0 || d[i].Transform != nil {
-				pi = NewChanIterator(&TransformIterator{dpi: di, it: di})
-			} else {
-				pi = &TransformIterator{dpi: di, it: di}
-			}
-		*/
-		pi = &TransformIterator{dpi: di, it: di}
+		pi := d[i].iterator(di)
 		defer pi.Close()
 
 		ai, err := NewJsonArrayReader(pi, 2048)
@@ -422,12 +870,23 @@ func GenerateDataset(rw http.ResponseWriter, r *http.Request) {
 			return
 		}
 		readers[i] = ai
+		if d[i].Annotations != nil && *d[i].Annotations {
+			annotations, err := d[i].annotations(c.DB)
+			if err != nil {
+				rest.WriteJSONError(rw, r, http.StatusBadRequest, err)
+				return
+			}
+			if readers[i], err = withAnnotations(ai, annotations); err != nil {
+				rest.WriteJSONError(rw, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
 	}
 	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
 	var w io.Writer
 	w = rw
 
-	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") && !assets.Get().Config.Verbose && TSDB.CompressQueryResponse {
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") && !assets.Get().GetConfig().Verbose && TSDB.CompressQueryResponse {
 		// If gzip is supported, compress the output
 		rw.Header().Set("Content-Encoding", "gzip")
 		rw.WriteHeader(http.StatusOK)
@@ -492,6 +951,21 @@ func getEvents(d []*Dataset) []dashboard.DashboardEvent {
 		})
 	}
 
+	// Datasets that include annotations are also updated when the annotations change
+	for i := range d {
+		if d[i].Annotations == nil || !*d[i].Annotations {
+			continue
+		}
+		for k := range d[i].GetTimeseries() {
+			for _, evt := range annotationEvents {
+				arr = append(arr, dashboard.DashboardEvent{
+					ObjectID: k,
+					Event:    evt,
+				})
+			}
+		}
+	}
+
 	return arr
 }
 
@@ -510,15 +984,18 @@ func GenerateDashboardDataset(w http.ResponseWriter, r *http.Request) {
 	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
-	readers := make([]*JsonArrayReader, len(d))
+	readers := make([]io.Reader, len(d))
 	for i := range d {
+		if err = withUserTimezone(c.DB, &d[i].Query); err != nil {
+			rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
+			return
+		}
 		di, err := d[i].Get(c.DB)
 		if err != nil {
 			rest.WriteJSONError(w, r, http.StatusBadRequest, err)
 			return
 		}
-		// pi := NewChanIterator(&TransformIterator{dpi: di, it: di})
-		pi := &TransformIterator{dpi: di, it: di}
+		pi := d[i].iterator(di)
 		defer pi.Close()
 
 		ai, err := NewJsonArrayReader(pi, 2048)
@@ -527,6 +1004,17 @@ func GenerateDashboardDataset(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		readers[i] = ai
+		if d[i].Annotations != nil && *d[i].Annotations {
+			annotations, err := d[i].annotations(c.DB)
+			if err != nil {
+				rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+				return
+			}
+			if readers[i], err = withAnnotations(ai, annotations); err != nil {
+				rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
 	}
 
 	evts, err := json.Marshal(getEvents(d))
@@ -603,9 +1091,34 @@ var Handler = func() *chi.Mux {
 		DataLength(w, r, true)
 	})
 
+	m.Post("/object/timeseries/rebuild", Rebuild)
+
+	m.Post("/object/timeseries/schema", ChangeSchemaHandler)
+
+	m.Get("/object/timeseries/rules", ReadRulesHandler)
+	m.Post("/object/timeseries/rules", CreateRuleHandler)
+	m.Get("/object/timeseries/rules/{ruleid}", ReadRuleHandler)
+	m.Patch("/object/timeseries/rules/{ruleid}", UpdateRuleHandler)
+	m.Delete("/object/timeseries/rules/{ruleid}", DeleteRuleHandler)
+
+	m.Get("/object/timeseries/alerts", ReadAlertsHandler)
+	m.Post("/object/timeseries/alerts", CreateAlertHandler)
+	m.Get("/object/timeseries/alerts/{alertid}", ReadAlertHandler)
+	m.Patch("/object/timeseries/alerts/{alertid}", UpdateAlertHandler)
+	m.Delete("/object/timeseries/alerts/{alertid}", DeleteAlertHandler)
+
+	m.Get("/object/timeseries/annotations", ReadAnnotationsHandler)
+	m.Post("/object/timeseries/annotations", CreateAnnotationHandler)
+	m.Get("/object/timeseries/annotations/{annotationid}", ReadAnnotationHandler)
+	m.Patch("/object/timeseries/annotations/{annotationid}", UpdateAnnotationHandler)
+	m.Delete("/object/timeseries/annotations/{annotationid}", DeleteAnnotationHandler)
+
 	m.Post("/object/act", Act)
 
 	m.Post("/api/timeseries/dataset", GenerateDataset)
+	m.Post("/api/timeseries/compact", Compact)
+	m.Get("/api/timeseries/settings", ReadSettingsHandler)
+	m.Patch("/api/timeseries/settings", UpdateSettingsHandler)
 
 	m.Post("/dashboard/", GenerateDashboardDataset)
 
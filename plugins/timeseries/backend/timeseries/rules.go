@@ -0,0 +1,496 @@
+package timeseries
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/events"
+	"github.com/heedy/pipescript"
+	"github.com/sirupsen/logrus"
+)
+
+// sqlRulesSchema is added in version 2 of the timeseries database
+const sqlRulesSchema = `
+CREATE TABLE timeseries_rules (
+	id VARCHAR(36) NOT NULL PRIMARY KEY,
+	tsid VARCHAR(36) NOT NULL,
+
+	name VARCHAR NOT NULL DEFAULT '',
+	-- The PipeScript transform run on the data written to the timeseries
+	transform VARCHAR NOT NULL,
+	-- The number of seconds of data before the written data that is also passed through the transform
+	lookback REAL NOT NULL DEFAULT 0,
+
+	-- The timeseries that the results are written to, and whether they are fired as an event
+	target VARCHAR(36) DEFAULT NULL,
+	event BOOLEAN NOT NULL DEFAULT false,
+
+	enabled BOOLEAN NOT NULL DEFAULT true,
+
+	-- The user or app that created the rule, which the rule runs as
+	creator VARCHAR NOT NULL,
+
+	-- The most recent error, and the number of failed runs since the rule was last modified
+	error VARCHAR DEFAULT NULL,
+	error_time REAL DEFAULT NULL,
+	error_count INTEGER NOT NULL DEFAULT 0,
+	last_run REAL DEFAULT NULL,
+
+	CONSTRAINT timeseries_fk
+		FOREIGN KEY(tsid)
+		REFERENCES objects(id)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE,
+	CONSTRAINT target_fk
+		FOREIGN KEY(target)
+		REFERENCES objects(id)
+		ON UPDATE CASCADE
+		ON DELETE SET NULL
+);
+CREATE INDEX timeseries_rules_tsid ON timeseries_rules(tsid);
+CREATE INDEX timeseries_rules_target ON timeseries_rules(target);
+`
+
+// RuleEvent is the event fired with the results of rules that output events
+const RuleEvent = "timeseries_rule"
+
+// Rule is a continuous query on a timeseries. Its transform is run on the data written to the timeseries,
+// and the results are written to the target timeseries, and/or fired as a timeseries_rule event.
+// The rule runs as the user or app that created it.
+type Rule struct {
+	ID         string   `json:"id" db:"id"`
+	Timeseries string   `json:"timeseries" db:"tsid"`
+	Name       *string  `json:"name,omitempty" db:"name"`
+	Transform  *string  `json:"transform,omitempty" db:"transform"`
+	Lookback   *float64 `json:"lookback,omitempty" db:"lookback"`
+	Target     *string  `json:"target,omitempty" db:"target"`
+	Event      *bool    `json:"event,omitempty" db:"event"`
+	Enabled    *bool    `json:"enabled,omitempty" db:"enabled"`
+
+	// These are set by heedy, and can't be modified
+	Creator    string   `json:"creator" db:"creator"`
+	Error      *string  `json:"error,omitempty" db:"error"`
+	ErrorTime  *float64 `json:"error_time,omitempty" db:"error_time"`
+	ErrorCount int64    `json:"error_count" db:"error_count"`
+	LastRun    *float64 `json:"last_run,omitempty" db:"last_run"`
+}
+
+// feeds returns whether writing to the timeseries from leads to data being written to the timeseries to,
+// either through rules or derived timeseries.
+func feeds(db *database.AdminDB, dp *DerivedProcessor, from string, to string) (bool, error) {
+	visited := map[string]bool{from: true}
+	queue := []string{from}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		var next []string
+		if err := db.Select(&next, "SELECT target FROM timeseries_rules WHERE tsid=? AND target IS NOT NULL", cur); err != nil {
+			return false, err
+		}
+		if dp != nil {
+			next = append(next, dp.dependents(cur)...)
+		}
+		for _, n := range next {
+			if n == to {
+				return true, nil
+			}
+			if !visited[n] {
+				visited[n] = true
+				queue = append(queue, n)
+			}
+		}
+	}
+	return false, nil
+}
+
+// validateRule checks that the rule can be run, and that the given db can read its timeseries and write to its target
+func validateRule(db database.DB, r *Rule) error {
+	if r.Transform == nil || *r.Transform == "" {
+		return errors.New("bad_request: A rule must have a transform")
+	}
+	if _, err := pipescript.Parse(*r.Transform); err != nil {
+		return err
+	}
+	if r.Lookback != nil && *r.Lookback < 0 {
+		return errors.New("bad_request: lookback can't be negative")
+	}
+	if r.Target == nil && (r.Event == nil || !*r.Event) {
+		return errors.New("bad_request: A rule must write to a target timeseries or fire an event")
+	}
+	src, err := db.ReadObject(r.Timeseries, &database.ReadObjectOptions{})
+	if err != nil {
+		return err
+	}
+	if !src.Access.HasScope("read") {
+		return database.ErrAccessDenied("The rule's timeseries can't be read")
+	}
+	if r.Target == nil {
+		return nil
+	}
+	if *r.Target == r.Timeseries {
+		return errors.New("bad_request: A rule can't write to its own timeseries")
+	}
+	obj, err := db.ReadObject(*r.Target, &database.ReadObjectOptions{})
+	if err != nil {
+		return err
+	}
+	if *obj.Type == DerivedType {
+		return ErrDerived
+	}
+	if *obj.Type != "timeseries" {
+		return errors.New("bad_request: The target of a rule must be a timeseries")
+	}
+	if !obj.Access.HasScope("write") {
+		return database.ErrAccessDenied("The rule's target can't be written")
+	}
+	loop, err := feeds(db.AdminDB(), Derived, *r.Target, r.Timeseries)
+	if err == nil && loop {
+		err = errors.New("bad_request: The rule's target leads back to its timeseries")
+	}
+	return err
+}
+
+// ReadRules returns all of the rules of the given timeseries
+func ReadRules(adb *database.AdminDB, tsid string) ([]Rule, error) {
+	rules := []Rule{}
+	err := adb.Select(&rules, "SELECT * FROM timeseries_rules WHERE tsid=? ORDER BY rowid ASC", tsid)
+	return rules, err
+}
+
+// ReadRule returns the given rule of the timeseries
+func ReadRule(adb *database.AdminDB, tsid string, rid string) (*Rule, error) {
+	var r Rule
+	err := adb.Get(&r, "SELECT * FROM timeseries_rules WHERE id=? AND tsid=?", rid, tsid)
+	if err == sql.ErrNoRows {
+		return nil, database.ErrNotFound
+	}
+	return &r, err
+}
+
+// CreateRule adds a rule to the timeseries, which runs as the user or app of the given db. The db is used to check
+// that the rule's timeseries can be read, and its target can be written.
+func CreateRule(db database.DB, r *Rule) (string, error) {
+	if err := validateRule(db, r); err != nil {
+		return "", err
+	}
+	if r.Name == nil {
+		name := ""
+		r.Name = &name
+	}
+	if r.Lookback == nil {
+		lookback := 0.0
+		r.Lookback = &lookback
+	}
+	if r.Event == nil {
+		event := false
+		r.Event = &event
+	}
+	if r.Enabled == nil {
+		enabled := true
+		r.Enabled = &enabled
+	}
+	r.ID = uuid.New().String()
+	r.Creator = db.ID()
+	res, err := db.AdminDB().Exec("INSERT INTO timeseries_rules(id,tsid,name,transform,lookback,target,event,enabled,creator) VALUES (?,?,?,?,?,?,?,?,?)",
+		r.ID, r.Timeseries, r.Name, r.Transform, r.Lookback, r.Target, r.Event, r.Enabled, r.Creator)
+	err = database.GetExecError(res, err)
+	if err == nil && Rules != nil {
+		Rules.refresh(r.Timeseries)
+	}
+	return r.ID, err
+}
+
+// UpdateRule modifies the values of the rule that are set. Since the rule changed, its errors are reset.
+func UpdateRule(db database.DB, r *Rule) error {
+	cur, err := ReadRule(db.AdminDB(), r.Timeseries, r.ID)
+	if err != nil {
+		return err
+	}
+	if r.Name != nil {
+		cur.Name = r.Name
+	}
+	if r.Transform != nil {
+		cur.Transform = r.Transform
+	}
+	if r.Lookback != nil {
+		cur.Lookback = r.Lookback
+	}
+	if r.Target != nil {
+		if *r.Target == "" {
+			cur.Target = nil
+		} else {
+			cur.Target = r.Target
+		}
+	}
+	if r.Event != nil {
+		cur.Event = r.Event
+	}
+	if r.Enabled != nil {
+		cur.Enabled = r.Enabled
+	}
+	if err = validateRule(db, cur); err != nil {
+		return err
+	}
+	res, err := db.AdminDB().Exec("UPDATE timeseries_rules SET name=?,transform=?,lookback=?,target=?,event=?,enabled=?,error=NULL,error_time=NULL,error_count=0 WHERE id=? AND tsid=?",
+		cur.Name, cur.Transform, cur.Lookback, cur.Target, cur.Event, cur.Enabled, cur.ID, cur.Timeseries)
+	err = database.GetExecError(res, err)
+	if err == nil && Rules != nil {
+		Rules.refresh(cur.Timeseries)
+	}
+	return err
+}
+
+// DeleteRule removes the rule from the timeseries
+func DeleteRule(adb *database.AdminDB, tsid string, rid string) error {
+	res, err := adb.Exec("DELETE FROM timeseries_rules WHERE id=? AND tsid=?", rid, tsid)
+	err = database.GetExecError(res, err)
+	if err == nil && Rules != nil {
+		Rules.refresh(tsid)
+	}
+	return err
+}
+
+type ruleJob struct {
+	tsid string
+	t1   float64
+	t2   float64
+}
+
+// RuleProcessor runs the rules of timeseries on the data written to them. The rules run in the background in the order
+// that the data was written, so that writes don't wait for them.
+type RuleProcessor struct {
+	DB *database.AdminDB
+
+	sync.Mutex
+	// The timeseries that have enabled rules
+	sources map[string]bool
+	queue   []ruleJob
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+// Rules is the global RuleProcessor, initialized when the plugin starts
+var Rules *RuleProcessor
+
+// NewRuleProcessor prepares to run the rules of all timeseries
+func NewRuleProcessor(db *database.AdminDB) (*RuleProcessor, error) {
+	var sources []string
+	if err := db.Select(&sources, "SELECT DISTINCT tsid FROM timeseries_rules WHERE enabled"); err != nil {
+		return nil, err
+	}
+	rp := &RuleProcessor{
+		DB:      db,
+		sources: make(map[string]bool),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	for _, s := range sources {
+		rp.sources[s] = true
+	}
+	return rp, nil
+}
+
+// refresh checks whether the given timeseries still has enabled rules
+func (rp *RuleProcessor) refresh(tsid string) {
+	var count int
+	if err := rp.DB.Get(&count, "SELECT COUNT(*) FROM timeseries_rules WHERE tsid=? AND enabled", tsid); err != nil {
+		logrus.WithFields(logrus.Fields{"plugin": PluginName, "object": tsid}).Errorf("Failed to read timeseries rules: %v", err)
+		return
+	}
+	rp.Lock()
+	if count > 0 {
+		rp.sources[tsid] = true
+	} else {
+		delete(rp.sources, tsid)
+	}
+	rp.Unlock()
+}
+
+// Fire queues the rules of timeseries that were written
+func (rp *RuleProcessor) Fire(e *events.Event) {
+	switch e.Event {
+	case "timeseries_data_write":
+		we, ok := e.Data.(*TimeseriesWriteEvent)
+		if !ok {
+			return
+		}
+		rp.Lock()
+		if !rp.sources[e.Object] {
+			rp.Unlock()
+			return
+		}
+		rp.queue = append(rp.queue, ruleJob{e.Object, we.T1, we.T2})
+		rp.Unlock()
+		select {
+		case rp.wake <- struct{}{}:
+		default:
+		}
+	case "object_delete":
+		rp.Lock()
+		delete(rp.sources, e.Object)
+		rp.Unlock()
+	}
+}
+
+// Run processes written data until the processor is stopped
+func (rp *RuleProcessor) Run() {
+	for {
+		select {
+		case <-rp.done:
+			return
+		case <-rp.wake:
+		}
+		for {
+			rp.Lock()
+			if len(rp.queue) == 0 {
+				rp.Unlock()
+				break
+			}
+			j := rp.queue[0]
+			rp.queue = rp.queue[1:]
+			rp.Unlock()
+			rp.process(j)
+		}
+	}
+}
+
+// Close stops the processor
+func (rp *RuleProcessor) Close() {
+	close(rp.done)
+}
+
+func (rp *RuleProcessor) process(j ruleJob) {
+	log := logrus.WithFields(logrus.Fields{"plugin": PluginName, "object": j.tsid})
+	var rules []Rule
+	if err := rp.DB.Select(&rules, "SELECT * FROM timeseries_rules WHERE tsid=? AND enabled ORDER BY rowid ASC", j.tsid); err != nil {
+		log.Errorf("Failed to read timeseries rules: %v", err)
+		return
+	}
+	if len(rules) == 0 {
+		return
+	}
+	for i := range rules {
+		now := float64(time.Now().UnixNano()) * 1e-9
+		err := rp.RunRule(rules[i].Creator, &rules[i], j.t1, j.t2)
+		if err != nil {
+			log.WithField("rule", rules[i].ID).Warnf("Rule failed: %v", err)
+			_, err = rp.DB.Exec("UPDATE timeseries_rules SET error=?,error_time=?,error_count=error_count+1 WHERE id=?", err.Error(), now, rules[i].ID)
+		} else {
+			_, err = rp.DB.Exec("UPDATE timeseries_rules SET last_run=? WHERE id=?", now, rules[i].ID)
+		}
+		if err != nil {
+			log.Errorf("Failed to update rule: %v", err)
+		}
+	}
+}
+
+// RunRule runs the rule on the data of its timeseries between t1 and t2 (inclusive), as the given user or app,
+// which must still be able to read the timeseries. The data in the lookback before t1 is passed through the
+// transform, but its results are discarded.
+func (rp *RuleProcessor) RunRule(as string, r *Rule, t1 float64, t2 float64) error {
+	db, err := rp.DB.As(as)
+	if err != nil {
+		return err
+	}
+	src, err := db.ReadObject(r.Timeseries, &database.ReadObjectOptions{})
+	if err != nil {
+		return err
+	}
+	if !src.Access.HasScope("read") {
+		return database.ErrAccessDenied("The rule's timeseries can't be read")
+	}
+	lookback := 0.0
+	if r.Lookback != nil {
+		lookback = *r.Lookback
+	}
+	di, err := TSDB.Query(&Query{
+		Timeseries: r.Timeseries,
+		T1:         t1 - lookback,
+		T2:         math.Nextafter(t2, math.Inf(1)),
+		Transform:  r.Transform,
+	})
+	if err != nil {
+		return err
+	}
+	data := DatapointArray{}
+	dp, err := di.Next()
+	for ; dp != nil && err == nil; dp, err = di.Next() {
+		if dp.Timestamp >= t1 {
+			data = append(data, dp)
+		}
+	}
+	di.Close()
+	if err != nil || len(data) == 0 {
+		return err
+	}
+
+	fe := events.NewFilledHandler(rp.DB, events.GlobalHandler)
+	if r.Target != nil {
+		if err = rp.write(fe, db, *r.Target, data); err != nil {
+			return err
+		}
+	}
+	if r.Event != nil && *r.Event {
+		fe.Fire(&events.Event{
+			Event:  RuleEvent,
+			Object: r.Timeseries,
+			Data: map[string]interface{}{
+				"rule": r.ID,
+				"name": r.Name,
+				"data": data,
+			},
+		})
+	}
+	return nil
+}
+
+// write inserts the results of a rule into the target timeseries, checking that the rule's creator
+// can still write to it, and that the data matches its schema
+func (rp *RuleProcessor) write(fe events.Handler, db database.DB, target string, data DatapointArray) error {
+	obj, err := db.ReadObject(target, &database.ReadObjectOptions{})
+	if err != nil {
+		return err
+	}
+	if *obj.Type != "timeseries" {
+		return errors.New("bad_request: The target of a rule must be a timeseries")
+	}
+	if !obj.Access.HasScope("write") {
+		return database.ErrAccessDenied("The rule's target can't be written")
+	}
+	var di DatapointIterator = NewDatapointArrayIterator(data)
+	if obj.Meta != nil {
+		if schema, ok := (*obj.Meta)["schema"].(map[string]interface{}); ok && len(schema) > 0 {
+			if di, err = NewDataValidator(di, schema, ""); err != nil {
+				return err
+			}
+		}
+	}
+	ii := NewInfoIterator(di)
+	if err = TSDB.Insert(target, ii, &InsertQuery{}); err != nil || ii.Count == 0 {
+		return err
+	}
+	ne := database.Date(time.Now().UTC())
+	err = rp.DB.UpdateObject(&database.Object{
+		Details: database.Details{
+			ID: target,
+		},
+		LastModified: &ne,
+	})
+	fe.Fire(&events.Event{
+		Event:  "timeseries_data_write",
+		Object: target,
+		Data: &TimeseriesWriteEvent{
+			T1:    ii.Tstart,
+			T2:    ii.Tend,
+			Count: ii.Count,
+			DP:    ii.LastPoint,
+		},
+	})
+	return err
+}
@@ -0,0 +1,140 @@
+package timeseries
+
+import (
+	"testing"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/events"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRules(t *testing.T) {
+	adb, oid1, oid2, cleanup := newDBWithObjects(t)
+	defer cleanup()
+	sd := TimeseriesDB{DB: adb,
+		BatchSize:             3,
+		MaxBatchSize:          5,
+		BatchCompressionLevel: 3}
+	TSDB = sd
+
+	transform := "filter $ > 3"
+	event := true
+	rid, err := CreateRule(adb, &Rule{
+		Timeseries: oid1,
+		Transform:  &transform,
+		Target:     &oid2,
+	})
+	require.NoError(t, err)
+
+	// The target can't lead back to the timeseries
+	_, err = CreateRule(adb, &Rule{
+		Timeseries: oid2,
+		Transform:  &transform,
+		Target:     &oid1,
+	})
+	require.Error(t, err)
+	badTransform := "filter $ >"
+	_, err = CreateRule(adb, &Rule{
+		Timeseries: oid1,
+		Transform:  &badTransform,
+		Target:     &oid2,
+	})
+	require.Error(t, err)
+
+	// Rules can only be created by those who can read the timeseries
+	name, passwd := "other", "other"
+	require.NoError(t, adb.CreateUser(&database.User{UserName: &name, Password: &passwd}))
+	_, err = CreateRule(database.NewUserDB(adb, "other"), &Rule{
+		Timeseries: oid1,
+		Transform:  &transform,
+		Event:      &event,
+	})
+	require.Error(t, err)
+	urid, err := CreateRule(database.NewUserDB(adb, "test"), &Rule{
+		Timeseries: oid1,
+		Transform:  &transform,
+		Event:      &event,
+	})
+	require.NoError(t, err)
+	r, err := ReadRule(adb, oid1, urid)
+	require.NoError(t, err)
+	require.Equal(t, "test", r.Creator)
+	require.NoError(t, DeleteRule(adb, oid1, urid))
+
+	rp, err := NewRuleProcessor(adb)
+	require.NoError(t, err)
+	write := func(data DatapointArray) {
+		ii := NewInfoIterator(NewDatapointArrayIterator(data))
+		require.NoError(t, sd.Insert(oid1, ii, &InsertQuery{}))
+		rp.Fire(&events.Event{
+			Event:  "timeseries_data_write",
+			Object: oid1,
+			Data:   &TimeseriesWriteEvent{T1: ii.Tstart, T2: ii.Tend, Count: ii.Count},
+		})
+		rp.Lock()
+		require.Len(t, rp.queue, 1)
+		j := rp.queue[0]
+		rp.queue = nil
+		rp.Unlock()
+		rp.process(j)
+	}
+
+	write(dpa6)
+	cmpQuery(t, sd, &Query{Timeseries: oid2}, DatapointArray{
+		&Datapoint{Timestamp: 4, Data: 4.},
+		&Datapoint{Timestamp: 5, Data: 5.},
+	})
+
+	// Only the newly written data is processed
+	write(DatapointArray{&Datapoint{Timestamp: 6, Data: 6.}, &Datapoint{Timestamp: 7, Data: 1.}})
+	cmpQuery(t, sd, &Query{Timeseries: oid2}, DatapointArray{
+		&Datapoint{Timestamp: 4, Data: 4.},
+		&Datapoint{Timestamp: 5, Data: 5.},
+		&Datapoint{Timestamp: 6, Data: 6.},
+	})
+	r, err = ReadRule(adb, oid1, rid)
+	require.NoError(t, err)
+	require.NotNil(t, r.LastRun)
+	require.Nil(t, r.Error)
+	require.Equal(t, "heedy", r.Creator)
+
+	// Rules run as their creator, who must still be able to read the timeseries
+	_, err = adb.Exec("UPDATE timeseries_rules SET creator='public' WHERE id=?", rid)
+	require.NoError(t, err)
+	write(DatapointArray{&Datapoint{Timestamp: 6.5, Data: 10.}})
+	r, err = ReadRule(adb, oid1, rid)
+	require.NoError(t, err)
+	require.NotNil(t, r.Error)
+	cmpQuery(t, sd, &Query{Timeseries: oid2, T1: 6.5}, DatapointArray{})
+	_, err = adb.Exec("UPDATE timeseries_rules SET creator='heedy',error_count=0 WHERE id=?", rid)
+	require.NoError(t, err)
+
+	// Errors are recorded in the rule
+	_, err = sd.ChangeSchema(oid2, &SchemaChange{Schema: map[string]interface{}{"type": "string"}, Force: true})
+	require.NoError(t, err)
+	write(DatapointArray{&Datapoint{Timestamp: 8, Data: 8.}})
+	r, err = ReadRule(adb, oid1, rid)
+	require.NoError(t, err)
+	require.NotNil(t, r.Error)
+	require.EqualValues(t, 1, r.ErrorCount)
+
+	// Disabled rules don't run
+	disabled := false
+	require.NoError(t, UpdateRule(adb, &Rule{ID: rid, Timeseries: oid1, Enabled: &disabled}))
+	r, err = ReadRule(adb, oid1, rid)
+	require.NoError(t, err)
+	require.Nil(t, r.Error)
+	require.EqualValues(t, 0, r.ErrorCount)
+	rp.refresh(oid1)
+	rp.Fire(&events.Event{
+		Event:  "timeseries_data_write",
+		Object: oid1,
+		Data:   &TimeseriesWriteEvent{T1: 8, T2: 8, Count: 1},
+	})
+	require.Len(t, rp.queue, 0)
+
+	require.NoError(t, DeleteRule(adb, oid1, rid))
+	rules, err := ReadRules(adb, oid1)
+	require.NoError(t, err)
+	require.Len(t, rules, 0)
+}
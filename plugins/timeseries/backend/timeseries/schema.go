@@ -0,0 +1,223 @@
+package timeseries
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/pipescript"
+)
+
+// maxSchemaViolations is the number of violations that are returned when checking data against a schema
+const maxSchemaViolations = 100
+
+// SchemaChange describes a change of a timeseries' schema
+type SchemaChange struct {
+	Schema map[string]interface{} `json:"schema"`
+	// An optional PipeScript transform that the stored data is rewritten with, to convert it to the new schema
+	Transform *string `json:"transform,omitempty"`
+	// Only check the data against the schema, without changing the timeseries
+	DryRun bool `json:"dry_run,omitempty"`
+	// Change the schema even if existing data fails validation
+	Force bool `json:"force,omitempty"`
+}
+
+// SchemaViolation is a datapoint that fails validation with a new schema
+type SchemaViolation struct {
+	Timestamp float64  `json:"t"`
+	Errors    []string `json:"errors"`
+}
+
+// SchemaCheck is the result of checking the data of a timeseries against a new schema
+type SchemaCheck struct {
+	Datapoints int `json:"datapoints"`
+	Invalid    int `json:"invalid"`
+	// The first violations, up to maxSchemaViolations
+	Violations []SchemaViolation `json:"violations"`
+	// Whether the schema was changed, and the data rewritten if there was a transform
+	Applied bool `json:"applied"`
+
+	// The range of the rewritten data, used for the write event
+	t1, t2 float64
+	last   *Datapoint
+	// The deletion of the old data by the rewrite, used for the delete event
+	replaced *Query
+}
+
+// ChangeSchema checks the data of the timeseries against the new schema, after passing it through the transform if given.
+// Unless it is a dry run, the schema is then set, and the data is rewritten with the transform. Changes where data fails
+// validation are rejected unless forced. Only the data is checked and rewritten - actions keep their stored values.
+func (ts *TimeseriesDB) ChangeSchema(tsid string, sc *SchemaChange) (*SchemaCheck, error) {
+	if sc.Schema == nil {
+		return nil, errors.New("bad_request: No schema given")
+	}
+	dv, err := NewDataValidator(EmptyIterator{}, sc.Schema, "")
+	if err != nil {
+		return nil, fmt.Errorf("bad_request: Invalid schema: %s", err.Error())
+	}
+	if sc.Transform != nil {
+		if _, err = pipescript.Parse(*sc.Transform); err != nil {
+			return nil, err
+		}
+	}
+	rewrite := sc.Transform != nil && !sc.DryRun
+
+	tx, err := ts.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if !sc.DryRun {
+		// The schema is set first, so that the rewritten batches are encoded with the new schema's codec
+		ne := database.Date(time.Now().UTC())
+		err = ts.DB.UpdateObjectTx(tx, &database.Object{
+			Details: database.Details{
+				ID: tsid,
+			},
+			Meta:         &database.JSONObject{"schema": sc.Schema},
+			LastModified: &ne,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	codec, err := ts.batchCodec(tx, tsid)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Queryx("SELECT data FROM timeseries WHERE tsid=? ORDER BY tstart ASC", tsid)
+	if err != nil {
+		return nil, err
+	}
+	var data DatapointIterator = NewBatchDatapointIterator(SQLBatchIterator{rows, nil}, nil)
+	defer data.Close()
+	if sc.Transform != nil {
+		if data, err = NewTransformIterator(*sc.Transform, data); err != nil {
+			return nil, err
+		}
+		// Transforms can output anything, so make sure that the rewritten data is a valid timeseries
+		data = NewSortChecker(data)
+	}
+
+	// The rewritten batches are held encoded until all data was read, since the old batches are read in the same transaction
+	check := &SchemaCheck{Violations: []SchemaViolation{}}
+	batches := []*batchinfo{}
+	batch := DatapointArray{}
+	addBatch := func() error {
+		b, err := batch.Encode(codec)
+		if err != nil {
+			return err
+		}
+		batches = append(batches, &batchinfo{
+			tstart: batch[0].Timestamp,
+			tend:   batch[len(batch)-1].EndTime(),
+			length: len(batch),
+			data:   b,
+		})
+		batch = DatapointArray{}
+		return nil
+	}
+	dp, err := data.Next()
+	for ; dp != nil && err == nil; dp, err = data.Next() {
+		check.Datapoints++
+		v, verr := dv.Violations(dp.Data)
+		if verr != nil {
+			return nil, verr
+		}
+		if v != nil {
+			check.Invalid++
+			if len(check.Violations) < maxSchemaViolations {
+				check.Violations = append(check.Violations, SchemaViolation{Timestamp: dp.Timestamp, Errors: v})
+			}
+		}
+		if rewrite {
+			if check.last == nil {
+				check.t1 = dp.Timestamp
+			}
+			check.t2 = dp.EndTime()
+			check.last = dp
+			batch = append(batch, dp)
+			if len(batch) >= ts.BatchSize {
+				if err = addBatch(); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	data.Close()
+
+	if sc.DryRun {
+		return check, nil
+	}
+	if check.Invalid > 0 && !sc.Force {
+		return check, fmt.Errorf("bad_request: %d datapoints fail validation with the new schema", check.Invalid)
+	}
+	if rewrite {
+		if len(batch) > 0 {
+			if err = addBatch(); err != nil {
+				return nil, err
+			}
+		}
+		res, err := tx.Exec("DELETE FROM timeseries WHERE tsid=?", tsid)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			// All of the old data was replaced
+			check.replaced = &Query{Timeseries: tsid}
+		}
+		for _, b := range batches {
+			if err = ts.insertBatch(tx, "timeseries", tsid, b); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	check.Applied = true
+	return check, nil
+}
+
+// checkSchemaUpdate is run when a timeseries' metadata is updated directly, and rejects schema changes
+// that the existing data fails, which need to be forced or migrated with ChangeSchema
+func checkSchemaUpdate(adb *database.AdminDB, tsid string, meta map[string]interface{}) error {
+	s, ok := meta["schema"]
+	if !ok || s == nil {
+		return nil
+	}
+	schema, ok := s.(map[string]interface{})
+	if !ok {
+		return errors.New("bad_request: The timeseries schema must be an object")
+	}
+
+	// Metadata updates usually leave the schema as it is, in which case the data doesn't need to be checked
+	var stored *string
+	if err := adb.Get(&stored, "SELECT json_extract(meta,'$.schema') FROM objects WHERE id=?", tsid); err != nil {
+		return err
+	}
+	if stored != nil {
+		var cur map[string]interface{}
+		if json.Unmarshal([]byte(*stored), &cur) == nil && reflect.DeepEqual(cur, schema) {
+			return nil
+		}
+	}
+
+	ts := TimeseriesDB{DB: adb}
+	check, err := ts.ChangeSchema(tsid, &SchemaChange{Schema: schema, DryRun: true})
+	if err != nil {
+		return err
+	}
+	if check.Invalid > 0 {
+		return fmt.Errorf("bad_request: %d datapoints fail validation with the new schema. Use the timeseries schema endpoint to migrate the data or force the change", check.Invalid)
+	}
+	return nil
+}
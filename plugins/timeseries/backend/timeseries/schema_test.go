@@ -0,0 +1,114 @@
+package timeseries
+
+import (
+	"testing"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeSchema(t *testing.T) {
+	adb, oid1, _, cleanup := newDBWithObjects(t)
+	defer cleanup()
+	sd := TimeseriesDB{DB: adb,
+		BatchSize:             2,
+		MaxBatchSize:          3,
+		BatchCompressionLevel: 2}
+	require.NoError(t, sd.Insert(oid1, NewDatapointArrayIterator(dpa6), &InsertQuery{}))
+	schema := func() interface{} {
+		o, err := adb.ReadObject(oid1, &database.ReadObjectOptions{})
+		require.NoError(t, err)
+		return (*o.Meta)["schema"]
+	}
+
+	// A dry run reports the violations without changing the timeseries
+	sc := &SchemaChange{Schema: map[string]interface{}{"type": "number", "maximum": 3}, DryRun: true}
+	check, err := sd.ChangeSchema(oid1, sc)
+	require.NoError(t, err)
+	require.Equal(t, 5, check.Datapoints)
+	require.Equal(t, 2, check.Invalid)
+	require.Len(t, check.Violations, 2)
+	require.EqualValues(t, 4, check.Violations[0].Timestamp)
+	require.False(t, check.Applied)
+	require.Equal(t, map[string]interface{}{}, schema())
+
+	// Incompatible changes are rejected unless forced
+	sc.DryRun = false
+	_, err = sd.ChangeSchema(oid1, sc)
+	require.Error(t, err)
+	require.Equal(t, map[string]interface{}{}, schema())
+
+	// A transform migrates the data to the new schema
+	transform := "$ > 2"
+	_, err = sd.ChangeSchema(oid1, &SchemaChange{Schema: map[string]interface{}{"type": "string"}, Transform: &transform})
+	require.Error(t, err)
+	check, err = sd.ChangeSchema(oid1, &SchemaChange{Schema: map[string]interface{}{"type": "boolean"}, Transform: &transform})
+	require.NoError(t, err)
+	require.True(t, check.Applied)
+	require.Equal(t, 0, check.Invalid)
+	require.Equal(t, map[string]interface{}{"type": "boolean"}, schema())
+	cmpQuery(t, sd, &Query{Timeseries: oid1}, DatapointArray{
+		&Datapoint{Timestamp: 1, Data: false},
+		&Datapoint{Timestamp: 2, Data: false},
+		&Datapoint{Timestamp: 3, Data: true},
+		&Datapoint{Timestamp: 4, Data: true},
+		&Datapoint{Timestamp: 5, Data: true},
+	})
+
+	// Forcing sets the schema even if the data doesn't validate
+	check, err = sd.ChangeSchema(oid1, &SchemaChange{Schema: map[string]interface{}{"type": "number"}, Force: true})
+	require.NoError(t, err)
+	require.True(t, check.Applied)
+	require.Equal(t, 5, check.Invalid)
+	require.Equal(t, map[string]interface{}{"type": "number"}, schema())
+
+	_, err = sd.ChangeSchema(oid1, &SchemaChange{Schema: map[string]interface{}{"type": 3}})
+	require.Error(t, err)
+
+	// The change goes through the object update, which marks the timeseries as modified
+	o, err := adb.ReadObject(oid1, &database.ReadObjectOptions{})
+	require.NoError(t, err)
+	require.NotNil(t, o.LastModified)
+
+	// A transform that removes all data still replaces the old data
+	transform = "filter($ > 10)"
+	check, err = sd.ChangeSchema(oid1, &SchemaChange{Schema: map[string]interface{}{"type": "boolean"}, Transform: &transform})
+	require.NoError(t, err)
+	require.Equal(t, 0, check.Datapoints)
+	require.Nil(t, check.last)
+	require.Equal(t, &Query{Timeseries: oid1}, check.replaced)
+	l, err := sd.Length(oid1, false)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, l)
+}
+
+func TestSchemaObjectUpdate(t *testing.T) {
+	adb, oid1, _, cleanup := newDBWithObjects(t)
+	defer cleanup()
+	sd := TimeseriesDB{DB: adb,
+		BatchSize:             2,
+		MaxBatchSize:          3,
+		BatchCompressionLevel: 2}
+	require.NoError(t, sd.Insert(oid1, NewDatapointArrayIterator(dpa6), &InsertQuery{}))
+	update := func(schema interface{}) error {
+		return adb.UpdateObject(&database.Object{
+			Details: database.Details{ID: oid1},
+			Meta:    &database.JSONObject{"schema": schema},
+		})
+	}
+
+	// Updating the object's metadata can't set a schema that the data fails
+	require.Error(t, update(map[string]interface{}{"type": "number", "maximum": 3}))
+	require.Error(t, update(map[string]interface{}{"type": "string"}))
+	require.NoError(t, update(map[string]interface{}{"type": "number"}))
+
+	o, err := adb.ReadObject(oid1, &database.ReadObjectOptions{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"type": "number"}, (*o.Meta)["schema"])
+
+	// Setting the schema that is already stored doesn't check the data again
+	_, err = adb.Exec(`UPDATE objects SET meta=json_set(meta,'$.schema',json('{"type":"string"}')) WHERE id=?`, oid1)
+	require.NoError(t, err)
+	require.NoError(t, update(map[string]interface{}{"type": "string"}))
+	require.Error(t, update(map[string]interface{}{"type": "string", "maxLength": 3}))
+}
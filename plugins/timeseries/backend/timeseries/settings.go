@@ -0,0 +1,73 @@
+package timeseries
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/heedy/heedy/backend/database"
+)
+
+// sqlSettingsSchema is added in version 6 of the timeseries database. It holds each user's settings for
+// timeseries queries.
+const sqlSettingsSchema = `
+CREATE TABLE timeseries_user_settings (
+	username VARCHAR(36) NOT NULL PRIMARY KEY,
+	-- The IANA timezone of the user's relative times and calendar buckets, where '' is UTC
+	timezone VARCHAR NOT NULL DEFAULT '',
+
+	CONSTRAINT user_fk
+		FOREIGN KEY(username)
+		REFERENCES users(username)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE
+);
+`
+
+// UserSettings are a user's settings for timeseries queries
+type UserSettings struct {
+	Timezone string `json:"timezone" db:"timezone"`
+}
+
+// ReadUserSettings returns the settings of the given user, which have defaults if the user never set them
+func ReadUserSettings(adb *database.AdminDB, username string) (*UserSettings, error) {
+	var s UserSettings
+	err := adb.Get(&s, "SELECT timezone FROM timeseries_user_settings WHERE username=?", username)
+	if err == sql.ErrNoRows {
+		return &UserSettings{}, nil
+	}
+	return &s, err
+}
+
+// UpdateUserSettings sets the settings of the given user
+func UpdateUserSettings(adb *database.AdminDB, username string, s *UserSettings) error {
+	if _, err := LoadTimezone(s.Timezone); err != nil {
+		return err
+	}
+	_, err := adb.Exec("INSERT OR REPLACE INTO timeseries_user_settings(username,timezone) VALUES (?,?);", username, s.Timezone)
+	return err
+}
+
+// dbUser returns the user that the database acts as: the user itself, or the owner of an app.
+// Public and admin databases have no user.
+func dbUser(db database.DB) string {
+	switch db.Type() {
+	case database.UserType:
+		return db.ID()
+	case database.AppType:
+		return strings.SplitN(db.ID(), "/", 2)[0]
+	}
+	return ""
+}
+
+// userTimezone returns the timezone that the queries of the database's user are in by default
+func userTimezone(db database.DB) (string, error) {
+	u := dbUser(db)
+	if u == "" {
+		return "", nil
+	}
+	s, err := ReadUserSettings(db.AdminDB(), u)
+	if err != nil {
+		return "", err
+	}
+	return s.Timezone, nil
+}
@@ -0,0 +1,42 @@
+package timeseries
+
+import (
+	"testing"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserSettings(t *testing.T) {
+	adb, cleanup := newDBWithUser(t)
+	defer cleanup()
+
+	s, err := ReadUserSettings(adb, "test")
+	require.NoError(t, err)
+	require.Equal(t, "", s.Timezone)
+
+	require.Error(t, UpdateUserSettings(adb, "test", &UserSettings{Timezone: "Mars/Olympus_Mons"}))
+	require.NoError(t, UpdateUserSettings(adb, "test", &UserSettings{Timezone: "Europe/Berlin"}))
+	require.NoError(t, UpdateUserSettings(adb, "test", &UserSettings{Timezone: "America/New_York"}))
+	s, err = ReadUserSettings(adb, "test")
+	require.NoError(t, err)
+	require.Equal(t, "America/New_York", s.Timezone)
+
+	// Queries of the user and the user's apps default to the user's timezone
+	tz, err := userTimezone(database.NewUserDB(adb, "test"))
+	require.NoError(t, err)
+	require.Equal(t, "America/New_York", tz)
+	owner := "test"
+	tz, err = userTimezone(database.NewAppDB(adb, &database.App{Details: database.Details{ID: "myapp"}, Owner: &owner}))
+	require.NoError(t, err)
+	require.Equal(t, "America/New_York", tz)
+	tz, err = userTimezone(adb)
+	require.NoError(t, err)
+	require.Equal(t, "", tz)
+
+	// The settings are removed with the user
+	require.NoError(t, adb.DelUser("test"))
+	s, err = ReadUserSettings(adb, "test")
+	require.NoError(t, err)
+	require.Equal(t, "", s.Timezone)
+}
@@ -2,7 +2,11 @@ package timeseries
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
+	"sync"
 	"time"
+	_ "time/tzdata" // Timezones are available on systems without a timezone database
 
 	"github.com/karrick/tparse"
 	jwriter "github.com/mailru/easyjson/jwriter"
@@ -12,10 +16,28 @@ func Unix(t time.Time) float64 {
 	return float64(t.UnixNano()) * 1e-9
 }
 
+// ParseTimestamp parses a timestamp in UTC. See ParseTimestampIn.
 func ParseTimestamp(ts interface{}) (float64, error) {
+	return ParseTimestampIn(ts, time.UTC)
+}
+
+// localLayouts are the formats of times without a timezone, which are interpreted in the query's timezone
+var localLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+// ParseTimestampIn parses a unix timestamp in seconds, or a string. Strings are RFC3339 times, times without
+// a timezone such as "2020-03-08", or relative times such as "now-1h" or "start of week-1w", where the dates
+// without timezone and the calendar times are in the given location.
+func ParseTimestampIn(ts interface{}, loc *time.Location) (float64, error) {
 	tss, ok := ts.(string)
 	if ok {
-		t, err := tparse.ParseNow(time.RFC3339, tss)
+		t, err := tparse.ParseWithMap(time.RFC3339, tss, namedTimes(time.Now().In(loc)))
+		if err != nil {
+			for _, layout := range localLayouts {
+				if lt, lerr := time.ParseInLocation(layout, tss, loc); lerr == nil {
+					return Unix(lt), nil
+				}
+			}
+		}
 		return Unix(t), err
 	}
 	f, ok := ts.(float64)
@@ -25,6 +47,70 @@ func ParseTimestamp(ts interface{}) (float64, error) {
 	return 0, errors.New("Could not parse timestamp")
 }
 
+// isRelativeTime returns whether the timestamp is a relative time such as "now-1h" or "today", whose value
+// depends on when it is parsed
+func isRelativeTime(ts interface{}) bool {
+	tss, ok := ts.(string)
+	if !ok {
+		return false
+	}
+	if _, err := strconv.ParseFloat(tss, 64); err == nil {
+		return false
+	}
+	for _, layout := range append([]string{time.RFC3339}, localLayouts...) {
+		if _, err := time.Parse(layout, tss); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// namedTimes returns the times that relative timestamps can start from
+func namedTimes(now time.Time) map[string]time.Time {
+	today := calendarStart(now, "day")
+	return map[string]time.Time{
+		"now":            now,
+		"today":          today,
+		"yesterday":      today.AddDate(0, 0, -1),
+		"tomorrow":       today.AddDate(0, 0, 1),
+		"start of week":  calendarStart(now, "week"),
+		"start of month": calendarStart(now, "month"),
+		"start of year":  calendarStart(now, "year"),
+	}
+}
+
+// calendarStart returns the start of the day, week (starting on Monday), month or year containing t, in t's location
+func calendarStart(t time.Time, unit string) time.Time {
+	y, m, d := t.Date()
+	switch unit {
+	case "week":
+		d -= (int(t.Weekday()) + 6) % 7
+	case "month":
+		d = 1
+	case "year":
+		m, d = time.January, 1
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+var timezones sync.Map
+
+// LoadTimezone returns the location of an IANA timezone, such as "America/New_York". The empty timezone is UTC.
+func LoadTimezone(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.UTC, nil
+	}
+	if loc, ok := timezones.Load(tz); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil || tz == "Local" {
+		return nil, fmt.Errorf("bad_query: Unknown timezone '%s'", tz)
+	}
+	timezones.Store(tz, loc)
+	return loc, nil
+}
+
 func jsonInterfaceMarshaller(out *jwriter.Writer, in interface{}) {
 	if in == nil {
 		out.RawString("null")
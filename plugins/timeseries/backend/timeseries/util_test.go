@@ -0,0 +1,66 @@
+package timeseries
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTimestampIn(t *testing.T) {
+	ny, err := LoadTimezone("America/New_York")
+	require.NoError(t, err)
+	_, err = LoadTimezone("Mars/Olympus_Mons")
+	require.Error(t, err)
+	_, err = LoadTimezone("Local")
+	require.Error(t, err)
+	utc, err := LoadTimezone("")
+	require.NoError(t, err)
+	require.Equal(t, time.UTC, utc)
+
+	// Times without a timezone are in the given location, and other times are unchanged
+	for ts, res := range map[interface{}]float64{
+		"2020-03-08":           1583643600,
+		"2020-03-08T12:00:00":  1583683200, // daylight saving time started at 2am
+		"2020-03-08T12:00:00Z": 1583668800,
+		"1583668800":           1583668800,
+		12.5:                   12.5,
+	} {
+		v, err := ParseTimestampIn(ts, ny)
+		require.NoError(t, err)
+		require.Equal(t, res, v, "%v", ts)
+	}
+	v, err := ParseTimestamp("2020-03-08")
+	require.NoError(t, err)
+	require.Equal(t, 1583625600., v)
+	_, err = ParseTimestampIn("the day after tomorrow", ny)
+	require.Error(t, err)
+
+	for ts, relative := range map[interface{}]bool{
+		"now-1h":               true,
+		"start of week":        true,
+		"2020-03-08":           false,
+		"2020-03-08T12:00:00Z": false,
+		"1583668800":           false,
+		12.5:                   false,
+		nil:                    false,
+	} {
+		require.Equal(t, relative, isRelativeTime(ts), "%v", ts)
+	}
+
+	today, err := ParseTimestampIn("today", ny)
+	require.NoError(t, err)
+	later, err := ParseTimestampIn("today+8h", ny)
+	require.NoError(t, err)
+	require.Equal(t, today+8*3600, later)
+
+	// Calendar times are at midnight, even when a day is shortened by daylight saving time
+	nt := namedTimes(time.Date(2020, 3, 11, 15, 30, 0, 0, ny))
+	require.Equal(t, time.Date(2020, 3, 11, 0, 0, 0, 0, ny), nt["today"])
+	require.Equal(t, time.Date(2020, 3, 9, 0, 0, 0, 0, ny), nt["start of week"])
+	require.Equal(t, time.Date(2020, 3, 1, 0, 0, 0, 0, ny), nt["start of month"])
+	require.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, ny), nt["start of year"])
+	nt = namedTimes(time.Date(2020, 3, 9, 1, 0, 0, 0, ny))
+	require.Equal(t, 23*time.Hour, nt["today"].Sub(nt["yesterday"]))
+	require.Equal(t, 24*time.Hour, nt["tomorrow"].Sub(nt["today"]))
+}
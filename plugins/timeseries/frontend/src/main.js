@@ -147,6 +147,19 @@ function setup(frontend) {
     icon: "timeline",
     update: Update,
   });
+
+  // Derived timeseries are read-only, so they only get the visualizations
+  frontend.objects.addComponent({
+    component: VisTimeseries,
+    type: "derived_timeseries",
+    key: "body",
+  });
+  frontend.objects.setType({
+    type: "derived_timeseries",
+    title: "Derived Timeseries",
+    list_title: "Derived Timeseries",
+    icon: "functions",
+  });
 }
 
 export default setup;